@@ -14,6 +14,10 @@ var cli struct {
 		RoomID string `kong:"arg,required,help='Room ID to connect'"`
 	} `kong:"cmd,help='Connect ro room'"`
 
+	DM struct {
+		Username string `kong:"arg,required,help='Username of user to chat with'"`
+	} `kong:"cmd,name='dm',help='Chat privately with user'"`
+
 	CreateUser struct {
 		Username string `kong:"arg,required,help='Username of your user'"`
 	} `kong:"cmd,help='Create new user'"`
@@ -28,6 +32,11 @@ func main() {
 
 		c := client.NewClient(cli.Host)
 		c.StartChat(cli.Join.RoomID)
+	case "dm <username>":
+		fmt.Println("Connecting...")
+
+		c := client.NewClient(cli.Host)
+		c.DirectChat(cli.DM.Username)
 	case "create-user <username>":
 		fmt.Println("Creating user...")
 
@@ -5,42 +5,288 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
 func MockIsRoomExist(m *MockRepository, roomID gomock.Matcher, ok bool, err error) {
 	m.EXPECT().
-		IsRoomExist(roomID).
+		IsRoomExist(gomock.Any(), roomID).
 		Return(ok, err).
 		Times(1)
 }
 
+func MockGetRoom(m *MockRepository, roomID gomock.Matcher, r *room.Room, err error) {
+	m.EXPECT().
+		GetRoom(gomock.Any(), roomID).
+		Return(r, err).
+		Times(1)
+}
+
 func MockGetMessages(m *MockRepository,
-	roomID, afterTime, messageLimit gomock.Matcher,
+	roomID, after, messageLimit gomock.Matcher,
 	messages []message.Message, err error) {
 	m.EXPECT().
-		GetMessages(roomID, afterTime, messageLimit).
+		GetMessages(gomock.Any(), roomID, after, messageLimit).
 		Return(messages, err).
 		Times(1)
 }
 
 func MockGetUsersFromIDs(m *MockRepository, ids gomock.Matcher, users []user.User, err error) {
 	m.EXPECT().
-		GetUsersFromIDs(ids).
+		GetUsersFromIDs(gomock.Any(), ids).
 		Return(users, err).
 		Times(1)
 }
 
-func MockGetMessageTime(m *MockRepository, afterMessageID gomock.Matcher, afterTime time.Time, err error) {
+func MockGetMessageTime(m *MockRepository,
+	roomID, afterMessageID gomock.Matcher,
+	afterTime time.Time, err error) {
 	m.EXPECT().
-		GetMessageTime(afterMessageID).
+		GetMessageTime(gomock.Any(), roomID, afterMessageID).
 		Return(afterTime, err).
 		Times(1)
 }
 
 func MockSaveMessage(m *MockRepository, msg gomock.Matcher, err error, times int) {
 	m.EXPECT().
-		SaveMessage(msg).
+		SaveMessage(gomock.Any(), msg).
 		Return(err).
 		Times(times)
 }
+
+func MockCreateUser(m *MockRepository, usr gomock.Matcher, err error) {
+	m.EXPECT().
+		CreateUser(gomock.Any(), usr, gomock.Any()).
+		Return(err).
+		Times(1)
+}
+
+func MockGetUserIDByToken(m *MockRepository, tokenHash gomock.Matcher, userID uuid.UUID, err error) {
+	m.EXPECT().
+		GetUserIDByToken(gomock.Any(), tokenHash).
+		Return(userID, err).
+		Times(1)
+}
+
+func MockGetUserByUsername(m *MockRepository, username gomock.Matcher, usr *user.User, err error) {
+	m.EXPECT().
+		GetUserByUsername(gomock.Any(), username).
+		Return(usr, err).
+		Times(1)
+}
+
+func MockGetRooms(m *MockRepository, rooms []room.Room, err error) {
+	m.EXPECT().
+		GetRooms(gomock.Any()).
+		Return(rooms, err).
+		Times(1)
+}
+
+func MockCreateRoom(m *MockRepository, r gomock.Matcher, err error) {
+	m.EXPECT().
+		CreateRoom(gomock.Any(), r).
+		Return(err).
+		Times(1)
+}
+
+func MockDeleteRoom(m *MockRepository, roomID gomock.Matcher, err error) {
+	m.EXPECT().
+		DeleteRoom(gomock.Any(), roomID).
+		Return(err).
+		Times(1)
+}
+
+func MockGetMessagesBefore(m *MockRepository,
+	roomID, before, messageLimit gomock.Matcher,
+	messages []message.Message, err error) {
+	m.EXPECT().
+		GetMessagesBefore(gomock.Any(), roomID, before, messageLimit).
+		Return(messages, err).
+		Times(1)
+}
+
+func MockGetOldestMessages(m *MockRepository,
+	roomID, after, messageLimit gomock.Matcher,
+	messages []message.Message, err error) {
+	m.EXPECT().
+		GetOldestMessages(gomock.Any(), roomID, after, messageLimit).
+		Return(messages, err).
+		Times(1)
+}
+
+func MockGetMessage(m *MockRepository, roomID, messageID gomock.Matcher, msg *message.Message, err error) {
+	m.EXPECT().
+		GetMessage(gomock.Any(), roomID, messageID).
+		Return(msg, err).
+		Times(1)
+}
+
+func MockEditMessage(m *MockRepository, roomID, messageID, text, editedAt gomock.Matcher, err error) {
+	m.EXPECT().
+		EditMessage(gomock.Any(), roomID, messageID, text, editedAt).
+		Return(err).
+		Times(1)
+}
+
+func MockDeleteMessage(m *MockRepository, roomID, messageID, deletedAt gomock.Matcher, err error) {
+	m.EXPECT().
+		DeleteMessage(gomock.Any(), roomID, messageID, deletedAt).
+		Return(err).
+		Times(1)
+}
+
+func MockUpdateMessage(m *MockRepository, roomID, messageID, updatedAt gomock.Matcher, err error) {
+	m.EXPECT().
+		UpdateMessage(gomock.Any(), roomID, messageID, updatedAt).
+		Return(err).
+		Times(1)
+}
+
+func MockGetUpdatedMessages(m *MockRepository,
+	roomID, after, until, messageLimit gomock.Matcher,
+	messages []message.Message, err error) {
+	m.EXPECT().
+		GetUpdatedMessages(gomock.Any(), roomID, after, until, messageLimit).
+		Return(messages, err).
+		Times(1)
+}
+
+func MockAddReaction(m *MockRepository, r gomock.Matcher, err error) {
+	m.EXPECT().
+		AddReaction(gomock.Any(), r).
+		Return(err).
+		Times(1)
+}
+
+func MockRemoveReaction(m *MockRepository, r gomock.Matcher, err error) {
+	m.EXPECT().
+		RemoveReaction(gomock.Any(), r).
+		Return(err).
+		Times(1)
+}
+
+func MockGetReactionCounts(m *MockRepository, roomID, messageIDs gomock.Matcher,
+	counts map[uuid.UUID]reaction.Counts, err error) {
+	m.EXPECT().
+		GetReactionCounts(gomock.Any(), roomID, messageIDs).
+		Return(counts, err).
+		Times(1)
+}
+
+func MockGetMessagesFromIDs(m *MockRepository, roomID, messageIDs gomock.Matcher, messages []message.Message,
+	err error) {
+	m.EXPECT().
+		GetMessagesFromIDs(gomock.Any(), roomID, messageIDs).
+		Return(messages, err).
+		Times(1)
+}
+
+func MockGetReplies(m *MockRepository, roomID, messageID, after, limit gomock.Matcher, messages []message.Message,
+	err error) {
+	m.EXPECT().
+		GetReplies(gomock.Any(), roomID, messageID, after, limit).
+		Return(messages, err).
+		Times(1)
+}
+
+func MockGetReplyCounts(m *MockRepository, roomID, messageIDs gomock.Matcher, counts map[uuid.UUID]int, err error) {
+	m.EXPECT().
+		GetReplyCounts(gomock.Any(), roomID, messageIDs).
+		Return(counts, err).
+		Times(1)
+}
+
+func MockAddRoomMembers(m *MockRepository, roomID, userIDs gomock.Matcher, err error) {
+	m.EXPECT().
+		AddRoomMembers(gomock.Any(), roomID, userIDs).
+		Return(err).
+		Times(1)
+}
+
+func MockIsRoomMember(m *MockRepository, roomID, userID gomock.Matcher, ok bool, err error) {
+	m.EXPECT().
+		IsRoomMember(gomock.Any(), roomID, userID).
+		Return(ok, err).
+		Times(1)
+}
+
+func MockGetRoomMembers(m *MockRepository, roomID gomock.Matcher, members []room.Member, err error) {
+	m.EXPECT().
+		GetRoomMembers(gomock.Any(), roomID).
+		Return(members, err).
+		Times(1)
+}
+
+func MockGetRoomMember(m *MockRepository, roomID, userID gomock.Matcher, member *room.Member, err error) {
+	m.EXPECT().
+		GetRoomMember(gomock.Any(), roomID, userID).
+		Return(member, err).
+		Times(1)
+}
+
+func MockUpdateRoomMember(m *MockRepository, roomID, member gomock.Matcher, err error) {
+	m.EXPECT().
+		UpdateRoomMember(gomock.Any(), roomID, member).
+		Return(err).
+		Times(1)
+}
+
+func MockRemoveRoomMember(m *MockRepository, roomID, userID gomock.Matcher, err error) {
+	m.EXPECT().
+		RemoveRoomMember(gomock.Any(), roomID, userID).
+		Return(err).
+		Times(1)
+}
+
+func MockMuteUser(m *MockRepository, roomID, userID, until gomock.Matcher, err error) {
+	m.EXPECT().
+		MuteUser(gomock.Any(), roomID, userID, until).
+		Return(err).
+		Times(1)
+}
+
+func MockUnmuteUser(m *MockRepository, roomID, userID gomock.Matcher, err error) {
+	m.EXPECT().
+		UnmuteUser(gomock.Any(), roomID, userID).
+		Return(err).
+		Times(1)
+}
+
+func MockBanUser(m *MockRepository, roomID, userID gomock.Matcher, err error) {
+	m.EXPECT().
+		BanUser(gomock.Any(), roomID, userID).
+		Return(err).
+		Times(1)
+}
+
+func MockUnbanUser(m *MockRepository, roomID, userID gomock.Matcher, err error) {
+	m.EXPECT().
+		UnbanUser(gomock.Any(), roomID, userID).
+		Return(err).
+		Times(1)
+}
+
+func MockIsBanned(m *MockRepository, roomID, userID gomock.Matcher, ok bool, err error) {
+	m.EXPECT().
+		IsBanned(gomock.Any(), roomID, userID).
+		Return(ok, err).
+		Times(1)
+}
+
+func MockSaveModerationAction(m *MockRepository, action gomock.Matcher, err error) {
+	m.EXPECT().
+		SaveModerationAction(gomock.Any(), action).
+		Return(err).
+		Times(1)
+}
+
+func MockGetModerationActions(m *MockRepository, roomID gomock.Matcher, actions []moderation.Action, err error) {
+	m.EXPECT().
+		GetModerationActions(gomock.Any(), roomID, gomock.Any()).
+		Return(actions, err).
+		Times(1)
+}
@@ -5,13 +5,18 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	uuid "github.com/google/uuid"
 	message "github.com/mymmrac/project-glynn/pkg/data/message"
+	moderation "github.com/mymmrac/project-glynn/pkg/data/moderation"
+	reaction "github.com/mymmrac/project-glynn/pkg/data/reaction"
+	room "github.com/mymmrac/project-glynn/pkg/data/room"
 	user "github.com/mymmrac/project-glynn/pkg/data/user"
+	repository "github.com/mymmrac/project-glynn/pkg/repository"
 )
 
 // MockRepository is a mock of Repository interface.
@@ -37,76 +42,555 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// AddReaction mocks base method.
+func (m *MockRepository) AddReaction(arg0 context.Context, arg1 *reaction.Reaction) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReaction", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddReaction indicates an expected call of AddReaction.
+func (mr *MockRepositoryMockRecorder) AddReaction(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReaction", reflect.TypeOf((*MockRepository)(nil).AddReaction), arg0, arg1)
+}
+
+// AddRoomMembers mocks base method.
+func (m *MockRepository) AddRoomMembers(arg0 context.Context, arg1 uuid.UUID, arg2 []uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRoomMembers", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRoomMembers indicates an expected call of AddRoomMembers.
+func (mr *MockRepositoryMockRecorder) AddRoomMembers(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRoomMembers", reflect.TypeOf((*MockRepository)(nil).AddRoomMembers), arg0, arg1, arg2)
+}
+
+// BanUser mocks base method.
+func (m *MockRepository) BanUser(arg0 context.Context, arg1, arg2 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BanUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BanUser indicates an expected call of BanUser.
+func (mr *MockRepositoryMockRecorder) BanUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BanUser", reflect.TypeOf((*MockRepository)(nil).BanUser), arg0, arg1, arg2)
+}
+
+// CreateRoom mocks base method.
+func (m *MockRepository) CreateRoom(arg0 context.Context, arg1 *room.Room) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRoom", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateRoom indicates an expected call of CreateRoom.
+func (mr *MockRepositoryMockRecorder) CreateRoom(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRoom", reflect.TypeOf((*MockRepository)(nil).CreateRoom), arg0, arg1)
+}
+
+// CreateUser mocks base method.
+func (m *MockRepository) CreateUser(arg0 context.Context, arg1 *user.User, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockRepositoryMockRecorder) CreateUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockRepository)(nil).CreateUser), arg0, arg1, arg2)
+}
+
+// DeleteMessage mocks base method.
+func (m *MockRepository) DeleteMessage(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMessage", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMessage indicates an expected call of DeleteMessage.
+func (mr *MockRepositoryMockRecorder) DeleteMessage(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMessage", reflect.TypeOf((*MockRepository)(nil).DeleteMessage), arg0, arg1, arg2, arg3)
+}
+
+// DeleteRoom mocks base method.
+func (m *MockRepository) DeleteRoom(arg0 context.Context, arg1 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRoom", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRoom indicates an expected call of DeleteRoom.
+func (mr *MockRepositoryMockRecorder) DeleteRoom(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRoom", reflect.TypeOf((*MockRepository)(nil).DeleteRoom), arg0, arg1)
+}
+
+// EditMessage mocks base method.
+func (m *MockRepository) EditMessage(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 string, arg4 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditMessage", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EditMessage indicates an expected call of EditMessage.
+func (mr *MockRepositoryMockRecorder) EditMessage(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditMessage", reflect.TypeOf((*MockRepository)(nil).EditMessage), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetMessage mocks base method.
+func (m *MockRepository) GetMessage(arg0 context.Context, arg1, arg2 uuid.UUID) (*message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessage", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMessage indicates an expected call of GetMessage.
+func (mr *MockRepositoryMockRecorder) GetMessage(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessage", reflect.TypeOf((*MockRepository)(nil).GetMessage), arg0, arg1, arg2)
+}
+
 // GetMessageTime mocks base method.
-func (m *MockRepository) GetMessageTime(arg0 uuid.UUID) (time.Time, error) {
+func (m *MockRepository) GetMessageTime(arg0 context.Context, arg1, arg2 uuid.UUID) (time.Time, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMessageTime", arg0)
+	ret := m.ctrl.Call(m, "GetMessageTime", arg0, arg1, arg2)
 	ret0, _ := ret[0].(time.Time)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMessageTime indicates an expected call of GetMessageTime.
-func (mr *MockRepositoryMockRecorder) GetMessageTime(arg0 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetMessageTime(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessageTime", reflect.TypeOf((*MockRepository)(nil).GetMessageTime), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessageTime", reflect.TypeOf((*MockRepository)(nil).GetMessageTime), arg0, arg1, arg2)
 }
 
 // GetMessages mocks base method.
-func (m *MockRepository) GetMessages(arg0 uuid.UUID, arg1 time.Time, arg2 uint) ([]message.Message, error) {
+func (m *MockRepository) GetMessages(arg0 context.Context, arg1 uuid.UUID, arg2 repository.Cursor, arg3 uint) ([]message.Message, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMessages", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "GetMessages", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]message.Message)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMessages indicates an expected call of GetMessages.
-func (mr *MockRepositoryMockRecorder) GetMessages(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetMessages(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessages", reflect.TypeOf((*MockRepository)(nil).GetMessages), arg0, arg1, arg2, arg3)
+}
+
+// GetMessagesBefore mocks base method.
+func (m *MockRepository) GetMessagesBefore(arg0 context.Context, arg1 uuid.UUID, arg2 repository.Cursor, arg3 uint) ([]message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessagesBefore", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMessagesBefore indicates an expected call of GetMessagesBefore.
+func (mr *MockRepositoryMockRecorder) GetMessagesBefore(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessagesBefore", reflect.TypeOf((*MockRepository)(nil).GetMessagesBefore), arg0, arg1, arg2, arg3)
+}
+
+// GetMessagesFromIDs mocks base method.
+func (m *MockRepository) GetMessagesFromIDs(arg0 context.Context, arg1 uuid.UUID, arg2 []uuid.UUID) ([]message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessagesFromIDs", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMessagesFromIDs indicates an expected call of GetMessagesFromIDs.
+func (mr *MockRepositoryMockRecorder) GetMessagesFromIDs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessagesFromIDs", reflect.TypeOf((*MockRepository)(nil).GetMessagesFromIDs), arg0, arg1, arg2)
+}
+
+// GetModerationActions mocks base method.
+func (m *MockRepository) GetModerationActions(arg0 context.Context, arg1 uuid.UUID, arg2 uint) ([]moderation.Action, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetModerationActions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]moderation.Action)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetModerationActions indicates an expected call of GetModerationActions.
+func (mr *MockRepositoryMockRecorder) GetModerationActions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetModerationActions", reflect.TypeOf((*MockRepository)(nil).GetModerationActions), arg0, arg1, arg2)
+}
+
+// GetOldestMessages mocks base method.
+func (m *MockRepository) GetOldestMessages(arg0 context.Context, arg1 uuid.UUID, arg2 repository.Cursor, arg3 uint) ([]message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOldestMessages", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOldestMessages indicates an expected call of GetOldestMessages.
+func (mr *MockRepositoryMockRecorder) GetOldestMessages(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOldestMessages", reflect.TypeOf((*MockRepository)(nil).GetOldestMessages), arg0, arg1, arg2, arg3)
+}
+
+// GetReactionCounts mocks base method.
+func (m *MockRepository) GetReactionCounts(arg0 context.Context, arg1 uuid.UUID, arg2 []uuid.UUID) (map[uuid.UUID]reaction.Counts, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReactionCounts", arg0, arg1, arg2)
+	ret0, _ := ret[0].(map[uuid.UUID]reaction.Counts)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReactionCounts indicates an expected call of GetReactionCounts.
+func (mr *MockRepositoryMockRecorder) GetReactionCounts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReactionCounts", reflect.TypeOf((*MockRepository)(nil).GetReactionCounts), arg0, arg1, arg2)
+}
+
+// GetReplies mocks base method.
+func (m *MockRepository) GetReplies(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 repository.Cursor, arg4 uint) ([]message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReplies", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReplies indicates an expected call of GetReplies.
+func (mr *MockRepositoryMockRecorder) GetReplies(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessages", reflect.TypeOf((*MockRepository)(nil).GetMessages), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReplies", reflect.TypeOf((*MockRepository)(nil).GetReplies), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetReplyCounts mocks base method.
+func (m *MockRepository) GetReplyCounts(arg0 context.Context, arg1 uuid.UUID, arg2 []uuid.UUID) (map[uuid.UUID]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReplyCounts", arg0, arg1, arg2)
+	ret0, _ := ret[0].(map[uuid.UUID]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReplyCounts indicates an expected call of GetReplyCounts.
+func (mr *MockRepositoryMockRecorder) GetReplyCounts(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReplyCounts", reflect.TypeOf((*MockRepository)(nil).GetReplyCounts), arg0, arg1, arg2)
+}
+
+// GetRoom mocks base method.
+func (m *MockRepository) GetRoom(arg0 context.Context, arg1 uuid.UUID) (*room.Room, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoom", arg0, arg1)
+	ret0, _ := ret[0].(*room.Room)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoom indicates an expected call of GetRoom.
+func (mr *MockRepositoryMockRecorder) GetRoom(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoom", reflect.TypeOf((*MockRepository)(nil).GetRoom), arg0, arg1)
+}
+
+// GetRoomMember mocks base method.
+func (m *MockRepository) GetRoomMember(arg0 context.Context, arg1, arg2 uuid.UUID) (*room.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoomMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*room.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoomMember indicates an expected call of GetRoomMember.
+func (mr *MockRepositoryMockRecorder) GetRoomMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoomMember", reflect.TypeOf((*MockRepository)(nil).GetRoomMember), arg0, arg1, arg2)
+}
+
+// GetRoomMembers mocks base method.
+func (m *MockRepository) GetRoomMembers(arg0 context.Context, arg1 uuid.UUID) ([]room.Member, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoomMembers", arg0, arg1)
+	ret0, _ := ret[0].([]room.Member)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoomMembers indicates an expected call of GetRoomMembers.
+func (mr *MockRepositoryMockRecorder) GetRoomMembers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoomMembers", reflect.TypeOf((*MockRepository)(nil).GetRoomMembers), arg0, arg1)
+}
+
+// GetRooms mocks base method.
+func (m *MockRepository) GetRooms(arg0 context.Context) ([]room.Room, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRooms", arg0)
+	ret0, _ := ret[0].([]room.Room)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRooms indicates an expected call of GetRooms.
+func (mr *MockRepositoryMockRecorder) GetRooms(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRooms", reflect.TypeOf((*MockRepository)(nil).GetRooms), arg0)
+}
+
+// GetUpdatedMessages mocks base method.
+func (m *MockRepository) GetUpdatedMessages(arg0 context.Context, arg1 uuid.UUID, arg2, arg3 time.Time, arg4 uint) ([]message.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUpdatedMessages", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]message.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUpdatedMessages indicates an expected call of GetUpdatedMessages.
+func (mr *MockRepositoryMockRecorder) GetUpdatedMessages(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUpdatedMessages", reflect.TypeOf((*MockRepository)(nil).GetUpdatedMessages), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetUserByUsername mocks base method.
+func (m *MockRepository) GetUserByUsername(arg0 context.Context, arg1 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByUsername", arg0, arg1)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByUsername indicates an expected call of GetUserByUsername.
+func (mr *MockRepositoryMockRecorder) GetUserByUsername(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockRepository)(nil).GetUserByUsername), arg0, arg1)
+}
+
+// GetUserIDByToken mocks base method.
+func (m *MockRepository) GetUserIDByToken(arg0 context.Context, arg1 string) (uuid.UUID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserIDByToken", arg0, arg1)
+	ret0, _ := ret[0].(uuid.UUID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserIDByToken indicates an expected call of GetUserIDByToken.
+func (mr *MockRepositoryMockRecorder) GetUserIDByToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserIDByToken", reflect.TypeOf((*MockRepository)(nil).GetUserIDByToken), arg0, arg1)
 }
 
 // GetUsersFromIDs mocks base method.
-func (m *MockRepository) GetUsersFromIDs(arg0 []uuid.UUID) ([]user.User, error) {
+func (m *MockRepository) GetUsersFromIDs(arg0 context.Context, arg1 []uuid.UUID) ([]user.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUsersFromIDs", arg0)
+	ret := m.ctrl.Call(m, "GetUsersFromIDs", arg0, arg1)
 	ret0, _ := ret[0].([]user.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUsersFromIDs indicates an expected call of GetUsersFromIDs.
-func (mr *MockRepositoryMockRecorder) GetUsersFromIDs(arg0 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetUsersFromIDs(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersFromIDs", reflect.TypeOf((*MockRepository)(nil).GetUsersFromIDs), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsersFromIDs", reflect.TypeOf((*MockRepository)(nil).GetUsersFromIDs), arg0, arg1)
+}
+
+// IsBanned mocks base method.
+func (m *MockRepository) IsBanned(arg0 context.Context, arg1, arg2 uuid.UUID) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBanned", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsBanned indicates an expected call of IsBanned.
+func (mr *MockRepositoryMockRecorder) IsBanned(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBanned", reflect.TypeOf((*MockRepository)(nil).IsBanned), arg0, arg1, arg2)
 }
 
 // IsRoomExist mocks base method.
-func (m *MockRepository) IsRoomExist(arg0 uuid.UUID) (bool, error) {
+func (m *MockRepository) IsRoomExist(arg0 context.Context, arg1 uuid.UUID) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "IsRoomExist", arg0)
+	ret := m.ctrl.Call(m, "IsRoomExist", arg0, arg1)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // IsRoomExist indicates an expected call of IsRoomExist.
-func (mr *MockRepositoryMockRecorder) IsRoomExist(arg0 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) IsRoomExist(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRoomExist", reflect.TypeOf((*MockRepository)(nil).IsRoomExist), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRoomExist", reflect.TypeOf((*MockRepository)(nil).IsRoomExist), arg0, arg1)
+}
+
+// IsRoomMember mocks base method.
+func (m *MockRepository) IsRoomMember(arg0 context.Context, arg1, arg2 uuid.UUID) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsRoomMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsRoomMember indicates an expected call of IsRoomMember.
+func (mr *MockRepositoryMockRecorder) IsRoomMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRoomMember", reflect.TypeOf((*MockRepository)(nil).IsRoomMember), arg0, arg1, arg2)
+}
+
+// MuteUser mocks base method.
+func (m *MockRepository) MuteUser(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MuteUser", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MuteUser indicates an expected call of MuteUser.
+func (mr *MockRepositoryMockRecorder) MuteUser(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteUser", reflect.TypeOf((*MockRepository)(nil).MuteUser), arg0, arg1, arg2, arg3)
+}
+
+// RemoveReaction mocks base method.
+func (m *MockRepository) RemoveReaction(arg0 context.Context, arg1 *reaction.Reaction) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveReaction", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveReaction indicates an expected call of RemoveReaction.
+func (mr *MockRepositoryMockRecorder) RemoveReaction(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveReaction", reflect.TypeOf((*MockRepository)(nil).RemoveReaction), arg0, arg1)
+}
+
+// RemoveRoomMember mocks base method.
+func (m *MockRepository) RemoveRoomMember(arg0 context.Context, arg1, arg2 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveRoomMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveRoomMember indicates an expected call of RemoveRoomMember.
+func (mr *MockRepositoryMockRecorder) RemoveRoomMember(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveRoomMember", reflect.TypeOf((*MockRepository)(nil).RemoveRoomMember), arg0, arg1, arg2)
 }
 
 // SaveMessage mocks base method.
-func (m *MockRepository) SaveMessage(arg0 *message.Message) error {
+func (m *MockRepository) SaveMessage(arg0 context.Context, arg1 *message.Message) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveMessage", arg0)
+	ret := m.ctrl.Call(m, "SaveMessage", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SaveMessage indicates an expected call of SaveMessage.
-func (mr *MockRepositoryMockRecorder) SaveMessage(arg0 interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SaveMessage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMessage", reflect.TypeOf((*MockRepository)(nil).SaveMessage), arg0, arg1)
+}
+
+// SaveModerationAction mocks base method.
+func (m *MockRepository) SaveModerationAction(arg0 context.Context, arg1 *moderation.Action) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveModerationAction", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveModerationAction indicates an expected call of SaveModerationAction.
+func (mr *MockRepositoryMockRecorder) SaveModerationAction(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveModerationAction", reflect.TypeOf((*MockRepository)(nil).SaveModerationAction), arg0, arg1)
+}
+
+// UnbanUser mocks base method.
+func (m *MockRepository) UnbanUser(arg0 context.Context, arg1, arg2 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnbanUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnbanUser indicates an expected call of UnbanUser.
+func (mr *MockRepositoryMockRecorder) UnbanUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnbanUser", reflect.TypeOf((*MockRepository)(nil).UnbanUser), arg0, arg1, arg2)
+}
+
+// UnmuteUser mocks base method.
+func (m *MockRepository) UnmuteUser(arg0 context.Context, arg1, arg2 uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnmuteUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnmuteUser indicates an expected call of UnmuteUser.
+func (mr *MockRepositoryMockRecorder) UnmuteUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnmuteUser", reflect.TypeOf((*MockRepository)(nil).UnmuteUser), arg0, arg1, arg2)
+}
+
+// UpdateMessage mocks base method.
+func (m *MockRepository) UpdateMessage(arg0 context.Context, arg1, arg2 uuid.UUID, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMessage", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMessage indicates an expected call of UpdateMessage.
+func (mr *MockRepositoryMockRecorder) UpdateMessage(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMessage", reflect.TypeOf((*MockRepository)(nil).UpdateMessage), arg0, arg1, arg2, arg3)
+}
+
+// UpdateRoomMember mocks base method.
+func (m *MockRepository) UpdateRoomMember(arg0 context.Context, arg1 uuid.UUID, arg2 *room.Member) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRoomMember", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRoomMember indicates an expected call of UpdateRoomMember.
+func (mr *MockRepositoryMockRecorder) UpdateRoomMember(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMessage", reflect.TypeOf((*MockRepository)(nil).SaveMessage), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRoomMember", reflect.TypeOf((*MockRepository)(nil).UpdateRoomMember), arg0, arg1, arg2)
 }
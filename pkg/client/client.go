@@ -4,16 +4,27 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/server"
 	"github.com/mymmrac/project-glynn/pkg/server/httpapi"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
@@ -21,39 +32,119 @@ import (
 const (
 	baseURL          = "%s/api/"
 	messagesEndpoint = "rooms/%s/messages"
+	streamEndpoint   = "rooms/%s/ws"
+	joinEndpoint     = "rooms/%s/join"
+	leaveEndpoint    = "rooms/%s/leave"
+	membersEndpoint  = "rooms/%s/members"
+	memberEndpoint   = membersEndpoint + "/%s"
+	bansEndpoint     = "rooms/%s/bans/%s"
+	moderationLog    = "rooms/%s/moderation"
 	usersEndpoint    = "users"
+	directEndpoint   = "direct/%s"
+	directMessages   = directEndpoint + "/messages"
 )
 
-const updateInterval = 1 * time.Second
+// pollWait is how long server holds poll request waiting for new messages or changes of sent messages
+const pollWait = 30 * time.Second
 const clearCurrentLine = "\u001B[F\u001B[2K"
+const userDataFile = "user.data"
 
-var usernameRegex = regexp.MustCompile(`^[a-zA-Z]\w{2,}$`)
+// quoteLength is max length in runes of replied message text shown above reply
+const quoteLength = 40
+
+// Commands are handled by client instead of sending them as text
+const (
+	historyCommand = "/history"
+	membersCommand = "/members"
+	inviteCommand  = "/invite"
+	leaveCommand   = "/leave"
+	roleCommand    = "/role"
+	muteCommand    = "/mute"
+	unmuteCommand  = "/unmute"
+	kickCommand    = "/kick"
+	banCommand     = "/ban"
+	unbanCommand   = "/unban"
+	logCommand     = "/log"
+)
+
+// moderationCommand is a command moderating user with username passed as its first argument
+type moderationCommand struct {
+	action   string // Action is a name of command displayed in errors
+	method   string
+	endpoint string // Endpoint formatted with room id and username
+	done     string // Done is displayed when command succeeds, formatted with username
+
+	// Arg is a usage of second argument which is encoded in body by newBody, empty if there is no second argument
+	arg     string
+	newBody func(arg string) interface{}
+}
+
+var moderationCommands = map[string]moderationCommand{
+	roleCommand: {action: "change role", method: http.MethodPut, endpoint: memberEndpoint + "/role",
+		done: "Role of %q changed.", arg: "<member|moderator|owner>", newBody: func(arg string) interface{} {
+			return chat.RoleChange{Role: room.Role(arg)}
+		}},
+	muteCommand: {action: "mute user", method: http.MethodPost, endpoint: memberEndpoint + "/mute",
+		done: "User %q muted.", arg: "<duration>", newBody: func(arg string) interface{} {
+			return chat.Mute{Duration: arg}
+		}},
+	unmuteCommand: {action: "unmute user", method: http.MethodDelete, endpoint: memberEndpoint + "/mute",
+		done: "User %q unmuted."},
+	kickCommand: {action: "kick user", method: http.MethodDelete, endpoint: memberEndpoint,
+		done: "User %q kicked."},
+	banCommand: {action: "ban user", method: http.MethodPut, endpoint: bansEndpoint,
+		done: "User %q banned."},
+	unbanCommand: {action: "unban user", method: http.MethodDelete, endpoint: bansEndpoint,
+		done: "User %q unbanned."},
+}
+
+var usernameRegex = regexp.MustCompile(user.UsernameRegex)
 
 // Client manages connection to server
 type Client struct {
-	httpClient     *http.Client
-	out            io.Writer
-	in             io.Reader
-	host           string
-	roomID         string
-	running        chan struct{}
-	updateInterval time.Duration
+	httpClient   *http.Client
+	out          io.Writer
+	in           io.Reader
+	host         string
+	roomID       string
+	running      chan struct{}
+	pollWait     time.Duration
+	useWebSocket bool
+	userDataPath string
+	credentials  *chat.Credentials
+
+	historyMu       sync.Mutex
+	oldestMessageID *uuid.UUID // Oldest displayed message, history is loaded before it
+	historyEnd      bool       // No more messages before oldest displayed message
 }
 
 // NewClient creates new client with connection to specified host
 func NewClient(host string) *Client {
 	return &Client{
-		httpClient:     http.DefaultClient,
-		host:           host,
-		out:            os.Stdout,
-		in:             os.Stdin,
-		updateInterval: updateInterval,
+		httpClient:   http.DefaultClient,
+		host:         host,
+		out:          os.Stdout,
+		in:           os.Stdin,
+		pollWait:     pollWait,
+		useWebSocket: true,
+		userDataPath: userDataFile,
 	}
 }
 
 // StartChat begins to listen for new messages and reading to send message until an error occurs
 func (c *Client) StartChat(roomID string) {
+	credentials, err := c.loadCredentials()
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to load user info, create user first.\nError: %v\n", err)
+		return
+	}
+	c.credentials = credentials
+
 	c.roomID = roomID
+	if !c.joinRoom() {
+		return
+	}
+
 	c.running = make(chan struct{}, 1)
 	go c.readMessages()
 	go c.sendMessages()
@@ -66,15 +157,60 @@ func (c *Client) readMessages() {
 	}()
 
 	var lastMessageID *uuid.UUID
-	url := fmt.Sprintf(baseURL+messagesEndpoint, c.host, c.roomID)
+	if c.useWebSocket {
+		// Falling back to polling if real-time updates are not available or connection was lost
+		lastMessageID, _ = c.streamMessages()
+	}
+	c.pollMessages(lastMessageID)
+}
 
+// streamMessages displays messages received over WebSocket until connection is closed,
+// returns id of last displayed message
+func (c *Client) streamMessages() (*uuid.UUID, error) {
+	url := fmt.Sprintf(baseURL+streamEndpoint, websocketHost(c.host), c.roomID)
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url, c.authHeader())
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	if err = resp.Body.Close(); err != nil {
+		return nil, fmt.Errorf("close response body: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var lastMessageID *uuid.UUID
+	for {
+		var cm chat.Messages
+		if err = conn.ReadJSON(&cm); err != nil {
+			return lastMessageID, fmt.Errorf("read: %w", err)
+		}
+
+		if id := c.displayMessages(&cm); id != nil {
+			lastMessageID = id
+		}
+	}
+}
+
+// pollMessages continuously requests and displays messages sent after lastMessageID (or latest if nil),
+// server holds each request until new messages are sent or sent messages are changed, changes made between
+// requests are requested by time returned in previous response
+func (c *Client) pollMessages(lastMessageID *uuid.UUID) {
+	url := fmt.Sprintf(baseURL+messagesEndpoint+"?%s=%s", c.host, c.roomID, httpapi.WaitParameter, c.pollWait)
+
+	var updatedAfter *time.Time
 	for {
 		reqURL := url
 		if lastMessageID != nil {
-			reqURL += fmt.Sprintf("?%s=%s", httpapi.LastMessageIDParameter, lastMessageID)
+			reqURL += fmt.Sprintf("&%s=%s", httpapi.LastMessageIDParameter, lastMessageID)
+		}
+		if updatedAfter != nil {
+			reqURL += fmt.Sprintf("&%s=%s", httpapi.UpdatedAfterParameter,
+				neturl.QueryEscape(updatedAfter.Format(time.RFC3339Nano)))
 		}
 
-		resp, err := c.httpClient.Get(reqURL)
+		resp, err := c.get(reqURL)
 		if err != nil {
 			fmt.Fprintf(c.out, "Unable to make get request.\nError: %v\n", err)
 			return
@@ -86,6 +222,10 @@ func (c *Client) readMessages() {
 		case http.StatusNotFound:
 			fmt.Fprintf(c.out, "Room with id %q not found.\n", c.roomID)
 			return
+		case http.StatusUnauthorized, http.StatusForbidden:
+			_ = resp.Body.Close()
+			fmt.Fprintf(c.out, "Room with id %q is private.\n", c.roomID)
+			return
 		default:
 			fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
 			return
@@ -103,18 +243,217 @@ func (c *Client) readMessages() {
 			return
 		}
 
-		// TODO move displaying to other func
-		for _, m := range cm.Messages {
-			fmt.Fprintf(c.out,
-				"%s [\033[33m%s\033[0m]: %s\n", m.Time.Local().Format(time.RFC822), cm.Usernames[m.UserID], m.Text)
+		if id := c.displayMessages(&cm); id != nil {
+			lastMessageID = id
 		}
+		if cm.UpdatedUntil != nil {
+			updatedAfter = cm.UpdatedUntil
+		}
+	}
+}
+
+// displayMessages prints messages and changed messages, returns id of last message or nil if there are no messages
+func (c *Client) displayMessages(cm *chat.Messages) *uuid.UUID {
+	c.printMessages(cm)
+
+	l := len(cm.Messages)
+	if l == 0 {
+		return nil
+	}
+
+	c.historyMu.Lock()
+	if c.oldestMessageID == nil {
+		c.oldestMessageID = &cm.Messages[0].ID
+	}
+	c.historyMu.Unlock()
+
+	return &cm.Messages[l-1].ID
+}
+
+// printMessages prints messages followed by changed messages which are printed again with their new text
+func (c *Client) printMessages(cm *chat.Messages) {
+	for _, m := range cm.Messages {
+		c.printMessage(&m, cm)
+	}
+	for _, m := range cm.Updated {
+		c.printMessage(&m, cm)
+	}
+}
+
+// printMessage prints one message, edited and deleted messages are marked, reactions and reply count are appended,
+// replies are preceded by short quote of replied message
+func (c *Client) printMessage(m *message.Message, cm *chat.Messages) {
+	if parent, ok := c.parentOf(m, cm); ok {
+		fmt.Fprintf(c.out, "  \033[2m↪ %s: %s\033[0m\n", cm.Usernames[parent.UserID], quoteText(parent))
+	}
+
+	text := m.Text
+	switch {
+	case m.Deleted:
+		text = "\033[2m(deleted)\033[0m"
+	case m.EditedAt != nil:
+		text += " \033[2m(edited)\033[0m"
+	}
+	if reactions := cm.Reactions[m.ID]; len(reactions) > 0 && !m.Deleted {
+		text += "  " + formatReactions(reactions)
+	}
+	if replies := cm.ReplyCounts[m.ID]; replies > 0 {
+		text += fmt.Sprintf(" \033[2m(%d %s)\033[0m", replies, plural(replies, "reply", "replies"))
+	}
+
+	fmt.Fprintf(c.out, "%s [\033[33m%s\033[0m]: %s\n", m.Time.Local().Format(time.RFC822), cm.Usernames[m.UserID], text)
+}
+
+// parentOf returns message replied by m if it's known, deleted replies have no quote
+func (c *Client) parentOf(m *message.Message, cm *chat.Messages) (*message.Message, bool) {
+	if m.ReplyTo == nil || m.Deleted {
+		return nil, false
+	}
+	parent, ok := cm.Parents[*m.ReplyTo]
+	return &parent, ok
+}
+
+// quoteText returns text of replied message shortened to one line of at most quoteLength runes
+func quoteText(m *message.Message) string {
+	if m.Deleted {
+		return "(deleted)"
+	}
+
+	text := []rune(strings.Join(strings.Fields(m.Text), " "))
+	if len(text) > quoteLength {
+		return string(text[:quoteLength-1]) + "…"
+	}
+	return string(text)
+}
+
+// plural returns singular form if n is 1 and plural form otherwise
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// formatReactions formats reaction counts ordered by emoji, e.g. "🎉 1 👍 2"
+func formatReactions(reactions reaction.Counts) string {
+	emojis := make([]string, 0, len(reactions))
+	for emoji := range reactions {
+		emojis = append(emojis, emoji)
+	}
+	sort.Strings(emojis)
+
+	formatted := make([]string, len(emojis))
+	for i, emoji := range emojis {
+		formatted[i] = fmt.Sprintf("%s %d", emoji, reactions[emoji])
+	}
+	return strings.Join(formatted, " ")
+}
+
+// showHistory displays page of messages sent before the oldest displayed message
+func (c *Client) showHistory() {
+	c.historyMu.Lock()
+	beforeMessageID, historyEnd := c.oldestMessageID, c.historyEnd
+	c.historyMu.Unlock()
+
+	if beforeMessageID == nil || historyEnd {
+		fmt.Fprintln(c.out, "No more messages.")
+		return
+	}
+
+	url := fmt.Sprintf(baseURL+messagesEndpoint+"?%s=%s",
+		c.host, c.roomID, httpapi.BeforeMessageIDParameter, beforeMessageID)
+
+	resp, err := c.get(url)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make get request.\nError: %v\n", err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		fmt.Fprintf(c.out, "Unable to get history.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+		return
+	}
+
+	var cm chat.Messages
+	err = json.NewDecoder(resp.Body).Decode(&cm)
+	_ = resp.Body.Close()
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to decode message.\nError: %v\n", err)
+		return
+	}
+
+	if len(cm.Messages) == 0 {
+		fmt.Fprintln(c.out, "No more messages.")
+	} else {
+		fmt.Fprintln(c.out, "--- History ---")
+		c.printMessages(&cm)
+		fmt.Fprintln(c.out, "--- End of history ---")
+	}
 
-		l := len(cm.Messages)
-		if l > 0 {
-			lastMessageID = &cm.Messages[l-1].ID
+	c.historyMu.Lock()
+	if len(cm.Messages) > 0 {
+		c.oldestMessageID = &cm.Messages[0].ID
+	}
+	c.historyEnd = !cm.HasMore
+	c.historyMu.Unlock()
+}
+
+// authHeader returns header with token of user, it's empty if credentials are not loaded
+func (c *Client) authHeader() http.Header {
+	header := make(http.Header)
+	if c.credentials != nil {
+		header.Set(httpapi.AuthorizationHeader, "Bearer "+c.credentials.Token)
+	}
+	return header
+}
+
+// get makes get request on behalf of user, so private rooms can be read by their members
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.authHeader()
+	return c.httpClient.Do(req)
+}
+
+// post makes post request with JSON encoded body on behalf of user, nil body is not sent
+func (c *Client) post(url string, body interface{}) (*http.Response, error) {
+	return c.request(http.MethodPost, url, body)
+}
+
+// request makes request with JSON encoded body on behalf of user, nil body is not sent
+func (c *Client) request(method, url string, body interface{}) (*http.Response, error) {
+	var reqBody io.Reader
+	if body != nil {
+		byteSlice, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode body: %w", err)
 		}
+		reqBody = bytes.NewReader(byteSlice)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.authHeader()
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	return c.httpClient.Do(req)
+}
 
-		time.Sleep(c.updateInterval)
+// websocketHost converts HTTP host to WebSocket host
+func websocketHost(host string) string {
+	switch {
+	case strings.HasPrefix(host, "https://"):
+		return "wss://" + strings.TrimPrefix(host, "https://")
+	case strings.HasPrefix(host, "http://"):
+		return "ws://" + strings.TrimPrefix(host, "http://")
+	default:
+		return host
 	}
 }
 
@@ -124,10 +463,6 @@ func (c *Client) sendMessages() {
 	}()
 
 	url := fmt.Sprintf(baseURL+messagesEndpoint, c.host, c.roomID)
-	userID, err := uuid.Parse("8b50748a-94ec-4ea4-9405-00e659bf62d4")
-	if err != nil {
-		return
-	}
 
 	scanner := bufio.NewScanner(c.in)
 	for scanner.Scan() {
@@ -140,9 +475,16 @@ func (c *Client) sendMessages() {
 			continue
 		}
 
+		handled, stop := c.runCommand(text)
+		if stop {
+			return
+		}
+		if handled {
+			continue
+		}
+
 		newMessage := chat.NewMessage{
-			UserID: userID,
-			Text:   text,
+			Text: text,
 		}
 
 		byteSlice, err := json.Marshal(newMessage)
@@ -152,21 +494,446 @@ func (c *Client) sendMessages() {
 		}
 		body := bytes.NewReader(byteSlice)
 
-		resp, err := c.httpClient.Post(url, "application/json; charset=UTF-8", body)
+		req, err := http.NewRequest(http.MethodPost, url, body)
+		if err != nil {
+			fmt.Fprintf(c.out, "Unable to create post request.\nError: %v\n", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		req.Header.Set(httpapi.AuthorizationHeader, "Bearer "+c.credentials.Token)
+
+		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
 			return
 		}
-		if err := resp.Body.Close(); err != nil {
-			fmt.Fprintf(c.out, "Unable to close response body.\nError: %v\n", err)
+		if !c.checkSent(resp) {
 			return
 		}
+	}
+}
 
-		if resp.StatusCode != http.StatusCreated {
-			fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+// checkSent displays why message was not sent and reports if messages can still be sent,
+// muted users stay in chat since they can still read it
+func (c *Client) checkSent(resp *http.Response) bool {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	//	nothing
+	case http.StatusUnauthorized:
+		fmt.Fprintln(c.out, "Not authorized, create user again.")
+		return false
+	case http.StatusForbidden:
+		if strings.HasSuffix(responseError(resp), server.ErrorMuted.Error()) {
+			fmt.Fprintln(c.out, "You are muted in this room, message was not sent.")
+			return true
+		}
+		fmt.Fprintln(c.out, "You are not a member of this room anymore.")
+		return false
+	case http.StatusRequestEntityTooLarge:
+		fmt.Fprintln(c.out, "Message is too long.")
+	default:
+		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+		return false
+	}
+	return true
+}
+
+// responseError returns error message from response body or status of response if body has no error
+func responseError(resp *http.Response) string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		return resp.Status
+	}
+	return body.Error
+}
+
+// runCommand runs command if text is one, reports if text was handled as command and if chat should be stopped,
+// text which is not a known command is sent as message
+func (c *Client) runCommand(text string) (handled, stop bool) {
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case historyCommand:
+		c.showHistory()
+	case membersCommand:
+		c.showMembers()
+	case inviteCommand:
+		if len(fields) != 2 {
+			fmt.Fprintf(c.out, "Usage: %s <username>\n", inviteCommand)
+			return true, false
+		}
+		c.invite(fields[1])
+	case leaveCommand:
+		return true, c.leaveRoom()
+	case logCommand:
+		c.showModerationLog()
+	default:
+		command, ok := moderationCommands[fields[0]]
+		if !ok {
+			return false, false
+		}
+		c.moderate(fields[0], command, fields[1:])
+	}
+	return true, false
+}
+
+// moderate runs moderation command with its arguments and displays its result
+func (c *Client) moderate(name string, command moderationCommand, args []string) {
+	argsCount := 1
+	usage := fmt.Sprintf("Usage: %s <username>\n", name)
+	if command.newBody != nil {
+		argsCount = 2
+		usage = fmt.Sprintf("Usage: %s <username> %s\n", name, command.arg)
+	}
+	if len(args) != argsCount {
+		fmt.Fprint(c.out, usage)
+		return
+	}
+
+	username := args[0]
+	if !usernameRegex.MatchString(username) {
+		fmt.Fprintf(c.out, "Invalid username %q.\n", username)
+		return
+	}
+
+	var body interface{}
+	if command.newBody != nil {
+		body = command.newBody(args[1])
+	}
+
+	resp, err := c.request(command.method, fmt.Sprintf(baseURL+command.endpoint, c.host, c.roomID, username), body)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make request.\nError: %v\n", err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(c.out, "Unable to %s: %s.\n", command.action, responseError(resp))
+		return
+	}
+	fmt.Fprintf(c.out, command.done+"\n", username)
+}
+
+// showModerationLog displays moderation actions in room from the oldest to the newest
+func (c *Client) showModerationLog() {
+	resp, err := c.get(fmt.Sprintf(baseURL+moderationLog, c.host, c.roomID))
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make get request.\nError: %v\n", err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(c.out, "Unable to get moderation log: %s.\n", responseError(resp))
+		return
+	}
+
+	var log chat.ModerationLog
+	if err = json.NewDecoder(resp.Body).Decode(&log); err != nil {
+		fmt.Fprintf(c.out, "Unable to decode moderation log.\nError: %v\n", err)
+		return
+	}
+
+	if len(log.Actions) == 0 {
+		fmt.Fprintln(c.out, "No moderation actions yet.")
+		return
+	}
+	for i := len(log.Actions) - 1; i >= 0; i-- {
+		action := &log.Actions[i]
+		fmt.Fprintf(c.out, "%s %s\n", action.Time.Local().Format(time.RFC822), formatAction(action, log.Usernames))
+	}
+}
+
+// formatAction formats moderation action as sentence, e.g. "alice muted bob until 20 May 21 17:31 EEST"
+func formatAction(action *moderation.Action, usernames map[uuid.UUID]string) string {
+	moderator := "admin"
+	if action.ModeratorID != nil {
+		moderator = usernames[*action.ModeratorID]
+	}
+	target := usernames[action.TargetID]
+
+	switch action.Kind {
+	case moderation.KindRole:
+		return fmt.Sprintf("%s made %s %s", moderator, target, action.Role)
+	case moderation.KindMute:
+		if action.Until != nil {
+			return fmt.Sprintf("%s muted %s until %s", moderator, target, action.Until.Local().Format(time.RFC822))
+		}
+		return fmt.Sprintf("%s muted %s", moderator, target)
+	case moderation.KindUnmute:
+		return fmt.Sprintf("%s unmuted %s", moderator, target)
+	case moderation.KindKick:
+		return fmt.Sprintf("%s kicked %s", moderator, target)
+	case moderation.KindBan:
+		return fmt.Sprintf("%s banned %s", moderator, target)
+	case moderation.KindUnban:
+		return fmt.Sprintf("%s unbanned %s", moderator, target)
+	default:
+		return fmt.Sprintf("%s did %q to %s", moderator, action.Kind, target)
+	}
+}
+
+// joinRoom makes user a member of room, so messages can be sent to it, reports if chat can be started
+func (c *Client) joinRoom() bool {
+	resp, err := c.post(fmt.Sprintf(baseURL+joinEndpoint, c.host, c.roomID), nil)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
+		return false
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true
+	case http.StatusNotFound:
+		fmt.Fprintf(c.out, "Room with id %q not found.\n", c.roomID)
+	case http.StatusForbidden:
+		fmt.Fprintf(c.out, "Room with id %q is private, ask one of its members for invite.\n", c.roomID)
+	case http.StatusUnauthorized:
+		fmt.Fprintln(c.out, "Not authorized, create user again.")
+	default:
+		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+	}
+	return false
+}
+
+// leaveRoom removes user from members of room, reports if user left it
+func (c *Client) leaveRoom() bool {
+	resp, err := c.post(fmt.Sprintf(baseURL+leaveEndpoint, c.host, c.roomID), nil)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
+		return false
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		fmt.Fprintln(c.out, "You left the room.")
+		return true
+	case http.StatusBadRequest:
+		fmt.Fprintln(c.out, "Direct chat can't be left.")
+	default:
+		fmt.Fprintf(c.out, "Unable to leave room.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+	}
+	return false
+}
+
+// showMembers displays usernames of room members, roles other than member and mutes are shown after username
+func (c *Client) showMembers() {
+	resp, err := c.get(fmt.Sprintf(baseURL+membersEndpoint, c.host, c.roomID))
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make get request.\nError: %v\n", err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(c.out, "Unable to get members.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+		return
+	}
+
+	var members []chat.Member
+	if err = json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		fmt.Fprintf(c.out, "Unable to decode members.\nError: %v\n", err)
+		return
+	}
+
+	usernames := make([]string, len(members))
+	for i, member := range members {
+		var marks []string
+		if member.Role != "" && member.Role != room.RoleMember {
+			marks = append(marks, string(member.Role))
+		}
+		if member.MutedUntil != nil {
+			marks = append(marks, "muted")
+		}
+
+		usernames[i] = member.Username
+		if len(marks) > 0 {
+			usernames[i] += " (" + strings.Join(marks, ", ") + ")"
+		}
+	}
+	fmt.Fprintf(c.out, "Members: %s\n", strings.Join(usernames, ", "))
+}
+
+// invite adds user with specified username to members of room
+func (c *Client) invite(username string) {
+	if !usernameRegex.MatchString(username) {
+		fmt.Fprintf(c.out, "Invalid username %q.\n", username)
+		return
+	}
+
+	resp, err := c.post(fmt.Sprintf(baseURL+membersEndpoint, c.host, c.roomID), chat.Invite{Username: username})
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
+		return
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		fmt.Fprintf(c.out, "User %q invited.\n", username)
+	case http.StatusNotFound:
+		fmt.Fprintf(c.out, "User %q not found.\n", username)
+	case http.StatusBadRequest:
+		fmt.Fprintln(c.out, "Users can't be invited to direct chat.")
+	default:
+		fmt.Fprintf(c.out, "Unable to invite user.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+	}
+}
+
+// DirectChat starts chat in direct room with user with specified username, if they have no direct room yet
+// first message is read and sent to create it
+func (c *Client) DirectChat(username string) {
+	if !usernameRegex.MatchString(username) {
+		fmt.Fprintf(c.out, "Invalid username %q.\n", username)
+		return
+	}
+
+	credentials, err := c.loadCredentials()
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to load user info, create user first.\nError: %v\n", err)
+		return
+	}
+	c.credentials = credentials
+
+	roomID, ok := c.getDirectRoom(username)
+	if !ok {
+		return
+	}
+	if roomID == nil {
+		if roomID, ok = c.startDirect(username); !ok {
 			return
 		}
 	}
+
+	c.StartChat(roomID.String())
+}
+
+// getDirectRoom returns id of direct room with user or nil if they have not sent messages to each other yet,
+// reports if chat can be continued
+func (c *Client) getDirectRoom(username string) (*uuid.UUID, bool) {
+	resp, err := c.get(fmt.Sprintf(baseURL+directEndpoint, c.host, username))
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make get request.\nError: %v\n", err)
+		return nil, false
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	//	nothing
+	case http.StatusNotFound:
+		return nil, true
+	case http.StatusUnauthorized:
+		fmt.Fprintln(c.out, "Not authorized, create user again.")
+		return nil, false
+	default:
+		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+		return nil, false
+	}
+
+	var roomID uuid.UUID
+	if err = json.NewDecoder(resp.Body).Decode(&roomID); err != nil {
+		fmt.Fprintf(c.out, "Unable to decode room id.\nError: %v\n", err)
+		return nil, false
+	}
+	return &roomID, true
+}
+
+// startDirect reads first message to user and sends it, returns id of created direct room,
+// reports if chat can be continued
+func (c *Client) startDirect(username string) (*uuid.UUID, bool) {
+	fmt.Fprintf(c.out, "No messages with %q yet, write the first one.\n", username)
+
+	// Rest of input is left buffered for chat
+	in := bufio.NewReader(c.in)
+	c.in = in
+
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, false
+		}
+		fmt.Fprint(c.out, clearCurrentLine)
+
+		text := c.parseText(line)
+		if text == "" {
+			fmt.Fprintln(c.out, "Empty or non UTF-8 text can't be sent.")
+			continue
+		}
+
+		roomID, retry, ok := c.sendDirectMessage(username, text)
+		if !retry {
+			return roomID, ok
+		}
+	}
+}
+
+// sendDirectMessage sends message to user and returns id of direct room, reports if message should be written again
+// and if chat can be continued
+func (c *Client) sendDirectMessage(username, text string) (roomID *uuid.UUID, retry, ok bool) {
+	byteSlice, err := json.Marshal(chat.NewMessage{Text: text})
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to encode message.\nError: %v\n", err)
+		return nil, false, false
+	}
+
+	url := fmt.Sprintf(baseURL+directMessages, c.host, username)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(byteSlice))
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to create post request.\nError: %v\n", err)
+		return nil, false, false
+	}
+	req.Header = c.authHeader()
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
+		return nil, false, false
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	//	nothing
+	case http.StatusRequestEntityTooLarge:
+		fmt.Fprintln(c.out, "Message is too long.")
+		return nil, true, false
+	case http.StatusNotFound:
+		fmt.Fprintf(c.out, "User %q not found.\n", username)
+		return nil, false, false
+	case http.StatusBadRequest:
+		fmt.Fprintf(c.out, "Unable to send direct message to %q.\n", username)
+		return nil, false, false
+	default:
+		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+		return nil, false, false
+	}
+
+	var id uuid.UUID
+	if err = json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		fmt.Fprintf(c.out, "Unable to decode room id.\nError: %v\n", err)
+		return nil, false, false
+	}
+	return &id, false, true
 }
 
 func (c *Client) parseText(text string) string {
@@ -200,28 +967,56 @@ func (c *Client) CreateUser(username string) {
 		fmt.Fprintf(c.out, "Unable to make post request.\nError: %v\n", err)
 		return
 	}
-	if err := resp.Body.Close(); err != nil {
-		fmt.Fprintf(c.out, "Unable to close response body.\nError: %v\n", err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	//	nothing
+	case http.StatusConflict:
+		fmt.Fprintf(c.out, "Username %q already taken.\n", username)
+		return
+	default:
+		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
 		return
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		fmt.Fprintf(c.out, "Something went wrong.\nStatus code: %d [%s]\n", resp.StatusCode, resp.Status)
+	var credentials chat.Credentials
+	err = json.NewDecoder(resp.Body).Decode(&credentials)
+	if err != nil {
+		fmt.Fprintf(c.out, "Unable to decode user credentials.\nError: %v\n", err)
 		return
 	}
 
-	var userIDBytes []byte
-	_, err = resp.Body.Read(userIDBytes)
+	userData, err := json.Marshal(credentials)
 	if err != nil {
-		fmt.Fprintf(c.out, "Unable to read response body.")
+		fmt.Fprintf(c.out, "Unable to encode user info.\nError: %v\n", err)
 		return
 	}
 
-	err = ioutil.WriteFile("user.data", userIDBytes, 0600)
+	err = ioutil.WriteFile(c.userDataPath, userData, 0600)
 	if err != nil {
 		fmt.Fprintf(c.out, "Unable to save user info.")
 		return
 	}
 
-	fmt.Fprintf(c.out, "User created succsefully, now you can join rooms.")
+	fmt.Fprintf(c.out, "User created successfully, now you can join rooms.")
+}
+
+// loadCredentials reads credentials of user saved on user creation
+func (c *Client) loadCredentials() (*chat.Credentials, error) {
+	userData, err := ioutil.ReadFile(c.userDataPath)
+	if err != nil {
+		return nil, fmt.Errorf("read user info: %w", err)
+	}
+
+	var credentials chat.Credentials
+	if err = json.Unmarshal(userData, &credentials); err != nil {
+		return nil, fmt.Errorf("decode user info: %w", err)
+	}
+	if credentials.Token == "" {
+		return nil, errors.New("no token in user info")
+	}
+	return &credentials, nil
 }
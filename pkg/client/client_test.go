@@ -4,15 +4,22 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/bmizerany/assert"
+	"github.com/gorilla/websocket"
 	"github.com/mymmrac/project-glynn/pkg/data/chat"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/server/httpapi"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/stretchr/testify/require"
 )
@@ -108,12 +115,11 @@ func TestClient_readMessages(t *testing.T) {
 
 	var outBuf bytes.Buffer
 	c := &Client{
-		httpClient:     server.Client(),
-		host:           server.URL,
-		roomID:         roomID.String(),
-		running:        make(chan struct{}, 1),
-		out:            &outBuf,
-		updateInterval: 0,
+		httpClient: server.Client(),
+		host:       server.URL,
+		roomID:     roomID.String(),
+		running:    make(chan struct{}, 1),
+		out:        &outBuf,
 	}
 
 	c.readMessages()
@@ -128,47 +134,634 @@ func TestClient_readMessages(t *testing.T) {
 		fmt.Sprintf("expected: %q\n actual: %q", expectedOutBuf.String(), outBuf.String()))
 }
 
+func TestClient_showHistory(t *testing.T) {
+	roomID := uuid.New()
+	userID := uuid.New()
+	messageTime := time.Unix(1621521072, 0).UTC()
+	url := fmt.Sprintf(baseURL+messagesEndpoint, "", roomID)
+
+	oldestID := uuid.New()
+	page := chat.Messages{
+		Messages: []message.Message{
+			{ID: uuid.New(), UserID: userID, RoomID: roomID, Text: "old", Time: messageTime},
+		},
+		Usernames: map[uuid.UUID]string{
+			userID: "test",
+		},
+		HasMore: false,
+	}
+
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, url, r.URL.Path)
+		assert.Equal(t, oldestID.String(), r.URL.Query().Get(httpapi.BeforeMessageIDParameter))
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		err := json.NewEncoder(w).Encode(page)
+		require.NoError(t, err)
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient: server.Client(),
+		host:       server.URL,
+		roomID:     roomID.String(),
+		out:        &outBuf,
+	}
+
+	c.showHistory()
+	assert.Equal(t, "No more messages.\n", outBuf.String())
+
+	c.displayMessages(&chat.Messages{Messages: []message.Message{{ID: oldestID, Time: messageTime}}})
+	outBuf.Reset()
+
+	c.showHistory()
+	assert.Equal(t, 1, runTimes)
+	assert.Equal(t, "--- History ---\n"+
+		messageTime.Local().Format(time.RFC822)+" [\u001B[33mtest\u001B[0m]: old\n"+
+		"--- End of history ---\n", outBuf.String())
+	assert.Equal(t, &page.Messages[0].ID, c.oldestMessageID)
+
+	outBuf.Reset()
+	c.showHistory()
+	assert.Equal(t, 1, runTimes)
+	assert.Equal(t, "No more messages.\n", outBuf.String())
+}
+
+func TestClient_pollMessages_hasMore(t *testing.T) {
+	roomID := uuid.New()
+	userID := uuid.New()
+	messageTime := time.Unix(1621521072, 0).UTC()
+
+	pages := []chat.Messages{
+		{
+			Messages: []message.Message{{ID: uuid.New(), UserID: userID, Text: "first", Time: messageTime}},
+			HasMore:  true,
+		},
+		{
+			Messages: []message.Message{{ID: uuid.New(), UserID: userID, Text: "second", Time: messageTime}},
+			HasMore:  true,
+		},
+	}
+	lastMessageID := uuid.New()
+	expectedLastIDs := []string{lastMessageID.String(), pages[0].Messages[0].ID.String(),
+		pages[1].Messages[0].ID.String()}
+
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, expectedLastIDs[runTimes], r.URL.Query().Get(httpapi.LastMessageIDParameter))
+		assert.Equal(t, "1m0s", r.URL.Query().Get(httpapi.WaitParameter))
+
+		if runTimes < len(pages) {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			err := json.NewEncoder(w).Encode(pages[runTimes])
+			require.NoError(t, err)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient: server.Client(),
+		host:       server.URL,
+		roomID:     roomID.String(),
+		out:        &outBuf,
+		pollWait:   time.Minute,
+	}
+
+	c.pollMessages(&lastMessageID)
+
+	assert.Equal(t, 3, runTimes)
+}
+
+func TestClient_pollMessages_updatedAfter(t *testing.T) {
+	roomID := uuid.New()
+	updatedUntil := time.Date(2021, 5, 20, 14, 31, 12, 123456789, time.UTC)
+
+	pages := []chat.Messages{
+		{UpdatedUntil: &updatedUntil},
+		{},
+	}
+	expectedUpdatedAfter := []string{"", updatedUntil.Format(time.RFC3339Nano),
+		updatedUntil.Format(time.RFC3339Nano)}
+
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, expectedUpdatedAfter[runTimes], r.URL.Query().Get(httpapi.UpdatedAfterParameter))
+
+		if runTimes < len(pages) {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			err := json.NewEncoder(w).Encode(pages[runTimes])
+			require.NoError(t, err)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient: server.Client(),
+		host:       server.URL,
+		roomID:     roomID.String(),
+		out:        &outBuf,
+		pollWait:   time.Minute,
+	}
+
+	c.pollMessages(nil)
+
+	assert.Equal(t, 3, runTimes)
+}
+
+func TestClient_printMessages(t *testing.T) {
+	userID := uuid.New()
+	messageTime := time.Unix(1621521072, 0).UTC()
+	editedAt := messageTime.Add(time.Minute)
+	formattedTime := messageTime.Local().Format(time.RFC822)
+
+	var outBuf bytes.Buffer
+	c := &Client{out: &outBuf}
+
+	newID := uuid.New()
+	parent := message.Message{ID: uuid.New(), UserID: userID, Text: "a rather long parent message\nwhich is cut in quote",
+		Time: messageTime}
+	deletedParent := message.Message{ID: uuid.New(), UserID: userID, Time: messageTime, Deleted: true}
+	c.printMessages(&chat.Messages{
+		Messages: []message.Message{
+			{ID: newID, UserID: userID, Text: "new", Time: messageTime},
+			{ID: uuid.New(), UserID: userID, Text: "reply", Time: messageTime, ReplyTo: &parent.ID},
+			{ID: uuid.New(), UserID: userID, Text: "late", Time: messageTime, ReplyTo: &deletedParent.ID},
+		},
+		Usernames: map[uuid.UUID]string{
+			userID: "test",
+		},
+		Updated: []message.Message{
+			{ID: uuid.New(), UserID: userID, Text: "edited", Time: messageTime, EditedAt: &editedAt},
+			{ID: uuid.New(), UserID: userID, Time: messageTime, Deleted: true, ReplyTo: &parent.ID},
+		},
+		Reactions: map[uuid.UUID]reaction.Counts{
+			newID: {"👍": 2, "🎉": 1},
+		},
+		Parents: map[uuid.UUID]message.Message{
+			parent.ID:        parent,
+			deletedParent.ID: deletedParent,
+		},
+		ReplyCounts: map[uuid.UUID]int{
+			newID: 3,
+		},
+	})
+
+	assert.Equal(t, formattedTime+" [\u001B[33mtest\u001B[0m]: new  🎉 1 👍 2 \u001B[2m(3 replies)\u001B[0m\n"+
+		"  \u001B[2m↪ test: a rather long parent message which is c…\u001B[0m\n"+
+		formattedTime+" [\u001B[33mtest\u001B[0m]: reply\n"+
+		"  \u001B[2m↪ test: (deleted)\u001B[0m\n"+
+		formattedTime+" [\u001B[33mtest\u001B[0m]: late\n"+
+		formattedTime+" [\u001B[33mtest\u001B[0m]: edited \u001B[2m(edited)\u001B[0m\n"+
+		formattedTime+" [\u001B[33mtest\u001B[0m]: \u001B[2m(deleted)\u001B[0m\n", outBuf.String())
+}
+
+func TestClient_readMessages_webSocket(t *testing.T) {
+	roomID := uuid.New()
+	userID := uuid.New()
+	messageTime := time.Unix(1621521072, 0).UTC()
+	messagesURL := fmt.Sprintf(baseURL+messagesEndpoint, "", roomID)
+	streamURL := fmt.Sprintf(baseURL+streamEndpoint, "", roomID)
+
+	cm := chat.Messages{
+		Messages: []message.Message{
+			{ID: uuid.New(), UserID: userID, RoomID: roomID, Text: "test", Time: messageTime},
+		},
+		Usernames: map[uuid.UUID]string{
+			userID: "test",
+		},
+	}
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+
+		switch r.URL.Path {
+		case streamURL:
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+
+			err = conn.WriteJSON(cm)
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+		case messagesURL:
+			// Polling continues after last streamed message
+			assert.Equal(t, cm.Messages[0].ID.String(), r.URL.Query().Get(httpapi.LastMessageIDParameter))
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:   server.Client(),
+		host:         server.URL,
+		roomID:       roomID.String(),
+		running:      make(chan struct{}, 1),
+		out:          &outBuf,
+		useWebSocket: true,
+	}
+
+	c.readMessages()
+
+	expectedOutBuf := bytes.NewBufferString(
+		messageTime.Local().Format(time.RFC822) + " [\u001B[33mtest\u001B[0m]: test\n" +
+			"Something went wrong.\n" +
+			"Status code: 400 [400 Bad Request]\n")
+	assert.Equal(t, expectedOutBuf, &outBuf,
+		fmt.Sprintf("expected: %q\n actual: %q", expectedOutBuf.String(), outBuf.String()))
+}
+
+func Test_websocketHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{host: "http://localhost:8080", expected: "ws://localhost:8080"},
+		{host: "https://example.com", expected: "wss://example.com"},
+		{host: "localhost", expected: "localhost"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.expected, websocketHost(tt.host))
+		})
+	}
+}
+
 func TestClient_sendMessages(t *testing.T) {
 	roomID := uuid.New()
 	url := fmt.Sprintf(baseURL+messagesEndpoint, "", roomID)
 
+	credentials := &chat.Credentials{UserID: uuid.New(), Token: "token"}
+
 	runTimes := 0
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, http.MethodPost, r.Method)
 		assert.Equal(t, url, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get(httpapi.AuthorizationHeader))
 
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
 		switch runTimes {
 		case 0:
 			w.WriteHeader(http.StatusCreated)
+		case 1:
+			w.WriteHeader(http.StatusForbidden)
+			err := json.NewEncoder(w).Encode(map[string]string{"error": "unable to send message: muted in room"})
+			require.NoError(t, err)
 		default:
 			w.WriteHeader(http.StatusBadRequest)
 		}
 		runTimes++
 	}))
 
-	inBuf := bytes.NewBufferString("test message\ntest message 2\n")
+	inBuf := bytes.NewBufferString("test message\ntest message 2\ntest message 3\n")
 
 	var outBuf bytes.Buffer
 	c := &Client{
-		httpClient: server.Client(),
-		host:       server.URL,
-		roomID:     roomID.String(),
-		running:    make(chan struct{}, 1),
-		in:         inBuf,
-		out:        &outBuf,
+		httpClient:  server.Client(),
+		host:        server.URL,
+		roomID:      roomID.String(),
+		running:     make(chan struct{}, 1),
+		in:          inBuf,
+		out:         &outBuf,
+		credentials: credentials,
 	}
 
 	c.sendMessages()
 
-	assert.Equal(t, 2, runTimes)
+	assert.Equal(t, 3, runTimes)
 
-	expectedOutBuf := bytes.NewBufferString(
-		clearCurrentLine + clearCurrentLine + "Something went wrong.\nStatus code: 400 [400 Bad Request]\n")
+	expectedOutBuf := bytes.NewBufferString(clearCurrentLine + clearCurrentLine +
+		"You are muted in this room, message was not sent.\n" + clearCurrentLine +
+		"Something went wrong.\nStatus code: 400 [400 Bad Request]\n")
 	assert.Equal(t, expectedOutBuf, &outBuf, fmt.Sprintf("%q", outBuf.String()))
 }
 
+func TestClient_joinRoom(t *testing.T) {
+	roomID := uuid.New()
+	url := fmt.Sprintf(baseURL+joinEndpoint, "", roomID)
+
+	statuses := []int{http.StatusOK, http.StatusForbidden, http.StatusNotFound}
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, url, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get(httpapi.AuthorizationHeader))
+
+		w.WriteHeader(statuses[runTimes])
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:  server.Client(),
+		host:        server.URL,
+		roomID:      roomID.String(),
+		out:         &outBuf,
+		credentials: &chat.Credentials{UserID: uuid.New(), Token: "token"},
+	}
+
+	assert.Equal(t, true, c.joinRoom())
+	assert.Equal(t, false, c.joinRoom())
+	assert.Equal(t, false, c.joinRoom())
+	assert.Equal(t, fmt.Sprintf("Room with id %q is private, ask one of its members for invite.\n"+
+		"Room with id %q not found.\n", roomID, roomID), outBuf.String())
+}
+
+func TestClient_runCommand(t *testing.T) {
+	roomID := uuid.New()
+	membersURL := fmt.Sprintf(baseURL+membersEndpoint, "", roomID)
+	leaveURL := fmt.Sprintf(baseURL+leaveEndpoint, "", roomID)
+	muteURL := fmt.Sprintf(baseURL+memberEndpoint+"/mute", "", roomID, "bob")
+	roleURL := fmt.Sprintf(baseURL+memberEndpoint+"/role", "", roomID, "bob")
+	banURL := fmt.Sprintf(baseURL+bansEndpoint, "", roomID, "bob")
+	logURL := fmt.Sprintf(baseURL+moderationLog, "", roomID)
+
+	mutedUntil := time.Date(2021, 5, 20, 17, 31, 0, 0, time.UTC)
+	aliceID, bobID := uuid.New(), uuid.New()
+	moderationActions := chat.ModerationLog{
+		Actions: []moderation.Action{
+			{TargetID: bobID, Kind: moderation.KindMute, Until: &mutedUntil, ModeratorID: &aliceID, Time: mutedUntil},
+			{TargetID: bobID, Kind: moderation.KindRole, Role: room.RoleModerator, Time: mutedUntil},
+		},
+		Usernames: map[uuid.UUID]string{aliceID: "alice", bobID: "bob"},
+	}
+	logTime := mutedUntil.Local().Format(time.RFC822)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get(httpapi.AuthorizationHeader))
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == membersURL:
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			err := json.NewEncoder(w).Encode([]chat.Member{
+				{Username: "alice", Role: room.RoleOwner},
+				{Username: "bob", Role: room.RoleMember, MutedUntil: &mutedUntil},
+				{Username: "carol", Role: room.RoleMember},
+			})
+			require.NoError(t, err)
+		case r.Method == http.MethodPost && r.URL.Path == membersURL:
+			var invite chat.Invite
+			err := json.NewDecoder(r.Body).Decode(&invite)
+			require.NoError(t, err)
+			if invite.Username != "carol" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPost && r.URL.Path == leaveURL:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPost && r.URL.Path == muteURL:
+			var mute chat.Mute
+			err := json.NewDecoder(r.Body).Decode(&mute)
+			require.NoError(t, err)
+			assert.Equal(t, "10m", mute.Duration)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && r.URL.Path == roleURL:
+			w.WriteHeader(http.StatusForbidden)
+			err := json.NewEncoder(w).Encode(map[string]string{"error": "not allowed to moderate user in room"})
+			require.NoError(t, err)
+		case r.Method == http.MethodPut && r.URL.Path == banURL:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == logURL:
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			err := json.NewEncoder(w).Encode(moderationActions)
+			require.NoError(t, err)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:  server.Client(),
+		host:        server.URL,
+		roomID:      roomID.String(),
+		out:         &outBuf,
+		credentials: &chat.Credentials{UserID: uuid.New(), Token: "token"},
+	}
+
+	tests := []struct {
+		text    string
+		handled bool
+		stop    bool
+		out     string
+	}{
+		{text: "hello /members", out: ""},
+		{text: "/unknown", out: ""},
+		{text: "/members", handled: true, out: "Members: alice (owner), bob (muted), carol\n"},
+		{text: "/invite", handled: true, out: "Usage: /invite <username>\n"},
+		{text: "/invite carol", handled: true, out: "User \"carol\" invited.\n"},
+		{text: "/invite dave", handled: true, out: "User \"dave\" not found.\n"},
+		{text: "/mute bob", handled: true, out: "Usage: /mute <username> <duration>\n"},
+		{text: "/mute bob 10m", handled: true, out: "User \"bob\" muted.\n"},
+		{text: "/ban bob", handled: true, out: "User \"bob\" banned.\n"},
+		{text: "/kick b", handled: true, out: "Invalid username \"b\".\n"},
+		{text: "/role bob moderator", handled: true,
+			out: "Unable to change role: not allowed to moderate user in room.\n"},
+		{text: "/log", handled: true, out: logTime + " admin made bob moderator\n" +
+			logTime + " alice muted bob until " + logTime + "\n"},
+		{text: "/leave", handled: true, stop: true, out: "You left the room.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			outBuf.Reset()
+
+			handled, stop := c.runCommand(tt.text)
+			assert.Equal(t, tt.handled, handled)
+			assert.Equal(t, tt.stop, stop)
+			assert.Equal(t, tt.out, outBuf.String())
+		})
+	}
+}
+
+func TestClient_getDirectRoom(t *testing.T) {
+	roomID := uuid.New()
+	url := fmt.Sprintf(baseURL+directEndpoint, "", "peer")
+
+	statuses := []int{http.StatusOK, http.StatusNotFound, http.StatusUnauthorized}
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, url, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get(httpapi.AuthorizationHeader))
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(statuses[runTimes])
+		if statuses[runTimes] == http.StatusOK {
+			err := json.NewEncoder(w).Encode(roomID)
+			require.NoError(t, err)
+		}
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:  server.Client(),
+		host:        server.URL,
+		out:         &outBuf,
+		credentials: &chat.Credentials{UserID: uuid.New(), Token: "token"},
+	}
+
+	actual, ok := c.getDirectRoom("peer")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, &roomID, actual)
+
+	actual, ok = c.getDirectRoom("peer")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, (*uuid.UUID)(nil), actual)
+
+	_, ok = c.getDirectRoom("peer")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, "Not authorized, create user again.\n", outBuf.String())
+}
+
+func TestClient_startDirect(t *testing.T) {
+	roomID := uuid.New()
+	url := fmt.Sprintf(baseURL+directMessages, "", "peer")
+
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, url, r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get(httpapi.AuthorizationHeader))
+
+		var newMessage chat.NewMessage
+		err := json.NewDecoder(r.Body).Decode(&newMessage)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", newMessage.Text)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+		switch runTimes {
+		case 0:
+			w.WriteHeader(http.StatusCreated)
+			err = json.NewEncoder(w).Encode(roomID)
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		runTimes++
+	}))
+	defer server.Close()
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:  server.Client(),
+		host:        server.URL,
+		in:          bytes.NewBufferString(" \nhello\nnext message\n"),
+		out:         &outBuf,
+		credentials: &chat.Credentials{UserID: uuid.New(), Token: "token"},
+	}
+
+	actual, ok := c.startDirect("peer")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, &roomID, actual)
+	assert.Equal(t, "No messages with \"peer\" yet, write the first one.\n"+
+		clearCurrentLine+"Empty or non UTF-8 text can't be sent.\n"+clearCurrentLine, outBuf.String())
+
+	rest, err := ioutil.ReadAll(c.in)
+	require.NoError(t, err)
+	assert.Equal(t, "next message\n", string(rest))
+
+	outBuf.Reset()
+	c.in = bytes.NewBufferString("hello\n")
+	_, ok = c.startDirect("peer")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, 2, runTimes)
+	assert.Equal(t, "No messages with \"peer\" yet, write the first one.\n"+
+		clearCurrentLine+"User \"peer\" not found.\n", outBuf.String())
+}
+
+func TestClient_CreateUser(t *testing.T) {
+	url := fmt.Sprintf(baseURL+usersEndpoint, "")
+	credentials := chat.Credentials{UserID: uuid.New(), Token: "token"}
+
+	runTimes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, url, r.URL.Path)
+
+		var newUser chat.NewUser
+		err := json.NewDecoder(r.Body).Decode(&newUser)
+		require.NoError(t, err)
+		assert.Equal(t, "test_user", newUser.Username)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+		switch runTimes {
+		case 0:
+			w.WriteHeader(http.StatusCreated)
+			err = json.NewEncoder(w).Encode(credentials)
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusConflict)
+		}
+		runTimes++
+	}))
+	defer server.Close()
+
+	userDataPath := filepath.Join(t.TempDir(), userDataFile)
+
+	var outBuf bytes.Buffer
+	c := &Client{
+		httpClient:   server.Client(),
+		host:         server.URL,
+		out:          &outBuf,
+		userDataPath: userDataPath,
+	}
+
+	c.CreateUser("test_user")
+	assert.Equal(t, "User created successfully, now you can join rooms.", outBuf.String())
+
+	actual, err := c.loadCredentials()
+	require.NoError(t, err)
+	assert.Equal(t, &credentials, actual)
+
+	outBuf.Reset()
+	c.CreateUser("test_user")
+	assert.Equal(t, "Username \"test_user\" already taken.\n", outBuf.String())
+
+	outBuf.Reset()
+	c.CreateUser("1 bad")
+	assert.Equal(t, 2, runTimes)
+	assert.Equal(t, "Invalid username, must contain only [a-Z], [0-9] or '_', "+
+		"starting from letter and at least 3 chars long.", outBuf.String())
+}
+
+func TestClient_loadCredentials(t *testing.T) {
+	dir := t.TempDir()
+	c := &Client{userDataPath: filepath.Join(dir, userDataFile)}
+
+	_, err := c.loadCredentials()
+	assert.NotEqual(t, nil, err)
+
+	require.NoError(t, ioutil.WriteFile(c.userDataPath, []byte("bad"), 0600))
+	_, err = c.loadCredentials()
+	assert.NotEqual(t, nil, err)
+
+	require.NoError(t, ioutil.WriteFile(c.userDataPath, []byte(`{"userID":"`+uuid.New().String()+`"}`), 0600))
+	_, err = c.loadCredentials()
+	assert.NotEqual(t, nil, err)
+}
+
 func TestNewClient(t *testing.T) {
 	host := "http://test.com"
 
@@ -178,5 +771,7 @@ func TestNewClient(t *testing.T) {
 	assert.Equal(t, os.Stdout, c.out)
 	assert.Equal(t, os.Stdin, c.in)
 	assert.Equal(t, http.DefaultClient, c.httpClient)
-	assert.Equal(t, updateInterval, c.updateInterval)
+	assert.Equal(t, pollWait, c.pollWait)
+	assert.Equal(t, true, c.useWebSocket)
+	assert.Equal(t, userDataFile, c.userDataPath)
 }
@@ -1,23 +1,95 @@
 package chat
 
 import (
+	"time"
+
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
 // Messages represents slice of messages with corresponding map of usernames
 type Messages struct {
-	Messages  []message.Message    `json:"messages"`  // Messages ordered by time
-	Usernames map[uuid.UUID]string `json:"usernames"` // Usernames of users who sent messages
+	Messages  []message.Message    `json:"messages"`          // Messages ordered by time
+	Usernames map[uuid.UUID]string `json:"usernames"`         // Usernames of users who sent messages
+	HasMore   bool                 `json:"hasMore"`           // HasMore reports if there are more messages to page through
+	Updated   []message.Message    `json:"updated,omitempty"` // Updated are already sent messages edited or deleted
+
+	// Reactions are counts of reactions on messages and updated messages by message id,
+	// messages without reactions are omitted
+	Reactions map[uuid.UUID]reaction.Counts `json:"reactions,omitempty"`
+
+	// Parents are messages replied to by messages and updated messages by their id
+	Parents map[uuid.UUID]message.Message `json:"parents,omitempty"`
+
+	// ReplyCounts are counts of replies on messages, updated messages and parents by message id,
+	// messages without replies are omitted
+	ReplyCounts map[uuid.UUID]int `json:"replyCounts,omitempty"`
+
+	// UpdatedUntil is a time to request next updated messages after, set only for polling requests
+	UpdatedUntil *time.Time `json:"updatedUntil,omitempty"`
 }
 
 // NewMessage represents new message from users
 type NewMessage struct {
-	UserID uuid.UUID `json:"userID"` // UserID who sent message
-	Text   string    `json:"text"`   // Text of sent message
+	Text    string     `json:"text"`              // Text of sent message
+	ReplyTo *uuid.UUID `json:"replyTo,omitempty"` // ReplyTo is an id of message from the same room, nil if not reply
+}
+
+// MessageEdit represents new text of already sent message
+type MessageEdit struct {
+	Text string `json:"text"` // Text replacing text of message
+}
+
+// NewReaction represents reaction of user on already sent message
+type NewReaction struct {
+	Emoji string `json:"emoji"` // Emoji user reacts with
 }
 
 // NewUser represents new user to be created
 type NewUser struct {
 	Username string `json:"username"` // Username of new user to be created
 }
+
+// NewRoom represents new room to be created
+type NewRoom struct {
+	Private bool   `json:"private"`         // Private reports if room can be read only by its members
+	Owner   string `json:"owner,omitempty"` // Owner is a username of user who owns room, empty if room has no owner
+}
+
+// Invite represents user invited to room
+type Invite struct {
+	Username string `json:"username"` // Username of invited user
+}
+
+// Member represents user who is a member of room
+type Member struct {
+	ID         uuid.UUID  `json:"id"`                   // ID of user
+	Username   string     `json:"username"`             // Username of user
+	Role       room.Role  `json:"role"`                 // Role of user in room
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"` // MutedUntil is a time when mute ends, nil if not muted
+}
+
+// RoleChange represents new role of room member
+type RoleChange struct {
+	Role room.Role `json:"role"` // Role member gets
+}
+
+// Mute represents mute of room member
+type Mute struct {
+	Duration string `json:"duration"` // Duration of mute, formatted like "90s", "10m" or "1h30m"
+}
+
+// ModerationLog represents moderation actions with corresponding map of usernames
+type ModerationLog struct {
+	Actions   []moderation.Action  `json:"actions"`   // Actions ordered from the newest
+	Usernames map[uuid.UUID]string `json:"usernames"` // Usernames of moderators and moderated users
+}
+
+// Credentials represents id and authentication token of user
+type Credentials struct {
+	UserID uuid.UUID `json:"userID"` // UserID of user
+	Token  string    `json:"token"`  // Token used to authenticate user
+}
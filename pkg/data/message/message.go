@@ -8,9 +8,16 @@ import (
 
 // Message represents one message from user in one room
 type Message struct {
-	ID     uuid.UUID `json:"id"`     // ID is a uniq identifier of message
-	UserID uuid.UUID `json:"userID"` // UserID is an id of user who sent message
-	RoomID uuid.UUID `json:"roomID"` // RoomID is an id of room in which message was sent
-	Text   string    `json:"text"`   // Text is actual text that user sent
-	Time   time.Time `json:"time"`   // Time when massage was sent
+	ID       uuid.UUID  `json:"id"`                 // ID is a uniq identifier of message
+	UserID   uuid.UUID  `json:"userID"`             // UserID is an id of user who sent message
+	RoomID   uuid.UUID  `json:"roomID"`             // RoomID is an id of room in which message was sent
+	Text     string     `json:"text"`               // Text is actual text that user sent, empty if deleted
+	Time     time.Time  `json:"time"`               // Time when massage was sent
+	EditedAt *time.Time `json:"editedAt,omitempty"` // EditedAt is time of the latest edit, nil if never edited
+	Deleted  bool       `json:"deleted,omitempty"`  // Deleted reports if message was deleted, it keeps its place
+	ReplyTo  *uuid.UUID `json:"replyTo,omitempty"`  // ReplyTo is an id of message from the same room, nil if not reply
+
+	// UpdatedAt is time of the latest edit, deletion or change of reactions, nil if never changed,
+	// it orders updates of messages and is not sent to clients
+	UpdatedAt *time.Time `json:"-"`
 }
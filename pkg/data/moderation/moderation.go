@@ -0,0 +1,32 @@
+package moderation
+
+import (
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// Kind is a kind of moderation action
+type Kind string
+
+const (
+	KindRole   Kind = "role"   // KindRole changes role of member
+	KindMute   Kind = "mute"   // KindMute forbids member to write to room until specified time
+	KindUnmute Kind = "unmute" // KindUnmute allows muted member to write again
+	KindKick   Kind = "kick"   // KindKick removes user from members of room
+	KindBan    Kind = "ban"    // KindBan removes user from members of room and forbids to join it again
+	KindUnban  Kind = "unban"  // KindUnban allows banned user to join room again
+)
+
+// Action represents one moderation action in room, actions are kept as audit trail of room
+type Action struct {
+	ID          uuid.UUID  `json:"id"`                    // ID is a uniq identifier of action
+	RoomID      uuid.UUID  `json:"roomID"`                // RoomID is an id of moderated room
+	ModeratorID *uuid.UUID `json:"moderatorID,omitempty"` // ModeratorID is an id of user who acted, nil for admin
+	TargetID    uuid.UUID  `json:"targetID"`              // TargetID is an id of moderated user
+	Kind        Kind       `json:"kind"`                  // Kind of action
+	Role        room.Role  `json:"role,omitempty"`        // Role is a new role of member, set only for KindRole
+	Until       *time.Time `json:"until,omitempty"`       // Until is the end of mute, set only for KindMute
+	Time        time.Time  `json:"time"`                  // Time when action was done
+}
@@ -0,0 +1,16 @@
+package reaction
+
+import (
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// Reaction represents emoji reaction of one user on one message
+type Reaction struct {
+	RoomID    uuid.UUID `json:"roomID"`    // RoomID is an id of room in which message was sent
+	MessageID uuid.UUID `json:"messageID"` // MessageID is an id of message user reacted on
+	UserID    uuid.UUID `json:"userID"`    // UserID is an id of user who reacted
+	Emoji     string    `json:"emoji"`     // Emoji user reacted with
+}
+
+// Counts represents amount of users reacted on one message by emoji
+type Counts map[string]int
@@ -1,10 +1,35 @@
 package room
 
 import (
+	"time"
+
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
 // Room represents chat room
 type Room struct {
-	ID uuid.UUID `json:"id"` // ID is a uniq identifier of room
+	ID      uuid.UUID `json:"id"`                // ID is a uniq identifier of room
+	Direct  bool      `json:"direct,omitempty"`  // Direct reports if room is a private conversation of two users
+	Private bool      `json:"private,omitempty"` // Private reports if room can be read only by its members
+}
+
+// Role of member in room, it defines what member can do with other members
+type Role string
+
+const (
+	RoleMember    Role = "member"    // RoleMember can read and write to room
+	RoleModerator Role = "moderator" // RoleModerator can also mute, kick and ban members
+	RoleOwner     Role = "owner"     // RoleOwner can also change roles of members
+)
+
+// Member represents user who is a member of room
+type Member struct {
+	UserID     uuid.UUID  `json:"userID"`               // UserID is an id of member
+	Role       Role       `json:"role"`                 // Role of member in room
+	MutedUntil *time.Time `json:"mutedUntil,omitempty"` // MutedUntil is time until member can't write, nil if not muted
+}
+
+// Muted reports if member can't write to room at specified time
+func (m *Member) Muted(now time.Time) bool {
+	return m.MutedUntil != nil && now.Before(*m.MutedUntil)
 }
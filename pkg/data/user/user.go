@@ -4,6 +4,9 @@ import (
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
+// UsernameRegex for matching valid username: only [a-Z], [0-9] or '_', starting from letter and at least 3 chars long
+const UsernameRegex = `^[a-zA-Z]\w{2,}$`
+
 // User represents info about chat participant
 type User struct {
 	ID       uuid.UUID `json:"id"`       // ID is a uniq identifier of user
@@ -1,63 +1,155 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gocql/gocql"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/data/user"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	keyspace            = "glynn"
-	createKeyspaceQuery = "CREATE KEYSPACE IF NOT EXISTS " +
-		keyspace + " WITH REPLICATION = { 'class' : 'SimpleStrategy', 'replication_factor' : 1 };"
-
-	createUsersTable    = "CREATE TABLE IF NOT EXISTS " + keyspace + ".users (id uuid PRIMARY KEY, username text);"
-	createRoomsTable    = "CREATE TABLE IF NOT EXISTS " + keyspace + ".rooms (id uuid PRIMARY KEY);"
-	createMessagesTable = "CREATE TABLE IF NOT EXISTS " +
-		keyspace + ".messages (id uuid, roomID uuid, userID uuid, text text, time timestamp, PRIMARY KEY (roomID, time));"
-
-	selectTimeOfMessage = "SELECT time FROM messages WHERE id = ? LIMIT 1 ALLOW FILTERING;"
-	selectMessages      = "SELECT id, roomID, userID, text, time FROM messages " +
-		"WHERE roomID = ? AND time > ? ORDER BY time DESC LIMIT ? ALLOW FILTERING;"
-	selectUsersByIDs  = "SELECT id, username FROM users WHERE id IN ?"
-	selectIfRoomExist = "SELECT count(*) FROM rooms WHERE id = ?;"
-
-	insertMessage = "INSERT INTO messages (id, userID, roomID, text, time) VALUES (?, ?, ?, ?, ?);"
+	createKeyspaceQuery = "CREATE KEYSPACE IF NOT EXISTS %s WITH REPLICATION = %s;"
+
+	selectTimeOfMessage   = "SELECT time FROM messages_by_id WHERE roomID = ? AND id = ?;"
+	selectTimesOfMessages = "SELECT id, time FROM messages_by_id WHERE roomID = ? AND id IN ?;"
+	selectBucketsAfter    = "SELECT bucket FROM message_buckets WHERE roomID = ? AND bucket >= ? ORDER BY bucket DESC;"
+	selectOldestBuckets   = "SELECT bucket FROM message_buckets WHERE roomID = ? AND bucket >= ? ORDER BY bucket ASC;"
+	selectBucketsBefore   = "SELECT bucket FROM message_buckets WHERE roomID = ? AND bucket <= ? ORDER BY bucket DESC;"
+	selectRoomBuckets     = "SELECT bucket FROM message_buckets WHERE roomID = ?;"
+	selectMessages        = "SELECT id, roomID, userID, text, time, editedAt, deleted, replyTo, updatedAt " +
+		"FROM room_messages WHERE roomID = ? AND bucket = ? AND (time, id) > (?, ?) ORDER BY time DESC, id DESC LIMIT ?;"
+	selectOldestMessages = "SELECT id, roomID, userID, text, time, editedAt, deleted, replyTo, updatedAt " +
+		"FROM room_messages WHERE roomID = ? AND bucket = ? AND (time, id) > (?, ?) ORDER BY time ASC, id ASC LIMIT ?;"
+	selectMessagesBefore = "SELECT id, roomID, userID, text, time, editedAt, deleted, replyTo, updatedAt " +
+		"FROM room_messages WHERE roomID = ? AND bucket = ? AND (time, id) < (?, ?) ORDER BY time DESC, id DESC LIMIT ?;"
+	selectMessage = "SELECT id, roomID, userID, text, time, editedAt, deleted, replyTo, updatedAt " +
+		"FROM room_messages WHERE roomID = ? AND bucket = ? AND time = ? AND id = ?;"
+	selectEditBucketsAfter = "SELECT bucket FROM message_edit_buckets WHERE roomID = ? AND bucket >= ? AND bucket <= ?;"
+	selectRoomEditBuckets  = "SELECT bucket FROM message_edit_buckets WHERE roomID = ?;"
+	selectEdits            = "SELECT id, editedAt FROM message_edits " +
+		"WHERE roomID = ? AND bucket = ? AND editedAt > ? AND editedAt <= ?;"
+	selectReplies = "SELECT id, time FROM message_replies " +
+		"WHERE roomID = ? AND replyTo = ? AND (time, id) > (?, ?) LIMIT ?;"
+	selectReplyCounts      = "SELECT replyTo FROM message_replies WHERE roomID = ? AND replyTo IN ?;"
+	selectReactions        = "SELECT messageID, emoji FROM message_reactions WHERE roomID = ? AND messageID IN ?;"
+	selectUsersByIDs       = "SELECT id, username FROM users WHERE id IN ?"
+	selectUserIDByUsername = "SELECT id FROM users_by_username WHERE username = ?;"
+	selectUserIDByToken    = "SELECT userID FROM tokens WHERE hash = ?;"
+	selectIfRoomExist      = "SELECT count(*) FROM rooms WHERE id = ?;"
+	selectRoom             = "SELECT id, direct, private FROM rooms WHERE id = ?;"
+	selectRooms            = "SELECT id, direct, private FROM rooms;"
+	selectIfRoomMember     = "SELECT count(*) FROM room_members WHERE roomID = ? AND userID = ?;"
+	selectRoomMembers      = "SELECT userID, role FROM room_members WHERE roomID = ?;"
+	selectRoomMember       = "SELECT userID, role FROM room_members WHERE roomID = ? AND userID = ?;"
+	selectRoomMutes        = "SELECT userID, until FROM room_mutes WHERE roomID = ?;"
+	selectMute             = "SELECT until FROM room_mutes WHERE roomID = ? AND userID = ?;"
+	selectIfBanned         = "SELECT count(*) FROM room_bans WHERE roomID = ? AND userID = ?;"
+	selectActions          = "SELECT id, roomID, moderatorID, targetID, kind, role, until, time " +
+		"FROM moderation_actions WHERE roomID = ? LIMIT ?;"
+
+	insertMessage = "INSERT INTO room_messages " +
+		"(roomID, bucket, time, id, userID, text, editedAt, deleted, replyTo, updatedAt) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
+	insertMessageBucket    = "INSERT INTO message_buckets (roomID, bucket) VALUES (?, ?);"
+	insertMessageByID      = "INSERT INTO messages_by_id (roomID, id, time) VALUES (?, ?, ?);"
+	insertEdit             = "INSERT INTO message_edits (roomID, bucket, editedAt, id) VALUES (?, ?, ?, ?);"
+	insertEditBucket       = "INSERT INTO message_edit_buckets (roomID, bucket) VALUES (?, ?);"
+	insertReply            = "INSERT INTO message_replies (roomID, replyTo, time, id) VALUES (?, ?, ?, ?);"
+	insertReaction         = "INSERT INTO message_reactions (roomID, messageID, emoji, userID) VALUES (?, ?, ?, ?);"
+	insertUser             = "INSERT INTO users (id, username) VALUES (?, ?);"
+	insertUsernameIfAbsent = "INSERT INTO users_by_username (username, id) VALUES (?, ?) IF NOT EXISTS;"
+	deleteUsernameIfID     = "DELETE FROM users_by_username WHERE username = ? IF id = ?;"
+	insertToken            = "INSERT INTO tokens (hash, userID) VALUES (?, ?);"
+	insertRoomIfAbsent     = "INSERT INTO rooms (id, direct, private) VALUES (?, ?, ?) IF NOT EXISTS;"
+	insertRoomMember       = "INSERT INTO room_members (roomID, userID) VALUES (?, ?);"
+	insertBan              = "INSERT INTO room_bans (roomID, userID) VALUES (?, ?);"
+	insertMute             = "INSERT INTO room_mutes (roomID, userID, until) VALUES (?, ?, ?);"
+	insertAction           = "INSERT INTO moderation_actions " +
+		"(roomID, time, id, moderatorID, targetID, kind, role, until) VALUES (?, ?, ?, ?, ?, ?, ?, ?);"
+
+	updateMessageText = "UPDATE room_messages SET text = ?, editedAt = ?, updatedAt = ? " +
+		"WHERE roomID = ? AND bucket = ? AND time = ? AND id = ? IF EXISTS;"
+	updateMessageDeleted = "UPDATE room_messages SET text = '', deleted = true, editedAt = ?, updatedAt = ? " +
+		"WHERE roomID = ? AND bucket = ? AND time = ? AND id = ? IF EXISTS;"
+	updateMessageTime = "UPDATE room_messages SET updatedAt = ? " +
+		"WHERE roomID = ? AND bucket = ? AND time = ? AND id = ? IF EXISTS;"
+	updateRoomMember = "UPDATE room_members SET role = ? WHERE roomID = ? AND userID = ? IF EXISTS;"
+
+	deleteReaction = "DELETE FROM message_reactions " +
+		"WHERE roomID = ? AND messageID = ? AND emoji = ? AND userID = ? IF EXISTS;"
+	deleteRoom             = "DELETE FROM rooms WHERE id = ?;"
+	deleteBucketMessages   = "DELETE FROM room_messages WHERE roomID = ? AND bucket = ?;"
+	deleteRoomBuckets      = "DELETE FROM message_buckets WHERE roomID = ?;"
+	deleteBucketEdits      = "DELETE FROM message_edits WHERE roomID = ? AND bucket = ?;"
+	deleteRoomEditBuckets  = "DELETE FROM message_edit_buckets WHERE roomID = ?;"
+	deleteRoomMessagesByID = "DELETE FROM messages_by_id WHERE roomID = ?;"
+	deleteRoomReactions    = "DELETE FROM message_reactions WHERE roomID = ?;"
+	deleteRoomReplies      = "DELETE FROM message_replies WHERE roomID = ?;"
+	deleteRoomMembers      = "DELETE FROM room_members WHERE roomID = ?;"
+	deleteRoomMember       = "DELETE FROM room_members WHERE roomID = ? AND userID = ?;"
+	deleteRoomBans         = "DELETE FROM room_bans WHERE roomID = ?;"
+	deleteBan              = "DELETE FROM room_bans WHERE roomID = ? AND userID = ?;"
+	deleteRoomMutes        = "DELETE FROM room_mutes WHERE roomID = ?;"
+	deleteMute             = "DELETE FROM room_mutes WHERE roomID = ? AND userID = ?;"
+	deleteRoomActions      = "DELETE FROM moderation_actions WHERE roomID = ?;"
 )
 
+// DefaultBucketPeriod is a default period of time covered by one partition of room messages
+const DefaultBucketPeriod = 24 * time.Hour
+
+// deleteBucketsBatchSize limits amount of bucket partitions deleted in one batch, so deleting rooms with long history
+// doesn't exceed batch size limits of Cassandra
+const deleteBucketsBatchSize = 32
+
 // Cassandra implementation of Repository
 type Cassandra struct {
-	session *gocql.Session
-	log     *logrus.Logger
+	session          *gocql.Session
+	config           CassandraConfig
+	writeConsistency gocql.Consistency
+	log              *logrus.Logger
 }
 
 // NewCassandraRepository creates new Cassandra Repository
-func NewCassandraRepository(log *logrus.Logger) *Cassandra {
+func NewCassandraRepository(config CassandraConfig, log *logrus.Logger) *Cassandra {
 	return &Cassandra{
-		log: log,
+		config: config,
+		log:    log,
 	}
 }
 
-// Connect starts new connection and initializes database if needed
-func (c *Cassandra) Connect(cassandraURL, cassandraUser, cassandraPass string, initDB bool) error {
-	cluster := gocql.NewCluster(cassandraURL)
-	cluster.Authenticator = gocql.PasswordAuthenticator{Username: cassandraUser, Password: cassandraPass}
-	// TODO use const ?
-	cluster.ProtoVersion = 4
-	cluster.Consistency = gocql.One
+// Connect starts new connection and initializes database if needed, initialization is canceled when ctx is done
+func (c *Cassandra) Connect(ctx context.Context, initDB bool) error {
+	if err := c.config.validate(); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	writeConsistency, err := gocql.ParseConsistencyWrapper(c.config.WriteConsistency)
+	if err != nil {
+		return fmt.Errorf("config: write consistency: %w", err)
+	}
+	c.writeConsistency = writeConsistency
+
+	cluster, err := c.config.clusterConfig()
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
 	cluster.Logger = c.log
 
 	if initDB {
-		if err := c.createKeyspace(cluster); err != nil {
+		if err = c.createKeyspace(ctx, cluster); err != nil {
 			return fmt.Errorf("inti db: %w", err)
 		}
 	}
-	cluster.Keyspace = keyspace
+	cluster.Keyspace = c.config.Keyspace
 
 	session, err := cluster.CreateSession()
 	if err != nil {
@@ -66,7 +158,7 @@ func (c *Cassandra) Connect(cassandraURL, cassandraUser, cassandraPass string, i
 	c.session = session
 
 	if initDB {
-		if err = c.createTables(); err != nil {
+		if err = c.migrateUp(ctx); err != nil {
 			return fmt.Errorf("inti db: %w", err)
 		}
 	}
@@ -82,71 +174,138 @@ func (c *Cassandra) Close() {
 	}
 }
 
-func (c *Cassandra) createKeyspace(cluster *gocql.ClusterConfig) error {
+func (c *Cassandra) createKeyspace(ctx context.Context, cluster *gocql.ClusterConfig) error {
 	session, err := cluster.CreateSession()
 	if err != nil {
 		return fmt.Errorf("create cluster: %w", err)
 	}
 	defer session.Close()
 
-	if err := session.Query(createKeyspaceQuery).Exec(); err != nil {
-		return fmt.Errorf("create keyspace %q: %w", keyspace, err)
+	// Config is validated, so keyspace name and replication are safe to use in query
+	replication, err := c.config.replication()
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(createKeyspaceQuery, c.config.Keyspace, replication)
+	if err = session.Query(query).WithContext(ctx).Consistency(c.writeConsistency).Exec(); err != nil {
+		return fmt.Errorf("create keyspace %q: %w", c.config.Keyspace, err)
 	}
 	return nil
 }
 
-func (c *Cassandra) createTables() error {
-	if err := c.session.Query(createUsersTable).Exec(); err != nil {
-		return fmt.Errorf("create users table: %w", err)
-	}
+// read returns query which selects data, it is canceled when ctx is done
+func (c *Cassandra) read(ctx context.Context, stmt string, values ...interface{}) *gocql.Query {
+	return c.session.Query(stmt, values...).WithContext(ctx)
+}
 
-	if err := c.session.Query(createRoomsTable).Exec(); err != nil {
-		return fmt.Errorf("create rooms table: %w", err)
-	}
+// write returns query which changes data, it is canceled when ctx is done
+func (c *Cassandra) write(ctx context.Context, stmt string, values ...interface{}) *gocql.Query {
+	return c.session.Query(stmt, values...).WithContext(ctx).Consistency(c.writeConsistency)
+}
 
-	if err := c.session.Query(createMessagesTable).Exec(); err != nil {
-		return fmt.Errorf("create messages table: %w", err)
-	}
-	return nil
+// writeBatch returns new logged batch of queries which change data, it is canceled when ctx is done
+func (c *Cassandra) writeBatch(ctx context.Context) *gocql.Batch {
+	batch := c.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.SetConsistency(c.writeConsistency)
+	return batch
+}
+
+// bucketOf returns bucket of messages saved at given time
+func (c *Cassandra) bucketOf(t time.Time) time.Time {
+	return t.UTC().Truncate(c.config.BucketPeriod)
 }
 
-func (c *Cassandra) GetMessageTime(messageID uuid.UUID) (time.Time, error) {
+func (c *Cassandra) GetMessageTime(ctx context.Context, roomID, messageID uuid.UUID) (time.Time, error) {
 	var t time.Time
-	if err := c.session.Query(selectTimeOfMessage, messageID.String()).Scan(&t); err != nil {
+	if err := c.read(ctx, selectTimeOfMessage, roomID.String(), messageID.String()).Scan(&t); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			err = ErrorNotFound
+		}
 		return time.Time{}, fmt.Errorf("get time of message %s: %w", messageID, err)
 	}
 	return t, nil
 }
 
-func (c *Cassandra) GetMessages(roomID uuid.UUID, afterTime time.Time, limit uint) ([]message.Message, error) {
-	it := c.session.Query(selectMessages, roomID.String(), afterTime, limit).Iter()
-	scanner := it.Scanner()
+func (c *Cassandra) GetMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	after.Time = sinceEpoch(after.Time)
+	messages, err := c.walkBuckets(ctx, roomID, selectBucketsAfter, selectMessages, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+	reverseMessages(messages)
+	return messages, nil
+}
 
-	messages := make([]message.Message, it.NumRows())
-	i := it.NumRows() - 1
-	for scanner.Next() {
-		var messageIDStr, userIDStr, roomIDStr string
-		var msg message.Message
-		err := scanner.Scan(&messageIDStr, &roomIDStr, &userIDStr, &msg.Text, &msg.Time)
-		if err != nil {
-			return nil, fmt.Errorf("scan message: %w", err)
-		}
+func (c *Cassandra) GetOldestMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	after.Time = sinceEpoch(after.Time)
+	messages, err := c.walkBuckets(ctx, roomID, selectOldestBuckets, selectOldestMessages, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get oldest messages: %w", err)
+	}
+	return messages, nil
+}
 
-		msg.ID, err = uuid.Parse(messageIDStr)
-		if err != nil {
-			return nil, fmt.Errorf("message id: %w", err)
+func (c *Cassandra) GetMessagesBefore(ctx context.Context, roomID uuid.UUID,
+	before Cursor, limit uint) ([]message.Message, error) {
+	messages, err := c.walkBuckets(ctx, roomID, selectBucketsBefore, selectMessagesBefore, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get messages before: %w", err)
+	}
+	reverseMessages(messages)
+	return messages, nil
+}
+
+// sinceEpoch replaces zero time which is stored as null by gocql with Unix epoch, no messages are sent before it
+func sinceEpoch(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Unix(0, 0)
+	}
+	return t
+}
+
+// walkBuckets selects up to limit messages bounded by cursor, bucketsQuery selects room buckets starting
+// from bucket of cursor, messagesQuery selects messages of one bucket in the same order
+func (c *Cassandra) walkBuckets(ctx context.Context, roomID uuid.UUID, bucketsQuery, messagesQuery string,
+	cursor Cursor, limit uint) ([]message.Message, error) {
+	// Cassandra keeps time with millisecond precision
+	cursor = cursor.truncate(time.Millisecond)
+	buckets := c.read(ctx, bucketsQuery, roomID.String(), c.bucketOf(cursor.Time)).Iter().Scanner()
+
+	var messages []message.Message
+	for uint(len(messages)) < limit && buckets.Next() {
+		var bucket time.Time
+		if err := buckets.Scan(&bucket); err != nil {
+			return nil, fmt.Errorf("scan bucket: %w", err)
 		}
-		msg.UserID, err = uuid.Parse(userIDStr)
+
+		it := c.read(ctx, messagesQuery, roomID.String(), bucket, cursor.Time, cursor.ID.String(),
+			limit-uint(len(messages))).Iter()
+		bucketMessages, err := scanMessages(it)
 		if err != nil {
-			return nil, fmt.Errorf("user id: %w", err)
+			return nil, fmt.Errorf("bucket %s: %w", bucket.Format(time.RFC3339), err)
 		}
-		msg.RoomID, err = uuid.Parse(roomIDStr)
+		messages = append(messages, bucketMessages...)
+	}
+
+	if err := buckets.Err(); err != nil {
+		return nil, fmt.Errorf("scan buckets: %w", err)
+	}
+	return messages, nil
+}
+
+// scanMessages scans all selected messages keeping order of selection
+func scanMessages(it *gocql.Iter) ([]message.Message, error) {
+	scanner := it.Scanner()
+
+	messages := make([]message.Message, 0, it.NumRows())
+	for scanner.Next() {
+		msg, err := scanMessage(scanner)
 		if err != nil {
-			return nil, fmt.Errorf("room id: %w", err)
+			return nil, err
 		}
-
-		messages[i] = msg
-		i--
+		messages = append(messages, msg)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -155,9 +314,75 @@ func (c *Cassandra) GetMessages(roomID uuid.UUID, afterTime time.Time, limit uin
 	return messages, nil
 }
 
-func (c *Cassandra) GetUsersFromIDs(uuids []uuid.UUID) ([]user.User, error) {
+// scanMessage scans current row selected as id, roomID, userID, text, time, editedAt, deleted, replyTo, updatedAt
+func scanMessage(scanner gocql.Scanner) (message.Message, error) {
+	var editedAt, updatedAt *time.Time
+	var deleted bool
+	var replyToStr string
+	msg, err := scanMessageColumns(scanner, &editedAt, &deleted, &replyToStr, &updatedAt)
+	if err != nil {
+		return message.Message{}, err
+	}
+	msg.EditedAt = editedAt
+	msg.Deleted = deleted
+
+	// Messages edited before updates were tracked have null update time
+	msg.UpdatedAt = updatedAt
+	if msg.UpdatedAt == nil {
+		msg.UpdatedAt = editedAt
+	}
+
+	// Null uuid is scanned as empty string
+	if replyToStr != "" {
+		replyTo, err := uuid.Parse(replyToStr)
+		if err != nil {
+			return message.Message{}, fmt.Errorf("reply to: %w", err)
+		}
+		msg.ReplyTo = &replyTo
+	}
+	return msg, nil
+}
+
+// scanLegacyMessage scans current row of legacy table selected as id, roomID, userID, text, time
+func scanLegacyMessage(scanner gocql.Scanner) (message.Message, error) {
+	return scanMessageColumns(scanner)
+}
+
+// scanMessageColumns scans current row selected as id, roomID, userID, text, time followed by other columns
+func scanMessageColumns(scanner gocql.Scanner, other ...interface{}) (message.Message, error) {
+	var messageIDStr, userIDStr, roomIDStr string
+	var msg message.Message
+	columns := append([]interface{}{&messageIDStr, &roomIDStr, &userIDStr, &msg.Text, &msg.Time}, other...)
+	err := scanner.Scan(columns...)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("scan message: %w", err)
+	}
+
+	msg.ID, err = uuid.Parse(messageIDStr)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("message id: %w", err)
+	}
+	msg.UserID, err = uuid.Parse(userIDStr)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("user id: %w", err)
+	}
+	msg.RoomID, err = uuid.Parse(roomIDStr)
+	if err != nil {
+		return message.Message{}, fmt.Errorf("room id: %w", err)
+	}
+	return msg, nil
+}
+
+// reverseMessages reverses messages selected in descending order of time to be in ascending order
+func reverseMessages(messages []message.Message) {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+}
+
+func (c *Cassandra) GetUsersFromIDs(ctx context.Context, uuids []uuid.UUID) ([]user.User, error) {
 	uuidsStr := uuid.ToStrings(uuids)
-	scanner := c.session.Query(selectUsersByIDs, uuidsStr).Iter().Scanner()
+	scanner := c.read(ctx, selectUsersByIDs, uuidsStr).Iter().Scanner()
 
 	var users []user.User
 	for scanner.Next() {
@@ -181,19 +406,704 @@ func (c *Cassandra) GetUsersFromIDs(uuids []uuid.UUID) ([]user.User, error) {
 	return users, nil
 }
 
-func (c *Cassandra) SaveMessage(msg *message.Message) error {
-	err := c.session.Query(insertMessage,
-		msg.ID.String(), msg.UserID.String(), msg.RoomID.String(), msg.Text, msg.Time).Exec()
+func (c *Cassandra) GetUserByUsername(ctx context.Context, username string) (*user.User, error) {
+	var idStr string
+	if err := c.read(ctx, selectUserIDByUsername, username).Scan(&idStr); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			err = ErrorNotFound
+		}
+		return nil, fmt.Errorf("get user %q: %w", username, err)
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("user id: %w", err)
+	}
+
+	return &user.User{
+		ID:       id,
+		Username: username,
+	}, nil
+}
+
+func (c *Cassandra) CreateUser(ctx context.Context, usr *user.User, tokenHash string) error {
+	var existingUsername, existingIDStr string
+	applied, err := c.write(ctx, insertUsernameIfAbsent, usr.Username, usr.ID.String()).
+		ScanCAS(&existingUsername, &existingIDStr)
+	if err != nil {
+		return fmt.Errorf("reserve username %q: %w", usr.Username, err)
+	}
+	if !applied {
+		return fmt.Errorf("create user %q: %w", usr.Username, ErrorUsernameTaken)
+	}
+
+	batch := c.writeBatch(ctx)
+	batch.Query(insertUser, usr.ID.String(), usr.Username)
+	batch.Query(insertToken, tokenHash, usr.ID.String())
+	if err = c.session.ExecuteBatch(batch); err != nil {
+		// Reservation is released even if ctx is done, otherwise username stays taken by user that doesn't exist
+		if relErr := c.write(context.Background(), deleteUsernameIfID, usr.Username, usr.ID.String()).
+			Exec(); relErr != nil {
+			return fmt.Errorf("create user %q: %w, release username: %s", usr.Username, err, relErr)
+		}
+		return fmt.Errorf("create user %q: %w", usr.Username, err)
+	}
+	return nil
+}
+
+func (c *Cassandra) GetUserIDByToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	var userIDStr string
+	if err := c.read(ctx, selectUserIDByToken, tokenHash).Scan(&userIDStr); err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			err = ErrorNotFound
+		}
+		return uuid.UUID{}, fmt.Errorf("get user by token: %w", err)
+	}
+
+	userID, err := uuid.Parse(userIDStr)
 	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("user id: %w", err)
+	}
+	return userID, nil
+}
+
+func (c *Cassandra) SaveMessage(ctx context.Context, msg *message.Message) error {
+	var replyTo *string
+	if msg.ReplyTo != nil {
+		replyToStr := msg.ReplyTo.String()
+		replyTo = &replyToStr
+	}
+
+	batch := c.writeBatch(ctx)
+	bucket := c.bucketOf(msg.Time)
+	batch.Query(insertMessage, msg.RoomID.String(), bucket, msg.Time, msg.ID.String(), msg.UserID.String(), msg.Text,
+		msg.EditedAt, msg.Deleted, replyTo, msg.UpdatedAt)
+	batch.Query(insertMessageBucket, msg.RoomID.String(), bucket)
+	batch.Query(insertMessageByID, msg.RoomID.String(), msg.ID.String(), msg.Time)
+	if replyTo != nil {
+		batch.Query(insertReply, msg.RoomID.String(), *replyTo, msg.Time, msg.ID.String())
+	}
+
+	if err := c.session.ExecuteBatch(batch); err != nil {
 		return fmt.Errorf("save message: %w", err)
 	}
 	return nil
 }
 
-func (c *Cassandra) IsRoomExist(roomID uuid.UUID) (bool, error) {
+func (c *Cassandra) GetMessage(ctx context.Context, roomID, messageID uuid.UUID) (*message.Message, error) {
+	t, err := c.GetMessageTime(ctx, roomID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+
+	msg, err := c.getMessageAt(ctx, roomID, messageID, t)
+	if err != nil {
+		return nil, fmt.Errorf("get message %s: %w", messageID, err)
+	}
+	return msg, nil
+}
+
+// getMessageAt returns message of room sent at given time or ErrorNotFound
+func (c *Cassandra) getMessageAt(ctx context.Context, roomID, messageID uuid.UUID,
+	t time.Time) (*message.Message, error) {
+	it := c.read(ctx, selectMessage, roomID.String(), c.bucketOf(t), t, messageID.String()).Iter()
+	messages, err := scanMessages(it)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrorNotFound
+	}
+	return &messages[0], nil
+}
+
+// GetMessagesFromIDs selects time of each message by id and then message itself from partition of its bucket
+func (c *Cassandra) GetMessagesFromIDs(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) ([]message.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	scanner := c.read(ctx, selectTimesOfMessages, roomID.String(), uuid.ToStrings(messageIDs)).Iter().Scanner()
+	messages, err := c.scanMessagesAt(ctx, roomID, scanner)
+	if err != nil {
+		return nil, fmt.Errorf("get messages from ids: %w", err)
+	}
+	return messages, nil
+}
+
+// GetReplies selects ids of replies from partition of room replies and then messages themselves
+func (c *Cassandra) GetReplies(ctx context.Context, roomID, messageID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	after.Time = sinceEpoch(after.Time)
+	// Cassandra keeps time with millisecond precision
+	after = after.truncate(time.Millisecond)
+
+	scanner := c.read(ctx, selectReplies, roomID.String(), messageID.String(), after.Time, after.ID.String(),
+		limit).Iter().Scanner()
+	messages, err := c.scanMessagesAt(ctx, roomID, scanner)
+	if err != nil {
+		return nil, fmt.Errorf("get replies: %w", err)
+	}
+	return messages, nil
+}
+
+// scanMessagesAt scans rows selected as id, time and selects each message, messages which are not found are skipped
+func (c *Cassandra) scanMessagesAt(ctx context.Context, roomID uuid.UUID,
+	scanner gocql.Scanner) ([]message.Message, error) {
+	var messages []message.Message
+	for scanner.Next() {
+		var messageIDStr string
+		var t time.Time
+		if err := scanner.Scan(&messageIDStr, &t); err != nil {
+			return nil, fmt.Errorf("scan message time: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+
+		msg, err := c.getMessageAt(ctx, roomID, messageID, t)
+		if errors.Is(err, ErrorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("message %s: %w", messageID, err)
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan message times: %w", err)
+	}
+	return messages, nil
+}
+
+// GetReplyCounts counts selected replies, like reactions replies of all messages of room are stored in one partition
+func (c *Cassandra) GetReplyCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	scanner := c.read(ctx, selectReplyCounts, roomID.String(), uuid.ToStrings(messageIDs)).Iter().Scanner()
+	for scanner.Next() {
+		var messageIDStr string
+		if err := scanner.Scan(&messageIDStr); err != nil {
+			return nil, fmt.Errorf("scan reply: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+		counts[messageID]++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan replies: %w", err)
+	}
+	return counts, nil
+}
+
+func (c *Cassandra) EditMessage(ctx context.Context, roomID, messageID uuid.UUID, text string,
+	editedAt time.Time) error {
+	if err := c.updateMessage(ctx, roomID, messageID, editedAt, updateMessageText, text, editedAt); err != nil {
+		return fmt.Errorf("edit message: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) DeleteMessage(ctx context.Context, roomID, messageID uuid.UUID, deletedAt time.Time) error {
+	if err := c.updateMessage(ctx, roomID, messageID, deletedAt, updateMessageDeleted, deletedAt); err != nil {
+		return fmt.Errorf("delete message: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) UpdateMessage(ctx context.Context, roomID, messageID uuid.UUID, updatedAt time.Time) error {
+	if err := c.updateMessage(ctx, roomID, messageID, updatedAt, updateMessageTime); err != nil {
+		return fmt.Errorf("update message: %w", err)
+	}
+	return nil
+}
+
+// updateMessage executes update query of existing message with given values followed by time of update and primary
+// key of message, returns ErrorNotFound if there is no such message, update is saved to edits before the message,
+// so it's never lost, updates which weren't applied are skipped by GetUpdatedMessages
+func (c *Cassandra) updateMessage(ctx context.Context, roomID, messageID uuid.UUID, updatedAt time.Time,
+	query string, values ...interface{}) error {
+	t, err := c.GetMessageTime(ctx, roomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	batch := c.writeBatch(ctx)
+	editBucket := c.bucketOf(updatedAt)
+	batch.Query(insertEdit, roomID.String(), editBucket, updatedAt, messageID.String())
+	batch.Query(insertEditBucket, roomID.String(), editBucket)
+	if err = c.session.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("save update of message %s: %w", messageID, err)
+	}
+
+	values = append(values, updatedAt, roomID.String(), c.bucketOf(t), t, messageID.String())
+	applied, err := c.write(ctx, query, values...).ScanCAS()
+	if err != nil {
+		return fmt.Errorf("update message %s: %w", messageID, err)
+	}
+	if !applied {
+		return fmt.Errorf("update message %s: %w", messageID, ErrorNotFound)
+	}
+	return nil
+}
+
+// GetUpdatedMessages walks partitions of edits between buckets of given times and selects each updated message,
+// edits which don't match time of the latest update of message are skipped
+func (c *Cassandra) GetUpdatedMessages(ctx context.Context, roomID uuid.UUID, after, until time.Time,
+	limit uint) ([]message.Message, error) {
+	// Cassandra keeps time with millisecond precision
+	after = sinceEpoch(after).Truncate(time.Millisecond)
+	until = sinceEpoch(until).Truncate(time.Millisecond)
+	buckets := c.read(ctx, selectEditBucketsAfter, roomID.String(), c.bucketOf(after), c.bucketOf(until)).Iter().
+		Scanner()
+
+	var messages []message.Message
+	for uint(len(messages)) < limit && buckets.Next() {
+		var bucket time.Time
+		if err := buckets.Scan(&bucket); err != nil {
+			return nil, fmt.Errorf("get updated messages: scan bucket: %w", err)
+		}
+
+		edits := c.read(ctx, selectEdits, roomID.String(), bucket, after, until).Iter().Scanner()
+		bucketMessages, err := c.scanUpdatedMessages(ctx, roomID, edits, limit-uint(len(messages)))
+		if err != nil {
+			return nil, fmt.Errorf("get updated messages: bucket %s: %w", bucket.Format(time.RFC3339), err)
+		}
+		messages = append(messages, bucketMessages...)
+	}
+
+	if err := buckets.Err(); err != nil {
+		return nil, fmt.Errorf("get updated messages: scan buckets: %w", err)
+	}
+	return messages, nil
+}
+
+// scanUpdatedMessages scans up to limit rows selected as id, editedAt and selects messages which were last updated
+// at that time
+func (c *Cassandra) scanUpdatedMessages(ctx context.Context, roomID uuid.UUID, scanner gocql.Scanner,
+	limit uint) ([]message.Message, error) {
+	var messages []message.Message
+	for uint(len(messages)) < limit && scanner.Next() {
+		var messageIDStr string
+		var editedAt time.Time
+		if err := scanner.Scan(&messageIDStr, &editedAt); err != nil {
+			return nil, fmt.Errorf("scan edit: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+
+		msg, err := c.GetMessage(ctx, roomID, messageID)
+		if errors.Is(err, ErrorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if msg.UpdatedAt == nil || !msg.UpdatedAt.Equal(editedAt) {
+			continue
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan edits: %w", err)
+	}
+	return messages, nil
+}
+
+func (c *Cassandra) AddReaction(ctx context.Context, r *reaction.Reaction) error {
+	err := c.write(ctx, insertReaction, r.RoomID.String(), r.MessageID.String(), r.Emoji, r.UserID.String()).Exec()
+	if err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) RemoveReaction(ctx context.Context, r *reaction.Reaction) error {
+	applied, err := c.write(ctx, deleteReaction, r.RoomID.String(), r.MessageID.String(), r.Emoji,
+		r.UserID.String()).ScanCAS()
+	if err != nil {
+		return fmt.Errorf("remove reaction %q: %w", r.Emoji, err)
+	}
+	if !applied {
+		return fmt.Errorf("remove reaction %q: %w", r.Emoji, ErrorNotFound)
+	}
+	return nil
+}
+
+// GetReactionCounts counts selected reactions, reactions of all messages of room are stored in one partition,
+// so it's cheaper than counting them in every partition of message
+func (c *Cassandra) GetReactionCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]reaction.Counts, error) {
+	counts := make(map[uuid.UUID]reaction.Counts)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	scanner := c.read(ctx, selectReactions, roomID.String(), uuid.ToStrings(messageIDs)).Iter().Scanner()
+	for scanner.Next() {
+		var messageIDStr, emoji string
+		if err := scanner.Scan(&messageIDStr, &emoji); err != nil {
+			return nil, fmt.Errorf("scan reaction: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+		addReactionCount(counts, messageID, emoji, 1)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan reactions: %w", err)
+	}
+	return counts, nil
+}
+
+func (c *Cassandra) IsRoomExist(ctx context.Context, roomID uuid.UUID) (bool, error) {
 	var exist int
-	if err := c.session.Query(selectIfRoomExist, roomID.String()).Scan(&exist); err != nil {
+	if err := c.read(ctx, selectIfRoomExist, roomID.String()).Scan(&exist); err != nil {
 		return false, fmt.Errorf("check room: %w", err)
 	}
 	return exist >= 1, nil
 }
+
+func (c *Cassandra) GetRoom(ctx context.Context, roomID uuid.UUID) (*room.Room, error) {
+	r, err := scanRoom(c.read(ctx, selectRoom, roomID.String()))
+	if err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			err = ErrorNotFound
+		}
+		return nil, fmt.Errorf("get room %s: %w", roomID, err)
+	}
+	return r, nil
+}
+
+func (c *Cassandra) GetRooms(ctx context.Context) ([]room.Room, error) {
+	scanner := c.read(ctx, selectRooms).Iter().Scanner()
+
+	var rooms []room.Room
+	for scanner.Next() {
+		r, err := scanRoom(scanner)
+		if err != nil {
+			return nil, fmt.Errorf("scan room: %w", err)
+		}
+		rooms = append(rooms, *r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+func (c *Cassandra) CreateRoom(ctx context.Context, r *room.Room) error {
+	if err := c.write(ctx, insertRoomIfAbsent, r.ID.String(), r.Direct, r.Private).Exec(); err != nil {
+		return fmt.Errorf("create room: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) AddRoomMembers(ctx context.Context, roomID uuid.UUID, userIDs []uuid.UUID) error {
+	batch := c.writeBatch(ctx)
+	for _, userID := range userIDs {
+		batch.Query(insertRoomMember, roomID.String(), userID.String())
+	}
+
+	if err := c.session.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("add room members: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	var member int
+	if err := c.read(ctx, selectIfRoomMember, roomID.String(), userID.String()).Scan(&member); err != nil {
+		return false, fmt.Errorf("check room member: %w", err)
+	}
+	return member >= 1, nil
+}
+
+func (c *Cassandra) GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]room.Member, error) {
+	mutes, err := c.getRoomMutes(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := c.read(ctx, selectRoomMembers, roomID.String()).Iter().Scanner()
+
+	var members []room.Member
+	for scanner.Next() {
+		member, err := scanCassandraMember(scanner)
+		if err != nil {
+			return nil, err
+		}
+		if until, ok := mutes[member.UserID]; ok {
+			member.MutedUntil = &until
+		}
+		members = append(members, *member)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan room members: %w", err)
+	}
+	return members, nil
+}
+
+// getRoomMutes returns ends of mutes in room by user id
+func (c *Cassandra) getRoomMutes(ctx context.Context, roomID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	scanner := c.read(ctx, selectRoomMutes, roomID.String()).Iter().Scanner()
+
+	mutes := make(map[uuid.UUID]time.Time)
+	for scanner.Next() {
+		var userIDStr string
+		var until time.Time
+		if err := scanner.Scan(&userIDStr, &until); err != nil {
+			return nil, fmt.Errorf("scan mute: %w", err)
+		}
+
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("muted user id: %w", err)
+		}
+		mutes[userID] = until
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan mutes: %w", err)
+	}
+	return mutes, nil
+}
+
+func (c *Cassandra) RemoveRoomMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := c.write(ctx, deleteRoomMember, roomID.String(), userID.String()).Exec(); err != nil {
+		return fmt.Errorf("remove room member: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoom deletes messages & edits of room in batches of bucket partitions and then everything else in one batch,
+// room itself is deleted last, so failed deletion can be retried
+func (c *Cassandra) DeleteRoom(ctx context.Context, roomID uuid.UUID) error {
+	batch, err := c.deleteBuckets(ctx, c.writeBatch(ctx), roomID, selectRoomBuckets, deleteBucketMessages)
+	if err != nil {
+		return fmt.Errorf("delete room messages: %w", err)
+	}
+	batch, err = c.deleteBuckets(ctx, batch, roomID, selectRoomEditBuckets, deleteBucketEdits)
+	if err != nil {
+		return fmt.Errorf("delete room edits: %w", err)
+	}
+
+	batch.Query(deleteRoomBuckets, roomID.String())
+	batch.Query(deleteRoomEditBuckets, roomID.String())
+	batch.Query(deleteRoomMessagesByID, roomID.String())
+	batch.Query(deleteRoomReactions, roomID.String())
+	batch.Query(deleteRoomReplies, roomID.String())
+	batch.Query(deleteRoomMembers, roomID.String())
+	batch.Query(deleteRoomMutes, roomID.String())
+	batch.Query(deleteRoomBans, roomID.String())
+	batch.Query(deleteRoomActions, roomID.String())
+	batch.Query(deleteRoom, roomID.String())
+
+	if err = c.session.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+	return nil
+}
+
+// deleteBuckets adds deletion of each bucket partition selected by bucketsQuery to batch, batch is executed every
+// time it reaches deleteBucketsBatchSize queries, returns batch with the rest of deletions
+func (c *Cassandra) deleteBuckets(ctx context.Context, batch *gocql.Batch, roomID uuid.UUID, bucketsQuery,
+	deleteQuery string) (*gocql.Batch, error) {
+	buckets := c.read(ctx, bucketsQuery, roomID.String()).Iter().Scanner()
+	for buckets.Next() {
+		var bucket time.Time
+		if err := buckets.Scan(&bucket); err != nil {
+			return nil, fmt.Errorf("scan bucket: %w", err)
+		}
+		batch.Query(deleteQuery, roomID.String(), bucket)
+
+		if batch.Size() == deleteBucketsBatchSize {
+			if err := c.session.ExecuteBatch(batch); err != nil {
+				return nil, err
+			}
+			batch = c.writeBatch(ctx)
+		}
+	}
+	if err := buckets.Err(); err != nil {
+		return nil, fmt.Errorf("scan buckets: %w", err)
+	}
+	return batch, nil
+}
+
+// scanCassandraMember scans row selected as userID, role, members added before roles were introduced
+// have null role and are scanned as room.RoleMember
+func scanCassandraMember(row rowScanner) (*room.Member, error) {
+	var userIDStr string
+	var member room.Member
+	if err := row.Scan(&userIDStr, &member.Role); err != nil {
+		return nil, fmt.Errorf("scan room member: %w", err)
+	}
+
+	var err error
+	member.UserID, err = uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("room member id: %w", err)
+	}
+	if member.Role == "" {
+		member.Role = room.RoleMember
+	}
+	return &member, nil
+}
+
+func (c *Cassandra) GetRoomMember(ctx context.Context, roomID, userID uuid.UUID) (*room.Member, error) {
+	member, err := scanCassandraMember(c.read(ctx, selectRoomMember, roomID.String(), userID.String()))
+	if err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			err = ErrorNotFound
+		}
+		return nil, fmt.Errorf("get room member %s: %w", userID, err)
+	}
+
+	var until time.Time
+	err = c.read(ctx, selectMute, roomID.String(), userID.String()).Scan(&until)
+	switch {
+	case err == nil:
+		member.MutedUntil = &until
+	case !errors.Is(err, gocql.ErrNotFound):
+		return nil, fmt.Errorf("get mute of room member %s: %w", userID, err)
+	}
+	return member, nil
+}
+
+func (c *Cassandra) UpdateRoomMember(ctx context.Context, roomID uuid.UUID, member *room.Member) error {
+	applied, err := c.write(ctx, updateRoomMember, member.Role, roomID.String(), member.UserID.String()).ScanCAS()
+	if err != nil {
+		return fmt.Errorf("update room member %s: %w", member.UserID, err)
+	}
+	if !applied {
+		return fmt.Errorf("update room member %s: %w", member.UserID, ErrorNotFound)
+	}
+	return nil
+}
+
+func (c *Cassandra) MuteUser(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error {
+	if err := c.write(ctx, insertMute, roomID.String(), userID.String(), until).Exec(); err != nil {
+		return fmt.Errorf("mute user: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) UnmuteUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := c.write(ctx, deleteMute, roomID.String(), userID.String()).Exec(); err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) BanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := c.write(ctx, insertBan, roomID.String(), userID.String()).Exec(); err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) UnbanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := c.write(ctx, deleteBan, roomID.String(), userID.String()).Exec(); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+	return nil
+}
+
+func (c *Cassandra) IsBanned(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	var banned int
+	if err := c.read(ctx, selectIfBanned, roomID.String(), userID.String()).Scan(&banned); err != nil {
+		return false, fmt.Errorf("check ban: %w", err)
+	}
+	return banned >= 1, nil
+}
+
+func (c *Cassandra) SaveModerationAction(ctx context.Context, action *moderation.Action) error {
+	var moderatorID *string
+	if action.ModeratorID != nil {
+		id := action.ModeratorID.String()
+		moderatorID = &id
+	}
+
+	err := c.write(ctx, insertAction, action.RoomID.String(), action.Time, action.ID.String(), moderatorID,
+		action.TargetID.String(), action.Kind, action.Role, action.Until).Exec()
+	if err != nil {
+		return fmt.Errorf("save moderation action: %w", err)
+	}
+	return nil
+}
+
+// GetModerationActions relies on clustering order of moderation_actions table to select the newest actions first
+func (c *Cassandra) GetModerationActions(ctx context.Context, roomID uuid.UUID,
+	limit uint) ([]moderation.Action, error) {
+	scanner := c.read(ctx, selectActions, roomID.String(), limit).Iter().Scanner()
+
+	var actions []moderation.Action
+	for scanner.Next() {
+		action, err := scanCassandraAction(scanner)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, *action)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan moderation actions: %w", err)
+	}
+	return actions, nil
+}
+
+// scanCassandraAction scans row selected as id, roomID, moderatorID, targetID, kind, role, until, time
+func scanCassandraAction(row rowScanner) (*moderation.Action, error) {
+	var actionIDStr, roomIDStr, moderatorIDStr, targetIDStr string
+	var until *time.Time
+	var action moderation.Action
+	err := row.Scan(&actionIDStr, &roomIDStr, &moderatorIDStr, &targetIDStr, &action.Kind, &action.Role, &until,
+		&action.Time)
+	if err != nil {
+		return nil, fmt.Errorf("scan moderation action: %w", err)
+	}
+
+	action.ID, err = uuid.Parse(actionIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("action id: %w", err)
+	}
+	action.RoomID, err = uuid.Parse(roomIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("room id: %w", err)
+	}
+	action.TargetID, err = uuid.Parse(targetIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("target id: %w", err)
+	}
+	// Null uuid is scanned as empty string
+	if moderatorIDStr != "" {
+		id, err := uuid.Parse(moderatorIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("moderator id: %w", err)
+		}
+		action.ModeratorID = &id
+	}
+	action.Until = until
+	return &action, nil
+}
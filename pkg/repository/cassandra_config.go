@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// Replication strategies of Cassandra keyspace
+const (
+	SimpleStrategy          = "SimpleStrategy"
+	NetworkTopologyStrategy = "NetworkTopologyStrategy"
+)
+
+// keyspaceRegex matches valid unquoted name of Cassandra keyspace
+var keyspaceRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,47}$`)
+
+// CassandraConfig configures connection to Cassandra cluster and layout of keyspace
+type CassandraConfig struct {
+	// Hosts are contact points of cluster, other nodes are discovered automatically
+	Hosts    []string
+	Username string
+	Password string
+
+	// Keyspace where all tables are stored
+	Keyspace string
+	// ReplicationClass is replication strategy used when keyspace is created, SimpleStrategy
+	// or NetworkTopologyStrategy
+	ReplicationClass string
+	// ReplicationFactor is a number of replicas for SimpleStrategy
+	ReplicationFactor int
+	// DataCenters is a number of replicas in each data center for NetworkTopologyStrategy
+	DataCenters map[string]int
+
+	// ReadConsistency and WriteConsistency are consistency levels of queries, e.g. ONE, QUORUM or LOCAL_QUORUM
+	ReadConsistency  string
+	WriteConsistency string
+
+	ProtoVersion   int
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+
+	// Retries is a number of retries of failed query with exponential backoff between
+	// RetryMinBackoff and RetryMaxBackoff, zero disables retries
+	Retries         int
+	RetryMinBackoff time.Duration
+	RetryMaxBackoff time.Duration
+
+	// TLS enables encryption of connections, TLSCAFile, TLSCertFile and TLSKeyFile are optional
+	TLS           bool
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSkipVerify bool
+
+	// BucketPeriod is a period of time covered by one partition of room messages,
+	// it must not be changed after messages were saved
+	BucketPeriod time.Duration
+}
+
+// DefaultCassandraConfig returns config for local single node cluster
+func DefaultCassandraConfig() CassandraConfig {
+	return CassandraConfig{
+		Hosts:             []string{"localhost"},
+		Keyspace:          "glynn",
+		ReplicationClass:  SimpleStrategy,
+		ReplicationFactor: 1,
+		ReadConsistency:   gocql.One.String(),
+		WriteConsistency:  gocql.One.String(),
+		ProtoVersion:      4,
+		Timeout:           11 * time.Second,
+		ConnectTimeout:    11 * time.Second,
+		RetryMinBackoff:   100 * time.Millisecond,
+		RetryMaxBackoff:   10 * time.Second,
+		BucketPeriod:      DefaultBucketPeriod,
+	}
+}
+
+// validate checks values which are not checked by gocql
+func (cfg *CassandraConfig) validate() error {
+	if len(cfg.Hosts) == 0 {
+		return errors.New("no hosts")
+	}
+	if !keyspaceRegex.MatchString(cfg.Keyspace) {
+		return fmt.Errorf("invalid keyspace name: %q", cfg.Keyspace)
+	}
+	if cfg.BucketPeriod <= 0 {
+		return fmt.Errorf("invalid bucket period: %s", cfg.BucketPeriod)
+	}
+	if cfg.Retries < 0 {
+		return fmt.Errorf("invalid number of retries: %d", cfg.Retries)
+	}
+	if _, err := cfg.replication(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// replication returns replication options of keyspace in CQL map format
+func (cfg *CassandraConfig) replication() (string, error) {
+	switch cfg.ReplicationClass {
+	case SimpleStrategy:
+		if cfg.ReplicationFactor < 1 {
+			return "", fmt.Errorf("invalid replication factor: %d", cfg.ReplicationFactor)
+		}
+		return fmt.Sprintf("{ 'class' : '%s', 'replication_factor' : %d }", SimpleStrategy, cfg.ReplicationFactor),
+			nil
+	case NetworkTopologyStrategy:
+		if len(cfg.DataCenters) == 0 {
+			return "", errors.New("no data centers")
+		}
+
+		dataCenters := make([]string, 0, len(cfg.DataCenters))
+		for dc := range cfg.DataCenters {
+			dataCenters = append(dataCenters, dc)
+		}
+		sort.Strings(dataCenters)
+
+		options := []string{fmt.Sprintf("'class' : '%s'", NetworkTopologyStrategy)}
+		for _, dc := range dataCenters {
+			factor := cfg.DataCenters[dc]
+			if factor < 1 || strings.ContainsAny(dc, `'\`) {
+				return "", fmt.Errorf("invalid replication of data center %q: %d", dc, factor)
+			}
+			options = append(options, fmt.Sprintf("'%s' : %d", dc, factor))
+		}
+		return "{ " + strings.Join(options, ", ") + " }", nil
+	default:
+		return "", fmt.Errorf("unknown replication class: %q", cfg.ReplicationClass)
+	}
+}
+
+// clusterConfig returns gocql config of cluster without keyspace set
+func (cfg *CassandraConfig) clusterConfig() (*gocql.ClusterConfig, error) {
+	readConsistency, err := gocql.ParseConsistencyWrapper(cfg.ReadConsistency)
+	if err != nil {
+		return nil, fmt.Errorf("read consistency: %w", err)
+	}
+
+	cluster := gocql.NewCluster(cfg.Hosts...)
+	if cfg.Username != "" || cfg.Password != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: cfg.Username, Password: cfg.Password}
+	}
+	cluster.ProtoVersion = cfg.ProtoVersion
+	cluster.Consistency = readConsistency
+	cluster.Timeout = cfg.Timeout
+	cluster.ConnectTimeout = cfg.ConnectTimeout
+
+	if cfg.Retries > 0 {
+		cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+			NumRetries: cfg.Retries,
+			Min:        cfg.RetryMinBackoff,
+			Max:        cfg.RetryMaxBackoff,
+		}
+	}
+
+	if cfg.TLS {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.TLSCAFile,
+			CertPath:               cfg.TLSCertFile,
+			KeyPath:                cfg.TLSKeyFile,
+			EnableHostVerification: !cfg.TLSSkipVerify,
+		}
+	}
+	return cluster, nil
+}
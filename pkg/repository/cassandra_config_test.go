@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassandraConfig_validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *CassandraConfig)
+		ok     bool
+	}{
+		{name: "default", change: func(cfg *CassandraConfig) {}, ok: true},
+		{name: "no hosts", change: func(cfg *CassandraConfig) { cfg.Hosts = nil }, ok: false},
+		{name: "empty keyspace", change: func(cfg *CassandraConfig) { cfg.Keyspace = "" }, ok: false},
+		{name: "quoted keyspace", change: func(cfg *CassandraConfig) { cfg.Keyspace = `glynn"; DROP` }, ok: false},
+		{name: "zero bucket period", change: func(cfg *CassandraConfig) { cfg.BucketPeriod = 0 }, ok: false},
+		{name: "negative retries", change: func(cfg *CassandraConfig) { cfg.Retries = -1 }, ok: false},
+		{name: "unknown replication", change: func(cfg *CassandraConfig) { cfg.ReplicationClass = "Local" }, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCassandraConfig()
+			tt.change(&cfg)
+
+			err := cfg.validate()
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCassandraConfig_replication(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      CassandraConfig
+		expected string
+		ok       bool
+	}{
+		{
+			name:     "simple",
+			cfg:      CassandraConfig{ReplicationClass: SimpleStrategy, ReplicationFactor: 3},
+			expected: "{ 'class' : 'SimpleStrategy', 'replication_factor' : 3 }",
+			ok:       true,
+		},
+		{
+			name: "simple zero factor",
+			cfg:  CassandraConfig{ReplicationClass: SimpleStrategy},
+			ok:   false,
+		},
+		{
+			name: "network topology",
+			cfg: CassandraConfig{
+				ReplicationClass: NetworkTopologyStrategy,
+				DataCenters:      map[string]int{"eu-west": 3, "dc1": 2},
+			},
+			expected: "{ 'class' : 'NetworkTopologyStrategy', 'dc1' : 2, 'eu-west' : 3 }",
+			ok:       true,
+		},
+		{
+			name: "network topology no data centers",
+			cfg:  CassandraConfig{ReplicationClass: NetworkTopologyStrategy},
+			ok:   false,
+		},
+		{
+			name: "network topology zero factor",
+			cfg: CassandraConfig{
+				ReplicationClass: NetworkTopologyStrategy,
+				DataCenters:      map[string]int{"dc1": 0},
+			},
+			ok: false,
+		},
+		{
+			name: "network topology quoted data center",
+			cfg: CassandraConfig{
+				ReplicationClass: NetworkTopologyStrategy,
+				DataCenters:      map[string]int{"dc1' : 1}; --": 1},
+			},
+			ok: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := tt.cfg.replication()
+			if tt.ok {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, actual)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCassandraConfig_clusterConfig(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		cfg := DefaultCassandraConfig()
+
+		cluster, err := cfg.clusterConfig()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"localhost"}, cluster.Hosts)
+		assert.Nil(t, cluster.Authenticator)
+		assert.Equal(t, 4, cluster.ProtoVersion)
+		assert.Equal(t, gocql.One, cluster.Consistency)
+		assert.Empty(t, cluster.Keyspace)
+		assert.Nil(t, cluster.SslOpts)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		cfg := DefaultCassandraConfig()
+		cfg.Hosts = []string{"node1", "node2:9043"}
+		cfg.Username = "user"
+		cfg.Password = "pass"
+		cfg.ReadConsistency = "local_quorum"
+		cfg.Timeout = time.Second
+		cfg.ConnectTimeout = 2 * time.Second
+		cfg.Retries = 3
+		cfg.TLS = true
+		cfg.TLSCAFile = "ca.pem"
+		cfg.TLSSkipVerify = true
+
+		cluster, err := cfg.clusterConfig()
+		require.NoError(t, err)
+		assert.Equal(t, cfg.Hosts, cluster.Hosts)
+		assert.Equal(t, gocql.PasswordAuthenticator{Username: "user", Password: "pass"}, cluster.Authenticator)
+		assert.Equal(t, gocql.LocalQuorum, cluster.Consistency)
+		assert.Equal(t, time.Second, cluster.Timeout)
+		assert.Equal(t, 2*time.Second, cluster.ConnectTimeout)
+		assert.Equal(t, &gocql.ExponentialBackoffRetryPolicy{
+			NumRetries: 3,
+			Min:        cfg.RetryMinBackoff,
+			Max:        cfg.RetryMaxBackoff,
+		}, cluster.RetryPolicy)
+		assert.Equal(t, &gocql.SslOptions{CaPath: "ca.pem", EnableHostVerification: false}, cluster.SslOpts)
+	})
+
+	t.Run("invalid consistency", func(t *testing.T) {
+		cfg := DefaultCassandraConfig()
+		cfg.ReadConsistency = "MOST"
+
+		_, err := cfg.clusterConfig()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/repository/migration"
+)
+
+const (
+	createSchemaVersionTable = "CREATE TABLE IF NOT EXISTS schema_version " +
+		"(version int PRIMARY KEY, description text, appliedAt timestamp);"
+	selectSchemaVersions = "SELECT version, appliedAt FROM schema_version;"
+	insertSchemaVersion  = "INSERT INTO schema_version (version, description, appliedAt) VALUES (?, ?, ?);"
+	deleteSchemaVersion  = "DELETE FROM schema_version WHERE version = ?;"
+
+	createUsersTable           = "CREATE TABLE IF NOT EXISTS users (id uuid PRIMARY KEY, username text);"
+	createUsersByUsernameTable = "CREATE TABLE IF NOT EXISTS users_by_username (username text PRIMARY KEY, id uuid);"
+	createTokensTable          = "CREATE TABLE IF NOT EXISTS tokens (hash text PRIMARY KEY, userID uuid);"
+	createRoomsTable           = "CREATE TABLE IF NOT EXISTS rooms (id uuid PRIMARY KEY);"
+	createMessagesTable        = "CREATE TABLE IF NOT EXISTS room_messages " +
+		"(roomID uuid, bucket timestamp, time timestamp, id uuid, userID uuid, text text, " +
+		"PRIMARY KEY ((roomID, bucket), time, id)) WITH CLUSTERING ORDER BY (time DESC, id DESC);"
+	createMessageBucketsTable = "CREATE TABLE IF NOT EXISTS message_buckets " +
+		"(roomID uuid, bucket timestamp, PRIMARY KEY (roomID, bucket)) WITH CLUSTERING ORDER BY (bucket DESC);"
+	createMessagesByIDTable = "CREATE TABLE IF NOT EXISTS messages_by_id " +
+		"(roomID uuid, id uuid, time timestamp, PRIMARY KEY (roomID, id));"
+
+	createReactionsTable = "CREATE TABLE IF NOT EXISTS message_reactions " +
+		"(roomID uuid, messageID uuid, emoji text, userID uuid, PRIMARY KEY (roomID, messageID, emoji, userID));"
+
+	createRepliesTable = "CREATE TABLE IF NOT EXISTS message_replies " +
+		"(roomID uuid, replyTo uuid, time timestamp, id uuid, PRIMARY KEY (roomID, replyTo, time, id));"
+
+	createRoomMembersTable = "CREATE TABLE IF NOT EXISTS room_members " +
+		"(roomID uuid, userID uuid, PRIMARY KEY (roomID, userID));"
+
+	createRoomBansTable = "CREATE TABLE IF NOT EXISTS room_bans " +
+		"(roomID uuid, userID uuid, PRIMARY KEY (roomID, userID));"
+	createActionsTable = "CREATE TABLE IF NOT EXISTS moderation_actions " +
+		"(roomID uuid, time timestamp, id uuid, moderatorID uuid, targetID uuid, kind text, role text, " +
+		"until timestamp, PRIMARY KEY (roomID, time, id)) WITH CLUSTERING ORDER BY (time DESC, id DESC);"
+
+	createMessageEditsTable = "CREATE TABLE IF NOT EXISTS message_edits " +
+		"(roomID uuid, bucket timestamp, editedAt timestamp, id uuid, PRIMARY KEY ((roomID, bucket), editedAt, id));"
+	createMessageEditBucketsTable = "CREATE TABLE IF NOT EXISTS message_edit_buckets " +
+		"(roomID uuid, bucket timestamp, PRIMARY KEY (roomID, bucket));"
+
+	createRoomMutesTable = "CREATE TABLE IF NOT EXISTS room_mutes " +
+		"(roomID uuid, userID uuid, until timestamp, PRIMARY KEY (roomID, userID));"
+
+	dropUsersTable           = "DROP TABLE IF EXISTS users;"
+	dropUsersByUsernameTable = "DROP TABLE IF EXISTS users_by_username;"
+	dropTokensTable          = "DROP TABLE IF EXISTS tokens;"
+	dropRoomsTable           = "DROP TABLE IF EXISTS rooms;"
+	dropMessagesTable        = "DROP TABLE IF EXISTS room_messages;"
+	dropMessageBucketsTable  = "DROP TABLE IF EXISTS message_buckets;"
+	dropMessagesByIDTable    = "DROP TABLE IF EXISTS messages_by_id;"
+
+	dropReactionsTable = "DROP TABLE IF EXISTS message_reactions;"
+
+	dropRepliesTable = "DROP TABLE IF EXISTS message_replies;"
+
+	dropRoomMembersTable = "DROP TABLE IF EXISTS room_members;"
+
+	dropActionsTable  = "DROP TABLE IF EXISTS moderation_actions;"
+	dropRoomBansTable = "DROP TABLE IF EXISTS room_bans;"
+
+	dropMessageEditBucketsTable = "DROP TABLE IF EXISTS message_edit_buckets;"
+	dropMessageEditsTable       = "DROP TABLE IF EXISTS message_edits;"
+
+	dropRoomMutesTable = "DROP TABLE IF EXISTS room_mutes;"
+
+	selectTableExist  = "SELECT count(*) FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?;"
+	selectColumnExist = "SELECT count(*) FROM system_schema.columns " +
+		"WHERE keyspace_name = ? AND table_name = ? AND column_name = ?;"
+	addColumnQuery            = "ALTER TABLE %s ADD %s %s;"
+	dropColumnQuery           = "ALTER TABLE %s DROP %s;"
+	selectLegacyMessagesQuery = "SELECT id, roomID, userID, text, time FROM %s;"
+	insertLegacyMessage       = "INSERT INTO room_messages (roomID, bucket, time, id, userID, text) " +
+		"VALUES (?, ?, ?, ?, ?, ?);"
+	selectMembersMutes   = "SELECT roomID, userID, mutedUntil FROM room_members;"
+	selectAllMutes       = "SELECT roomID, userID, until FROM room_mutes;"
+	updateMemberIfExists = "UPDATE room_members SET mutedUntil = ? WHERE roomID = ? AND userID = ? IF EXISTS;"
+)
+
+// tableColumn is a column added to existing table by migration
+type tableColumn struct {
+	table string
+	name  string
+	kind  string
+}
+
+// Columns added to tables after they were created
+var (
+	messageEditedAtColumn  = tableColumn{table: "room_messages", name: "editedAt", kind: "timestamp"}
+	messageDeletedColumn   = tableColumn{table: "room_messages", name: "deleted", kind: "boolean"}
+	messageReplyToColumn   = tableColumn{table: "room_messages", name: "replyTo", kind: "uuid"}
+	roomDirectColumn       = tableColumn{table: "rooms", name: "direct", kind: "boolean"}
+	roomPrivateColumn      = tableColumn{table: "rooms", name: "private", kind: "boolean"}
+	memberRoleColumn       = tableColumn{table: "room_members", name: "role", kind: "text"}
+	memberMutedUntilColumn = tableColumn{table: "room_members", name: "mutedUntil", kind: "timestamp"}
+	messageUpdatedAtColumn = tableColumn{table: "room_messages", name: "updatedAt", kind: "timestamp"}
+)
+
+// legacyMessagesTables are tables where messages were stored before migrations were introduced, messages
+// of the same room sent at the same time were overwriting each other in all of them
+var legacyMessagesTables = []string{
+	"messages",           // Single partition per room
+	"messages_by_bucket", // Partition per room & bucket
+}
+
+// migrations returns all changes of Cassandra schema, new migrations must be added with the next version
+// and never changed after release, Cassandra has no transactions, so migrations must be idempotent to be applied
+// again if saving their version fails
+func (c *Cassandra) migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version:     1,
+			Description: "create users, tokens, rooms & messages tables",
+			// Tables may already exist if they were created before migrations were introduced
+			Up: c.execAll(createUsersTable, createUsersByUsernameTable, createTokensTable, createRoomsTable,
+				createMessagesTable, createMessageBucketsTable, createMessagesByIDTable),
+			Down: c.execAll(dropMessagesByIDTable, dropMessageBucketsTable, dropMessagesTable, dropRoomsTable,
+				dropTokensTable, dropUsersByUsernameTable, dropUsersTable),
+		},
+		{
+			Version:     2,
+			Description: "copy messages from legacy tables",
+			Up:          c.migrateLegacyMessages,
+			// Legacy tables are kept and copied messages are dropped with tables of version 1
+			Down: func(context.Context, migration.Tx) error { return nil },
+		},
+		{
+			Version:     3,
+			Description: "add edit time & deleted flag to messages",
+			Up:          c.addColumns(messageEditedAtColumn, messageDeletedColumn),
+			Down:        c.dropColumns(messageEditedAtColumn, messageDeletedColumn),
+		},
+		{
+			Version:     4,
+			Description: "create reactions table",
+			Up:          c.execAll(createReactionsTable),
+			Down:        c.execAll(dropReactionsTable),
+		},
+		{
+			Version:     5,
+			Description: "add replies to messages",
+			Up:          inOrder(c.addColumns(messageReplyToColumn), c.execAll(createRepliesTable)),
+			Down:        inOrder(c.execAll(dropRepliesTable), c.dropColumns(messageReplyToColumn)),
+		},
+		{
+			Version:     6,
+			Description: "add direct rooms & room members",
+			Up:          inOrder(c.addColumns(roomDirectColumn), c.execAll(createRoomMembersTable)),
+			Down:        inOrder(c.execAll(dropRoomMembersTable), c.dropColumns(roomDirectColumn)),
+		},
+		{
+			Version:     7,
+			Description: "add private rooms",
+			Up:          c.addColumns(roomPrivateColumn),
+			Down:        c.dropColumns(roomPrivateColumn),
+		},
+		{
+			Version:     8,
+			Description: "add member roles & mutes, bans & moderation log",
+			Up: inOrder(c.addColumns(memberRoleColumn, memberMutedUntilColumn),
+				c.execAll(createRoomBansTable, createActionsTable)),
+			Down: inOrder(c.execAll(dropActionsTable, dropRoomBansTable),
+				c.dropColumns(memberRoleColumn, memberMutedUntilColumn)),
+		},
+		{
+			Version:     9,
+			Description: "create message edits tables",
+			// Messages edited before are not returned as edited
+			Up:   c.execAll(createMessageEditsTable, createMessageEditBucketsTable),
+			Down: c.execAll(dropMessageEditBucketsTable, dropMessageEditsTable),
+		},
+		{
+			Version:     10,
+			Description: "move mutes from room members to separate table",
+			Up:          c.migrateMutesUp,
+			// Mutes of users who are not members are lost
+			Down: c.migrateMutesDown,
+		},
+		{
+			Version:     11,
+			Description: "track updates of messages including reactions",
+			// Messages edited before keep null update time, it's read as time of edit
+			Up:   c.addColumns(messageUpdatedAtColumn),
+			Down: c.dropColumns(messageUpdatedAtColumn),
+		},
+	}
+}
+
+// execAll returns function executing statements one by one, statements must be idempotent
+func (c *Cassandra) execAll(statements ...string) func(ctx context.Context, _ migration.Tx) error {
+	return func(ctx context.Context, _ migration.Tx) error {
+		for _, stmt := range statements {
+			if err := c.session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+				return fmt.Errorf("exec %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// addColumns returns function adding columns to their tables, columns that already exist are skipped
+func (c *Cassandra) addColumns(columns ...tableColumn) func(ctx context.Context, _ migration.Tx) error {
+	return func(ctx context.Context, _ migration.Tx) error {
+		for _, column := range columns {
+			exist, err := c.columnExist(ctx, column)
+			if err != nil {
+				return err
+			}
+			if !exist {
+				stmt := fmt.Sprintf(addColumnQuery, column.table, column.name, column.kind)
+				if err = c.execAll(stmt)(ctx, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// dropColumns returns function dropping columns from their tables, columns that don't exist are skipped
+func (c *Cassandra) dropColumns(columns ...tableColumn) func(ctx context.Context, _ migration.Tx) error {
+	return func(ctx context.Context, _ migration.Tx) error {
+		for _, column := range columns {
+			exist, err := c.columnExist(ctx, column)
+			if err != nil {
+				return err
+			}
+			if exist {
+				if err = c.execAll(fmt.Sprintf(dropColumnQuery, column.table, column.name))(ctx, nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// columnExist checks if column exists, system schema keeps names of columns in lower case
+func (c *Cassandra) columnExist(ctx context.Context, column tableColumn) (bool, error) {
+	var exist int
+	err := c.read(ctx, selectColumnExist, c.config.Keyspace, column.table, strings.ToLower(column.name)).Scan(&exist)
+	if err != nil {
+		return false, fmt.Errorf("check column %s.%s: %w", column.table, column.name, err)
+	}
+	return exist > 0, nil
+}
+
+// tableExist checks if table exists
+func (c *Cassandra) tableExist(ctx context.Context, table string) (bool, error) {
+	var exist int
+	if err := c.read(ctx, selectTableExist, c.config.Keyspace, table).Scan(&exist); err != nil {
+		return false, fmt.Errorf("check table %s: %w", table, err)
+	}
+	return exist > 0, nil
+}
+
+// inOrder returns function running steps of migration one by one
+func inOrder(steps ...func(ctx context.Context, tx migration.Tx) error) func(ctx context.Context,
+	tx migration.Tx) error {
+	return func(ctx context.Context, tx migration.Tx) error {
+		for _, step := range steps {
+			if err := step(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Migrator returns migrator of Cassandra schema
+func (c *Cassandra) Migrator() (*migration.Migrator, error) {
+	versions := &cassandraVersions{
+		session:          c.session,
+		keyspace:         c.config.Keyspace,
+		writeConsistency: c.writeConsistency,
+	}
+	return migration.NewMigrator(versions, c.migrations())
+}
+
+// migrateUp applies all pending migrations
+func (c *Cassandra) migrateUp(ctx context.Context) error {
+	migrator, err := c.Migrator()
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		c.log.Infof("Applied migration %d: %s", m.Version, m.Description)
+	}
+	return err
+}
+
+// migrateLegacyMessages copies messages from legacy tables into current tables
+func (c *Cassandra) migrateLegacyMessages(ctx context.Context, _ migration.Tx) error {
+	for _, table := range legacyMessagesTables {
+		if err := c.migrateLegacyTable(ctx, table); err != nil {
+			return fmt.Errorf("table %q: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (c *Cassandra) migrateLegacyTable(ctx context.Context, table string) error {
+	exist, err := c.tableExist(ctx, table)
+	if err != nil || !exist {
+		return err
+	}
+
+	scanner := c.read(ctx, fmt.Sprintf(selectLegacyMessagesQuery, table)).Iter().Scanner()
+	count := 0
+	for scanner.Next() {
+		msg, err := scanLegacyMessage(scanner)
+		if err != nil {
+			return err
+		}
+
+		if err = c.saveLegacyMessage(ctx, &msg); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan legacy messages: %w", err)
+	}
+
+	c.log.Infof("Copied %d messages from legacy %q table, it can be dropped", count, table)
+	return nil
+}
+
+// saveLegacyMessage saves message copied from legacy table using only columns of version 1, columns added
+// by later migrations don't exist yet
+func (c *Cassandra) saveLegacyMessage(ctx context.Context, msg *message.Message) error {
+	batch := c.writeBatch(ctx)
+	bucket := c.bucketOf(msg.Time)
+	batch.Query(insertLegacyMessage, msg.RoomID.String(), bucket, msg.Time, msg.ID.String(), msg.UserID.String(),
+		msg.Text)
+	batch.Query(insertMessageBucket, msg.RoomID.String(), bucket)
+	batch.Query(insertMessageByID, msg.RoomID.String(), msg.ID.String(), msg.Time)
+
+	if err := c.session.ExecuteBatch(batch); err != nil {
+		return fmt.Errorf("save legacy message: %w", err)
+	}
+	return nil
+}
+
+// migrateMutesUp copies mutes of room members into room_mutes table and drops column they were stored in,
+// copying is skipped if column is already dropped
+func (c *Cassandra) migrateMutesUp(ctx context.Context, _ migration.Tx) error {
+	if err := c.execAll(createRoomMutesTable)(ctx, nil); err != nil {
+		return err
+	}
+
+	exist, err := c.columnExist(ctx, memberMutedUntilColumn)
+	if err != nil || !exist {
+		return err
+	}
+
+	scanner := c.read(ctx, selectMembersMutes).Iter().Scanner()
+	for scanner.Next() {
+		var roomID, userID string
+		var until *time.Time
+		if err := scanner.Scan(&roomID, &userID, &until); err != nil {
+			return fmt.Errorf("scan member mute: %w", err)
+		}
+		if until == nil {
+			continue
+		}
+
+		if err := c.write(ctx, insertMute, roomID, userID, *until).Exec(); err != nil {
+			return fmt.Errorf("copy mute: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan members mutes: %w", err)
+	}
+
+	return c.dropColumns(memberMutedUntilColumn)(ctx, nil)
+}
+
+// migrateMutesDown copies mutes back into room_members table, mutes of users who are not members are not copied,
+// copying is skipped if room_mutes table is already dropped
+func (c *Cassandra) migrateMutesDown(ctx context.Context, _ migration.Tx) error {
+	if err := c.addColumns(memberMutedUntilColumn)(ctx, nil); err != nil {
+		return err
+	}
+
+	exist, err := c.tableExist(ctx, "room_mutes")
+	if err != nil || !exist {
+		return err
+	}
+
+	scanner := c.read(ctx, selectAllMutes).Iter().Scanner()
+	for scanner.Next() {
+		var roomID, userID string
+		var until time.Time
+		if err := scanner.Scan(&roomID, &userID, &until); err != nil {
+			return fmt.Errorf("scan mute: %w", err)
+		}
+
+		if _, err := c.write(ctx, updateMemberIfExists, until, roomID, userID).ScanCAS(); err != nil {
+			return fmt.Errorf("copy mute: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scan mutes: %w", err)
+	}
+
+	return c.execAll(dropRoomMutesTable)(ctx, nil)
+}
+
+// cassandraVersions keeps applied migrations in schema_version table
+type cassandraVersions struct {
+	session          *gocql.Session
+	keyspace         string
+	writeConsistency gocql.Consistency
+}
+
+func (v *cassandraVersions) InitVersions(ctx context.Context) error {
+	if err := v.session.Query(createSchemaVersionTable).WithContext(ctx).Exec(); err != nil {
+		return fmt.Errorf("create schema version table: %w", err)
+	}
+	return nil
+}
+
+func (v *cassandraVersions) VersionsExist(ctx context.Context) (bool, error) {
+	var exist int
+	if err := v.session.Query(selectTableExist, v.keyspace, "schema_version").WithContext(ctx).
+		Scan(&exist); err != nil {
+		return false, fmt.Errorf("check schema version table: %w", err)
+	}
+	return exist > 0, nil
+}
+
+func (v *cassandraVersions) AppliedVersions(ctx context.Context) ([]migration.AppliedVersion, error) {
+	scanner := v.session.Query(selectSchemaVersions).WithContext(ctx).Iter().Scanner()
+
+	var versions []migration.AppliedVersion
+	for scanner.Next() {
+		var version int
+		var applied migration.AppliedVersion
+		if err := scanner.Scan(&version, &applied.AppliedAt); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		applied.Version = uint(version)
+		versions = append(versions, applied)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan versions: %w", err)
+	}
+	return versions, nil
+}
+
+// InTx runs f without transaction, Cassandra doesn't support them
+func (v *cassandraVersions) InTx(_ context.Context, f func(tx migration.Tx) error) error {
+	return f(nil)
+}
+
+func (v *cassandraVersions) SaveVersion(ctx context.Context, _ migration.Tx, version migration.AppliedVersion,
+	description string) error {
+	if err := v.session.Query(insertSchemaVersion, int(version.Version), description, version.AppliedAt).
+		WithContext(ctx).Consistency(v.writeConsistency).Exec(); err != nil {
+		return fmt.Errorf("save version: %w", err)
+	}
+	return nil
+}
+
+func (v *cassandraVersions) DeleteVersion(ctx context.Context, _ migration.Tx, version uint) error {
+	if err := v.session.Query(deleteSchemaVersion, int(version)).WithContext(ctx).Consistency(v.writeConsistency).
+		Exec(); err != nil {
+		return fmt.Errorf("delete version: %w", err)
+	}
+	return nil
+}
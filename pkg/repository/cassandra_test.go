@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/repository/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCassandra_bucketOf(t *testing.T) {
+	day := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		period   time.Duration
+		time     time.Time
+		expected time.Time
+	}{
+		{
+			name:     "start of day",
+			period:   DefaultBucketPeriod,
+			time:     day,
+			expected: day,
+		},
+		{
+			name:     "end of day",
+			period:   DefaultBucketPeriod,
+			time:     day.Add(24*time.Hour - time.Millisecond),
+			expected: day,
+		},
+		{
+			name:     "next day",
+			period:   DefaultBucketPeriod,
+			time:     day.Add(24 * time.Hour),
+			expected: day.Add(24 * time.Hour),
+		},
+		{
+			name:     "other time zone",
+			period:   DefaultBucketPeriod,
+			time:     day.Add(time.Hour).In(time.FixedZone("UTC+3", 3*60*60)),
+			expected: day,
+		},
+		{
+			name:     "hour period",
+			period:   time.Hour,
+			time:     day.Add(90 * time.Minute),
+			expected: day.Add(time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultCassandraConfig()
+			config.BucketPeriod = tt.period
+			c := NewCassandraRepository(config, nil)
+			actual := c.bucketOf(tt.time)
+			assert.True(t, tt.expected.Equal(actual), "expected: %s, actual: %s", tt.expected, actual)
+		})
+	}
+}
+
+func TestSinceEpoch(t *testing.T) {
+	assert.Equal(t, time.Unix(0, 0), sinceEpoch(time.Time{}))
+
+	now := time.Now()
+	assert.Equal(t, now, sinceEpoch(now))
+}
+
+func TestCassandra_Connect_invalidConfig(t *testing.T) {
+	config := DefaultCassandraConfig()
+	config.BucketPeriod = 0
+	c := NewCassandraRepository(config, nil)
+	assert.Error(t, c.Connect(context.Background(), false))
+
+	config = DefaultCassandraConfig()
+	config.WriteConsistency = "MOST"
+	c = NewCassandraRepository(config, nil)
+	assert.Error(t, c.Connect(context.Background(), false))
+}
+
+func TestCassandra_migrations(t *testing.T) {
+	c := NewCassandraRepository(DefaultCassandraConfig(), nil)
+	migrations := c.migrations()
+
+	_, err := migration.NewMigrator(nil, migrations)
+	assert.NoError(t, err)
+
+	for i, m := range migrations {
+		assert.Equal(t, uint(i+1), m.Version, "versions must be sequential")
+		assert.NotEmpty(t, m.Description)
+	}
+}
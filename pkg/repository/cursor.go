@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// lastID is the greatest possible message id
+var lastID = uuid.UUID{
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+}
+
+// Cursor is a position in history of room, messages are ordered by time and then by id so messages sent
+// at the same time have stable order, zero Cursor points before all messages
+type Cursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+// MessageCursor returns cursor pointing at message with given id sent at given time
+func MessageCursor(messageTime time.Time, messageID uuid.UUID) Cursor {
+	return Cursor{
+		Time: messageTime,
+		ID:   messageID,
+	}
+}
+
+// TimeCursor returns cursor pointing after all messages sent at given time and before all messages sent later
+func TimeCursor(t time.Time) Cursor {
+	return Cursor{
+		Time: t,
+		ID:   lastID,
+	}
+}
+
+// compare returns -1 if message is before cursor, 0 if cursor points at it and +1 if message is after cursor
+func (c Cursor) compare(msg *message.Message) int {
+	switch {
+	case msg.Time.Before(c.Time):
+		return -1
+	case msg.Time.After(c.Time):
+		return 1
+	default:
+		return bytes.Compare(msg.ID[:], c.ID[:])
+	}
+}
+
+// truncate returns the same position in storage which keeps time with given precision, cursor between stored
+// times points after all messages sent at the earlier one
+func (c Cursor) truncate(precision time.Duration) Cursor {
+	t := c.Time.Truncate(precision)
+	if t.Equal(c.Time) {
+		return c
+	}
+	return TimeCursor(t)
+}
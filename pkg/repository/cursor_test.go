@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor_compare(t *testing.T) {
+	msgTime := time.Unix(1621521072, 0).UTC()
+	msg := &message.Message{ID: uuid.New(), Time: msgTime}
+
+	tests := []struct {
+		name     string
+		cursor   Cursor
+		expected int
+	}{
+		{name: "zero", cursor: Cursor{}, expected: 1},
+		{name: "at message", cursor: MessageCursor(msgTime, msg.ID), expected: 0},
+		{name: "earlier time", cursor: TimeCursor(msgTime.Add(-time.Millisecond)), expected: 1},
+		{name: "later time", cursor: Cursor{Time: msgTime.Add(time.Millisecond)}, expected: -1},
+		{name: "start of time", cursor: Cursor{Time: msgTime}, expected: 1},
+		{name: "end of time", cursor: TimeCursor(msgTime), expected: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.cursor.compare(msg))
+		})
+	}
+}
+
+func TestCursor_truncate(t *testing.T) {
+	msgTime := time.Unix(1621521072, 0).UTC()
+	id := uuid.New()
+
+	tests := []struct {
+		name     string
+		cursor   Cursor
+		expected Cursor
+	}{
+		{name: "zero", cursor: Cursor{}, expected: Cursor{}},
+		{name: "precise", cursor: MessageCursor(msgTime, id), expected: MessageCursor(msgTime, id)},
+		{name: "precise time", cursor: TimeCursor(msgTime), expected: TimeCursor(msgTime)},
+		{name: "between", cursor: Cursor{Time: msgTime.Add(time.Microsecond)}, expected: TimeCursor(msgTime)},
+		{
+			name:     "between at message",
+			cursor:   MessageCursor(msgTime.Add(time.Microsecond), id),
+			expected: TimeCursor(msgTime),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := tt.cursor.truncate(time.Millisecond)
+			assert.Equal(t, tt.expected, actual)
+
+			// Order of stored messages relative to cursor must be kept
+			msg := &message.Message{ID: uuid.New(), Time: msgTime}
+			assert.Equal(t, tt.cursor.compare(msg), actual.compare(msg))
+		})
+	}
+}
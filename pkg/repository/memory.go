@@ -0,0 +1,796 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// Memory implementation of Repository, all data is stored in memory and lost on exit
+type Memory struct {
+	mu           sync.RWMutex
+	messages     map[uuid.UUID][]message.Message                         // Messages of each room ordered by time and id
+	messageTimes map[uuid.UUID]map[uuid.UUID]time.Time                   // Room id -> message id -> time
+	reactions    map[uuid.UUID]map[uuid.UUID]map[memoryReaction]struct{} // Room id -> message id -> reactions
+	users        map[uuid.UUID]user.User
+	usernames    map[string]uuid.UUID
+	tokens       map[string]uuid.UUID
+	rooms        map[uuid.UUID]room.Room
+	members      map[uuid.UUID]map[uuid.UUID]room.Member // Room id -> user id -> member
+	mutes        map[uuid.UUID]map[uuid.UUID]time.Time   // Room id -> user id -> end of mute
+	bans         map[uuid.UUID]map[uuid.UUID]struct{}    // Room id -> user ids of banned users
+	actions      map[uuid.UUID][]moderation.Action       // Moderation log of each room ordered by time
+}
+
+// memoryReaction is a reaction of one user on message
+type memoryReaction struct {
+	userID uuid.UUID
+	emoji  string
+}
+
+// NewMemoryRepository creates new empty Memory Repository
+func NewMemoryRepository() *Memory {
+	return &Memory{
+		messages:     make(map[uuid.UUID][]message.Message),
+		messageTimes: make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		reactions:    make(map[uuid.UUID]map[uuid.UUID]map[memoryReaction]struct{}),
+		users:        make(map[uuid.UUID]user.User),
+		usernames:    make(map[string]uuid.UUID),
+		tokens:       make(map[string]uuid.UUID),
+		rooms:        make(map[uuid.UUID]room.Room),
+		members:      make(map[uuid.UUID]map[uuid.UUID]room.Member),
+		mutes:        make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		bans:         make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		actions:      make(map[uuid.UUID][]moderation.Action),
+	}
+}
+
+func (m *Memory) GetMessageTime(ctx context.Context, roomID, messageID uuid.UUID) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.messageTimes[roomID][messageID]
+	if !ok {
+		return time.Time{}, fmt.Errorf("get time of message %s: %w", messageID, ErrorNotFound)
+	}
+	return t, nil
+}
+
+func (m *Memory) GetMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roomMessages := m.messages[roomID]
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return after.compare(&roomMessages[i]) > 0
+	})
+	roomMessages = roomMessages[i:]
+
+	if uint(len(roomMessages)) > limit {
+		roomMessages = roomMessages[uint(len(roomMessages))-limit:]
+	}
+
+	messages := make([]message.Message, len(roomMessages))
+	copy(messages, roomMessages)
+	return messages, nil
+}
+
+func (m *Memory) GetOldestMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roomMessages := m.messages[roomID]
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return after.compare(&roomMessages[i]) > 0
+	})
+	roomMessages = roomMessages[i:]
+
+	if uint(len(roomMessages)) > limit {
+		roomMessages = roomMessages[:limit]
+	}
+
+	messages := make([]message.Message, len(roomMessages))
+	copy(messages, roomMessages)
+	return messages, nil
+}
+
+func (m *Memory) GetMessagesBefore(ctx context.Context, roomID uuid.UUID,
+	before Cursor, limit uint) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roomMessages := m.messages[roomID]
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return before.compare(&roomMessages[i]) >= 0
+	})
+	roomMessages = roomMessages[:i]
+
+	if uint(len(roomMessages)) > limit {
+		roomMessages = roomMessages[uint(len(roomMessages))-limit:]
+	}
+
+	messages := make([]message.Message, len(roomMessages))
+	copy(messages, roomMessages)
+	return messages, nil
+}
+
+func (m *Memory) GetUsersFromIDs(ctx context.Context, uuids []uuid.UUID) ([]user.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make(map[uuid.UUID]struct{}, len(uuids))
+	var users []user.User
+	for _, id := range uuids {
+		if _, ok := found[id]; ok {
+			continue
+		}
+
+		usr, ok := m.users[id]
+		if !ok {
+			continue
+		}
+		found[id] = struct{}{}
+		users = append(users, usr)
+	}
+	return users, nil
+}
+
+func (m *Memory) GetUserByUsername(ctx context.Context, username string) (*user.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.usernames[username]
+	if !ok {
+		return nil, fmt.Errorf("get user %q: %w", username, ErrorNotFound)
+	}
+	usr := m.users[id]
+	return &usr, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, usr *user.User, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.usernames[usr.Username]; ok {
+		return fmt.Errorf("create user %q: %w", usr.Username, ErrorUsernameTaken)
+	}
+
+	m.users[usr.ID] = *usr
+	m.usernames[usr.Username] = usr.ID
+	m.tokens[tokenHash] = usr.ID
+	return nil
+}
+
+func (m *Memory) GetUserIDByToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	if err := ctx.Err(); err != nil {
+		return uuid.UUID{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userID, ok := m.tokens[tokenHash]
+	if !ok {
+		return uuid.UUID{}, fmt.Errorf("get user by token: %w", ErrorNotFound)
+	}
+	return userID, nil
+}
+
+func (m *Memory) SaveMessage(ctx context.Context, msg *message.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	roomMessages := m.messages[msg.RoomID]
+	position := MessageCursor(msg.Time, msg.ID)
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return position.compare(&roomMessages[i]) > 0
+	})
+
+	roomMessages = append(roomMessages, message.Message{})
+	copy(roomMessages[i+1:], roomMessages[i:])
+	roomMessages[i] = *msg
+
+	m.messages[msg.RoomID] = roomMessages
+
+	roomMessageTimes, ok := m.messageTimes[msg.RoomID]
+	if !ok {
+		roomMessageTimes = make(map[uuid.UUID]time.Time)
+		m.messageTimes[msg.RoomID] = roomMessageTimes
+	}
+	roomMessageTimes[msg.ID] = msg.Time
+	return nil
+}
+
+func (m *Memory) GetMessage(ctx context.Context, roomID, messageID uuid.UUID) (*message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	msg := m.findMessage(roomID, messageID)
+	if msg == nil {
+		return nil, fmt.Errorf("get message %s: %w", messageID, ErrorNotFound)
+	}
+	found := *msg
+	return &found, nil
+}
+
+func (m *Memory) EditMessage(ctx context.Context, roomID, messageID uuid.UUID, text string,
+	editedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg := m.findMessage(roomID, messageID)
+	if msg == nil {
+		return fmt.Errorf("edit message %s: %w", messageID, ErrorNotFound)
+	}
+	msg.Text = text
+	msg.EditedAt = &editedAt
+	msg.UpdatedAt = &editedAt
+	return nil
+}
+
+func (m *Memory) DeleteMessage(ctx context.Context, roomID, messageID uuid.UUID, deletedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg := m.findMessage(roomID, messageID)
+	if msg == nil {
+		return fmt.Errorf("delete message %s: %w", messageID, ErrorNotFound)
+	}
+	msg.Text = ""
+	msg.Deleted = true
+	msg.EditedAt = &deletedAt
+	msg.UpdatedAt = &deletedAt
+	return nil
+}
+
+func (m *Memory) UpdateMessage(ctx context.Context, roomID, messageID uuid.UUID, updatedAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg := m.findMessage(roomID, messageID)
+	if msg == nil {
+		return fmt.Errorf("update message %s: %w", messageID, ErrorNotFound)
+	}
+	msg.UpdatedAt = &updatedAt
+	return nil
+}
+
+func (m *Memory) GetUpdatedMessages(ctx context.Context, roomID uuid.UUID, after, until time.Time,
+	limit uint) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var messages []message.Message
+	for _, msg := range m.messages[roomID] {
+		if msg.UpdatedAt != nil && msg.UpdatedAt.After(after) && !msg.UpdatedAt.After(until) {
+			messages = append(messages, msg)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].UpdatedAt.Equal(*messages[j].UpdatedAt) {
+			return messages[i].UpdatedAt.Before(*messages[j].UpdatedAt)
+		}
+		return bytes.Compare(messages[i].ID[:], messages[j].ID[:]) < 0
+	})
+
+	if uint(len(messages)) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// findMessage returns stored message of room by its id or nil if there is no such message,
+// must be called with locked mutex
+func (m *Memory) findMessage(roomID, messageID uuid.UUID) *message.Message {
+	t, ok := m.messageTimes[roomID][messageID]
+	if !ok {
+		return nil
+	}
+
+	roomMessages := m.messages[roomID]
+	position := MessageCursor(t, messageID)
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return position.compare(&roomMessages[i]) >= 0
+	})
+	if i == len(roomMessages) || roomMessages[i].ID != messageID {
+		return nil
+	}
+	return &roomMessages[i]
+}
+
+func (m *Memory) GetMessagesFromIDs(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make(map[uuid.UUID]struct{}, len(messageIDs))
+	var messages []message.Message
+	for _, id := range messageIDs {
+		if _, ok := found[id]; ok {
+			continue
+		}
+
+		msg := m.findMessage(roomID, id)
+		if msg == nil {
+			continue
+		}
+		found[id] = struct{}{}
+		messages = append(messages, *msg)
+	}
+	return messages, nil
+}
+
+func (m *Memory) GetReplies(ctx context.Context, roomID, messageID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roomMessages := m.messages[roomID]
+	i := sort.Search(len(roomMessages), func(i int) bool {
+		return after.compare(&roomMessages[i]) > 0
+	})
+
+	var replies []message.Message
+	for _, msg := range roomMessages[i:] {
+		if uint(len(replies)) >= limit {
+			break
+		}
+		if msg.ReplyTo != nil && *msg.ReplyTo == messageID {
+			replies = append(replies, msg)
+		}
+	}
+	return replies, nil
+}
+
+func (m *Memory) GetReplyCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	requested := make(map[uuid.UUID]struct{}, len(messageIDs))
+	for _, id := range messageIDs {
+		requested[id] = struct{}{}
+	}
+
+	counts := make(map[uuid.UUID]int)
+	for _, msg := range m.messages[roomID] {
+		if msg.ReplyTo == nil {
+			continue
+		}
+		if _, ok := requested[*msg.ReplyTo]; ok {
+			counts[*msg.ReplyTo]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *Memory) AddReaction(ctx context.Context, r *reaction.Reaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	roomReactions, ok := m.reactions[r.RoomID]
+	if !ok {
+		roomReactions = make(map[uuid.UUID]map[memoryReaction]struct{})
+		m.reactions[r.RoomID] = roomReactions
+	}
+
+	messageReactions, ok := roomReactions[r.MessageID]
+	if !ok {
+		messageReactions = make(map[memoryReaction]struct{})
+		roomReactions[r.MessageID] = messageReactions
+	}
+	messageReactions[memoryReaction{userID: r.UserID, emoji: r.Emoji}] = struct{}{}
+	return nil
+}
+
+func (m *Memory) RemoveReaction(ctx context.Context, r *reaction.Reaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messageReactions := m.reactions[r.RoomID][r.MessageID]
+	key := memoryReaction{userID: r.UserID, emoji: r.Emoji}
+	if _, ok := messageReactions[key]; !ok {
+		return fmt.Errorf("remove reaction %q: %w", r.Emoji, ErrorNotFound)
+	}
+
+	delete(messageReactions, key)
+	if len(messageReactions) == 0 {
+		delete(m.reactions[r.RoomID], r.MessageID)
+	}
+	return nil
+}
+
+func (m *Memory) GetReactionCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]reaction.Counts, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[uuid.UUID]reaction.Counts)
+	for _, id := range messageIDs {
+		messageReactions := m.reactions[roomID][id]
+		if len(messageReactions) == 0 {
+			continue
+		}
+
+		messageCounts := make(reaction.Counts)
+		for r := range messageReactions {
+			messageCounts[r.emoji]++
+		}
+		counts[id] = messageCounts
+	}
+	return counts, nil
+}
+
+func (m *Memory) IsRoomExist(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.rooms[roomID]
+	return ok, nil
+}
+
+func (m *Memory) GetRoom(ctx context.Context, roomID uuid.UUID) (*room.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.rooms[roomID]
+	if !ok {
+		return nil, fmt.Errorf("get room %s: %w", roomID, ErrorNotFound)
+	}
+	return &r, nil
+}
+
+func (m *Memory) GetRooms(ctx context.Context) ([]room.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rooms := make([]room.Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms, nil
+}
+
+func (m *Memory) CreateRoom(ctx context.Context, r *room.Room) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[r.ID]; !ok {
+		m.rooms[r.ID] = *r
+	}
+	return nil
+}
+
+func (m *Memory) AddRoomMembers(ctx context.Context, roomID uuid.UUID, userIDs []uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members, ok := m.members[roomID]
+	if !ok {
+		members = make(map[uuid.UUID]room.Member)
+		m.members[roomID] = members
+	}
+	for _, id := range userIDs {
+		if _, ok = members[id]; !ok {
+			members[id] = room.Member{UserID: id, Role: room.RoleMember}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.members[roomID][userID]
+	return ok, nil
+}
+
+func (m *Memory) GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]room.Member, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := make([]room.Member, 0, len(m.members[roomID]))
+	for _, member := range m.members[roomID] {
+		members = append(members, m.withMute(roomID, member))
+	}
+	return members, nil
+}
+
+// withMute returns member with mute of user in room, must be called with locked mutex
+func (m *Memory) withMute(roomID uuid.UUID, member room.Member) room.Member {
+	if until, ok := m.mutes[roomID][member.UserID]; ok {
+		member.MutedUntil = &until
+	}
+	return member
+}
+
+func (m *Memory) RemoveRoomMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.members[roomID], userID)
+	return nil
+}
+
+func (m *Memory) DeleteRoom(ctx context.Context, roomID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.reactions, roomID)
+	delete(m.messageTimes, roomID)
+	delete(m.messages, roomID)
+	delete(m.members, roomID)
+	delete(m.mutes, roomID)
+	delete(m.bans, roomID)
+	delete(m.actions, roomID)
+	delete(m.rooms, roomID)
+	return nil
+}
+
+func (m *Memory) GetRoomMember(ctx context.Context, roomID, userID uuid.UUID) (*room.Member, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.members[roomID][userID]
+	if !ok {
+		return nil, fmt.Errorf("get room member %s: %w", userID, ErrorNotFound)
+	}
+	member = m.withMute(roomID, member)
+	return &member, nil
+}
+
+func (m *Memory) UpdateRoomMember(ctx context.Context, roomID uuid.UUID, member *room.Member) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[roomID][member.UserID]; !ok {
+		return fmt.Errorf("update room member %s: %w", member.UserID, ErrorNotFound)
+	}
+	m.members[roomID][member.UserID] = room.Member{UserID: member.UserID, Role: member.Role}
+	return nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mutes, ok := m.mutes[roomID]
+	if !ok {
+		mutes = make(map[uuid.UUID]time.Time)
+		m.mutes[roomID] = mutes
+	}
+	mutes[userID] = until
+	return nil
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mutes[roomID], userID)
+	return nil
+}
+
+func (m *Memory) BanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bans, ok := m.bans[roomID]
+	if !ok {
+		bans = make(map[uuid.UUID]struct{})
+		m.bans[roomID] = bans
+	}
+	bans[userID] = struct{}{}
+	return nil
+}
+
+func (m *Memory) UnbanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.bans[roomID], userID)
+	return nil
+}
+
+func (m *Memory) IsBanned(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.bans[roomID][userID]
+	return ok, nil
+}
+
+func (m *Memory) SaveModerationAction(ctx context.Context, action *moderation.Action) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Inserted after actions done at the same time to keep order in which they were saved
+	actions := m.actions[action.RoomID]
+	i := sort.Search(len(actions), func(i int) bool {
+		return actions[i].Time.After(action.Time)
+	})
+	actions = append(actions, moderation.Action{})
+	copy(actions[i+1:], actions[i:])
+	actions[i] = *action
+	m.actions[action.RoomID] = actions
+	return nil
+}
+
+func (m *Memory) GetModerationActions(ctx context.Context, roomID uuid.UUID,
+	limit uint) ([]moderation.Action, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roomActions := m.actions[roomID]
+	if uint(len(roomActions)) > limit {
+		roomActions = roomActions[uint(len(roomActions))-limit:]
+	}
+
+	actions := make([]moderation.Action, len(roomActions))
+	for i := range roomActions {
+		actions[len(actions)-1-i] = roomActions[i]
+	}
+	return actions, nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_GetMessages(t *testing.T) {
+	m := NewMemoryRepository()
+	roomID := uuid.New()
+	startTime := time.Unix(1621521072, 0).UTC()
+
+	messages := make([]message.Message, 5)
+	for i := range messages {
+		messages[i] = message.Message{
+			ID:     uuid.New(),
+			UserID: uuid.New(),
+			RoomID: roomID,
+			Text:   "message " + strconv.Itoa(i),
+			Time:   startTime.Add(time.Second * time.Duration(i)),
+		}
+	}
+	// Saved out of order on purpose
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		require.NoError(t, m.SaveMessage(context.Background(), &messages[i]))
+	}
+	require.NoError(t, m.SaveMessage(context.Background(),
+		&message.Message{ID: uuid.New(), RoomID: uuid.New(), Time: startTime}))
+
+	type args struct {
+		after Cursor
+		limit uint
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []message.Message
+	}{
+		{
+			name:     "all",
+			args:     args{after: Cursor{}, limit: 10},
+			expected: messages,
+		},
+		{
+			name:     "limit newest",
+			args:     args{after: Cursor{}, limit: 2},
+			expected: messages[3:],
+		},
+		{
+			name:     "after time",
+			args:     args{after: TimeCursor(messages[1].Time), limit: 10},
+			expected: messages[2:],
+		},
+		{
+			name:     "after time with limit",
+			args:     args{after: TimeCursor(messages[0].Time), limit: 3},
+			expected: messages[2:],
+		},
+		{
+			name:     "after last",
+			args:     args{after: TimeCursor(messages[4].Time), limit: 10},
+			expected: []message.Message{},
+		},
+		{
+			name:     "zero limit",
+			args:     args{after: Cursor{}, limit: 0},
+			expected: []message.Message{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := m.GetMessages(context.Background(), roomID, tt.args.after, tt.args.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("unknown room", func(t *testing.T) {
+		actual, err := m.GetMessages(context.Background(), uuid.New(), Cursor{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+func TestMemory_sameTime(t *testing.T) {
+	m := NewMemoryRepository()
+	roomID := uuid.New()
+	msgTime := time.Unix(1621521072, 0).UTC()
+
+	messages := []message.Message{
+		{ID: uuid.UUID{0x10}, RoomID: roomID, Time: msgTime},
+		{ID: uuid.UUID{0x20}, RoomID: roomID, Time: msgTime},
+		{ID: uuid.UUID{0x30}, RoomID: roomID, Time: msgTime},
+	}
+	for _, i := range []int{1, 2, 0} {
+		require.NoError(t, m.SaveMessage(context.Background(), &messages[i]))
+	}
+
+	actual, err := m.GetMessages(context.Background(), roomID, Cursor{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, messages, actual)
+
+	actual, err = m.GetOldestMessages(context.Background(), roomID, MessageCursor(msgTime, messages[0].ID), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, messages[1:], actual)
+
+	actual, err = m.GetMessagesBefore(context.Background(), roomID, MessageCursor(msgTime, messages[2].ID), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, messages[:2], actual)
+
+	actual, err = m.GetMessages(context.Background(), roomID, TimeCursor(msgTime), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+}
+
+func TestMemory_GetMessageTime(t *testing.T) {
+	m := NewMemoryRepository()
+	msg := &message.Message{ID: uuid.New(), RoomID: uuid.New(), Time: time.Unix(1621521072, 0).UTC()}
+	require.NoError(t, m.SaveMessage(context.Background(), msg))
+
+	t.Run("ok", func(t *testing.T) {
+		actual, err := m.GetMessageTime(context.Background(), msg.RoomID, msg.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, msg.Time, actual)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := m.GetMessageTime(context.Background(), msg.RoomID, uuid.New())
+		assert.ErrorIs(t, err, ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		_, err := m.GetMessageTime(context.Background(), uuid.New(), msg.ID)
+		assert.ErrorIs(t, err, ErrorNotFound)
+	})
+}
+
+func TestMemory_GetUsersFromIDs(t *testing.T) {
+	m := NewMemoryRepository()
+	users := []user.User{
+		{ID: uuid.New(), Username: "user1"},
+		{ID: uuid.New(), Username: "user2"},
+	}
+	for i := range users {
+		require.NoError(t, m.CreateUser(context.Background(), &users[i], uuid.New().String()))
+	}
+
+	actual, err := m.GetUsersFromIDs(context.Background(), []uuid.UUID{users[0].ID, uuid.New(), users[1].ID, users[0].ID})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, users, actual)
+}
+
+func TestMemory_IsRoomExist(t *testing.T) {
+	m := NewMemoryRepository()
+	roomID := uuid.New()
+	require.NoError(t, m.CreateRoom(context.Background(), &room.Room{ID: roomID}))
+
+	ok, err := m.IsRoomExist(context.Background(), roomID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = m.IsRoomExist(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemory_concurrent(t *testing.T) {
+	m := NewMemoryRepository()
+	roomID := uuid.New()
+	require.NoError(t, m.CreateRoom(context.Background(), &room.Room{ID: roomID}))
+
+	const count = 50
+	var wg sync.WaitGroup
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, m.SaveMessage(context.Background(), &message.Message{
+				ID:     uuid.New(),
+				RoomID: roomID,
+				Time:   time.Unix(int64(i), 0),
+			}))
+			_, err := m.GetMessages(context.Background(), roomID, Cursor{}, count)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	actual, err := m.GetMessages(context.Background(), roomID, Cursor{}, count)
+	assert.NoError(t, err)
+	require.Len(t, actual, count)
+	for i := 1; i < count; i++ {
+		assert.True(t, actual[i-1].Time.Before(actual[i].Time))
+	}
+}
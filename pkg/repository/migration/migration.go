@@ -0,0 +1,234 @@
+// Package migration applies ordered, versioned changes of storage schema
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrorNoMigrations returned when there is no applied migration to revert
+	ErrorNoMigrations = errors.New("no applied migrations")
+
+	// ErrorIrreversible returned when reverting migration without Down
+	ErrorIrreversible = errors.New("migration is irreversible")
+
+	// ErrorUnknownVersion returned when storage has applied migration which is not known
+	ErrorUnknownVersion = errors.New("unknown schema version")
+)
+
+// Migration is one versioned change of storage schema
+type Migration struct {
+	// Version orders migrations, it must be unique and greater than zero
+	Version uint
+
+	// Description shortly describes the change
+	Description string
+
+	// Up applies the change in transaction
+	Up func(ctx context.Context, tx Tx) error
+
+	// Down reverts the change in transaction, nil if migration is irreversible
+	Down func(ctx context.Context, tx Tx) error
+}
+
+// Tx is a transaction in which migration is applied and recorded, it's nil for storages without transactions,
+// migrations of such storages must be idempotent, so they can be applied again if recording fails
+type Tx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// AppliedVersion is a record of applied migration
+type AppliedVersion struct {
+	Version   uint
+	AppliedAt time.Time
+}
+
+// Store keeps track of applied migrations, usually in schema_version table of the same storage
+type Store interface {
+	// InitVersions creates schema version table if not exist
+	InitVersions(ctx context.Context) error
+
+	// VersionsExist reports if schema version table exists without changing storage
+	VersionsExist(ctx context.Context) (bool, error)
+
+	// AppliedVersions returns all applied migrations in any order
+	AppliedVersions(ctx context.Context) ([]AppliedVersion, error)
+
+	// InTx runs f in transaction which is committed if f succeeds, storages without transactions run f with nil
+	InTx(ctx context.Context, f func(tx Tx) error) error
+
+	// SaveVersion records migration as applied in transaction
+	SaveVersion(ctx context.Context, tx Tx, version AppliedVersion, description string) error
+
+	// DeleteVersion removes record of applied migration in transaction
+	DeleteVersion(ctx context.Context, tx Tx, version uint) error
+}
+
+// Status is a state of one migration
+type Status struct {
+	Version     uint
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Migrator applies and reverts migrations, it must not be used concurrently with other migrators of the same storage
+type Migrator struct {
+	store      Store
+	migrations []Migration
+}
+
+// NewMigrator creates new Migrator, migrations are sorted by version
+func NewMigrator(store Store, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	for i, m := range sorted {
+		if m.Version == 0 {
+			return nil, fmt.Errorf("migration %q: zero version", m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration %q: duplicated version %d", m.Description, m.Version)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d: no up", m.Version)
+		}
+	}
+
+	return &Migrator{
+		store:      store,
+		migrations: sorted,
+	}, nil
+}
+
+// applied returns applied migrations by their versions, schema version table is created if not exist
+func (m *Migrator) applied(ctx context.Context) (map[uint]AppliedVersion, error) {
+	if err := m.store.InitVersions(ctx); err != nil {
+		return nil, fmt.Errorf("init versions: %w", err)
+	}
+	return m.appliedVersions(ctx)
+}
+
+// appliedVersions returns applied migrations by their versions, schema version table must exist
+func (m *Migrator) appliedVersions(ctx context.Context) (map[uint]AppliedVersion, error) {
+	versions, err := m.store.AppliedVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("applied versions: %w", err)
+	}
+
+	known := make(map[uint]struct{}, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = struct{}{}
+	}
+
+	applied := make(map[uint]AppliedVersion, len(versions))
+	for _, v := range versions {
+		if _, ok := known[v.Version]; !ok {
+			return nil, fmt.Errorf("version %d: %w", v.Version, ErrorUnknownVersion)
+		}
+		applied[v.Version] = v
+	}
+	return applied, nil
+}
+
+// Up applies all pending migrations in order of versions and returns applied ones
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate up: %w", err)
+	}
+
+	var done []Migration
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+
+		err = m.store.InTx(ctx, func(tx Tx) error {
+			if err := mg.Up(ctx, tx); err != nil {
+				return err
+			}
+
+			version := AppliedVersion{Version: mg.Version, AppliedAt: time.Now().UTC()}
+			if err := m.store.SaveVersion(ctx, tx, version, mg.Description); err != nil {
+				return fmt.Errorf("save version: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return done, fmt.Errorf("migrate up to %d: %w", mg.Version, err)
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down reverts the latest applied migration and returns it
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrate down: %w", err)
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+
+		if mg.Down == nil {
+			return nil, fmt.Errorf("migrate down from %d: %w", mg.Version, ErrorIrreversible)
+		}
+		err = m.store.InTx(ctx, func(tx Tx) error {
+			if err := mg.Down(ctx, tx); err != nil {
+				return err
+			}
+			if err := m.store.DeleteVersion(ctx, tx, mg.Version); err != nil {
+				return fmt.Errorf("delete version: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migrate down from %d: %w", mg.Version, err)
+		}
+		return &mg, nil
+	}
+	return nil, fmt.Errorf("migrate down: %w", ErrorNoMigrations)
+}
+
+// Status returns state of all migrations ordered by version, it only reads storage, so missing schema version
+// table is not created and all migrations are reported as pending
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	exist, err := m.store.VersionsExist(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migrations status: versions exist: %w", err)
+	}
+
+	applied := make(map[uint]AppliedVersion)
+	if exist {
+		applied, err = m.appliedVersions(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("migrations status: %w", err)
+		}
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mg := range m.migrations {
+		v, ok := applied[mg.Version]
+		statuses[i] = Status{
+			Version:     mg.Version,
+			Description: mg.Description,
+			Applied:     ok,
+			AppliedAt:   v.AppliedAt,
+		}
+	}
+	return statuses, nil
+}
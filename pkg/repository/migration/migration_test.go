@@ -0,0 +1,326 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errAny = errors.New("error")
+
+var errNoTx = errors.New("no transaction")
+
+// memoryStore keeps applied versions in memory, changes made in failed transaction are discarded
+type memoryStore struct {
+	versions  map[uint]AppliedVersion
+	initErr   error
+	saveErr   error
+	noTable   bool
+	rollbacks int
+}
+
+// memoryTx is a transaction of memoryStore
+type memoryTx struct{}
+
+func (memoryTx) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func newMemoryStore(versions ...uint) *memoryStore {
+	s := &memoryStore{versions: make(map[uint]AppliedVersion)}
+	for _, v := range versions {
+		s.versions[v] = AppliedVersion{Version: v}
+	}
+	return s
+}
+
+func (s *memoryStore) InitVersions(_ context.Context) error {
+	if s.initErr != nil {
+		return s.initErr
+	}
+	s.noTable = false
+	return nil
+}
+
+func (s *memoryStore) VersionsExist(_ context.Context) (bool, error) {
+	return !s.noTable, nil
+}
+
+func (s *memoryStore) AppliedVersions(_ context.Context) ([]AppliedVersion, error) {
+	versions := make([]AppliedVersion, 0, len(s.versions))
+	for _, v := range s.versions {
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+func (s *memoryStore) InTx(_ context.Context, f func(tx Tx) error) error {
+	versions := make(map[uint]AppliedVersion, len(s.versions))
+	for v, applied := range s.versions {
+		versions[v] = applied
+	}
+
+	if err := f(memoryTx{}); err != nil {
+		s.versions = versions
+		s.rollbacks++
+		return err
+	}
+	return nil
+}
+
+func (s *memoryStore) SaveVersion(_ context.Context, tx Tx, version AppliedVersion, _ string) error {
+	if tx == nil {
+		return errNoTx
+	}
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.versions[version.Version] = version
+	return nil
+}
+
+func (s *memoryStore) DeleteVersion(_ context.Context, tx Tx, version uint) error {
+	if tx == nil {
+		return errNoTx
+	}
+	delete(s.versions, version)
+	return nil
+}
+
+// recorder records applied and reverted migrations
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) migration(version uint) Migration {
+	name := strconv.Itoa(int(version))
+	return Migration{
+		Version:     version,
+		Description: "migration " + name,
+		Up: func(_ context.Context, tx Tx) error {
+			if tx == nil {
+				return errNoTx
+			}
+			r.calls = append(r.calls, "up "+name)
+			return nil
+		},
+		Down: func(_ context.Context, tx Tx) error {
+			if tx == nil {
+				return errNoTx
+			}
+			r.calls = append(r.calls, "down "+name)
+			return nil
+		},
+	}
+}
+
+func versions(migrations []Migration) []uint {
+	vs := make([]uint, len(migrations))
+	for i, m := range migrations {
+		vs[i] = m.Version
+	}
+	return vs
+}
+
+func TestNewMigrator(t *testing.T) {
+	r := &recorder{}
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		ok         bool
+	}{
+		{name: "ok", migrations: []Migration{r.migration(2), r.migration(1)}, ok: true},
+		{name: "empty", migrations: nil, ok: true},
+		{name: "zero version", migrations: []Migration{r.migration(0)}, ok: false},
+		{name: "duplicated version", migrations: []Migration{r.migration(1), r.migration(1)}, ok: false},
+		{name: "no up", migrations: []Migration{{Version: 1}}, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMigrator(newMemoryStore(), tt.migrations)
+			if tt.ok {
+				assert.NoError(t, err)
+				assert.NotNil(t, m)
+			} else {
+				assert.Error(t, err)
+				assert.Nil(t, m)
+			}
+		})
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	t.Run("all in order", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore()
+		m, err := NewMigrator(store, []Migration{r.migration(3), r.migration(1), r.migration(2)})
+		require.NoError(t, err)
+
+		applied, err := m.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{1, 2, 3}, versions(applied))
+		assert.Equal(t, []string{"up 1", "up 2", "up 3"}, r.calls)
+		assert.Len(t, store.versions, 3)
+		assert.False(t, store.versions[1].AppliedAt.IsZero())
+	})
+
+	t.Run("only pending", func(t *testing.T) {
+		r := &recorder{}
+		m, err := NewMigrator(newMemoryStore(1, 2), []Migration{r.migration(1), r.migration(2), r.migration(3)})
+		require.NoError(t, err)
+
+		applied, err := m.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{3}, versions(applied))
+		assert.Equal(t, []string{"up 3"}, r.calls)
+	})
+
+	t.Run("up to date", func(t *testing.T) {
+		r := &recorder{}
+		m, err := NewMigrator(newMemoryStore(1), []Migration{r.migration(1)})
+		require.NoError(t, err)
+
+		applied, err := m.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+		assert.Empty(t, r.calls)
+	})
+
+	t.Run("stops on error", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore()
+		failing := r.migration(2)
+		failing.Up = func(context.Context, Tx) error { return errAny }
+		m, err := NewMigrator(store, []Migration{r.migration(1), failing, r.migration(3)})
+		require.NoError(t, err)
+
+		applied, err := m.Up(context.Background())
+		assert.ErrorIs(t, err, errAny)
+		assert.Equal(t, []uint{1}, versions(applied))
+		assert.Equal(t, []string{"up 1"}, r.calls)
+		assert.Len(t, store.versions, 1)
+		assert.Equal(t, 1, store.rollbacks)
+	})
+
+	t.Run("save version err", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore()
+		store.saveErr = errAny
+		m, err := NewMigrator(store, []Migration{r.migration(1), r.migration(2)})
+		require.NoError(t, err)
+
+		applied, err := m.Up(context.Background())
+		assert.ErrorIs(t, err, errAny)
+		assert.Empty(t, applied)
+		assert.Empty(t, store.versions)
+		// Change is rolled back together with its version, so it's applied again by the next run
+		assert.Equal(t, 1, store.rollbacks)
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		r := &recorder{}
+		m, err := NewMigrator(newMemoryStore(1, 5), []Migration{r.migration(1), r.migration(2)})
+		require.NoError(t, err)
+
+		_, err = m.Up(context.Background())
+		assert.ErrorIs(t, err, ErrorUnknownVersion)
+		assert.Empty(t, r.calls)
+	})
+
+	t.Run("init err", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore()
+		store.initErr = errAny
+		m, err := NewMigrator(store, []Migration{r.migration(1)})
+		require.NoError(t, err)
+
+		_, err = m.Up(context.Background())
+		assert.ErrorIs(t, err, errAny)
+		assert.Empty(t, r.calls)
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	t.Run("latest", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore(1, 2)
+		m, err := NewMigrator(store, []Migration{r.migration(1), r.migration(2), r.migration(3)})
+		require.NoError(t, err)
+
+		reverted, err := m.Down(context.Background())
+		assert.NoError(t, err)
+		require.NotNil(t, reverted)
+		assert.Equal(t, uint(2), reverted.Version)
+		assert.Equal(t, []string{"down 2"}, r.calls)
+		assert.Contains(t, store.versions, uint(1))
+		assert.NotContains(t, store.versions, uint(2))
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		r := &recorder{}
+		m, err := NewMigrator(newMemoryStore(), []Migration{r.migration(1)})
+		require.NoError(t, err)
+
+		reverted, err := m.Down(context.Background())
+		assert.ErrorIs(t, err, ErrorNoMigrations)
+		assert.Nil(t, reverted)
+	})
+
+	t.Run("irreversible", func(t *testing.T) {
+		store := newMemoryStore(1)
+		m, err := NewMigrator(store, []Migration{{Version: 1, Up: func(context.Context, Tx) error { return nil }}})
+		require.NoError(t, err)
+
+		reverted, err := m.Down(context.Background())
+		assert.ErrorIs(t, err, ErrorIrreversible)
+		assert.Nil(t, reverted)
+		assert.Contains(t, store.versions, uint(1))
+	})
+
+	t.Run("down err", func(t *testing.T) {
+		r := &recorder{}
+		store := newMemoryStore(1)
+		failing := r.migration(1)
+		failing.Down = func(context.Context, Tx) error { return errAny }
+		m, err := NewMigrator(store, []Migration{failing})
+		require.NoError(t, err)
+
+		_, err = m.Down(context.Background())
+		assert.ErrorIs(t, err, errAny)
+		assert.Contains(t, store.versions, uint(1))
+		assert.Equal(t, 1, store.rollbacks)
+	})
+}
+
+func TestMigrator_Status(t *testing.T) {
+	r := &recorder{}
+	m, err := NewMigrator(newMemoryStore(1), []Migration{r.migration(2), r.migration(1)})
+	require.NoError(t, err)
+
+	statuses, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Status{
+		{Version: 1, Description: "migration 1", Applied: true},
+		{Version: 2, Description: "migration 2", Applied: false},
+	}, statuses)
+}
+
+func TestMigrator_Status_noTable(t *testing.T) {
+	r := &recorder{}
+	store := newMemoryStore()
+	store.noTable = true
+	store.initErr = errAny
+	m, err := NewMigrator(store, []Migration{r.migration(1)})
+	require.NoError(t, err)
+
+	statuses, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Status{{Version: 1, Description: "migration 1", Applied: false}}, statuses)
+	assert.True(t, store.noTable)
+}
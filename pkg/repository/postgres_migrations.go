@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/repository/migration"
+)
+
+const (
+	postgresCreateSchemaVersionTable = "CREATE TABLE IF NOT EXISTS schema_version " +
+		"(version INTEGER PRIMARY KEY, description TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL);"
+	postgresSelectSchemaVersions     = "SELECT version, applied_at FROM schema_version;"
+	postgresSelectSchemaVersionExist = "SELECT to_regclass('schema_version') IS NOT NULL;"
+	postgresInsertSchemaVersion      = "INSERT INTO schema_version (version, description, applied_at) VALUES ($1, $2, $3);"
+	postgresDeleteSchemaVersion      = "DELETE FROM schema_version WHERE version = $1;"
+
+	postgresCreateUsersTable = "CREATE TABLE users " +
+		"(id UUID PRIMARY KEY, username TEXT NOT NULL UNIQUE);"
+	postgresCreateTokensTable = "CREATE TABLE tokens " +
+		"(hash TEXT PRIMARY KEY, user_id UUID NOT NULL);"
+	postgresCreateRoomsTable    = "CREATE TABLE rooms (id UUID PRIMARY KEY);"
+	postgresCreateMessagesTable = "CREATE TABLE messages " +
+		"(id UUID NOT NULL, room_id UUID NOT NULL, user_id UUID NOT NULL, text TEXT NOT NULL, " +
+		"time TIMESTAMPTZ NOT NULL, PRIMARY KEY (room_id, id));"
+	postgresCreateMessagesTimeIndex = "CREATE INDEX messages_by_time ON messages (room_id, time, id);"
+
+	postgresAddMessageEditColumns = "ALTER TABLE messages ADD COLUMN edited_at TIMESTAMPTZ, " +
+		"ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false;"
+
+	postgresCreateReactionsTable = "CREATE TABLE reactions " +
+		"(room_id UUID NOT NULL, message_id UUID NOT NULL, emoji TEXT NOT NULL, user_id UUID NOT NULL, " +
+		"PRIMARY KEY (room_id, message_id, emoji, user_id));"
+
+	postgresAddMessageReplyToColumn  = "ALTER TABLE messages ADD COLUMN reply_to UUID;"
+	postgresCreateMessagesReplyIndex = "CREATE INDEX messages_by_reply ON messages (room_id, reply_to, time, id);"
+
+	postgresAddRoomDirectColumn    = "ALTER TABLE rooms ADD COLUMN direct BOOLEAN NOT NULL DEFAULT false;"
+	postgresCreateRoomMembersTable = "CREATE TABLE room_members " +
+		"(room_id UUID NOT NULL, user_id UUID NOT NULL, PRIMARY KEY (room_id, user_id));"
+
+	postgresAddRoomPrivateColumn = "ALTER TABLE rooms ADD COLUMN private BOOLEAN NOT NULL DEFAULT false;"
+
+	postgresAddMemberColumns = "ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member', " +
+		"ADD COLUMN muted_until TIMESTAMPTZ;"
+	postgresCreateRoomBansTable = "CREATE TABLE room_bans " +
+		"(room_id UUID NOT NULL, user_id UUID NOT NULL, PRIMARY KEY (room_id, user_id));"
+	postgresCreateActionsTable = "CREATE TABLE moderation_actions " +
+		"(id UUID NOT NULL, room_id UUID NOT NULL, moderator_id UUID, target_id UUID NOT NULL, kind TEXT NOT NULL, " +
+		"role TEXT NOT NULL, until TIMESTAMPTZ, time TIMESTAMPTZ NOT NULL, PRIMARY KEY (room_id, id));"
+	postgresCreateActionsTimeIndex = "CREATE INDEX moderation_actions_by_time " +
+		"ON moderation_actions (room_id, time, id);"
+
+	postgresCreateMessagesEditIndex = "CREATE INDEX messages_by_edit ON messages (room_id, edited_at, id);"
+
+	postgresCreateRoomMutesTable = "CREATE TABLE room_mutes " +
+		"(room_id UUID NOT NULL, user_id UUID NOT NULL, until TIMESTAMPTZ NOT NULL, PRIMARY KEY (room_id, user_id));"
+	postgresCopyMembersMutes = "INSERT INTO room_mutes (room_id, user_id, until) " +
+		"SELECT room_id, user_id, muted_until FROM room_members WHERE muted_until IS NOT NULL;"
+	postgresDropMemberMutedUntilColumn = "ALTER TABLE room_members DROP COLUMN muted_until;"
+
+	postgresAddMessageUpdatedAtColumn = "ALTER TABLE messages ADD COLUMN updated_at TIMESTAMPTZ;"
+	postgresCopyMessagesEditedAt      = "UPDATE messages SET updated_at = edited_at;"
+	postgresCreateMessagesUpdateIndex = "CREATE INDEX messages_by_update ON messages (room_id, updated_at, id);"
+
+	postgresDropUsersTable    = "DROP TABLE users;"
+	postgresDropTokensTable   = "DROP TABLE tokens;"
+	postgresDropRoomsTable    = "DROP TABLE rooms;"
+	postgresDropMessagesTable = "DROP TABLE messages;"
+
+	postgresDropMessageEditColumns = "ALTER TABLE messages DROP COLUMN deleted, DROP COLUMN edited_at;"
+
+	postgresDropReactionsTable = "DROP TABLE reactions;"
+
+	postgresDropMessagesReplyIndex   = "DROP INDEX messages_by_reply;"
+	postgresDropMessageReplyToColumn = "ALTER TABLE messages DROP COLUMN reply_to;"
+
+	postgresDropRoomMembersTable = "DROP TABLE room_members;"
+	postgresDropRoomDirectColumn = "ALTER TABLE rooms DROP COLUMN direct;"
+
+	postgresDropRoomPrivateColumn = "ALTER TABLE rooms DROP COLUMN private;"
+
+	postgresDropActionsTable  = "DROP TABLE moderation_actions;"
+	postgresDropRoomBansTable = "DROP TABLE room_bans;"
+	postgresDropMemberColumns = "ALTER TABLE room_members DROP COLUMN muted_until, DROP COLUMN role;"
+
+	postgresDropMessagesEditIndex = "DROP INDEX messages_by_edit;"
+
+	postgresAddMemberMutedUntilColumn = "ALTER TABLE room_members ADD COLUMN muted_until TIMESTAMPTZ;"
+	postgresCopyMutesToMembers        = "UPDATE room_members m SET muted_until = u.until FROM room_mutes u " +
+		"WHERE u.room_id = m.room_id AND u.user_id = m.user_id;"
+	postgresDropRoomMutesTable = "DROP TABLE room_mutes;"
+
+	postgresDropMessagesUpdateIndex    = "DROP INDEX messages_by_update;"
+	postgresDropMessageUpdatedAtColumn = "ALTER TABLE messages DROP COLUMN updated_at;"
+)
+
+// migrations returns all changes of PostgreSQL schema, new migrations must be added with the next version
+// and never changed after release
+func (p *Postgres) migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version:     1,
+			Description: "create users, tokens, rooms & messages tables",
+			Up: p.execAll(postgresCreateUsersTable, postgresCreateTokensTable, postgresCreateRoomsTable,
+				postgresCreateMessagesTable, postgresCreateMessagesTimeIndex),
+			Down: p.execAll(postgresDropMessagesTable, postgresDropRoomsTable, postgresDropTokensTable,
+				postgresDropUsersTable),
+		},
+		{
+			Version:     2,
+			Description: "add edit time & deleted flag to messages",
+			Up:          p.execAll(postgresAddMessageEditColumns),
+			Down:        p.execAll(postgresDropMessageEditColumns),
+		},
+		{
+			Version:     3,
+			Description: "create reactions table",
+			Up:          p.execAll(postgresCreateReactionsTable),
+			Down:        p.execAll(postgresDropReactionsTable),
+		},
+		{
+			Version:     4,
+			Description: "add replies to messages",
+			Up:          p.execAll(postgresAddMessageReplyToColumn, postgresCreateMessagesReplyIndex),
+			Down:        p.execAll(postgresDropMessagesReplyIndex, postgresDropMessageReplyToColumn),
+		},
+		{
+			Version:     5,
+			Description: "add direct rooms & room members",
+			Up:          p.execAll(postgresAddRoomDirectColumn, postgresCreateRoomMembersTable),
+			Down:        p.execAll(postgresDropRoomMembersTable, postgresDropRoomDirectColumn),
+		},
+		{
+			Version:     6,
+			Description: "add private rooms",
+			Up:          p.execAll(postgresAddRoomPrivateColumn),
+			Down:        p.execAll(postgresDropRoomPrivateColumn),
+		},
+		{
+			Version:     7,
+			Description: "add member roles & mutes, bans & moderation log",
+			Up: p.execAll(postgresAddMemberColumns, postgresCreateRoomBansTable, postgresCreateActionsTable,
+				postgresCreateActionsTimeIndex),
+			Down: p.execAll(postgresDropActionsTable, postgresDropRoomBansTable, postgresDropMemberColumns),
+		},
+		{
+			Version:     8,
+			Description: "index messages by edit time",
+			Up:          p.execAll(postgresCreateMessagesEditIndex),
+			Down:        p.execAll(postgresDropMessagesEditIndex),
+		},
+		{
+			Version:     9,
+			Description: "move mutes from room members to separate table",
+			Up: p.execAll(postgresCreateRoomMutesTable, postgresCopyMembersMutes,
+				postgresDropMemberMutedUntilColumn),
+			// Mutes of users who are not members are lost
+			Down: p.execAll(postgresAddMemberMutedUntilColumn, postgresCopyMutesToMembers,
+				postgresDropRoomMutesTable),
+		},
+		{
+			Version:     10,
+			Description: "track updates of messages including reactions",
+			Up: p.execAll(postgresAddMessageUpdatedAtColumn, postgresCopyMessagesEditedAt,
+				postgresCreateMessagesUpdateIndex, postgresDropMessagesEditIndex),
+			Down: p.execAll(postgresCreateMessagesEditIndex, postgresDropMessagesUpdateIndex,
+				postgresDropMessageUpdatedAtColumn),
+		},
+	}
+}
+
+// execAll returns function executing statements one by one in transaction of migration
+func (p *Postgres) execAll(statements ...string) func(ctx context.Context, tx migration.Tx) error {
+	return func(ctx context.Context, tx migration.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("exec %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Migrator returns migrator of PostgreSQL schema
+func (p *Postgres) Migrator() (*migration.Migrator, error) {
+	return migration.NewMigrator(&postgresVersions{db: p.db}, p.migrations())
+}
+
+// migrateUp applies all pending migrations
+func (p *Postgres) migrateUp(ctx context.Context) error {
+	migrator, err := p.Migrator()
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		p.log.Infof("Applied migration %d: %s", m.Version, m.Description)
+	}
+	return err
+}
+
+// postgresVersions keeps applied migrations in schema_version table
+type postgresVersions struct {
+	db *sql.DB
+}
+
+func (v *postgresVersions) InitVersions(ctx context.Context) error {
+	if _, err := v.db.ExecContext(ctx, postgresCreateSchemaVersionTable); err != nil {
+		return fmt.Errorf("create schema version table: %w", err)
+	}
+	return nil
+}
+
+func (v *postgresVersions) VersionsExist(ctx context.Context) (bool, error) {
+	var exist bool
+	if err := v.db.QueryRowContext(ctx, postgresSelectSchemaVersionExist).Scan(&exist); err != nil {
+		return false, fmt.Errorf("check schema version table: %w", err)
+	}
+	return exist, nil
+}
+
+func (v *postgresVersions) AppliedVersions(ctx context.Context) ([]migration.AppliedVersion, error) {
+	rows, err := v.db.QueryContext(ctx, postgresSelectSchemaVersions)
+	if err != nil {
+		return nil, fmt.Errorf("select versions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var versions []migration.AppliedVersion
+	for rows.Next() {
+		var version uint
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		versions = append(versions, migration.AppliedVersion{Version: version, AppliedAt: appliedAt.UTC()})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (v *postgresVersions) InTx(ctx context.Context, f func(tx migration.Tx) error) error {
+	return inTx(ctx, v.db, func(tx *sql.Tx) error { return f(tx) })
+}
+
+func (v *postgresVersions) SaveVersion(ctx context.Context, tx migration.Tx, version migration.AppliedVersion,
+	description string) error {
+	_, err := tx.ExecContext(ctx, postgresInsertSchemaVersion, version.Version, description,
+		version.AppliedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("save version: %w", err)
+	}
+	return nil
+}
+
+func (v *postgresVersions) DeleteVersion(ctx context.Context, tx migration.Tx, version uint) error {
+	if _, err := tx.ExecContext(ctx, postgresDeleteSchemaVersion, version); err != nil {
+		return fmt.Errorf("delete version: %w", err)
+	}
+	return nil
+}
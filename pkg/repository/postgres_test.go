@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgres_Connect_noURL(t *testing.T) {
+	p := NewPostgresRepository("", nil)
+	assert.Error(t, p.Connect(context.Background(), false))
+}
+
+func TestPostgres_migrations(t *testing.T) {
+	p := NewPostgresRepository("", nil)
+	for i, m := range p.migrations() {
+		assert.Equal(t, uint(i+1), m.Version, "versions must be sequential")
+		assert.NotEmpty(t, m.Description)
+	}
+}
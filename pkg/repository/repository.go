@@ -1,40 +1,200 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/data/user"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
-// Repository manages data related to messages, users and rooms
+var (
+	// ErrorNotFound returned when requested data not exist
+	ErrorNotFound = errors.New("not found")
+
+	// ErrorUsernameTaken returned when user with the same username already exist
+	ErrorUsernameTaken = errors.New("username already taken")
+)
+
+// Repository manages data related to messages, users and rooms, all methods stop and return error of context
+// when it is done
 type Repository interface {
 	MessageRepository
+	ReactionRepository
 	UserRepository
 	RoomRepository
+	ModerationRepository
 }
 
 // MessageRepository manages data related to messages
 type MessageRepository interface {
-	// GetMessageTime returns time when massage was sent by its id
-	GetMessageTime(messageID uuid.UUID) (time.Time, error)
+	// GetMessageTime returns time when massage was sent to specified room by its id or ErrorNotFound
+	GetMessageTime(ctx context.Context, roomID, messageID uuid.UUID) (time.Time, error)
+
+	// GetMessages returns limited amount of latest messages from specified room after specified cursor
+	GetMessages(ctx context.Context, roomID uuid.UUID, after Cursor, limit uint) ([]message.Message, error)
+
+	// GetOldestMessages returns limited amount of earliest messages from specified room after specified cursor
+	GetOldestMessages(ctx context.Context, roomID uuid.UUID, after Cursor, limit uint) ([]message.Message, error)
+
+	// GetMessagesBefore returns limited amount of latest messages from specified room before specified cursor
+	GetMessagesBefore(ctx context.Context, roomID uuid.UUID, before Cursor, limit uint) ([]message.Message, error)
 
-	// GetMessages returns limited amount of messages from specified room and after specified time
-	GetMessages(roomID uuid.UUID, afterTime time.Time, limit uint) ([]message.Message, error)
+	// GetMessage returns message from specified room by its id or ErrorNotFound
+	GetMessage(ctx context.Context, roomID, messageID uuid.UUID) (*message.Message, error)
+
+	// GetMessagesFromIDs returns messages from specified room by their ids in any order, unknown ids are skipped
+	GetMessagesFromIDs(ctx context.Context, roomID uuid.UUID, messageIDs []uuid.UUID) ([]message.Message, error)
+
+	// GetReplies returns limited amount of earliest replies on message from specified room after specified cursor
+	GetReplies(ctx context.Context, roomID, messageID uuid.UUID, after Cursor, limit uint) ([]message.Message, error)
+
+	// GetReplyCounts returns counts of replies on specified messages from room by message id,
+	// messages without replies are omitted
+	GetReplyCounts(ctx context.Context, roomID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]int, error)
 
 	// SaveMessage saves given massage
-	SaveMessage(message *message.Message) error
+	SaveMessage(ctx context.Context, message *message.Message) error
+
+	// EditMessage replaces text of message from specified room and sets time of edit as time of edit and update
+	// or returns ErrorNotFound
+	EditMessage(ctx context.Context, roomID, messageID uuid.UUID, text string, editedAt time.Time) error
+
+	// DeleteMessage marks message from specified room as deleted, erases its text and sets time of deletion as
+	// time of edit and update or returns ErrorNotFound, deleted message keeps its place, so cursors pointing at it
+	// stay valid
+	DeleteMessage(ctx context.Context, roomID, messageID uuid.UUID, deletedAt time.Time) error
+
+	// UpdateMessage sets time of update of message from specified room, whose details like reactions changed,
+	// or returns ErrorNotFound
+	UpdateMessage(ctx context.Context, roomID, messageID uuid.UUID, updatedAt time.Time) error
+
+	// GetUpdatedMessages returns limited amount of messages from specified room last updated after time
+	// after and not later than time until ordered by time of update and id
+	GetUpdatedMessages(ctx context.Context, roomID uuid.UUID, after, until time.Time,
+		limit uint) ([]message.Message, error)
+}
+
+// ReactionRepository manages data related to reactions on messages
+type ReactionRepository interface {
+	// AddReaction saves reaction of user on message, saving the same reaction again does nothing
+	AddReaction(ctx context.Context, reaction *reaction.Reaction) error
+
+	// RemoveReaction deletes reaction of user on message or returns ErrorNotFound
+	RemoveReaction(ctx context.Context, reaction *reaction.Reaction) error
+
+	// GetReactionCounts returns counts of reactions on specified messages from room by message id,
+	// messages without reactions are omitted
+	GetReactionCounts(ctx context.Context, roomID uuid.UUID, messageIDs []uuid.UUID) (map[uuid.UUID]reaction.Counts,
+		error)
 }
 
 // UserRepository manages data related to users
 type UserRepository interface {
 	// GetUsersFromIDs returns slice of users by their ids
-	GetUsersFromIDs([]uuid.UUID) ([]user.User, error)
+	GetUsersFromIDs(ctx context.Context, ids []uuid.UUID) ([]user.User, error)
+
+	// GetUserByUsername returns user with specified username or ErrorNotFound
+	GetUserByUsername(ctx context.Context, username string) (*user.User, error)
+
+	// CreateUser saves new user together with hash of its authentication token or returns ErrorUsernameTaken
+	// if username is already used, neither user nor token is saved if any of them fails
+	CreateUser(ctx context.Context, user *user.User, tokenHash string) error
+
+	// GetUserIDByToken returns id of user by hash of authentication token or ErrorNotFound
+	GetUserIDByToken(ctx context.Context, tokenHash string) (uuid.UUID, error)
 }
 
 // RoomRepository manages data related to rooms
 type RoomRepository interface {
 	// IsRoomExist checks if room exist
-	IsRoomExist(roomID uuid.UUID) (bool, error)
+	IsRoomExist(ctx context.Context, roomID uuid.UUID) (bool, error)
+
+	// GetRoom returns room by its id or ErrorNotFound
+	GetRoom(ctx context.Context, roomID uuid.UUID) (*room.Room, error)
+
+	// GetRooms returns all rooms
+	GetRooms(ctx context.Context) ([]room.Room, error)
+
+	// CreateRoom saves new room, room that already exist is kept unchanged
+	CreateRoom(ctx context.Context, room *room.Room) error
+
+	// AddRoomMembers adds users to members of room with room.RoleMember, users that are already members are kept
+	// with their roles
+	AddRoomMembers(ctx context.Context, roomID uuid.UUID, userIDs []uuid.UUID) error
+
+	// IsRoomMember checks if user is a member of room
+	IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+
+	// GetRoomMembers returns all members of room with their mutes
+	GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]room.Member, error)
+
+	// RemoveRoomMember removes user from members of room, removing user that is not a member has no effect
+	RemoveRoomMember(ctx context.Context, roomID, userID uuid.UUID) error
+
+	// DeleteRoom deletes room with all its messages, reactions, members, mutes, bans and moderation log
+	DeleteRoom(ctx context.Context, roomID uuid.UUID) error
+}
+
+// ModerationRepository manages roles and mutes of room members, bans and moderation log of rooms
+type ModerationRepository interface {
+	// GetRoomMember returns member of room with its mute or ErrorNotFound if user is not a member
+	GetRoomMember(ctx context.Context, roomID, userID uuid.UUID) (*room.Member, error)
+
+	// UpdateRoomMember saves role of member of room or returns ErrorNotFound if user is not a member,
+	// mute of member is saved by MuteUser
+	UpdateRoomMember(ctx context.Context, roomID uuid.UUID, member *room.Member) error
+
+	// MuteUser mutes user in room until specified time replacing previous mute, mute is kept when user leaves room
+	MuteUser(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error
+
+	// UnmuteUser lifts mute of user in room, unmuting user that is not muted has no effect
+	UnmuteUser(ctx context.Context, roomID, userID uuid.UUID) error
+
+	// BanUser bans user from room, banning user again has no effect
+	BanUser(ctx context.Context, roomID, userID uuid.UUID) error
+
+	// UnbanUser lifts ban of user from room, unbanning user that is not banned has no effect
+	UnbanUser(ctx context.Context, roomID, userID uuid.UUID) error
+
+	// IsBanned checks if user is banned from room
+	IsBanned(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+
+	// SaveModerationAction saves action to moderation log of room
+	SaveModerationAction(ctx context.Context, action *moderation.Action) error
+
+	// GetModerationActions returns limited amount of latest actions from moderation log of room, newest first
+	GetModerationActions(ctx context.Context, roomID uuid.UUID, limit uint) ([]moderation.Action, error)
+}
+
+// addReactionCount adds count of reactions with emoji on message to counts
+func addReactionCount(counts map[uuid.UUID]reaction.Counts, messageID uuid.UUID, emoji string, count int) {
+	messageCounts, ok := counts[messageID]
+	if !ok {
+		messageCounts = make(reaction.Counts)
+		counts[messageID] = messageCounts
+	}
+	messageCounts[emoji] += count
+}
+
+// scanRoom scans room selected as id, direct, private
+func scanRoom(row rowScanner) (*room.Room, error) {
+	var idStr string
+	var r room.Room
+	if err := row.Scan(&idStr, &r.Direct, &r.Private); err != nil {
+		return nil, err
+	}
+
+	var err error
+	r.ID, err = uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("room id: %w", err)
+	}
+	return &r, nil
 }
@@ -0,0 +1,175 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/repository/repotest"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cassandraURLEnv is an environment variable with Cassandra URL, Cassandra tests are skipped if it's not set
+const cassandraURLEnv = "GLYNN_TEST_CASSANDRA_URL"
+
+// postgresURLEnv is an environment variable with PostgreSQL connection string, PostgreSQL tests are skipped
+// if it's not set
+const postgresURLEnv = "GLYNN_TEST_POSTGRES_URL"
+
+func TestMemory(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		return repository.NewMemoryRepository()
+	})
+}
+
+func TestSQLite(t *testing.T) {
+	log, _ := test.NewNullLogger()
+	newSQLite := func(t *testing.T) *repository.SQLite {
+		sqlite := repository.NewSQLiteRepository(filepath.Join(t.TempDir(), "glynn.db"), log)
+		require.NoError(t, sqlite.Connect(context.Background(), true))
+		t.Cleanup(sqlite.Close)
+		return sqlite
+	}
+
+	t.Run("migrations", func(t *testing.T) {
+		sqlite := newSQLite(t)
+		migrator, err := sqlite.Migrator()
+		require.NoError(t, err)
+
+		statuses, err := migrator.Status(context.Background())
+		require.NoError(t, err)
+		for _, status := range statuses {
+			assert.True(t, status.Applied, "migration %d", status.Version)
+		}
+
+		for range statuses {
+			_, err = migrator.Down(context.Background())
+			require.NoError(t, err)
+		}
+		applied, err := migrator.Up(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, applied, len(statuses))
+	})
+
+	t.Run("failed version save", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "glynn.db")
+		sqlite := repository.NewSQLiteRepository(path, log)
+		require.NoError(t, sqlite.Connect(context.Background(), true))
+		t.Cleanup(sqlite.Close)
+
+		migrator, err := sqlite.Migrator()
+		require.NoError(t, err)
+		reverted, err := migrator.Down(context.Background())
+		require.NoError(t, err)
+
+		db, err := sql.Open("sqlite", path)
+		require.NoError(t, err)
+		defer func() { _ = db.Close() }()
+		_, err = db.Exec("CREATE TRIGGER fail_version BEFORE INSERT ON schema_version " +
+			"BEGIN SELECT RAISE(ABORT, 'failed'); END;")
+		require.NoError(t, err)
+
+		applied, err := migrator.Up(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, applied)
+
+		// Change is rolled back together with its version, so it's applied again by the next run
+		_, err = db.Exec("DROP TRIGGER fail_version;")
+		require.NoError(t, err)
+		applied, err = migrator.Up(context.Background())
+		require.NoError(t, err)
+		if assert.Len(t, applied, 1) {
+			assert.Equal(t, reverted.Version, applied[0].Version)
+		}
+	})
+
+	t.Run("status without schema", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "glynn.db")
+		sqlite := repository.NewSQLiteRepository(path, log)
+		require.NoError(t, sqlite.Connect(context.Background(), false))
+		t.Cleanup(sqlite.Close)
+
+		migrator, err := sqlite.Migrator()
+		require.NoError(t, err)
+
+		statuses, err := migrator.Status(context.Background())
+		require.NoError(t, err)
+		require.NotEmpty(t, statuses)
+		for _, status := range statuses {
+			assert.False(t, status.Applied, "migration %d", status.Version)
+		}
+
+		db, err := sql.Open("sqlite", path)
+		require.NoError(t, err)
+		defer func() { _ = db.Close() }()
+
+		var tables int
+		require.NoError(t, db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table';").Scan(&tables))
+		assert.Zero(t, tables)
+	})
+
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		return newSQLite(t)
+	})
+}
+
+func TestCassandra(t *testing.T) {
+	cassandraURL := os.Getenv(cassandraURLEnv)
+	if cassandraURL == "" {
+		t.Skipf("%s is not set", cassandraURLEnv)
+	}
+
+	log, _ := test.NewNullLogger()
+	config := repository.DefaultCassandraConfig()
+	config.Hosts = []string{cassandraURL}
+	cassandra := repository.NewCassandraRepository(config, log)
+	require.NoError(t, cassandra.Connect(context.Background(), true))
+	t.Cleanup(cassandra.Close)
+
+	t.Run("migrations", func(t *testing.T) {
+		migrator, err := cassandra.Migrator()
+		require.NoError(t, err)
+
+		statuses, err := migrator.Status(context.Background())
+		require.NoError(t, err)
+		for _, status := range statuses {
+			assert.True(t, status.Applied, "migration %d", status.Version)
+		}
+	})
+
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		return cassandra
+	})
+}
+
+func TestPostgres(t *testing.T) {
+	postgresURL := os.Getenv(postgresURLEnv)
+	if postgresURL == "" {
+		t.Skipf("%s is not set", postgresURLEnv)
+	}
+
+	log, _ := test.NewNullLogger()
+	postgres := repository.NewPostgresRepository(postgresURL, log)
+	require.NoError(t, postgres.Connect(context.Background(), true))
+	t.Cleanup(postgres.Close)
+
+	t.Run("migrations", func(t *testing.T) {
+		migrator, err := postgres.Migrator()
+		require.NoError(t, err)
+
+		statuses, err := migrator.Status(context.Background())
+		require.NoError(t, err)
+		for _, status := range statuses {
+			assert.True(t, status.Applied, "migration %d", status.Version)
+		}
+	})
+
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		return postgres
+	})
+}
@@ -0,0 +1,1273 @@
+// Package repotest provides behavioural tests which every repository.Repository implementation must pass
+package repotest
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Constructor creates repository under test
+type Constructor func(t *testing.T) repository.Repository
+
+// Run runs all behavioural tests against repository created by constructor
+func Run(t *testing.T, newRepo Constructor) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo repository.Repository)
+	}{
+		{name: "GetMessages", test: testGetMessages},
+		{name: "GetOldestMessages", test: testGetOldestMessages},
+		{name: "GetMessagesBefore", test: testGetMessagesBefore},
+		{name: "MessagesAcrossDays", test: testMessagesAcrossDays},
+		{name: "MessagesAtSameTime", test: testMessagesAtSameTime},
+		{name: "GetMessageTime", test: testGetMessageTime},
+		{name: "GetMessage", test: testGetMessage},
+		{name: "EditMessage", test: testEditMessage},
+		{name: "DeleteMessage", test: testDeleteMessage},
+		{name: "UpdateMessage", test: testUpdateMessage},
+		{name: "GetUpdatedMessages", test: testGetUpdatedMessages},
+		{name: "GetMessagesFromIDs", test: testGetMessagesFromIDs},
+		{name: "Replies", test: testReplies},
+		{name: "Reactions", test: testReactions},
+		{name: "GetUsersFromIDs", test: testGetUsersFromIDs},
+		{name: "CreateUser", test: testCreateUser},
+		{name: "Tokens", test: testTokens},
+		{name: "IsRoomExist", test: testIsRoomExist},
+		{name: "GetRoom", test: testGetRoom},
+		{name: "RoomMembers", test: testRoomMembers},
+		{name: "RoomMember", test: testRoomMember},
+		{name: "Mutes", test: testMutes},
+		{name: "Bans", test: testBans},
+		{name: "ModerationActions", test: testModerationActions},
+		{name: "Rooms", test: testRooms},
+		{name: "CanceledContext", test: testCanceledContext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+// startTime is a base time for generated messages, storages are not required to keep more than millisecond precision
+var startTime = time.Unix(1621521072, 0).UTC()
+
+func newMessages(roomID uuid.UUID, count int) []message.Message {
+	messages := make([]message.Message, count)
+	for i := range messages {
+		messages[i] = message.Message{
+			ID:     uuid.New(),
+			UserID: uuid.New(),
+			RoomID: roomID,
+			Text:   "message " + strconv.Itoa(i),
+			Time:   startTime.Add(time.Second * time.Duration(i)),
+		}
+	}
+	return messages
+}
+
+func saveMessages(t *testing.T, repo repository.Repository, messages []message.Message, order []int) {
+	t.Helper()
+
+	for _, i := range order {
+		require.NoError(t, repo.SaveMessage(context.Background(), &messages[i]))
+	}
+}
+
+func testGetMessages(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 5)
+	saveMessages(t, repo, messages, []int{3, 0, 4, 1, 2})
+
+	otherRoomMessages := newMessages(uuid.New(), 2)
+	saveMessages(t, repo, otherRoomMessages, []int{0, 1})
+
+	type args struct {
+		after repository.Cursor
+		limit uint
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []message.Message
+	}{
+		{
+			name:     "all ordered by time",
+			args:     args{after: repository.Cursor{}, limit: 10},
+			expected: messages,
+		},
+		{
+			name:     "limit keeps newest",
+			args:     args{after: repository.Cursor{}, limit: 2},
+			expected: messages[3:],
+		},
+		{
+			name:     "strictly after time",
+			args:     args{after: repository.TimeCursor(messages[1].Time), limit: 10},
+			expected: messages[2:],
+		},
+		{
+			name:     "after time with limit",
+			args:     args{after: repository.TimeCursor(messages[0].Time), limit: 3},
+			expected: messages[2:],
+		},
+		{
+			name:     "between messages",
+			args:     args{after: repository.TimeCursor(messages[2].Time.Add(time.Millisecond)), limit: 10},
+			expected: messages[3:],
+		},
+		{
+			name:     "after last",
+			args:     args{after: repository.TimeCursor(messages[4].Time), limit: 10},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.GetMessages(context.Background(), roomID, tt.args.after, tt.args.limit)
+			assert.NoError(t, err)
+			assertMessages(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("unknown room", func(t *testing.T) {
+		actual, err := repo.GetMessages(context.Background(), uuid.New(), repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+func testGetOldestMessages(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 5)
+	saveMessages(t, repo, messages, []int{3, 0, 4, 1, 2})
+
+	otherRoomMessages := newMessages(uuid.New(), 2)
+	saveMessages(t, repo, otherRoomMessages, []int{0, 1})
+
+	type args struct {
+		after repository.Cursor
+		limit uint
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []message.Message
+	}{
+		{
+			name:     "all ordered by time",
+			args:     args{after: repository.Cursor{}, limit: 10},
+			expected: messages,
+		},
+		{
+			name:     "limit keeps oldest",
+			args:     args{after: repository.Cursor{}, limit: 2},
+			expected: messages[:2],
+		},
+		{
+			name:     "strictly after time with limit",
+			args:     args{after: repository.TimeCursor(messages[1].Time), limit: 2},
+			expected: messages[2:4],
+		},
+		{
+			name:     "between messages",
+			args:     args{after: repository.TimeCursor(messages[2].Time.Add(time.Millisecond)), limit: 10},
+			expected: messages[3:],
+		},
+		{
+			// Storages keep time with lower precision, but message at stored time is still before cursor
+			name:     "start of time more precise than storage",
+			args:     args{after: repository.Cursor{Time: messages[2].Time.Add(time.Nanosecond)}, limit: 10},
+			expected: messages[3:],
+		},
+		{
+			name:     "after last",
+			args:     args{after: repository.TimeCursor(messages[4].Time), limit: 10},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.GetOldestMessages(context.Background(), roomID, tt.args.after, tt.args.limit)
+			assert.NoError(t, err)
+			assertMessages(t, tt.expected, actual)
+		})
+	}
+}
+
+func testGetMessagesBefore(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 5)
+	saveMessages(t, repo, messages, []int{3, 0, 4, 1, 2})
+
+	otherRoomMessages := newMessages(uuid.New(), 2)
+	saveMessages(t, repo, otherRoomMessages, []int{0, 1})
+
+	type args struct {
+		before repository.Cursor
+		limit  uint
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []message.Message
+	}{
+		{
+			name:     "all ordered by time",
+			args:     args{before: repository.Cursor{Time: messages[4].Time.Add(time.Millisecond)}, limit: 10},
+			expected: messages,
+		},
+		{
+			name:     "strictly before time",
+			args:     args{before: repository.Cursor{Time: messages[3].Time}, limit: 10},
+			expected: messages[:3],
+		},
+		{
+			name:     "limit keeps newest",
+			args:     args{before: repository.Cursor{Time: messages[3].Time}, limit: 2},
+			expected: messages[1:3],
+		},
+		{
+			name:     "between messages",
+			args:     args{before: repository.Cursor{Time: messages[2].Time.Add(-time.Millisecond)}, limit: 10},
+			expected: messages[:2],
+		},
+		{
+			name:     "before first",
+			args:     args{before: repository.Cursor{Time: messages[0].Time}, limit: 10},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.GetMessagesBefore(context.Background(), roomID, tt.args.before, tt.args.limit)
+			assert.NoError(t, err)
+			assertMessages(t, tt.expected, actual)
+		})
+	}
+
+	t.Run("unknown room", func(t *testing.T) {
+		actual, err := repo.GetMessagesBefore(context.Background(), uuid.New(), repository.TimeCursor(time.Now()), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+// testMessagesAcrossDays checks that messages are selected the same way when storage partitions them by time
+func testMessagesAcrossDays(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 8)
+	for i := range messages {
+		messages[i].Time = startTime.Add(10 * time.Hour * time.Duration(i))
+	}
+	saveMessages(t, repo, messages, []int{5, 2, 7, 0, 3, 6, 1, 4})
+
+	t.Run("all", func(t *testing.T) {
+		actual, err := repo.GetMessages(context.Background(), roomID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assertMessages(t, messages, actual)
+	})
+
+	t.Run("newest", func(t *testing.T) {
+		actual, err := repo.GetMessages(context.Background(), roomID, repository.TimeCursor(messages[1].Time), 4)
+		assert.NoError(t, err)
+		assertMessages(t, messages[4:], actual)
+	})
+
+	t.Run("oldest", func(t *testing.T) {
+		actual, err := repo.GetOldestMessages(context.Background(), roomID, repository.TimeCursor(messages[1].Time), 4)
+		assert.NoError(t, err)
+		assertMessages(t, messages[2:6], actual)
+	})
+
+	t.Run("before", func(t *testing.T) {
+		actual, err := repo.GetMessagesBefore(context.Background(), roomID, repository.Cursor{Time: messages[6].Time}, 4)
+		assert.NoError(t, err)
+		assertMessages(t, messages[2:6], actual)
+	})
+
+	t.Run("empty days", func(t *testing.T) {
+		actual, err := repo.GetOldestMessages(context.Background(), roomID, repository.TimeCursor(messages[7].Time), 4)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+
+		actual, err = repo.GetMessagesBefore(context.Background(), roomID, repository.Cursor{Time: messages[0].Time}, 4)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+// testMessagesAtSameTime checks that messages sent at the same time are all kept and paged through exactly once,
+// storages may order such messages by id differently
+func testMessagesAtSameTime(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 5)
+	for i := range messages {
+		messages[i].Time = startTime
+	}
+	saveMessages(t, repo, messages, []int{3, 0, 4, 1, 2})
+
+	all, err := repo.GetMessages(context.Background(), roomID, repository.Cursor{}, 10)
+	require.NoError(t, err)
+	require.Len(t, all, len(messages))
+	assert.ElementsMatch(t, messageIDs(messages), messageIDs(all))
+
+	cursorOf := func(msg message.Message) repository.Cursor {
+		msgTime, err := repo.GetMessageTime(context.Background(), roomID, msg.ID)
+		require.NoError(t, err)
+		return repository.MessageCursor(msgTime, msg.ID)
+	}
+
+	t.Run("forward", func(t *testing.T) {
+		var paged []message.Message
+		cursor := repository.Cursor{}
+		for i := 0; i < len(messages); i++ {
+			page, err := repo.GetOldestMessages(context.Background(), roomID, cursor, 2)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			paged = append(paged, page...)
+			cursor = cursorOf(page[len(page)-1])
+		}
+		assertMessages(t, all, paged)
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		var paged []message.Message
+		cursor := repository.TimeCursor(startTime)
+		for i := 0; i < len(messages); i++ {
+			page, err := repo.GetMessagesBefore(context.Background(), roomID, cursor, 2)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			paged = append(page, paged...)
+			cursor = cursorOf(page[0])
+		}
+		assertMessages(t, all, paged)
+	})
+
+	t.Run("newest after message", func(t *testing.T) {
+		actual, err := repo.GetMessages(context.Background(), roomID, cursorOf(all[1]), 2)
+		assert.NoError(t, err)
+		assertMessages(t, all[3:], actual)
+	})
+
+	t.Run("after time", func(t *testing.T) {
+		actual, err := repo.GetOldestMessages(context.Background(), roomID, repository.TimeCursor(startTime), 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+func messageIDs(messages []message.Message) []uuid.UUID {
+	ids := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func testGetMessageTime(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 2)
+	saveMessages(t, repo, messages, []int{0, 1})
+
+	t.Run("ok", func(t *testing.T) {
+		for _, msg := range messages {
+			actual, err := repo.GetMessageTime(context.Background(), roomID, msg.ID)
+			assert.NoError(t, err)
+			assert.True(t, msg.Time.Equal(actual), "expected: %s, actual: %s", msg.Time, actual)
+		}
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		_, err := repo.GetMessageTime(context.Background(), roomID, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		_, err := repo.GetMessageTime(context.Background(), uuid.New(), messages[0].ID)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testGetMessage(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 2)
+	saveMessages(t, repo, messages, []int{0, 1})
+
+	t.Run("ok", func(t *testing.T) {
+		for _, msg := range messages {
+			actual, err := repo.GetMessage(context.Background(), roomID, msg.ID)
+			require.NoError(t, err)
+			assertMessages(t, []message.Message{msg}, []message.Message{*actual})
+		}
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		_, err := repo.GetMessage(context.Background(), roomID, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		_, err := repo.GetMessage(context.Background(), uuid.New(), messages[0].ID)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testEditMessage(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 3)
+	saveMessages(t, repo, messages, []int{0, 1, 2})
+
+	t.Run("ok", func(t *testing.T) {
+		editedAt := startTime.Add(time.Hour)
+		err := repo.EditMessage(context.Background(), roomID, messages[1].ID, "edited", editedAt)
+		require.NoError(t, err)
+		messages[1].Text = "edited"
+		messages[1].EditedAt = &editedAt
+		messages[1].UpdatedAt = &editedAt
+
+		// Edited message keeps its place
+		actual, err := repo.GetMessages(context.Background(), roomID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assertMessages(t, messages, actual)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		err := repo.EditMessage(context.Background(), roomID, uuid.New(), "edited", startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		err := repo.EditMessage(context.Background(), uuid.New(), messages[0].ID, "edited", startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testDeleteMessage(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 3)
+	saveMessages(t, repo, messages, []int{0, 1, 2})
+
+	t.Run("ok", func(t *testing.T) {
+		deletedAt := startTime.Add(time.Hour)
+		require.NoError(t, repo.DeleteMessage(context.Background(), roomID, messages[1].ID, deletedAt))
+		messages[1].Text = ""
+		messages[1].Deleted = true
+		messages[1].EditedAt = &deletedAt
+		messages[1].UpdatedAt = &deletedAt
+
+		actual, err := repo.GetMessages(context.Background(), roomID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assertMessages(t, messages, actual)
+
+		// Deleted message still can be used as cursor
+		deleted := repository.MessageCursor(messages[1].Time, messages[1].ID)
+		actual, err = repo.GetOldestMessages(context.Background(), roomID, deleted, 10)
+		assert.NoError(t, err)
+		assertMessages(t, messages[2:], actual)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		err := repo.DeleteMessage(context.Background(), roomID, uuid.New(), startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		err := repo.DeleteMessage(context.Background(), uuid.New(), messages[0].ID, startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testUpdateMessage(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	roomID := uuid.New()
+	messages := newMessages(roomID, 2)
+	saveMessages(t, repo, messages, []int{0, 1})
+
+	t.Run("ok", func(t *testing.T) {
+		edited := startTime.Add(time.Minute)
+		updated := startTime.Add(time.Hour)
+		reupdated := updated.Add(time.Hour)
+		require.NoError(t, repo.EditMessage(ctx, roomID, messages[0].ID, "edited", edited))
+		require.NoError(t, repo.UpdateMessage(ctx, roomID, messages[1].ID, updated))
+		require.NoError(t, repo.UpdateMessage(ctx, roomID, messages[0].ID, reupdated))
+		messages[0].Text, messages[0].EditedAt, messages[0].UpdatedAt = "edited", &edited, &reupdated
+		messages[1].UpdatedAt = &updated
+
+		// Update keeps text and time of edit, but orders message by time of update
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, startTime, reupdated, 10)
+		assert.NoError(t, err)
+		assertMessages(t, []message.Message{messages[1], messages[0]}, actual)
+
+		actual, err = repo.GetUpdatedMessages(ctx, roomID, startTime, updated, 10)
+		assert.NoError(t, err)
+		assertMessages(t, messages[1:], actual)
+	})
+
+	t.Run("unknown id", func(t *testing.T) {
+		err := repo.UpdateMessage(ctx, roomID, uuid.New(), startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("other room", func(t *testing.T) {
+		err := repo.UpdateMessage(ctx, uuid.New(), messages[0].ID, startTime)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testGetUpdatedMessages(t *testing.T, repo repository.Repository) {
+	ctx := context.Background()
+	roomID := uuid.New()
+	messages := newMessages(roomID, 4)
+	saveMessages(t, repo, messages, []int{0, 1, 2, 3})
+
+	// Edits are days apart, so storages splitting them by time are covered
+	edited := startTime.Add(time.Hour)
+	deleted := edited.Add(time.Minute)
+	overwritten := edited.Add(2 * time.Minute)
+	reedited := startTime.Add(48 * time.Hour)
+	require.NoError(t, repo.EditMessage(ctx, roomID, messages[2].ID, "edited", edited))
+	require.NoError(t, repo.DeleteMessage(ctx, roomID, messages[0].ID, deleted))
+	require.NoError(t, repo.EditMessage(ctx, roomID, messages[3].ID, "overwritten", overwritten))
+	require.NoError(t, repo.EditMessage(ctx, roomID, messages[3].ID, "reedited", reedited))
+	messages[2].Text, messages[2].EditedAt, messages[2].UpdatedAt = "edited", &edited, &edited
+	messages[0].Text, messages[0].Deleted, messages[0].EditedAt, messages[0].UpdatedAt = "", true, &deleted, &deleted
+	messages[3].Text, messages[3].EditedAt, messages[3].UpdatedAt = "reedited", &reedited, &reedited
+	expected := []message.Message{messages[2], messages[0], messages[3]}
+	latest := reedited.Add(time.Hour)
+
+	t.Run("all", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, startTime, latest, 10)
+		assert.NoError(t, err)
+		assertMessages(t, expected, actual)
+	})
+
+	t.Run("after time", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, edited, latest, 10)
+		assert.NoError(t, err)
+		assertMessages(t, expected[1:], actual)
+	})
+
+	t.Run("latest edit only", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, deleted, latest, 10)
+		assert.NoError(t, err)
+		assertMessages(t, expected[2:], actual)
+	})
+
+	t.Run("until time", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, startTime, deleted, 10)
+		assert.NoError(t, err)
+		assertMessages(t, expected[:2], actual)
+
+		// Message edited again later is returned only by requests covering its latest edit
+		actual, err = repo.GetUpdatedMessages(ctx, roomID, deleted, overwritten, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, startTime, latest, 2)
+		assert.NoError(t, err)
+		assertMessages(t, expected[:2], actual)
+	})
+
+	t.Run("nothing edited", func(t *testing.T) {
+		actual, err := repo.GetUpdatedMessages(ctx, roomID, reedited, latest, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+
+		actual, err = repo.GetUpdatedMessages(ctx, uuid.New(), startTime, latest, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+func testReactions(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 3)
+	saveMessages(t, repo, messages, []int{0, 1, 2})
+	userIDs := []uuid.UUID{uuid.New(), uuid.New()}
+
+	newReaction := func(messageID, userID uuid.UUID, emoji string) *reaction.Reaction {
+		return &reaction.Reaction{RoomID: roomID, MessageID: messageID, UserID: userID, Emoji: emoji}
+	}
+
+	t.Run("add", func(t *testing.T) {
+		require.NoError(t, repo.AddReaction(context.Background(), newReaction(messages[0].ID, userIDs[0], "👍")))
+		require.NoError(t, repo.AddReaction(context.Background(), newReaction(messages[0].ID, userIDs[1], "👍")))
+		require.NoError(t, repo.AddReaction(context.Background(), newReaction(messages[0].ID, userIDs[0], "❤️")))
+		require.NoError(t, repo.AddReaction(context.Background(), newReaction(messages[1].ID, userIDs[1], "🎉")))
+
+		// The same reaction is counted once
+		require.NoError(t, repo.AddReaction(context.Background(), newReaction(messages[1].ID, userIDs[1], "🎉")))
+
+		actual, err := repo.GetReactionCounts(context.Background(), roomID, messageIDs(messages))
+		assert.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]reaction.Counts{
+			messages[0].ID: {"👍": 2, "❤️": 1},
+			messages[1].ID: {"🎉": 1},
+		}, actual)
+	})
+
+	t.Run("only requested", func(t *testing.T) {
+		actual, err := repo.GetReactionCounts(context.Background(), roomID, messageIDs(messages[1:]))
+		assert.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]reaction.Counts{messages[1].ID: {"🎉": 1}}, actual)
+
+		actual, err = repo.GetReactionCounts(context.Background(), roomID, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+
+		actual, err = repo.GetReactionCounts(context.Background(), uuid.New(), messageIDs(messages))
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		require.NoError(t, repo.RemoveReaction(context.Background(), newReaction(messages[0].ID, userIDs[0], "👍")))
+		require.NoError(t, repo.RemoveReaction(context.Background(), newReaction(messages[1].ID, userIDs[1], "🎉")))
+
+		actual, err := repo.GetReactionCounts(context.Background(), roomID, messageIDs(messages))
+		assert.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]reaction.Counts{messages[0].ID: {"👍": 1, "❤️": 1}}, actual)
+	})
+
+	t.Run("remove unknown", func(t *testing.T) {
+		err := repo.RemoveReaction(context.Background(), newReaction(messages[0].ID, userIDs[0], "👍"))
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+
+		err = repo.RemoveReaction(context.Background(), newReaction(messages[2].ID, userIDs[0], "👍"))
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testGetMessagesFromIDs(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 3)
+	saveMessages(t, repo, messages, []int{0, 1, 2})
+
+	otherRoomMessages := newMessages(uuid.New(), 1)
+	saveMessages(t, repo, otherRoomMessages, []int{0})
+
+	getMessages := func(t *testing.T, ids []uuid.UUID) []message.Message {
+		t.Helper()
+
+		actual, err := repo.GetMessagesFromIDs(context.Background(), roomID, ids)
+		require.NoError(t, err)
+		// Messages are returned in any order
+		sort.Slice(actual, func(i, j int) bool {
+			return actual[i].Time.Before(actual[j].Time)
+		})
+		return actual
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		actual := getMessages(t, []uuid.UUID{messages[2].ID, messages[0].ID})
+		assertMessages(t, []message.Message{messages[0], messages[2]}, actual)
+	})
+
+	t.Run("unknown or other room", func(t *testing.T) {
+		actual := getMessages(t, []uuid.UUID{messages[1].ID, uuid.New(), otherRoomMessages[0].ID})
+		assertMessages(t, messages[1:2], actual)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		assert.Empty(t, getMessages(t, nil))
+	})
+}
+
+func testReplies(t *testing.T, repo repository.Repository) {
+	roomID := uuid.New()
+	messages := newMessages(roomID, 6)
+	parent, otherParent := messages[0], messages[2]
+	for _, i := range []int{1, 3, 5} {
+		messages[i].ReplyTo = &parent.ID
+	}
+	messages[4].ReplyTo = &otherParent.ID
+	saveMessages(t, repo, messages, []int{5, 0, 3, 1, 2, 4})
+	replies := []message.Message{messages[1], messages[3], messages[5]}
+
+	t.Run("get message", func(t *testing.T) {
+		actual, err := repo.GetMessage(context.Background(), roomID, messages[1].ID)
+		require.NoError(t, err)
+		assertMessages(t, messages[1:2], []message.Message{*actual})
+	})
+
+	t.Run("all", func(t *testing.T) {
+		actual, err := repo.GetReplies(context.Background(), roomID, parent.ID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assertMessages(t, replies, actual)
+	})
+
+	t.Run("limit & cursor", func(t *testing.T) {
+		actual, err := repo.GetReplies(context.Background(), roomID, parent.ID, repository.Cursor{}, 2)
+		assert.NoError(t, err)
+		assertMessages(t, replies[:2], actual)
+
+		after := repository.MessageCursor(replies[1].Time, replies[1].ID)
+		actual, err = repo.GetReplies(context.Background(), roomID, parent.ID, after, 2)
+		assert.NoError(t, err)
+		assertMessages(t, replies[2:], actual)
+	})
+
+	t.Run("no replies", func(t *testing.T) {
+		actual, err := repo.GetReplies(context.Background(), roomID, messages[1].ID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+
+		actual, err = repo.GetReplies(context.Background(), uuid.New(), parent.ID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("counts", func(t *testing.T) {
+		actual, err := repo.GetReplyCounts(context.Background(), roomID, messageIDs(messages))
+		assert.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]int{parent.ID: 3, otherParent.ID: 1}, actual)
+
+		actual, err = repo.GetReplyCounts(context.Background(), roomID, []uuid.UUID{otherParent.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]int{otherParent.ID: 1}, actual)
+
+		actual, err = repo.GetReplyCounts(context.Background(), roomID, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+}
+
+// newUsername returns username unique across test runs
+func newUsername() string {
+	return "user_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func newUsers(t *testing.T, repo repository.Repository, count int) []user.User {
+	t.Helper()
+
+	users := make([]user.User, count)
+	for i := range users {
+		users[i] = user.User{
+			ID:       uuid.New(),
+			Username: newUsername(),
+		}
+		require.NoError(t, repo.CreateUser(context.Background(), &users[i], uuid.New().String()))
+	}
+	return users
+}
+
+func testGetUsersFromIDs(t *testing.T, repo repository.Repository) {
+	users := newUsers(t, repo, 3)
+
+	type args struct {
+		ids []uuid.UUID
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected []user.User
+	}{
+		{
+			name:     "empty",
+			args:     args{ids: []uuid.UUID{}},
+			expected: nil,
+		},
+		{
+			name:     "all",
+			args:     args{ids: []uuid.UUID{users[0].ID, users[1].ID, users[2].ID}},
+			expected: users,
+		},
+		{
+			name:     "duplicates",
+			args:     args{ids: []uuid.UUID{users[1].ID, users[0].ID, users[1].ID, users[1].ID}},
+			expected: users[:2],
+		},
+		{
+			name:     "missing",
+			args:     args{ids: []uuid.UUID{uuid.New(), users[2].ID, uuid.New()}},
+			expected: users[2:],
+		},
+		{
+			name:     "only missing",
+			args:     args{ids: []uuid.UUID{uuid.New(), uuid.New()}},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := repo.GetUsersFromIDs(context.Background(), tt.args.ids)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, actual)
+		})
+	}
+}
+
+func testCreateUser(t *testing.T, repo repository.Repository) {
+	usr := newUsers(t, repo, 1)[0]
+
+	t.Run("get by username", func(t *testing.T) {
+		actual, err := repo.GetUserByUsername(context.Background(), usr.Username)
+		assert.NoError(t, err)
+		assert.Equal(t, &usr, actual)
+	})
+
+	t.Run("get by id", func(t *testing.T) {
+		actual, err := repo.GetUsersFromIDs(context.Background(), []uuid.UUID{usr.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, []user.User{usr}, actual)
+	})
+
+	t.Run("unknown username", func(t *testing.T) {
+		_, err := repo.GetUserByUsername(context.Background(), newUsername())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+
+	t.Run("username taken", func(t *testing.T) {
+		duplicate := &user.User{
+			ID:       uuid.New(),
+			Username: usr.Username,
+		}
+		tokenHash := uuid.New().String()
+		err := repo.CreateUser(context.Background(), duplicate, tokenHash)
+		assert.ErrorIs(t, err, repository.ErrorUsernameTaken)
+
+		actual, err := repo.GetUsersFromIDs(context.Background(), []uuid.UUID{duplicate.ID})
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+
+		_, err = repo.GetUserIDByToken(context.Background(), tokenHash)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testTokens(t *testing.T, repo repository.Repository) {
+	usr := user.User{ID: uuid.New(), Username: newUsername()}
+	tokenHash := uuid.New().String()
+	require.NoError(t, repo.CreateUser(context.Background(), &usr, tokenHash))
+
+	t.Run("ok", func(t *testing.T) {
+		actual, err := repo.GetUserIDByToken(context.Background(), tokenHash)
+		assert.NoError(t, err)
+		assert.Equal(t, usr.ID, actual)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := repo.GetUserIDByToken(context.Background(), uuid.New().String())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func newRoom(t *testing.T, repo repository.Repository) room.Room {
+	t.Helper()
+
+	r := room.Room{ID: uuid.New()}
+	require.NoError(t, repo.CreateRoom(context.Background(), &r))
+	return r
+}
+
+func testIsRoomExist(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+
+	ok, err := repo.IsRoomExist(context.Background(), roomID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repo.IsRoomExist(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func testGetRoom(t *testing.T, repo repository.Repository) {
+	r := newRoom(t, repo)
+
+	t.Run("ok", func(t *testing.T) {
+		actual, err := repo.GetRoom(context.Background(), r.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &r, actual)
+	})
+
+	t.Run("direct kept on create again", func(t *testing.T) {
+		direct := room.Room{ID: uuid.New(), Direct: true}
+		require.NoError(t, repo.CreateRoom(context.Background(), &direct))
+		require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: direct.ID}))
+
+		actual, err := repo.GetRoom(context.Background(), direct.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &direct, actual)
+	})
+
+	t.Run("private", func(t *testing.T) {
+		private := room.Room{ID: uuid.New(), Private: true}
+		require.NoError(t, repo.CreateRoom(context.Background(), &private))
+
+		actual, err := repo.GetRoom(context.Background(), private.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, &private, actual)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repo.GetRoom(context.Background(), uuid.New())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testRoomMembers(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+	members := []uuid.UUID{uuid.New(), uuid.New()}
+
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, members))
+	// Adding the same member again is not an error
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, members[:1]))
+
+	for _, userID := range members {
+		ok, err := repo.IsRoomMember(context.Background(), roomID, userID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	ok, err := repo.IsRoomMember(context.Background(), roomID, uuid.New())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = repo.IsRoomMember(context.Background(), uuid.New(), members[0])
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	actual, err := repo.GetRoomMembers(context.Background(), roomID)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []room.Member{
+		{UserID: members[0], Role: room.RoleMember},
+		{UserID: members[1], Role: room.RoleMember},
+	}, actual)
+
+	require.NoError(t, repo.RemoveRoomMember(context.Background(), roomID, members[0]))
+	// Removing user that is not a member is not an error
+	require.NoError(t, repo.RemoveRoomMember(context.Background(), roomID, members[0]))
+
+	ok, err = repo.IsRoomMember(context.Background(), roomID, members[0])
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	actual, err = repo.GetRoomMembers(context.Background(), roomID)
+	assert.NoError(t, err)
+	assert.Equal(t, []room.Member{{UserID: members[1], Role: room.RoleMember}}, actual)
+
+	actual, err = repo.GetRoomMembers(context.Background(), uuid.New())
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+}
+
+func testRoomMember(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+	userID := uuid.New()
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{userID}))
+
+	t.Run("update", func(t *testing.T) {
+		member, err := repo.GetRoomMember(context.Background(), roomID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, &room.Member{UserID: userID, Role: room.RoleMember}, member)
+
+		member.Role = room.RoleModerator
+		require.NoError(t, repo.UpdateRoomMember(context.Background(), roomID, member))
+		// Adding the same member again keeps its role
+		require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{userID}))
+
+		actual, err := repo.GetRoomMember(context.Background(), roomID, userID)
+		require.NoError(t, err)
+		assert.Equal(t, &room.Member{UserID: userID, Role: room.RoleModerator}, actual)
+	})
+
+	t.Run("unknown member", func(t *testing.T) {
+		_, err := repo.GetRoomMember(context.Background(), roomID, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+
+		err = repo.UpdateRoomMember(context.Background(), roomID, &room.Member{UserID: uuid.New(), Role: room.RoleOwner})
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+	})
+}
+
+func testMutes(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+	mutedID, userID := uuid.New(), uuid.New()
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{mutedID, userID}))
+
+	until := startTime.Add(time.Hour)
+	require.NoError(t, repo.MuteUser(context.Background(), roomID, mutedID, startTime))
+	// Muting user again replaces previous mute
+	require.NoError(t, repo.MuteUser(context.Background(), roomID, mutedID, until))
+	assertMuted(t, repo, roomID, mutedID, &until)
+
+	members, err := repo.GetRoomMembers(context.Background(), roomID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	for _, member := range members {
+		if member.UserID == mutedID {
+			if assert.NotNil(t, member.MutedUntil) {
+				assert.True(t, until.Equal(*member.MutedUntil))
+			}
+		} else {
+			assert.Nil(t, member.MutedUntil)
+		}
+	}
+
+	t.Run("rejoin", func(t *testing.T) {
+		require.NoError(t, repo.RemoveRoomMember(context.Background(), roomID, mutedID))
+		require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{mutedID}))
+		assertMuted(t, repo, roomID, mutedID, &until)
+	})
+
+	t.Run("update role", func(t *testing.T) {
+		err := repo.UpdateRoomMember(context.Background(), roomID,
+			&room.Member{UserID: mutedID, Role: room.RoleModerator})
+		require.NoError(t, err)
+		assertMuted(t, repo, roomID, mutedID, &until)
+	})
+
+	t.Run("unmute", func(t *testing.T) {
+		require.NoError(t, repo.UnmuteUser(context.Background(), roomID, mutedID))
+		// Unmuting user that is not muted is not an error
+		require.NoError(t, repo.UnmuteUser(context.Background(), roomID, mutedID))
+		assertMuted(t, repo, roomID, mutedID, nil)
+	})
+}
+
+// assertMuted checks that member of room is muted until specified time or not muted if it's nil
+func assertMuted(t *testing.T, repo repository.Repository, roomID, userID uuid.UUID, until *time.Time) {
+	t.Helper()
+
+	member, err := repo.GetRoomMember(context.Background(), roomID, userID)
+	require.NoError(t, err)
+	if until == nil {
+		assert.Nil(t, member.MutedUntil)
+	} else if assert.NotNil(t, member.MutedUntil) {
+		assert.True(t, until.Equal(*member.MutedUntil), "expected: %s, actual: %s", until, member.MutedUntil)
+	}
+}
+
+func testBans(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+	bannedID := uuid.New()
+
+	require.NoError(t, repo.BanUser(context.Background(), roomID, bannedID))
+	// Banning user again is not an error
+	require.NoError(t, repo.BanUser(context.Background(), roomID, bannedID))
+
+	ok, err := repo.IsBanned(context.Background(), roomID, bannedID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = repo.IsBanned(context.Background(), uuid.New(), bannedID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, repo.UnbanUser(context.Background(), roomID, bannedID))
+	// Unbanning user that is not banned is not an error
+	require.NoError(t, repo.UnbanUser(context.Background(), roomID, bannedID))
+
+	ok, err = repo.IsBanned(context.Background(), roomID, bannedID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func testModerationActions(t *testing.T, repo repository.Repository) {
+	roomID := newRoom(t, repo).ID
+	moderatorID, userID := uuid.New(), uuid.New()
+	until := startTime.Add(time.Hour)
+	actions := []moderation.Action{
+		{ID: uuid.New(), RoomID: roomID, ModeratorID: &moderatorID, TargetID: userID, Kind: moderation.KindRole,
+			Role: room.RoleModerator, Time: startTime},
+		{ID: uuid.New(), RoomID: roomID, TargetID: userID, Kind: moderation.KindMute, Until: &until,
+			Time: startTime.Add(time.Minute)},
+		{ID: uuid.New(), RoomID: roomID, ModeratorID: &moderatorID, TargetID: userID, Kind: moderation.KindBan,
+			Time: startTime.Add(2 * time.Minute)},
+	}
+	// Saved out of order
+	for _, i := range []int{1, 0, 2} {
+		require.NoError(t, repo.SaveModerationAction(context.Background(), &actions[i]))
+	}
+
+	actual, err := repo.GetModerationActions(context.Background(), roomID, 10)
+	assert.NoError(t, err)
+	assertActions(t, []moderation.Action{actions[2], actions[1], actions[0]}, actual)
+
+	actual, err = repo.GetModerationActions(context.Background(), roomID, 2)
+	assert.NoError(t, err)
+	assertActions(t, []moderation.Action{actions[2], actions[1]}, actual)
+
+	actual, err = repo.GetModerationActions(context.Background(), uuid.New(), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+}
+
+// assertActions checks that moderation actions are equal and in the same order, ignoring time location
+func assertActions(t *testing.T, expected, actual []moderation.Action) {
+	t.Helper()
+
+	if !assert.Len(t, actual, len(expected)) {
+		return
+	}
+	for i := range expected {
+		exp, act := expected[i], actual[i]
+		assert.True(t, exp.Time.Equal(act.Time), "action %d time, expected: %s, actual: %s", i, exp.Time, act.Time)
+		exp.Time, act.Time = time.Time{}, time.Time{}
+		if exp.Until != nil && act.Until != nil {
+			assert.True(t, exp.Until.Equal(*act.Until), "action %d until, expected: %s, actual: %s",
+				i, exp.Until, act.Until)
+			exp.Until, act.Until = nil, nil
+		}
+		assert.Equal(t, exp, act, "action %d", i)
+	}
+}
+
+func testRooms(t *testing.T, repo repository.Repository) {
+	rooms := []room.Room{newRoom(t, repo), newRoom(t, repo)}
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := repo.GetRooms(context.Background())
+		assert.NoError(t, err)
+		assert.Subset(t, actual, rooms)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		deleted, kept := rooms[0], rooms[1]
+		deletedMessages := newMessages(deleted.ID, 2)
+		saveMessages(t, repo, deletedMessages, []int{0, 1})
+		keptMessages := newMessages(kept.ID, 2)
+		saveMessages(t, repo, keptMessages, []int{0, 1})
+		require.NoError(t, repo.AddReaction(context.Background(), &reaction.Reaction{
+			RoomID: deleted.ID, MessageID: deletedMessages[0].ID, UserID: uuid.New(), Emoji: "👍",
+		}))
+		reply := newMessages(deleted.ID, 1)[0]
+		reply.ReplyTo = &deletedMessages[0].ID
+		require.NoError(t, repo.SaveMessage(context.Background(), &reply))
+		member, banned := addModeratedMembers(t, repo, deleted.ID)
+
+		require.NoError(t, repo.DeleteRoom(context.Background(), deleted.ID))
+
+		ok, err := repo.IsRoomExist(context.Background(), deleted.ID)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		actualRooms, err := repo.GetRooms(context.Background())
+		assert.NoError(t, err)
+		assert.NotContains(t, actualRooms, deleted)
+		assert.Contains(t, actualRooms, kept)
+
+		actualMessages, err := repo.GetMessages(context.Background(), deleted.ID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actualMessages)
+
+		_, err = repo.GetMessageTime(context.Background(), deleted.ID, deletedMessages[0].ID)
+		assert.ErrorIs(t, err, repository.ErrorNotFound)
+
+		actualReactions, err := repo.GetReactionCounts(context.Background(), deleted.ID, messageIDs(deletedMessages))
+		assert.NoError(t, err)
+		assert.Empty(t, actualReactions)
+
+		actualReplies, err := repo.GetReplyCounts(context.Background(), deleted.ID, messageIDs(deletedMessages))
+		assert.NoError(t, err)
+		assert.Empty(t, actualReplies)
+
+		ok, err = repo.IsRoomMember(context.Background(), deleted.ID, member)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = repo.IsBanned(context.Background(), deleted.ID, banned)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		// Mute is kept when member leaves room, so it's checked by adding member again
+		require.NoError(t, repo.AddRoomMembers(context.Background(), deleted.ID, []uuid.UUID{member}))
+		assertMuted(t, repo, deleted.ID, member, nil)
+
+		actualActions, err := repo.GetModerationActions(context.Background(), deleted.ID, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, actualActions)
+
+		actualMessages, err = repo.GetMessages(context.Background(), kept.ID, repository.Cursor{}, 10)
+		assert.NoError(t, err)
+		assertMessages(t, keptMessages, actualMessages)
+	})
+}
+
+// addModeratedMembers adds new muted member to room and bans new user in it with corresponding moderation action
+func addModeratedMembers(t *testing.T, repo repository.Repository, roomID uuid.UUID) (member, banned uuid.UUID) {
+	t.Helper()
+
+	member, banned = uuid.New(), uuid.New()
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{member}))
+	require.NoError(t, repo.MuteUser(context.Background(), roomID, member, startTime.Add(time.Hour)))
+	require.NoError(t, repo.BanUser(context.Background(), roomID, banned))
+	require.NoError(t, repo.SaveModerationAction(context.Background(), &moderation.Action{
+		ID: uuid.New(), RoomID: roomID, TargetID: banned, Kind: moderation.KindBan, Time: startTime,
+	}))
+	return member, banned
+}
+
+// assertMessages checks that messages are equal and in the same order, ignoring time location
+func assertMessages(t *testing.T, expected, actual []message.Message) {
+	t.Helper()
+
+	if !assert.Len(t, actual, len(expected)) {
+		return
+	}
+	for i := range expected {
+		exp, act := expected[i], actual[i]
+		assert.True(t, exp.Time.Equal(act.Time), "message %d time, expected: %s, actual: %s", i, exp.Time, act.Time)
+		exp.Time, act.Time = time.Time{}, time.Time{}
+		if exp.EditedAt != nil && act.EditedAt != nil {
+			assert.True(t, exp.EditedAt.Equal(*act.EditedAt), "message %d edit time, expected: %s, actual: %s",
+				i, exp.EditedAt, act.EditedAt)
+			exp.EditedAt, act.EditedAt = nil, nil
+		}
+		if exp.UpdatedAt != nil && act.UpdatedAt != nil {
+			assert.True(t, exp.UpdatedAt.Equal(*act.UpdatedAt), "message %d update time, expected: %s, actual: %s",
+				i, exp.UpdatedAt, act.UpdatedAt)
+			exp.UpdatedAt, act.UpdatedAt = nil, nil
+		}
+		assert.Equal(t, exp, act, "message %d", i)
+	}
+}
+
+func testCanceledContext(t *testing.T, repo repository.Repository) {
+	r := newRoom(t, repo)
+	messages := newMessages(r.ID, 1)
+	saveMessages(t, repo, messages, []int{0})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("read", func(t *testing.T) {
+		_, err := repo.GetMessages(ctx, r.ID, repository.Cursor{}, 10)
+		assert.Error(t, err)
+
+		_, err = repo.GetMessageTime(ctx, r.ID, messages[0].ID)
+		assert.Error(t, err)
+
+		_, err = repo.IsRoomExist(ctx, r.ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		msg := newMessages(r.ID, 1)[0]
+		assert.Error(t, repo.SaveMessage(ctx, &msg))
+
+		assert.Error(t, repo.CreateRoom(ctx, &room.Room{ID: uuid.New()}))
+	})
+}
@@ -0,0 +1,854 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/sirupsen/logrus"
+
+	// Registers pure Go SQLite driver
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteDriver = "sqlite"
+
+	sqliteSelectTimeOfMessage = "SELECT time FROM messages WHERE room_id = ? AND id = ?;"
+	sqliteSelectMessages      = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND (time, id) > (?, ?) ORDER BY time DESC, id DESC LIMIT ?;"
+	sqliteSelectOldestMessages = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND (time, id) > (?, ?) ORDER BY time ASC, id ASC LIMIT ?;"
+	sqliteSelectMessagesBefore = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND (time, id) < (?, ?) ORDER BY time DESC, id DESC LIMIT ?;"
+	sqliteSelectMessage = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND id = ?;"
+	sqliteSelectUpdatedMessages = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND updated_at > ? AND updated_at <= ? ORDER BY updated_at ASC, id ASC LIMIT ?;"
+	sqliteSelectMessagesByIDs = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND id IN (%s);"
+	sqliteSelectReplies = "SELECT id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at " +
+		"FROM messages WHERE room_id = ? AND reply_to = ? AND (time, id) > (?, ?) ORDER BY time ASC, id ASC LIMIT ?;"
+	sqliteSelectReplyCounts = "SELECT reply_to, count(*) FROM messages " +
+		"WHERE room_id = ? AND reply_to IN (%s) GROUP BY reply_to;"
+	sqliteSelectReactionCounts = "SELECT message_id, emoji, count(*) FROM reactions " +
+		"WHERE room_id = ? AND message_id IN (%s) GROUP BY message_id, emoji;"
+	sqliteSelectUsersByIDs       = "SELECT id, username FROM users WHERE id IN (%s);"
+	sqliteSelectUserIDByUsername = "SELECT id FROM users WHERE username = ?;"
+	sqliteSelectUserIDByToken    = "SELECT user_id FROM tokens WHERE hash = ?;"
+	sqliteSelectIfRoomExist      = "SELECT count(*) FROM rooms WHERE id = ?;"
+	sqliteSelectRoom             = "SELECT id, direct, private FROM rooms WHERE id = ?;"
+	sqliteSelectRooms            = "SELECT id, direct, private FROM rooms;"
+	sqliteSelectIfRoomMember     = "SELECT count(*) FROM room_members WHERE room_id = ? AND user_id = ?;"
+	sqliteSelectRoomMembers      = "SELECT m.user_id, m.role, u.until FROM room_members m " +
+		"LEFT JOIN room_mutes u ON u.room_id = m.room_id AND u.user_id = m.user_id WHERE m.room_id = ?;"
+	sqliteSelectRoomMember = "SELECT m.user_id, m.role, u.until FROM room_members m " +
+		"LEFT JOIN room_mutes u ON u.room_id = m.room_id AND u.user_id = m.user_id " +
+		"WHERE m.room_id = ? AND m.user_id = ?;"
+	sqliteSelectIfBanned = "SELECT count(*) FROM room_bans WHERE room_id = ? AND user_id = ?;"
+	sqliteSelectActions  = "SELECT id, room_id, moderator_id, target_id, kind, role, until, time " +
+		"FROM moderation_actions WHERE room_id = ? ORDER BY time DESC, id DESC LIMIT ?;"
+
+	sqliteInsertMessage = "INSERT INTO messages " +
+		"(id, room_id, user_id, text, time, edited_at, deleted, reply_to, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);"
+	sqliteInsertReaction = "INSERT INTO reactions (room_id, message_id, emoji, user_id) VALUES (?, ?, ?, ?) " +
+		"ON CONFLICT DO NOTHING;"
+	sqliteInsertUser  = "INSERT INTO users (id, username) VALUES (?, ?) ON CONFLICT (username) DO NOTHING;"
+	sqliteInsertToken = "INSERT INTO tokens (hash, user_id) VALUES (?, ?) " +
+		"ON CONFLICT (hash) DO UPDATE SET user_id = excluded.user_id;"
+	sqliteInsertRoom       = "INSERT INTO rooms (id, direct, private) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING;"
+	sqliteInsertRoomMember = "INSERT INTO room_members (room_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING;"
+	sqliteInsertBan        = "INSERT INTO room_bans (room_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING;"
+	sqliteInsertMute       = "INSERT INTO room_mutes (room_id, user_id, until) VALUES (?, ?, ?) " +
+		"ON CONFLICT (room_id, user_id) DO UPDATE SET until = excluded.until;"
+	sqliteInsertAction = "INSERT INTO moderation_actions " +
+		"(id, room_id, moderator_id, target_id, kind, role, until, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?);"
+
+	sqliteUpdateMessageText = "UPDATE messages SET text = ?, edited_at = ?, updated_at = ? " +
+		"WHERE room_id = ? AND id = ?;"
+	sqliteUpdateMessageDeleted = "UPDATE messages SET text = '', deleted = 1, edited_at = ?, updated_at = ? " +
+		"WHERE room_id = ? AND id = ?;"
+	sqliteUpdateMessageTime = "UPDATE messages SET updated_at = ? WHERE room_id = ? AND id = ?;"
+	sqliteUpdateRoomMember  = "UPDATE room_members SET role = ? WHERE room_id = ? AND user_id = ?;"
+
+	sqliteDeleteReaction      = "DELETE FROM reactions WHERE room_id = ? AND message_id = ? AND emoji = ? AND user_id = ?;"
+	sqliteDeleteRoom          = "DELETE FROM rooms WHERE id = ?;"
+	sqliteDeleteRoomMessages  = "DELETE FROM messages WHERE room_id = ?;"
+	sqliteDeleteRoomReactions = "DELETE FROM reactions WHERE room_id = ?;"
+	sqliteDeleteRoomMembers   = "DELETE FROM room_members WHERE room_id = ?;"
+	sqliteDeleteRoomMember    = "DELETE FROM room_members WHERE room_id = ? AND user_id = ?;"
+	sqliteDeleteRoomBans      = "DELETE FROM room_bans WHERE room_id = ?;"
+	sqliteDeleteBan           = "DELETE FROM room_bans WHERE room_id = ? AND user_id = ?;"
+	sqliteDeleteRoomMutes     = "DELETE FROM room_mutes WHERE room_id = ?;"
+	sqliteDeleteMute          = "DELETE FROM room_mutes WHERE room_id = ? AND user_id = ?;"
+	sqliteDeleteRoomActions   = "DELETE FROM moderation_actions WHERE room_id = ?;"
+)
+
+// SQLite implementation of Repository, all data is stored in a single file of embedded database
+type SQLite struct {
+	db   *sql.DB
+	path string
+	log  *logrus.Logger
+}
+
+// NewSQLiteRepository creates new SQLite Repository stored in file at path, ":memory:" keeps data in memory
+func NewSQLiteRepository(path string, log *logrus.Logger) *SQLite {
+	return &SQLite{
+		path: path,
+		log:  log,
+	}
+}
+
+// Connect opens database file creating it if not exist and applies pending migrations if needed
+func (s *SQLite) Connect(ctx context.Context, initDB bool) error {
+	if s.path == "" {
+		return errors.New("config: no path")
+	}
+
+	db, err := sql.Open(sqliteDriver, s.path)
+	if err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+	// SQLite allows only one writer at a time, so all queries share one connection instead of
+	// failing with busy errors, it also keeps ":memory:" database the same for all queries
+	db.SetMaxOpenConns(1)
+	s.db = db
+
+	if err = db.PingContext(ctx); err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+
+	if initDB {
+		if err = s.migrateUp(ctx); err != nil {
+			return fmt.Errorf("inti db: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Close database
+func (s *SQLite) Close() {
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			s.log.Error("Failed to close sqlite: ", err)
+		}
+	}
+}
+
+// toMillis returns number of milliseconds since Unix epoch, time is stored as milliseconds to keep its order
+func toMillis(t time.Time) int64 {
+	return t.Unix()*int64(time.Second/time.Millisecond) + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
+// fromMillis returns UTC time from number of milliseconds since Unix epoch
+func fromMillis(ms int64) time.Time {
+	perSecond := int64(time.Second / time.Millisecond)
+	return time.Unix(ms/perSecond, ms%perSecond*int64(time.Millisecond)).UTC()
+}
+
+func (s *SQLite) GetMessageTime(ctx context.Context, roomID, messageID uuid.UUID) (time.Time, error) {
+	var ms int64
+	err := s.db.QueryRowContext(ctx, sqliteSelectTimeOfMessage, roomID.String(), messageID.String()).Scan(&ms)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrorNotFound
+		}
+		return time.Time{}, fmt.Errorf("get time of message %s: %w", messageID, err)
+	}
+	return fromMillis(ms), nil
+}
+
+func (s *SQLite) GetMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	messages, err := s.selectMessages(ctx, sqliteSelectMessages, roomID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+	reverseMessages(messages)
+	return messages, nil
+}
+
+func (s *SQLite) GetOldestMessages(ctx context.Context, roomID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	messages, err := s.selectMessages(ctx, sqliteSelectOldestMessages, roomID, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get oldest messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *SQLite) GetMessagesBefore(ctx context.Context, roomID uuid.UUID,
+	before Cursor, limit uint) ([]message.Message, error) {
+	messages, err := s.selectMessages(ctx, sqliteSelectMessagesBefore, roomID, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get messages before: %w", err)
+	}
+	reverseMessages(messages)
+	return messages, nil
+}
+
+// selectMessages selects up to limit messages of room bounded by cursor, ids are stored as lowercase strings,
+// so their order is the same as order of bytes used by Cursor
+func (s *SQLite) selectMessages(ctx context.Context, query string, roomID uuid.UUID, cursor Cursor,
+	limit uint) ([]message.Message, error) {
+	cursor = cursor.truncate(time.Millisecond)
+	return s.queryMessages(ctx, query, roomID.String(), toMillis(cursor.Time), cursor.ID.String(), limit)
+}
+
+// queryMessages selects messages by query with given args
+func (s *SQLite) queryMessages(ctx context.Context, query string, args ...interface{}) ([]message.Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select messages: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var messages []message.Message
+	for rows.Next() {
+		msg, err := scanSQLiteMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan messages: %w", err)
+	}
+	return messages, nil
+}
+
+// scanSQLiteMessage scans row selected as id, room_id, user_id, text, time, edited_at, deleted, reply_to,
+// updated_at
+func scanSQLiteMessage(row rowScanner) (*message.Message, error) {
+	var messageIDStr, roomIDStr, userIDStr string
+	var ms int64
+	var editedAt, updatedAt sql.NullInt64
+	var replyTo sql.NullString
+	var msg message.Message
+	err := row.Scan(&messageIDStr, &roomIDStr, &userIDStr, &msg.Text, &ms, &editedAt, &msg.Deleted, &replyTo,
+		&updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scan message: %w", err)
+	}
+
+	msg.ID, err = uuid.Parse(messageIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("message id: %w", err)
+	}
+	msg.RoomID, err = uuid.Parse(roomIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("room id: %w", err)
+	}
+	msg.UserID, err = uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("user id: %w", err)
+	}
+	msg.Time = fromMillis(ms)
+	if editedAt.Valid {
+		t := fromMillis(editedAt.Int64)
+		msg.EditedAt = &t
+	}
+	if updatedAt.Valid {
+		t := fromMillis(updatedAt.Int64)
+		msg.UpdatedAt = &t
+	}
+	if replyTo.Valid {
+		id, err := uuid.Parse(replyTo.String)
+		if err != nil {
+			return nil, fmt.Errorf("reply to: %w", err)
+		}
+		msg.ReplyTo = &id
+	}
+	return &msg, nil
+}
+
+// sqliteInArgs returns args of query selecting ids from room followed by placeholders of ids for "IN (%s)"
+func sqliteInArgs(roomID uuid.UUID, ids []uuid.UUID) ([]interface{}, string) {
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, roomID.String())
+	for _, id := range ids {
+		args = append(args, id.String())
+	}
+	return args, strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+}
+
+func (s *SQLite) GetUsersFromIDs(ctx context.Context, uuids []uuid.UUID) ([]user.User, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(uuids))
+	for i, id := range uuids {
+		args[i] = id.String()
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(uuids)), ", ")
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(sqliteSelectUsersByIDs, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select users: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var users []user.User
+	for rows.Next() {
+		var usr user.User
+		var idStr string
+		if err = rows.Scan(&idStr, &usr.Username); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+
+		usr.ID, err = uuid.Parse(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("user id: %w", err)
+		}
+		users = append(users, usr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan users: %w", err)
+	}
+	return users, nil
+}
+
+func (s *SQLite) GetUserByUsername(ctx context.Context, username string) (*user.User, error) {
+	var idStr string
+	if err := s.db.QueryRowContext(ctx, sqliteSelectUserIDByUsername, username).Scan(&idStr); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrorNotFound
+		}
+		return nil, fmt.Errorf("get user %q: %w", username, err)
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("user id: %w", err)
+	}
+
+	return &user.User{
+		ID:       id,
+		Username: username,
+	}, nil
+}
+
+func (s *SQLite) CreateUser(ctx context.Context, usr *user.User, tokenHash string) error {
+	err := inTx(ctx, s.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, sqliteInsertUser, usr.ID.String(), usr.Username)
+		if err != nil {
+			return err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if inserted == 0 {
+			return ErrorUsernameTaken
+		}
+
+		if _, err = tx.ExecContext(ctx, sqliteInsertToken, tokenHash, usr.ID.String()); err != nil {
+			return fmt.Errorf("save token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create user %q: %w", usr.Username, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetUserIDByToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	var userIDStr string
+	if err := s.db.QueryRowContext(ctx, sqliteSelectUserIDByToken, tokenHash).Scan(&userIDStr); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrorNotFound
+		}
+		return uuid.UUID{}, fmt.Errorf("get user by token: %w", err)
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("user id: %w", err)
+	}
+	return userID, nil
+}
+
+func (s *SQLite) SaveMessage(ctx context.Context, msg *message.Message) error {
+	var editedAt sql.NullInt64
+	if msg.EditedAt != nil {
+		editedAt = sql.NullInt64{Int64: toMillis(*msg.EditedAt), Valid: true}
+	}
+	var updatedAt sql.NullInt64
+	if msg.UpdatedAt != nil {
+		updatedAt = sql.NullInt64{Int64: toMillis(*msg.UpdatedAt), Valid: true}
+	}
+	var replyTo sql.NullString
+	if msg.ReplyTo != nil {
+		replyTo = sql.NullString{String: msg.ReplyTo.String(), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, sqliteInsertMessage, msg.ID.String(), msg.RoomID.String(), msg.UserID.String(),
+		msg.Text, toMillis(msg.Time), editedAt, msg.Deleted, replyTo, updatedAt)
+	if err != nil {
+		return fmt.Errorf("save message: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetMessage(ctx context.Context, roomID, messageID uuid.UUID) (*message.Message, error) {
+	msg, err := scanSQLiteMessage(s.db.QueryRowContext(ctx, sqliteSelectMessage, roomID.String(), messageID.String()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrorNotFound
+		}
+		return nil, fmt.Errorf("get message %s: %w", messageID, err)
+	}
+	return msg, nil
+}
+
+func (s *SQLite) GetMessagesFromIDs(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) ([]message.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	args, placeholders := sqliteInArgs(roomID, messageIDs)
+	messages, err := s.queryMessages(ctx, fmt.Sprintf(sqliteSelectMessagesByIDs, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("get messages from ids: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *SQLite) GetReplies(ctx context.Context, roomID, messageID uuid.UUID,
+	after Cursor, limit uint) ([]message.Message, error) {
+	after = after.truncate(time.Millisecond)
+	messages, err := s.queryMessages(ctx, sqliteSelectReplies, roomID.String(), messageID.String(),
+		toMillis(after.Time), after.ID.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("get replies: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *SQLite) GetReplyCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	args, placeholders := sqliteInArgs(roomID, messageIDs)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(sqliteSelectReplyCounts, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select reply counts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var messageIDStr string
+		var count int
+		if err = rows.Scan(&messageIDStr, &count); err != nil {
+			return nil, fmt.Errorf("scan reply count: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+		counts[messageID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan reply counts: %w", err)
+	}
+	return counts, nil
+}
+
+func (s *SQLite) EditMessage(ctx context.Context, roomID, messageID uuid.UUID, text string,
+	editedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, sqliteUpdateMessageText, text, toMillis(editedAt), toMillis(editedAt),
+		roomID.String(), messageID.String())
+	if err = updatedOne(result, err); err != nil {
+		return fmt.Errorf("edit message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteMessage(ctx context.Context, roomID, messageID uuid.UUID, deletedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, sqliteUpdateMessageDeleted, toMillis(deletedAt), toMillis(deletedAt),
+		roomID.String(), messageID.String())
+	if err = updatedOne(result, err); err != nil {
+		return fmt.Errorf("delete message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) UpdateMessage(ctx context.Context, roomID, messageID uuid.UUID, updatedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, sqliteUpdateMessageTime, toMillis(updatedAt), roomID.String(),
+		messageID.String())
+	if err = updatedOne(result, err); err != nil {
+		return fmt.Errorf("update message %s: %w", messageID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetUpdatedMessages(ctx context.Context, roomID uuid.UUID, after, until time.Time,
+	limit uint) ([]message.Message, error) {
+	messages, err := s.queryMessages(ctx, sqliteSelectUpdatedMessages, roomID.String(), toMillis(after),
+		toMillis(until), limit)
+	if err != nil {
+		return nil, fmt.Errorf("get updated messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *SQLite) AddReaction(ctx context.Context, r *reaction.Reaction) error {
+	_, err := s.db.ExecContext(ctx, sqliteInsertReaction, r.RoomID.String(), r.MessageID.String(), r.Emoji,
+		r.UserID.String())
+	if err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) RemoveReaction(ctx context.Context, r *reaction.Reaction) error {
+	result, err := s.db.ExecContext(ctx, sqliteDeleteReaction, r.RoomID.String(), r.MessageID.String(), r.Emoji,
+		r.UserID.String())
+	if err = updatedOne(result, err); err != nil {
+		return fmt.Errorf("remove reaction %q: %w", r.Emoji, err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetReactionCounts(ctx context.Context, roomID uuid.UUID,
+	messageIDs []uuid.UUID) (map[uuid.UUID]reaction.Counts, error) {
+	counts := make(map[uuid.UUID]reaction.Counts)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	args, placeholders := sqliteInArgs(roomID, messageIDs)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(sqliteSelectReactionCounts, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("select reaction counts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var messageIDStr, emoji string
+		var count int
+		if err = rows.Scan(&messageIDStr, &emoji, &count); err != nil {
+			return nil, fmt.Errorf("scan reaction count: %w", err)
+		}
+
+		messageID, err := uuid.Parse(messageIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("message id: %w", err)
+		}
+		addReactionCount(counts, messageID, emoji, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan reaction counts: %w", err)
+	}
+	return counts, nil
+}
+
+func (s *SQLite) IsRoomExist(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	var exist int
+	if err := s.db.QueryRowContext(ctx, sqliteSelectIfRoomExist, roomID.String()).Scan(&exist); err != nil {
+		return false, fmt.Errorf("check room: %w", err)
+	}
+	return exist >= 1, nil
+}
+
+func (s *SQLite) GetRoom(ctx context.Context, roomID uuid.UUID) (*room.Room, error) {
+	r, err := scanRoom(s.db.QueryRowContext(ctx, sqliteSelectRoom, roomID.String()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("select room %s: %w", roomID, ErrorNotFound)
+		}
+		return nil, fmt.Errorf("select room: %w", err)
+	}
+	return r, nil
+}
+
+func (s *SQLite) GetRooms(ctx context.Context) ([]room.Room, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteSelectRooms)
+	if err != nil {
+		return nil, fmt.Errorf("select rooms: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var rooms []room.Room
+	for rows.Next() {
+		r, err := scanRoom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan room: %w", err)
+		}
+		rooms = append(rooms, *r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan rooms: %w", err)
+	}
+	return rooms, nil
+}
+
+func (s *SQLite) CreateRoom(ctx context.Context, r *room.Room) error {
+	if _, err := s.db.ExecContext(ctx, sqliteInsertRoom, r.ID.String(), r.Direct, r.Private); err != nil {
+		return fmt.Errorf("create room: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) AddRoomMembers(ctx context.Context, roomID uuid.UUID, userIDs []uuid.UUID) error {
+	err := inTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, userID := range userIDs {
+			if _, err := tx.ExecContext(ctx, sqliteInsertRoomMember, roomID.String(), userID.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("add room members: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	var member int
+	err := s.db.QueryRowContext(ctx, sqliteSelectIfRoomMember, roomID.String(), userID.String()).Scan(&member)
+	if err != nil {
+		return false, fmt.Errorf("check room member: %w", err)
+	}
+	return member >= 1, nil
+}
+
+func (s *SQLite) GetRoomMembers(ctx context.Context, roomID uuid.UUID) ([]room.Member, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteSelectRoomMembers, roomID.String())
+	if err != nil {
+		return nil, fmt.Errorf("select room members: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var members []room.Member
+	for rows.Next() {
+		member, err := scanSQLiteMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan room members: %w", err)
+	}
+	return members, nil
+}
+
+func (s *SQLite) RemoveRoomMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, sqliteDeleteRoomMember, roomID.String(), userID.String()); err != nil {
+		return fmt.Errorf("remove room member: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteRoom(ctx context.Context, roomID uuid.UUID) error {
+	err := inTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomReactions, roomID.String()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomMessages, roomID.String()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomMembers, roomID.String()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomMutes, roomID.String()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomBans, roomID.String()); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteDeleteRoomActions, roomID.String()); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, sqliteDeleteRoom, roomID.String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+	return nil
+}
+
+// scanSQLiteMember scans row selected as user_id, role, until of mute
+func scanSQLiteMember(row rowScanner) (*room.Member, error) {
+	var userIDStr string
+	var mutedUntil sql.NullInt64
+	var member room.Member
+	if err := row.Scan(&userIDStr, &member.Role, &mutedUntil); err != nil {
+		return nil, fmt.Errorf("scan room member: %w", err)
+	}
+
+	var err error
+	member.UserID, err = uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("room member id: %w", err)
+	}
+	if mutedUntil.Valid {
+		t := fromMillis(mutedUntil.Int64)
+		member.MutedUntil = &t
+	}
+	return &member, nil
+}
+
+func (s *SQLite) GetRoomMember(ctx context.Context, roomID, userID uuid.UUID) (*room.Member, error) {
+	member, err := scanSQLiteMember(s.db.QueryRowContext(ctx, sqliteSelectRoomMember, roomID.String(),
+		userID.String()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("select room member %s: %w", userID, ErrorNotFound)
+		}
+		return nil, fmt.Errorf("select room member: %w", err)
+	}
+	return member, nil
+}
+
+func (s *SQLite) UpdateRoomMember(ctx context.Context, roomID uuid.UUID, member *room.Member) error {
+	result, err := s.db.ExecContext(ctx, sqliteUpdateRoomMember, member.Role, roomID.String(), member.UserID.String())
+	if err = updatedOne(result, err); err != nil {
+		return fmt.Errorf("update room member %s: %w", member.UserID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) MuteUser(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error {
+	if _, err := s.db.ExecContext(ctx, sqliteInsertMute, roomID.String(), userID.String(), toMillis(until)); err != nil {
+		return fmt.Errorf("mute user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) UnmuteUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, sqliteDeleteMute, roomID.String(), userID.String()); err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) BanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, sqliteInsertBan, roomID.String(), userID.String()); err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) UnbanUser(ctx context.Context, roomID, userID uuid.UUID) error {
+	if _, err := s.db.ExecContext(ctx, sqliteDeleteBan, roomID.String(), userID.String()); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) IsBanned(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	var banned int
+	err := s.db.QueryRowContext(ctx, sqliteSelectIfBanned, roomID.String(), userID.String()).Scan(&banned)
+	if err != nil {
+		return false, fmt.Errorf("check ban: %w", err)
+	}
+	return banned >= 1, nil
+}
+
+func (s *SQLite) SaveModerationAction(ctx context.Context, action *moderation.Action) error {
+	var moderatorID sql.NullString
+	if action.ModeratorID != nil {
+		moderatorID = sql.NullString{String: action.ModeratorID.String(), Valid: true}
+	}
+	var until sql.NullInt64
+	if action.Until != nil {
+		until = sql.NullInt64{Int64: toMillis(*action.Until), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, sqliteInsertAction, action.ID.String(), action.RoomID.String(), moderatorID,
+		action.TargetID.String(), action.Kind, action.Role, until, toMillis(action.Time))
+	if err != nil {
+		return fmt.Errorf("save moderation action: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetModerationActions(ctx context.Context, roomID uuid.UUID,
+	limit uint) ([]moderation.Action, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteSelectActions, roomID.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("select moderation actions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var actions []moderation.Action
+	for rows.Next() {
+		action, err := scanSQLiteAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, *action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan moderation actions: %w", err)
+	}
+	return actions, nil
+}
+
+// scanSQLiteAction scans row selected as id, room_id, moderator_id, target_id, kind, role, until, time
+func scanSQLiteAction(row rowScanner) (*moderation.Action, error) {
+	var actionIDStr, roomIDStr, targetIDStr string
+	var moderatorID sql.NullString
+	var until sql.NullInt64
+	var ms int64
+	var action moderation.Action
+	err := row.Scan(&actionIDStr, &roomIDStr, &moderatorID, &targetIDStr, &action.Kind, &action.Role, &until, &ms)
+	if err != nil {
+		return nil, fmt.Errorf("scan moderation action: %w", err)
+	}
+
+	action.ID, err = uuid.Parse(actionIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("action id: %w", err)
+	}
+	action.RoomID, err = uuid.Parse(roomIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("room id: %w", err)
+	}
+	action.TargetID, err = uuid.Parse(targetIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("target id: %w", err)
+	}
+	if moderatorID.Valid {
+		id, err := uuid.Parse(moderatorID.String)
+		if err != nil {
+			return nil, fmt.Errorf("moderator id: %w", err)
+		}
+		action.ModeratorID = &id
+	}
+	if until.Valid {
+		t := fromMillis(until.Int64)
+		action.Until = &t
+	}
+	action.Time = fromMillis(ms)
+	return &action, nil
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mymmrac/project-glynn/pkg/repository/migration"
+)
+
+const (
+	sqliteCreateSchemaVersionTable = "CREATE TABLE IF NOT EXISTS schema_version " +
+		"(version INTEGER PRIMARY KEY, description TEXT NOT NULL, applied_at INTEGER NOT NULL);"
+	sqliteSelectSchemaVersions     = "SELECT version, applied_at FROM schema_version;"
+	sqliteSelectSchemaVersionExist = "SELECT count(*) FROM sqlite_master " +
+		"WHERE type = 'table' AND name = 'schema_version';"
+	sqliteInsertSchemaVersion = "INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?);"
+	sqliteDeleteSchemaVersion = "DELETE FROM schema_version WHERE version = ?;"
+
+	sqliteCreateUsersTable = "CREATE TABLE users " +
+		"(id TEXT PRIMARY KEY, username TEXT NOT NULL UNIQUE);"
+	sqliteCreateTokensTable = "CREATE TABLE tokens " +
+		"(hash TEXT PRIMARY KEY, user_id TEXT NOT NULL);"
+	sqliteCreateRoomsTable    = "CREATE TABLE rooms (id TEXT PRIMARY KEY);"
+	sqliteCreateMessagesTable = "CREATE TABLE messages " +
+		"(id TEXT NOT NULL, room_id TEXT NOT NULL, user_id TEXT NOT NULL, text TEXT NOT NULL, time INTEGER NOT NULL, " +
+		"PRIMARY KEY (room_id, id));"
+	sqliteCreateMessagesTimeIndex = "CREATE INDEX messages_by_time ON messages (room_id, time, id);"
+
+	sqliteAddMessageEditedAtColumn = "ALTER TABLE messages ADD COLUMN edited_at INTEGER;"
+	sqliteAddMessageDeletedColumn  = "ALTER TABLE messages ADD COLUMN deleted INTEGER NOT NULL DEFAULT 0;"
+
+	sqliteCreateReactionsTable = "CREATE TABLE reactions " +
+		"(room_id TEXT NOT NULL, message_id TEXT NOT NULL, emoji TEXT NOT NULL, user_id TEXT NOT NULL, " +
+		"PRIMARY KEY (room_id, message_id, emoji, user_id));"
+
+	sqliteAddMessageReplyToColumn  = "ALTER TABLE messages ADD COLUMN reply_to TEXT;"
+	sqliteCreateMessagesReplyIndex = "CREATE INDEX messages_by_reply ON messages (room_id, reply_to, time, id);"
+
+	sqliteAddRoomDirectColumn    = "ALTER TABLE rooms ADD COLUMN direct INTEGER NOT NULL DEFAULT 0;"
+	sqliteCreateRoomMembersTable = "CREATE TABLE room_members " +
+		"(room_id TEXT NOT NULL, user_id TEXT NOT NULL, PRIMARY KEY (room_id, user_id));"
+
+	sqliteAddRoomPrivateColumn = "ALTER TABLE rooms ADD COLUMN private INTEGER NOT NULL DEFAULT 0;"
+
+	sqliteAddMemberRoleColumn       = "ALTER TABLE room_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member';"
+	sqliteAddMemberMutedUntilColumn = "ALTER TABLE room_members ADD COLUMN muted_until INTEGER;"
+	sqliteCreateRoomBansTable       = "CREATE TABLE room_bans " +
+		"(room_id TEXT NOT NULL, user_id TEXT NOT NULL, PRIMARY KEY (room_id, user_id));"
+	sqliteCreateActionsTable = "CREATE TABLE moderation_actions " +
+		"(id TEXT NOT NULL, room_id TEXT NOT NULL, moderator_id TEXT, target_id TEXT NOT NULL, kind TEXT NOT NULL, " +
+		"role TEXT NOT NULL, until INTEGER, time INTEGER NOT NULL, PRIMARY KEY (room_id, id));"
+	sqliteCreateActionsTimeIndex = "CREATE INDEX moderation_actions_by_time ON moderation_actions (room_id, time, id);"
+
+	sqliteCreateMessagesEditIndex = "CREATE INDEX messages_by_edit ON messages (room_id, edited_at, id);"
+
+	sqliteCreateRoomMutesTable = "CREATE TABLE room_mutes " +
+		"(room_id TEXT NOT NULL, user_id TEXT NOT NULL, until INTEGER NOT NULL, PRIMARY KEY (room_id, user_id));"
+	sqliteCopyMembersMutes = "INSERT INTO room_mutes (room_id, user_id, until) " +
+		"SELECT room_id, user_id, muted_until FROM room_members WHERE muted_until IS NOT NULL;"
+
+	sqliteAddMessageUpdatedAtColumn = "ALTER TABLE messages ADD COLUMN updated_at INTEGER;"
+	sqliteCopyMessagesEditedAt      = "UPDATE messages SET updated_at = edited_at;"
+	sqliteCreateMessagesUpdateIndex = "CREATE INDEX messages_by_update ON messages (room_id, updated_at, id);"
+
+	sqliteDropUsersTable    = "DROP TABLE users;"
+	sqliteDropTokensTable   = "DROP TABLE tokens;"
+	sqliteDropRoomsTable    = "DROP TABLE rooms;"
+	sqliteDropMessagesTable = "DROP TABLE messages;"
+
+	sqliteDropMessageEditedAtColumn = "ALTER TABLE messages DROP COLUMN edited_at;"
+	sqliteDropMessageDeletedColumn  = "ALTER TABLE messages DROP COLUMN deleted;"
+
+	sqliteDropReactionsTable = "DROP TABLE reactions;"
+
+	sqliteDropMessagesReplyIndex   = "DROP INDEX messages_by_reply;"
+	sqliteDropMessageReplyToColumn = "ALTER TABLE messages DROP COLUMN reply_to;"
+
+	sqliteDropRoomMembersTable = "DROP TABLE room_members;"
+	sqliteDropRoomDirectColumn = "ALTER TABLE rooms DROP COLUMN direct;"
+
+	sqliteDropRoomPrivateColumn = "ALTER TABLE rooms DROP COLUMN private;"
+
+	sqliteDropActionsTable           = "DROP TABLE moderation_actions;"
+	sqliteDropRoomBansTable          = "DROP TABLE room_bans;"
+	sqliteDropMemberMutedUntilColumn = "ALTER TABLE room_members DROP COLUMN muted_until;"
+	sqliteDropMemberRoleColumn       = "ALTER TABLE room_members DROP COLUMN role;"
+
+	sqliteDropMessagesEditIndex = "DROP INDEX messages_by_edit;"
+
+	sqliteCopyMutesToMembers = "UPDATE room_members SET muted_until = (SELECT until FROM room_mutes " +
+		"WHERE room_mutes.room_id = room_members.room_id AND room_mutes.user_id = room_members.user_id);"
+	sqliteDropRoomMutesTable = "DROP TABLE room_mutes;"
+
+	sqliteDropMessagesUpdateIndex    = "DROP INDEX messages_by_update;"
+	sqliteDropMessageUpdatedAtColumn = "ALTER TABLE messages DROP COLUMN updated_at;"
+)
+
+// migrations returns all changes of SQLite schema, new migrations must be added with the next version
+// and never changed after release
+func (s *SQLite) migrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version:     1,
+			Description: "create users, tokens, rooms & messages tables",
+			Up: s.execAll(sqliteCreateUsersTable, sqliteCreateTokensTable, sqliteCreateRoomsTable,
+				sqliteCreateMessagesTable, sqliteCreateMessagesTimeIndex),
+			Down: s.execAll(sqliteDropMessagesTable, sqliteDropRoomsTable, sqliteDropTokensTable, sqliteDropUsersTable),
+		},
+		{
+			Version:     2,
+			Description: "add edit time & deleted flag to messages",
+			Up:          s.execAll(sqliteAddMessageEditedAtColumn, sqliteAddMessageDeletedColumn),
+			Down:        s.execAll(sqliteDropMessageDeletedColumn, sqliteDropMessageEditedAtColumn),
+		},
+		{
+			Version:     3,
+			Description: "create reactions table",
+			Up:          s.execAll(sqliteCreateReactionsTable),
+			Down:        s.execAll(sqliteDropReactionsTable),
+		},
+		{
+			Version:     4,
+			Description: "add replies to messages",
+			Up:          s.execAll(sqliteAddMessageReplyToColumn, sqliteCreateMessagesReplyIndex),
+			Down:        s.execAll(sqliteDropMessagesReplyIndex, sqliteDropMessageReplyToColumn),
+		},
+		{
+			Version:     5,
+			Description: "add direct rooms & room members",
+			Up:          s.execAll(sqliteAddRoomDirectColumn, sqliteCreateRoomMembersTable),
+			Down:        s.execAll(sqliteDropRoomMembersTable, sqliteDropRoomDirectColumn),
+		},
+		{
+			Version:     6,
+			Description: "add private rooms",
+			Up:          s.execAll(sqliteAddRoomPrivateColumn),
+			Down:        s.execAll(sqliteDropRoomPrivateColumn),
+		},
+		{
+			Version:     7,
+			Description: "add member roles & mutes, bans & moderation log",
+			Up: s.execAll(sqliteAddMemberRoleColumn, sqliteAddMemberMutedUntilColumn, sqliteCreateRoomBansTable,
+				sqliteCreateActionsTable, sqliteCreateActionsTimeIndex),
+			Down: s.execAll(sqliteDropActionsTable, sqliteDropRoomBansTable, sqliteDropMemberMutedUntilColumn,
+				sqliteDropMemberRoleColumn),
+		},
+		{
+			Version:     8,
+			Description: "index messages by edit time",
+			Up:          s.execAll(sqliteCreateMessagesEditIndex),
+			Down:        s.execAll(sqliteDropMessagesEditIndex),
+		},
+		{
+			Version:     9,
+			Description: "move mutes from room members to separate table",
+			Up: s.execAll(sqliteCreateRoomMutesTable, sqliteCopyMembersMutes,
+				sqliteDropMemberMutedUntilColumn),
+			// Mutes of users who are not members are lost
+			Down: s.execAll(sqliteAddMemberMutedUntilColumn, sqliteCopyMutesToMembers, sqliteDropRoomMutesTable),
+		},
+		{
+			Version:     10,
+			Description: "track updates of messages including reactions",
+			Up: s.execAll(sqliteAddMessageUpdatedAtColumn, sqliteCopyMessagesEditedAt, sqliteCreateMessagesUpdateIndex,
+				sqliteDropMessagesEditIndex),
+			Down: s.execAll(sqliteCreateMessagesEditIndex, sqliteDropMessagesUpdateIndex,
+				sqliteDropMessageUpdatedAtColumn),
+		},
+	}
+}
+
+// execAll returns function executing statements one by one in transaction of migration
+func (s *SQLite) execAll(statements ...string) func(ctx context.Context, tx migration.Tx) error {
+	return func(ctx context.Context, tx migration.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("exec %q: %w", stmt, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Migrator returns migrator of SQLite schema
+func (s *SQLite) Migrator() (*migration.Migrator, error) {
+	return migration.NewMigrator(&sqliteVersions{db: s.db}, s.migrations())
+}
+
+// migrateUp applies all pending migrations
+func (s *SQLite) migrateUp(ctx context.Context) error {
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		s.log.Infof("Applied migration %d: %s", m.Version, m.Description)
+	}
+	return err
+}
+
+// sqliteVersions keeps applied migrations in schema_version table
+type sqliteVersions struct {
+	db *sql.DB
+}
+
+func (v *sqliteVersions) InitVersions(ctx context.Context) error {
+	if _, err := v.db.ExecContext(ctx, sqliteCreateSchemaVersionTable); err != nil {
+		return fmt.Errorf("create schema version table: %w", err)
+	}
+	return nil
+}
+
+func (v *sqliteVersions) VersionsExist(ctx context.Context) (bool, error) {
+	var exist int
+	if err := v.db.QueryRowContext(ctx, sqliteSelectSchemaVersionExist).Scan(&exist); err != nil {
+		return false, fmt.Errorf("check schema version table: %w", err)
+	}
+	return exist > 0, nil
+}
+
+func (v *sqliteVersions) AppliedVersions(ctx context.Context) ([]migration.AppliedVersion, error) {
+	rows, err := v.db.QueryContext(ctx, sqliteSelectSchemaVersions)
+	if err != nil {
+		return nil, fmt.Errorf("select versions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var versions []migration.AppliedVersion
+	for rows.Next() {
+		var version uint
+		var appliedAt int64
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		versions = append(versions, migration.AppliedVersion{Version: version, AppliedAt: fromMillis(appliedAt)})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("scan versions: %w", err)
+	}
+	return versions, nil
+}
+
+func (v *sqliteVersions) InTx(ctx context.Context, f func(tx migration.Tx) error) error {
+	return inTx(ctx, v.db, func(tx *sql.Tx) error { return f(tx) })
+}
+
+func (v *sqliteVersions) SaveVersion(ctx context.Context, tx migration.Tx, version migration.AppliedVersion,
+	description string) error {
+	_, err := tx.ExecContext(ctx, sqliteInsertSchemaVersion, version.Version, description,
+		toMillis(version.AppliedAt))
+	if err != nil {
+		return fmt.Errorf("save version: %w", err)
+	}
+	return nil
+}
+
+func (v *sqliteVersions) DeleteVersion(ctx context.Context, tx migration.Tx, version uint) error {
+	if _, err := tx.ExecContext(ctx, sqliteDeleteSchemaVersion, version); err != nil {
+		return fmt.Errorf("delete version: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMillis(t *testing.T) {
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected int64
+	}{
+		{name: "epoch", time: time.Unix(0, 0), expected: 0},
+		{name: "milliseconds", time: time.Unix(1621521072, 123456789), expected: 1621521072123},
+		{name: "before epoch", time: time.Unix(-1, 0), expected: -1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := toMillis(tt.time)
+			assert.Equal(t, tt.expected, actual)
+			assert.True(t, tt.time.Truncate(time.Millisecond).Equal(fromMillis(actual)))
+		})
+	}
+
+	assert.Less(t, toMillis(time.Time{}), toMillis(time.Unix(0, 0)), "zero time must be before any message")
+	assert.Equal(t, time.UTC, fromMillis(0).Location())
+}
+
+func TestSQLite_Connect_noPath(t *testing.T) {
+	s := NewSQLiteRepository("", nil)
+	assert.Error(t, s.Connect(context.Background(), false))
+}
+
+func TestSQLite_migrations(t *testing.T) {
+	s := NewSQLiteRepository(":memory:", nil)
+	for i, m := range s.migrations() {
+		assert.Equal(t, uint(i+1), m.Version, "versions must be sequential")
+		assert.NotEmpty(t, m.Description)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// tokenSize is amount of random bytes in authentication token
+const tokenSize = 32
+
+// generateToken returns new random authentication token
+func generateToken() (string, error) {
+	token := make([]byte, tokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// hashToken returns hash of token, only hashes of tokens are stored
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Authenticate returns id of user that owns token or ErrorUnauthorized
+func (s *Service) Authenticate(ctx context.Context, token string) (uuid.UUID, error) {
+	if token == "" {
+		return uuid.UUID{}, fmt.Errorf("authenticate: %w", ErrorUnauthorized)
+	}
+
+	userID, err := s.userRepo.GetUserIDByToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return uuid.UUID{}, fmt.Errorf("authenticate: %w", ErrorUnauthorized)
+		}
+		return uuid.UUID{}, fmt.Errorf("authenticate: %w", err)
+	}
+	return userID, nil
+}
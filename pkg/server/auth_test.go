@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generateToken(t *testing.T) {
+	token, err := generateToken()
+	require.NoError(t, err)
+	assert.Len(t, token, tokenSize*2)
+
+	other, err := generateToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func Test_hashToken(t *testing.T) {
+	assert.Equal(t, hashToken("token"), hashToken("token"))
+	assert.NotEqual(t, hashToken("token"), hashToken("other"))
+	assert.NotEqual(t, "token", hashToken("token"))
+}
+
+func TestService_Authenticate(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	tests := []struct {
+		name        string
+		token       string
+		repoCalled  bool
+		repoErr     error
+		expectedErr error
+	}{
+		{
+			name:       "ok",
+			token:      "token",
+			repoCalled: true,
+		},
+		{
+			name:        "empty",
+			token:       "",
+			expectedErr: ErrorUnauthorized,
+		},
+		{
+			name:        "unknown",
+			token:       "token",
+			repoCalled:  true,
+			repoErr:     repository.ErrorNotFound,
+			expectedErr: ErrorUnauthorized,
+		},
+		{
+			name:        "err",
+			token:       "token",
+			repoCalled:  true,
+			repoErr:     errAny,
+			expectedErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.repoCalled {
+				mocks.MockGetUserIDByToken(m, gomock.Eq(hashToken(tt.token)), userID, tt.repoErr)
+			}
+
+			actual, err := service.Authenticate(context.Background(), tt.token)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, userID, actual)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// directRoomNamespace separates hashes of direct room ids from other hashes of user ids
+const directRoomNamespace = "glynn direct room"
+
+// directRoomID returns id of direct room of two users, it's the same for both orders of users and formatted
+// as random UUID (version 4), so it's accepted everywhere room id is
+func directRoomID(a, b uuid.UUID) uuid.UUID {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(directRoomNamespace))
+	hash.Write(a[:])
+	hash.Write(b[:])
+
+	var id uuid.UUID
+	copy(id[:], hash.Sum(nil))
+	id[6] = id[6]&0x0f | 0x40 // Version 4
+	id[8] = id[8]&0x3f | 0x80 // Variant is RFC 4122
+	return id
+}
+
+// getPeer returns user with specified username to have direct conversation with, or ErrorUserNotFound
+func (s *Service) getPeer(ctx context.Context, userID uuid.UUID, username string) (*user.User, error) {
+	peer, err := s.userRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return nil, fmt.Errorf("get peer: %w", ErrorUserNotFound)
+		}
+		return nil, fmt.Errorf("get peer: %w", err)
+	}
+	if peer.ID == userID {
+		return nil, fmt.Errorf("get peer: %w", ErrorDirectToSelf)
+	}
+	return peer, nil
+}
+
+// GetDirectRoom returns id of direct room of user with user with specified username,
+// ErrorRoomNotFound is returned if they have not sent direct messages to each other yet
+func (s *Service) GetDirectRoom(ctx context.Context, userID uuid.UUID, username string) (uuid.UUID, error) {
+	peer, err := s.getPeer(ctx, userID, username)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("direct room: %w", err)
+	}
+
+	roomID := directRoomID(userID, peer.ID)
+	if err = s.CheckRoom(ctx, roomID); err != nil {
+		return uuid.UUID{}, fmt.Errorf("direct room: %w", err)
+	}
+	return roomID, nil
+}
+
+// SendDirectMessage sends message to direct room of user with user with specified username,
+// room is created on first message, returns id of direct room
+func (s *Service) SendDirectMessage(ctx context.Context, userID uuid.UUID, username string,
+	newMessage chat.NewMessage) (uuid.UUID, error) {
+	// Validated before room is created, so invalid message won't start conversation
+	if err := s.rules.Validate(newMessage.Text); err != nil {
+		return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+	}
+
+	peer, err := s.getPeer(ctx, userID, username)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+	}
+
+	roomID := directRoomID(userID, peer.ID)
+	exist, err := s.roomRepo.IsRoomExist(ctx, roomID)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+	}
+
+	if !exist {
+		// Members are added first, so direct room never exists without them, both steps can be safely repeated
+		// if users start conversation at the same time
+		if err = s.roomRepo.AddRoomMembers(ctx, roomID, []uuid.UUID{userID, peer.ID}); err != nil {
+			return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+		}
+		if err = s.roomRepo.CreateRoom(ctx, &room.Room{ID: roomID, Direct: true}); err != nil {
+			return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+		}
+	}
+
+	if err = s.SendMessage(ctx, roomID, userID, newMessage); err != nil {
+		return uuid.UUID{}, fmt.Errorf("send direct message: %w", err)
+	}
+	return roomID, nil
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_directRoomID(t *testing.T) {
+	a := uuid.New()
+	b := uuid.New()
+
+	id := directRoomID(a, b)
+	assert.Equal(t, id, directRoomID(b, a))
+	assert.NotEqual(t, id, directRoomID(a, uuid.New()))
+	assert.Regexp(t, regexp.MustCompile("^"+uuid.Regex+"$"), id.String())
+}
+
+func TestService_GetDirectRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	peer := user.User{ID: uuid.New(), Username: "peer"}
+	directID := directRoomID(userID, peer.ID)
+
+	t.Run("ok", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		mocks.MockIsRoomExist(m, gomock.Eq(directID), true, nil)
+
+		actual, err := service.GetDirectRoom(context.Background(), userID, peer.Username)
+		require.NoError(t, err)
+		assert.Equal(t, directID, actual)
+	})
+
+	t.Run("no messages yet", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		mocks.MockIsRoomExist(m, gomock.Eq(directID), false, nil)
+
+		_, err := service.GetDirectRoom(context.Background(), userID, peer.Username)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), nil, repository.ErrorNotFound)
+
+		_, err := service.GetDirectRoom(context.Background(), userID, peer.Username)
+		assert.ErrorIs(t, err, ErrorUserNotFound)
+	})
+
+	t.Run("self", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &user.User{ID: userID, Username: peer.Username}, nil)
+
+		_, err := service.GetDirectRoom(context.Background(), userID, peer.Username)
+		assert.ErrorIs(t, err, ErrorDirectToSelf)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), nil, errAny)
+
+		_, err := service.GetDirectRoom(context.Background(), userID, peer.Username)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
+
+func TestService_SendDirectMessage(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	peer := user.User{ID: uuid.New(), Username: "peer"}
+	directID := directRoomID(usr.ID, peer.ID)
+	newMessage := chat.NewMessage{Text: "Hello"}
+
+	mockSend := func() {
+		mocks.MockGetRoom(m, gomock.Eq(directID), &room.Room{ID: directID, Direct: true}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(directID), gomock.Eq(usr.ID),
+			&room.Member{UserID: usr.ID, Role: room.RoleMember}, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+	}
+
+	t.Run("first message", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		mocks.MockIsRoomExist(m, gomock.Eq(directID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(directID), gomock.Eq([]uuid.UUID{usr.ID, peer.ID}), nil)
+		mocks.MockCreateRoom(m, gomock.Eq(&room.Room{ID: directID, Direct: true}), nil)
+		mockSend()
+
+		actual, err := service.SendDirectMessage(context.Background(), usr.ID, peer.Username, newMessage)
+		require.NoError(t, err)
+		assert.Equal(t, directID, actual)
+	})
+
+	t.Run("existing room", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		mocks.MockIsRoomExist(m, gomock.Eq(directID), true, nil)
+		mockSend()
+
+		actual, err := service.SendDirectMessage(context.Background(), usr.ID, peer.Username, newMessage)
+		require.NoError(t, err)
+		assert.Equal(t, directID, actual)
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		_, err := service.SendDirectMessage(context.Background(), usr.ID, peer.Username, chat.NewMessage{Text: " "})
+		assert.ErrorIs(t, err, ErrorEmptyMessage)
+	})
+
+	t.Run("self", func(t *testing.T) {
+		found := usr
+		mocks.MockGetUserByUsername(m, gomock.Eq(usr.Username), &found, nil)
+
+		_, err := service.SendDirectMessage(context.Background(), usr.ID, usr.Username, newMessage)
+		assert.ErrorIs(t, err, ErrorDirectToSelf)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), nil, repository.ErrorNotFound)
+
+		_, err := service.SendDirectMessage(context.Background(), usr.ID, peer.Username, newMessage)
+		assert.ErrorIs(t, err, ErrorUserNotFound)
+	})
+
+	t.Run("err members", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		mocks.MockIsRoomExist(m, gomock.Eq(directID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(directID), gomock.Any(), errAny)
+
+		_, err := service.SendDirectMessage(context.Background(), usr.ID, peer.Username, newMessage)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
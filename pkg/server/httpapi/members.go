@@ -0,0 +1,167 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+)
+
+func (s *Server) joinRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("join room: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.JoinRoom(ctx, roomID, userID)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) leaveRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("leave room: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.LeaveRoom(ctx, roomID, userID)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) getRoomMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		members, err := s.service.GetRoomMembers(ctx, roomID, readerIDFromContext(r.Context()))
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, members, http.StatusOK)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) inviteToRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		inviter, ok := editorFromContext(r.Context())
+		if !ok {
+			s.log.Error("invite to room: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var invite chat.Invite
+		err = decodeJSON(r, &invite)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.InviteToRoom(ctx, roomID, inviter, invite)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
@@ -0,0 +1,259 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_joinRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/rooms/%s/join", roomID), nil)
+	req = mux.SetURLVars(req, vars)
+	reqUser := req.WithContext(withUserID(req.Context(), userID))
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{userID}), nil)
+
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("banned", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("private", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.joinRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_leaveRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/rooms/%s/leave", roomID), nil)
+	req = mux.SetURLVars(req, vars)
+	reqUser := req.WithContext(withUserID(req.Context(), userID))
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), nil)
+
+		rr := httptest.NewRecorder()
+		srv.leaveRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.leaveRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.leaveRoom()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.leaveRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_getRoomMembers(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/rooms/%s/members", roomID), nil)
+	req = mux.SetURLVars(req, vars)
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMembers(m, gomock.Eq(roomID), []room.Member{{UserID: usr.ID, Role: room.RoleOwner}}, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getRoomMembers()(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actual []chat.Member
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		require.NoError(t, err)
+		assert.Equal(t, []chat.Member{{ID: usr.ID, Username: usr.Username, Role: room.RoleOwner}}, actual)
+	})
+
+	t.Run("private anonymous", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getRoomMembers()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.getRoomMembers()(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_inviteToRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	invited := user.User{ID: uuid.New(), Username: "invited"}
+
+	newRequest := func(body string, admin bool) *http.Request {
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/members", roomID), strings.NewReader(body))
+		req = mux.SetURLVars(req, vars)
+		if admin {
+			return req.WithContext(withAdmin(req.Context()))
+		}
+		return req.WithContext(withUserID(req.Context(), userID))
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		found := invited
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), &found, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(invited.ID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{invited.ID}), nil)
+
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, newRequest(`{"username":"invited"}`, false))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		found := invited
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), &found, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(invited.ID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{invited.ID}), nil)
+
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, newRequest(`{"username":"invited"}`, true))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, newRequest(`{"username":"invited"}`, false))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, newRequest(`{"username":"invited"}`, true))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, newRequest(`{`, false))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/members", roomID), strings.NewReader(`{"username":"invited"}`))
+		req = mux.SetURLVars(req, vars)
+
+		rr := httptest.NewRecorder()
+		srv.inviteToRoom()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
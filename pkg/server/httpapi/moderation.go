@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// moderateFunc is a moderation action of moderator on user with specified username in room
+type moderateFunc func(ctx context.Context, roomID uuid.UUID, moderator server.Editor, username string) error
+
+// moderateUser returns handler of moderation action which has no request body
+func (s *Server) moderateUser(name string, moderate moderateFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		moderator, ok := editorFromContext(r.Context())
+		if !ok {
+			s.log.Errorf("%s: no authenticated user", name)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = moderate(ctx, roomID, moderator, mux.Vars(r)[usernameParameter])
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) setRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var change chat.RoleChange
+		err := decodeJSON(r, &change)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.moderateUser("set role", func(ctx context.Context, roomID uuid.UUID, moderator server.Editor,
+			username string) error {
+			return s.service.SetRole(ctx, roomID, moderator, username, change)
+		})(w, r)
+	}
+}
+
+func (s *Server) muteUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mute chat.Mute
+		err := decodeJSON(r, &mute)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		s.moderateUser("mute user", func(ctx context.Context, roomID uuid.UUID, moderator server.Editor,
+			username string) error {
+			return s.service.MuteUser(ctx, roomID, moderator, username, mute)
+		})(w, r)
+	}
+}
+
+func (s *Server) getModerationLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		moderator, ok := editorFromContext(r.Context())
+		if !ok {
+			s.log.Error("moderation log: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		log, err := s.service.GetModerationLog(ctx, roomID, moderator)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, log, http.StatusOK)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newModerationRequest returns request of moderator to moderate user with username "target"
+func newModerationRequest(method, path, body string, moderatorID *uuid.UUID) *http.Request {
+	req := httptest.NewRequest(method, fmt.Sprintf("/api/rooms/%s/%s", roomID, path), strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{
+		roomIDParameter:   roomID.String(),
+		usernameParameter: "target",
+	})
+	if moderatorID == nil {
+		return req.WithContext(withAdmin(req.Context()))
+	}
+	return req.WithContext(withUserID(req.Context(), *moderatorID))
+}
+
+// mockModeration expects moderator with specified role to moderate member of public room
+func mockModeration(moderatorID uuid.UUID, moderatorRole room.Role, target user.User) {
+	mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+	mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(moderatorID),
+		&room.Member{UserID: moderatorID, Role: moderatorRole}, nil)
+	mocks.MockGetUserByUsername(m, gomock.Eq(target.Username), &target, nil)
+	mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID),
+		&room.Member{UserID: target.ID, Role: room.RoleMember}, nil)
+}
+
+func TestServer_moderateUser(t *testing.T) {
+	setup(t)
+
+	moderatorID := uuid.New()
+	target := user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("kick", func(t *testing.T) {
+		mockModeration(moderatorID, room.RoleModerator, target)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		mocks.MockSaveModerationAction(m, gomock.Any(), nil)
+
+		rr := httptest.NewRecorder()
+		srv.moderateUser("kick user", service.KickUser)(rr,
+			newModerationRequest(http.MethodDelete, "members/target", "", &moderatorID))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("ban by admin", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		found := target
+		mocks.MockGetUserByUsername(m, gomock.Eq(target.Username), &found, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil, repository.ErrorNotFound)
+		mocks.MockBanUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		mocks.MockSaveModerationAction(m, gomock.Any(), nil)
+
+		rr := httptest.NewRecorder()
+		srv.moderateUser("ban user", service.BanUser)(rr, newModerationRequest(http.MethodPut, "bans/target", "", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("not moderator", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(moderatorID),
+			&room.Member{UserID: moderatorID, Role: room.RoleMember}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.moderateUser("kick user", service.KickUser)(rr,
+			newModerationRequest(http.MethodDelete, "members/target", "", &moderatorID))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("no user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/rooms/%s/members/target", roomID), nil)
+		req = mux.SetURLVars(req, vars)
+
+		rr := httptest.NewRecorder()
+		srv.moderateUser("kick user", service.KickUser)(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.moderateUser("unban user", service.UnbanUser)(rr,
+			newModerationRequest(http.MethodDelete, "bans/target", "", &moderatorID))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_setRole(t *testing.T) {
+	setup(t)
+
+	ownerID := uuid.New()
+	target := user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("ok", func(t *testing.T) {
+		mockModeration(ownerID, room.RoleOwner, target)
+		mocks.MockUpdateRoomMember(m, gomock.Eq(roomID),
+			gomock.Eq(&room.Member{UserID: target.ID, Role: room.RoleModerator}), nil)
+		mocks.MockSaveModerationAction(m, gomock.Any(), nil)
+
+		rr := httptest.NewRecorder()
+		srv.setRole()(rr, newModerationRequest(http.MethodPut, "members/target/role", `{"role":"moderator"}`,
+			&ownerID))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.setRole()(rr, newModerationRequest(http.MethodPut, "members/target/role", `{"role":"king"}`, &ownerID))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.setRole()(rr, newModerationRequest(http.MethodPut, "members/target/role", `{`, &ownerID))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestServer_muteUser(t *testing.T) {
+	setup(t)
+
+	moderatorID := uuid.New()
+	target := user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("ok", func(t *testing.T) {
+		mockModeration(moderatorID, room.RoleModerator, target)
+		mocks.MockMuteUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), gomock.Any(), nil)
+		mocks.MockSaveModerationAction(m, gomock.Any(), nil)
+
+		rr := httptest.NewRecorder()
+		srv.muteUser()(rr, newModerationRequest(http.MethodPost, "members/target/mute", `{"duration":"10m"}`,
+			&moderatorID))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("invalid duration", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.muteUser()(rr, newModerationRequest(http.MethodPost, "members/target/mute", `{"duration":"soon"}`,
+			&moderatorID))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.muteUser()(rr, newModerationRequest(http.MethodPost, "members/target/mute", `{`, &moderatorID))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestServer_getModerationLog(t *testing.T) {
+	setup(t)
+
+	moderatorID := uuid.New()
+	target := user.User{ID: uuid.New(), Username: "target"}
+	actions := []moderation.Action{
+		{ID: uuid.New(), RoomID: roomID, TargetID: target.ID, Kind: moderation.KindBan},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetModerationActions(m, gomock.Eq(roomID), actions, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{target.ID}), []user.User{target}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getModerationLog()(rr, newModerationRequest(http.MethodGet, "moderation", "", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actual chat.ModerationLog
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&actual))
+		assert.Equal(t, chat.ModerationLog{
+			Actions:   actions,
+			Usernames: map[uuid.UUID]string{target.ID: target.Username},
+		}, actual)
+	})
+
+	t.Run("not moderator", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(moderatorID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.getModerationLog()(rr, newModerationRequest(http.MethodGet, "moderation", "", &moderatorID))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.getModerationLog()(rr, newModerationRequest(http.MethodGet, "moderation", "", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
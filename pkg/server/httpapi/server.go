@@ -1,9 +1,13 @@
 package httpapi
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -14,22 +18,40 @@ import (
 )
 
 const (
-	roomIDParameter        = "roomID"
-	LastMessageIDParameter = "lastMessageID"
+	roomIDParameter          = "roomID"
+	messageIDParameter       = "messageID"
+	emojiParameter           = "emoji"
+	usernameParameter        = "username"
+	LastMessageIDParameter   = "lastMessageID"
+	BeforeMessageIDParameter = "beforeMessageID"
+	WaitParameter            = "wait"
+	UpdatedAfterParameter    = "updatedAfter"
+
+	// AdminTokenHeader is a header with token required for admin API
+	AdminTokenHeader = "AdminToken"
+
+	// AuthorizationHeader is a header with bearer token of user
+	AuthorizationHeader = "Authorization"
+	bearerPrefix        = "Bearer "
 )
 
 // Server http api
 type Server struct {
-	service *server.Service
-	router  mux.Router
-	log     *logrus.Logger
+	service        *server.Service
+	router         mux.Router
+	adminToken     string
+	requestTimeout time.Duration
+	log            *logrus.Logger
 }
 
-// NewServer creates new server and initializes routes
-func NewServer(service *server.Service, log *logrus.Logger) *Server {
+// NewServer creates new server and initializes routes, admin API is disabled if adminToken is empty,
+// requests are canceled after requestTimeout (not counting time of waiting for new messages), zero means no timeout
+func NewServer(service *server.Service, adminToken string, requestTimeout time.Duration, log *logrus.Logger) *Server {
 	srv := &Server{
-		service: service,
-		log:     log,
+		service:        service,
+		adminToken:     adminToken,
+		requestTimeout: requestTimeout,
+		log:            log,
 	}
 	srv.routes()
 	return srv
@@ -46,55 +68,365 @@ func (s *Server) routes() {
 	api := s.router.PathPrefix("/api").Subrouter()
 	roomMessagesAPI := api.PathPrefix(fmt.Sprintf("/rooms/{%s:%s}/messages", roomIDParameter, uuid.Regex)).Subrouter()
 
-	roomMessagesAPI.HandleFunc("", s.getMessages()).
+	roomMessagesAPI.Handle("", s.maybeAuthenticated(s.getMessages())).
 		Methods(http.MethodGet)
-	roomMessagesAPI.HandleFunc("", s.getMessages()).
+	roomMessagesAPI.Handle("", s.maybeAuthenticated(s.getMessages())).
 		Queries(LastMessageIDParameter, fmt.Sprintf("{%s:%s}", LastMessageIDParameter, uuid.Regex)).
 		Methods(http.MethodGet)
-	roomMessagesAPI.HandleFunc("", s.sendMassage()).
+	roomMessagesAPI.Handle("", s.authenticated(s.sendMassage())).
+		Methods(http.MethodPost)
+	roomMessagesAPI.Handle(fmt.Sprintf("/{%s:%s}", messageIDParameter, uuid.Regex), s.userOrAdmin(s.editMessage())).
+		Methods(http.MethodPut)
+	roomMessagesAPI.Handle(fmt.Sprintf("/{%s:%s}", messageIDParameter, uuid.Regex), s.userOrAdmin(s.deleteMessage())).
+		Methods(http.MethodDelete)
+	roomMessagesAPI.Handle(fmt.Sprintf("/{%s:%s}/thread", messageIDParameter, uuid.Regex),
+		s.maybeAuthenticated(s.getThread())).
+		Methods(http.MethodGet)
+
+	reactionsPath := fmt.Sprintf("/{%s:%s}/reactions", messageIDParameter, uuid.Regex)
+	roomMessagesAPI.Handle(reactionsPath, s.authenticated(s.addReaction())).
+		Methods(http.MethodPost)
+	roomMessagesAPI.Handle(fmt.Sprintf("%s/{%s}", reactionsPath, emojiParameter), s.authenticated(s.removeReaction())).
+		Methods(http.MethodDelete)
+
+	api.Handle(fmt.Sprintf("/rooms/{%s:%s}/ws", roomIDParameter, uuid.Regex),
+		s.maybeAuthenticated(s.streamMessages())).
+		Methods(http.MethodGet)
+	api.Handle(fmt.Sprintf("/rooms/{%s:%s}/events", roomIDParameter, uuid.Regex),
+		s.maybeAuthenticated(s.streamEvents())).
+		Methods(http.MethodGet)
+
+	roomPath := fmt.Sprintf("/rooms/{%s:%s}", roomIDParameter, uuid.Regex)
+	api.Handle(roomPath+"/join", s.authenticated(s.joinRoom())).
+		Methods(http.MethodPost)
+	api.Handle(roomPath+"/leave", s.authenticated(s.leaveRoom())).
+		Methods(http.MethodPost)
+	api.Handle(roomPath+"/members", s.maybeAuthenticated(s.getRoomMembers())).
+		Methods(http.MethodGet)
+	api.Handle(roomPath+"/members", s.userOrAdmin(s.inviteToRoom())).
+		Methods(http.MethodPost)
+
+	memberPath := fmt.Sprintf("%s/members/{%s}", roomPath, usernameParameter)
+	api.Handle(memberPath, s.userOrAdmin(s.moderateUser("kick user", s.service.KickUser))).
+		Methods(http.MethodDelete)
+	api.Handle(memberPath+"/role", s.userOrAdmin(s.setRole())).
+		Methods(http.MethodPut)
+	api.Handle(memberPath+"/mute", s.userOrAdmin(s.muteUser())).
+		Methods(http.MethodPost)
+	api.Handle(memberPath+"/mute", s.userOrAdmin(s.moderateUser("unmute user", s.service.UnmuteUser))).
+		Methods(http.MethodDelete)
+	banPath := fmt.Sprintf("%s/bans/{%s}", roomPath, usernameParameter)
+	api.Handle(banPath, s.userOrAdmin(s.moderateUser("ban user", s.service.BanUser))).
+		Methods(http.MethodPut)
+	api.Handle(banPath, s.userOrAdmin(s.moderateUser("unban user", s.service.UnbanUser))).
+		Methods(http.MethodDelete)
+	api.Handle(roomPath+"/moderation", s.userOrAdmin(s.getModerationLog())).
+		Methods(http.MethodGet)
+
+	directPath := fmt.Sprintf("/direct/{%s}", usernameParameter)
+	api.Handle(directPath, s.authenticated(s.getDirectRoom())).
+		Methods(http.MethodGet)
+	api.Handle(directPath+"/messages", s.authenticated(s.sendDirectMessage())).
+		Methods(http.MethodPost)
+
+	api.HandleFunc("/users", s.createUser()).
+		Methods(http.MethodPost)
+
+	roomsAPI := api.PathPrefix("/rooms").Subrouter()
+	roomsAPI.Use(s.adminOnly)
+
+	roomsAPI.HandleFunc("", s.getRooms()).
+		Methods(http.MethodGet)
+	roomsAPI.HandleFunc("", s.createRoom()).
 		Methods(http.MethodPost)
+	roomsAPI.HandleFunc(fmt.Sprintf("/{%s:%s}", roomIDParameter, uuid.Regex), s.deleteRoom()).
+		Methods(http.MethodDelete)
+}
+
+// requestContext returns context of request which is canceled after request timeout extended by wait
+func (s *Server) requestContext(r *http.Request, wait time.Duration) (context.Context, context.CancelFunc) {
+	if s.requestTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.requestTimeout+wait)
+}
+
+// adminOnly allows only requests with valid admin token
+func (s *Server) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(AdminTokenHeader)
+		if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			err := respondJSONError(w, errors.New("invalid admin token"), http.StatusForbidden)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticated allows only requests with valid bearer token and stores id of authenticated user in request context
+func (s *Server) authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := s.requestContext(r, 0)
+		userID, err := s.service.Authenticate(ctx, bearerToken(r))
+		cancel()
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withUserID(r.Context(), userID)))
+	})
+}
+
+// maybeAuthenticated allows anonymous requests, but requests with bearer token are allowed only if token is valid
+// and id of authenticated user is stored in request context
+func (s *Server) maybeAuthenticated(next http.Handler) http.Handler {
+	user := s.authenticated(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(AuthorizationHeader) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user.ServeHTTP(w, r)
+	})
+}
+
+// userOrAdmin allows requests with valid admin token or with valid bearer token of user if admin token is not set,
+// requests with admin token are marked as made by admin in request context
+func (s *Server) userOrAdmin(next http.Handler) http.Handler {
+	user := s.authenticated(next)
+	admin := s.adminOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(withAdmin(r.Context())))
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(AdminTokenHeader) == "" {
+			user.ServeHTTP(w, r)
+			return
+		}
+		admin.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) getMessages() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-
-		// TODO move to func
-		roomIDStr, ok := vars[roomIDParameter]
-		if !ok {
-			s.log.Error("roomID is required")
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		roomID, err := uuid.Parse(roomIDStr)
+
+		query, err := messagesQueryFromRequest(r)
 		if err != nil {
-			s.log.Error("invalid roomID: ", err)
-			w.WriteHeader(http.StatusBadRequest)
+			if err = respondJSONError(w, err, http.StatusBadRequest); err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 			return
 		}
 
+		ctx, cancel := s.requestContext(r, query.wait)
+		defer cancel()
+
+		readerID := readerIDFromContext(r.Context())
+
 		var messages *chat.Messages
+		switch {
+		case query.beforeMessageID != nil:
+			messages, err = s.service.GetMessagesBeforeMessage(ctx, roomID, readerID, *query.beforeMessageID)
+		case query.wait > 0 || query.updatedAfter != nil:
+			messages, err = s.service.WaitMessages(ctx, roomID, readerID, query.lastMessageID, query.updatedAfter,
+				query.wait)
+		case query.lastMessageID == nil:
+			messages, err = s.service.GetMessagesLatest(ctx, roomID, readerID)
+		default:
+			messages, err = s.service.GetMessagesAfterMessage(ctx, roomID, readerID, *query.lastMessageID)
+		}
 
-		lastMessageIDStr := r.URL.Query().Get(LastMessageIDParameter)
-		if lastMessageIDStr == "" {
-			messages, err = s.service.GetMessagesLatest(roomID)
-		} else {
-			var lastMessageID uuid.UUID
-			if lastMessageID, err = uuid.Parse(lastMessageIDStr); err != nil {
-				if err = respondJSONError(w, err, http.StatusBadRequest); err != nil {
-					s.log.Error(err)
-					w.WriteHeader(http.StatusInternalServerError)
-				}
-				return
+		if err != nil {
+			err := respondJSONError(w, err, errorStatus(err, http.StatusBadRequest))
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
 			}
+			return
+		}
 
-			messages, err = s.service.GetMessagesAfterMessage(roomID, lastMessageID)
+		err = respondJSON(w, messages, http.StatusOK)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
 		}
+	}
+}
 
+func (s *Server) sendMassage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
 		if err != nil {
-			status := http.StatusBadRequest
-			if errors.Is(err, server.ErrorRoomNotFound) {
-				status = http.StatusNotFound
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("send message: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var newMessage chat.NewMessage
+		err = decodeJSON(r, &newMessage)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.SendMessage(ctx, roomID, userID, newMessage)
+		if err != nil {
+			err := respondJSONError(w, err, errorStatus(err, http.StatusBadRequest))
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (s *Server) getDirectRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("get direct room: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		roomID, err := s.service.GetDirectRoom(ctx, userID, mux.Vars(r)[usernameParameter])
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, roomID, http.StatusOK)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) sendDirectMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("send direct message: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var newMessage chat.NewMessage
+		err := decodeJSON(r, &newMessage)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		roomID, err := s.service.SendDirectMessage(ctx, userID, mux.Vars(r)[usernameParameter], newMessage)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, roomID, http.StatusCreated)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) getThread() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, messageID, err := messageIDsFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lastMessageID, err := lastMessageIDFromQuery(r)
+		if err != nil {
+			if err = respondJSONError(w, err, http.StatusBadRequest); err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		messages, err := s.service.GetThread(ctx, roomID, readerIDFromContext(r.Context()), messageID, lastMessageID)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
 			}
 
 			err := respondJSONError(w, err, status)
@@ -113,26 +445,184 @@ func (s *Server) getMessages() http.HandlerFunc {
 	}
 }
 
-func (s *Server) sendMassage() http.HandlerFunc {
+func (s *Server) editMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, messageID, err := messageIDsFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		editor, ok := editorFromContext(r.Context())
+		if !ok {
+			s.log.Error("edit message: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var edit chat.MessageEdit
+		err = decodeJSON(r, &edit)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.EditMessage(ctx, roomID, messageID, editor, edit)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) deleteMessage() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
+		roomID, messageID, err := messageIDsFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 
-		// TODO move to func
-		roomIDStr, ok := vars[roomIDParameter]
+		editor, ok := editorFromContext(r.Context())
 		if !ok {
-			s.log.Error("roomID is required")
+			s.log.Error("delete message: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.DeleteMessage(ctx, roomID, messageID, editor)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) addReaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, messageID, err := messageIDsFromVars(r)
+		if err != nil {
+			s.log.Error(err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		roomID, err := uuid.Parse(roomIDStr)
+
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("add reaction: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var newReaction chat.NewReaction
+		err = decodeJSON(r, &newReaction)
+		if err != nil {
+			err := respondJSONError(w, err, http.StatusBadRequest)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.AddReaction(ctx, roomID, messageID, userID, newReaction)
 		if err != nil {
-			s.log.Error("invalid roomID: ", err)
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func (s *Server) removeReaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, messageID, err := messageIDsFromVars(r)
+		if err != nil {
+			s.log.Error(err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		var newMessage chat.NewMessage
-		err = decodeJSON(r, &newMessage)
+		userID, ok := userIDFromContext(r.Context())
+		if !ok {
+			s.log.Error("remove reaction: no authenticated user")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.RemoveReaction(ctx, roomID, messageID, userID, mux.Vars(r)[emojiParameter])
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Server) createUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var newUser chat.NewUser
+		err := decodeJSON(r, &newUser)
 		if err != nil {
 			err := respondJSONError(w, err, http.StatusBadRequest)
 			if err != nil {
@@ -142,8 +632,67 @@ func (s *Server) sendMassage() http.HandlerFunc {
 			return
 		}
 
-		err = s.service.SendMessage(roomID, newMessage)
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		credentials, err := s.service.CreateUser(ctx, newUser)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, credentials, http.StatusCreated)
 		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) getRooms() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		rooms, err := s.service.GetRooms(ctx)
+		if err != nil {
+			s.log.Error(err)
+			err := respondJSONError(w, err, http.StatusInternalServerError)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		roomIDs := make([]uuid.UUID, len(rooms))
+		for i, rm := range rooms {
+			roomIDs[i] = rm.ID
+		}
+
+		err = respondJSON(w, roomIDs, http.StatusOK)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) createRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Body is optional, room is public by default
+		var newRoom chat.NewRoom
+		err := decodeJSON(r, &newRoom)
+		if err != nil && !errors.Is(err, io.EOF) {
 			err := respondJSONError(w, err, http.StatusBadRequest)
 			if err != nil {
 				s.log.Error(err)
@@ -152,6 +701,59 @@ func (s *Server) sendMassage() http.HandlerFunc {
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		roomID, err := s.service.CreateRoom(ctx, newRoom)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		err = respondJSON(w, roomID, http.StatusCreated)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *Server) deleteRoom() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := s.requestContext(r, 0)
+		defer cancel()
+
+		err = s.service.DeleteRoom(ctx, roomID)
+		if err != nil {
+			status := errorStatus(err, http.StatusInternalServerError)
+			if status == http.StatusInternalServerError {
+				s.log.Error(err)
+			}
+
+			err := respondJSONError(w, err, status)
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
 	}
 }
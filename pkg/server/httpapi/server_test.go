@@ -2,12 +2,16 @@ package httpapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,7 +20,10 @@ import (
 	"github.com/mymmrac/project-glynn/internal/mocks"
 	"github.com/mymmrac/project-glynn/pkg/data/chat"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
 	"github.com/mymmrac/project-glynn/pkg/server"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/sirupsen/logrus/hooks/test"
@@ -24,6 +31,8 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+const testAdminToken = "test-admin-token"
+
 var (
 	m       *mocks.MockRepository
 	service *server.Service
@@ -36,10 +45,11 @@ func setup(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	m = mocks.NewMockRepository(ctrl)
 	log, _ := test.NewNullLogger()
-	service = server.NewService(m, log)
+	service = server.NewService(m, server.DefaultMessageRules(), log)
 	srv = Server{
-		service: service,
-		log:     log,
+		service:    service,
+		adminToken: testAdminToken,
+		log:        log,
 	}
 	roomID = uuid.New()
 	vars = map[string]string{
@@ -47,6 +57,16 @@ func setup(t *testing.T) {
 	}
 }
 
+// mockMember expects member of room without moderation role to be requested
+func mockMember(roomID, userID gomock.Matcher) {
+	m.EXPECT().
+		GetRoomMember(gomock.Any(), roomID, userID).
+		DoAndReturn(func(_ context.Context, _, userID uuid.UUID) (*room.Member, error) {
+			return &room.Member{UserID: userID, Role: room.RoleMember}, nil
+		}).
+		Times(1)
+}
+
 func getTestData() (messages []message.Message, users []user.User, usernames map[uuid.UUID]string) {
 	messages = []message.Message{
 		{
@@ -87,18 +107,30 @@ func getTestData() (messages []message.Message, users []user.User, usernames map
 func TestServer_sendMassage(t *testing.T) {
 	setup(t)
 
+	userID := uuid.New()
 	newMessage := chat.NewMessage{
-		UserID: uuid.New(),
-		Text:   "test",
+		Text: "test",
 	}
 	messageBytes, err := json.Marshal(newMessage)
 	require.NoError(t, err)
 
 	reqNilBody := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/rooms/%s/messages", roomID), nil)
+	reqNilBody = reqNilBody.WithContext(withUserID(reqNilBody.Context(), userID))
+
+	usr := user.User{ID: userID, Username: "test"}
 
 	t.Run("ok", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{userID}), []user.User{usr}, nil)
+		m.EXPECT().
+			SaveMessage(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, msg *message.Message) error {
+				assert.Equal(t, userID, msg.UserID)
+				assert.Equal(t, newMessage.Text, msg.Text)
+				return nil
+			}).
+			Times(1)
 
 		req := httptest.NewRequest(http.MethodPost,
 			fmt.Sprintf("/api/rooms/%s/messages", roomID),
@@ -107,6 +139,7 @@ func TestServer_sendMassage(t *testing.T) {
 			roomIDParameter: roomID.String(),
 		}
 		req = mux.SetURLVars(req, vars)
+		req = req.WithContext(withUserID(req.Context(), userID))
 
 		rr := httptest.NewRecorder()
 		srv.sendMassage()(rr, req)
@@ -114,6 +147,18 @@ func TestServer_sendMassage(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, rr.Code)
 	})
 
+	t.Run("no user", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/messages", roomID),
+			bytes.NewReader(messageBytes))
+		req = mux.SetURLVars(req, vars)
+
+		rr := httptest.NewRecorder()
+		srv.sendMassage()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
 	t.Run("no room id", func(t *testing.T) {
 		rr := httptest.NewRecorder()
 		srv.sendMassage()(rr, reqNilBody)
@@ -144,8 +189,76 @@ func TestServer_sendMassage(t *testing.T) {
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 
+	t.Run("invalid text", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			text     string
+			expected int
+		}{
+			{name: "empty", text: " ", expected: http.StatusBadRequest},
+			{name: "control char", text: "a\u0000b", expected: http.StatusBadRequest},
+			{name: "too long", text: strings.Repeat("a", server.DefaultMessageMaxLength+1),
+				expected: http.StatusRequestEntityTooLarge},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				body, err := json.Marshal(chat.NewMessage{Text: tt.text})
+				require.NoError(t, err)
+
+				req := httptest.NewRequest(http.MethodPost,
+					fmt.Sprintf("/api/rooms/%s/messages", roomID),
+					bytes.NewReader(body))
+				req = mux.SetURLVars(req, vars)
+				req = req.WithContext(withUserID(req.Context(), userID))
+
+				rr := httptest.NewRecorder()
+				srv.sendMassage()(rr, req)
+
+				assert.Equal(t, tt.expected, rr.Code)
+			})
+		}
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{userID}), nil, nil)
+
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/messages", roomID),
+			bytes.NewReader(messageBytes))
+		req = mux.SetURLVars(req, vars)
+		req = req.WithContext(withUserID(req.Context(), userID))
+
+		rr := httptest.NewRecorder()
+		srv.sendMassage()(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("parent not found", func(t *testing.T) {
+		parentID := uuid.New()
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parentID), nil, repository.ErrorNotFound)
+
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/messages", roomID),
+			strings.NewReader(fmt.Sprintf(`{"text":"test","replyTo":"%s"}`, parentID)))
+		req = mux.SetURLVars(req, vars)
+		req = req.WithContext(withUserID(req.Context(), userID))
+
+		rr := httptest.NewRecorder()
+		srv.sendMassage()(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), server.ErrorParentNotFound.Error())
+	})
+
 	t.Run("save err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{userID}), []user.User{usr}, nil)
 		mocks.MockSaveMessage(m, gomock.Any(), errors.New("error"), 1)
 
 		req := httptest.NewRequest(http.MethodPost,
@@ -153,6 +266,7 @@ func TestServer_sendMassage(t *testing.T) {
 			bytes.NewReader(messageBytes))
 
 		req = mux.SetURLVars(req, vars)
+		req = req.WithContext(withUserID(req.Context(), userID))
 
 		rr := httptest.NewRecorder()
 		srv.sendMassage()(rr, req)
@@ -168,9 +282,11 @@ func TestServer_getMessages(t *testing.T) {
 	req = mux.SetURLVars(req, vars)
 
 	messages, users, usernames := getTestData()
+	reactions := map[uuid.UUID]reaction.Counts{messages[0].ID: {"👍": 1}}
 	expected := &chat.Messages{
 		Messages:  messages,
 		Usernames: usernames,
+		Reactions: reactions,
 	}
 	var actual *chat.Messages
 
@@ -182,9 +298,11 @@ func TestServer_getMessages(t *testing.T) {
 	}
 
 	t.Run("ok", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
 		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(server.MessageLimit), messages, nil)
 		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), reactions, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
 
 		rr := httptest.NewRecorder()
 		srv.getMessages()(rr, req)
@@ -201,10 +319,13 @@ func TestServer_getMessages(t *testing.T) {
 		lastMessageID := uuid.New()
 		afterTime := time.Unix(1621521072, 0).UTC()
 
-		mocks.MockGetMessageTime(m, gomock.Eq(lastMessageID), afterTime, nil)
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Eq(afterTime), gomock.Eq(server.MessageLimit), messages, nil)
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(lastMessageID), afterTime, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(repository.MessageCursor(afterTime, lastMessageID)),
+			gomock.Eq(server.MessageLimit+1), messages, nil)
 		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), reactions, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
 
 		reqLastMessage := httptest.NewRequest(http.MethodGet,
 			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, LastMessageIDParameter, lastMessageID),
@@ -222,6 +343,129 @@ func TestServer_getMessages(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 
+	t.Run("ok before message", func(t *testing.T) {
+		beforeMessageID := uuid.New()
+		beforeTime := time.Unix(1621521072, 0).UTC()
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(beforeMessageID), beforeTime, nil)
+		mocks.MockGetMessagesBefore(m, gomock.Eq(roomID), gomock.Eq(repository.MessageCursor(beforeTime, beforeMessageID)),
+			gomock.Eq(server.MessageLimit+1), messages, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), reactions, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+
+		reqBefore := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, BeforeMessageIDParameter, beforeMessageID),
+			nil)
+		reqBefore = mux.SetURLVars(reqBefore, vars)
+
+		rr := httptest.NewRecorder()
+		srv.getMessages()(rr, reqBefore)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("bad before message id", func(t *testing.T) {
+		reqBefore := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, BeforeMessageIDParameter, "bad_id"),
+			nil)
+		reqBefore = mux.SetURLVars(reqBefore, vars)
+
+		withBadRequest(reqBefore)
+	})
+
+	t.Run("before message with last message", func(t *testing.T) {
+		reqBefore := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s&%s=%s", roomID,
+				BeforeMessageIDParameter, uuid.New(), LastMessageIDParameter, uuid.New()),
+			nil)
+		reqBefore = mux.SetURLVars(reqBefore, vars)
+
+		withBadRequest(reqBefore)
+	})
+
+	t.Run("before message with updated after", func(t *testing.T) {
+		reqBefore := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s&%s=%s", roomID,
+				BeforeMessageIDParameter, uuid.New(), UpdatedAfterParameter, "2021-05-20T14:31:12Z"),
+			nil)
+		reqBefore = mux.SetURLVars(reqBefore, vars)
+
+		withBadRequest(reqBefore)
+	})
+
+	t.Run("ok wait", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(server.MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+
+		reqWait := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, WaitParameter, "1ms"),
+			nil)
+		reqWait = mux.SetURLVars(reqWait, vars)
+
+		rr := httptest.NewRecorder()
+		srv.getMessages()(rr, reqWait)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actualWait chat.Messages
+		err := json.NewDecoder(rr.Body).Decode(&actualWait)
+		assert.NoError(t, err)
+		assert.Empty(t, actualWait.Messages)
+	})
+
+	t.Run("ok updated after", func(t *testing.T) {
+		updatedAfter := time.Unix(1621521072, 0).UTC()
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(server.MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+		mocks.MockGetUpdatedMessages(m, gomock.Eq(roomID), gomock.Eq(updatedAfter), gomock.Any(),
+			gomock.Eq(server.MessageLimit), nil, nil)
+
+		reqUpdated := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, UpdatedAfterParameter,
+				updatedAfter.Format(time.RFC3339Nano)),
+			nil)
+		reqUpdated = mux.SetURLVars(reqUpdated, vars)
+
+		rr := httptest.NewRecorder()
+		srv.getMessages()(rr, reqUpdated)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actualUpdated chat.Messages
+		err := json.NewDecoder(rr.Body).Decode(&actualUpdated)
+		assert.NoError(t, err)
+		assert.Empty(t, actualUpdated.Updated)
+		require.NotNil(t, actualUpdated.UpdatedUntil)
+		assert.True(t, actualUpdated.UpdatedUntil.After(updatedAfter))
+	})
+
+	t.Run("bad updated after", func(t *testing.T) {
+		reqUpdated := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, UpdatedAfterParameter, "bad"),
+			nil)
+		reqUpdated = mux.SetURLVars(reqUpdated, vars)
+
+		withBadRequest(reqUpdated)
+	})
+
+	t.Run("bad wait", func(t *testing.T) {
+		reqWait := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, WaitParameter, "bad"),
+			nil)
+		reqWait = mux.SetURLVars(reqWait, vars)
+
+		withBadRequest(reqWait)
+	})
+
 	t.Run("bad last message id", func(t *testing.T) {
 		reqLastMessage := httptest.NewRequest(http.MethodGet,
 			fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, LastMessageIDParameter, "bad_id"),
@@ -247,93 +491,1257 @@ func TestServer_getMessages(t *testing.T) {
 	})
 
 	t.Run("get messages err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
 		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(server.MessageLimit), messages, errors.New(""))
 
 		withBadRequest(req)
 	})
 
 	t.Run("room not found err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), false, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
 
 		rr := httptest.NewRecorder()
 		srv.getMessages()(rr, req)
 
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
+
+	t.Run("direct anonymous", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getMessages()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("direct not member", func(t *testing.T) {
+		userID := uuid.New()
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getMessages()(rr, req.WithContext(withUserID(req.Context(), userID)))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
 }
 
-func TestServer_routes(t *testing.T) {
+func TestServer_createUser(t *testing.T) {
 	setup(t)
 
-	srv.routes()
+	newRequest := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/api/users", bytes.NewBufferString(body))
+	}
 
-	type args struct {
-		method string
-		url    string
+	t.Run("ok", func(t *testing.T) {
+		var savedUser *user.User
+		m.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, usr *user.User, _ string) error {
+				savedUser = usr
+				return nil
+			}).
+			Times(1)
+
+		rr := httptest.NewRecorder()
+		srv.createUser()(rr, newRequest(`{"username":"test_user"}`))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var actual chat.Credentials
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+		require.NotNil(t, savedUser)
+		assert.Equal(t, savedUser.ID, actual.UserID)
+		assert.NotEmpty(t, actual.Token)
+		assert.Equal(t, "test_user", savedUser.Username)
+	})
+
+	t.Run("decode user", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.createUser()(rr, newRequest("{"))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid username", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.createUser()(rr, newRequest(`{"username":"1 bad"}`))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("username taken", func(t *testing.T) {
+		mocks.MockCreateUser(m, gomock.Any(), repository.ErrorUsernameTaken)
+
+		rr := httptest.NewRecorder()
+		srv.createUser()(rr, newRequest(`{"username":"test_user"}`))
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("save err", func(t *testing.T) {
+		mocks.MockCreateUser(m, gomock.Any(), errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.createUser()(rr, newRequest(`{"username":"test_user"}`))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_adminOnly(t *testing.T) {
+	setup(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		expected   int
+	}{
+		{name: "ok", adminToken: testAdminToken, token: testAdminToken, expected: http.StatusTeapot},
+		{name: "no token", adminToken: testAdminToken, token: "", expected: http.StatusForbidden},
+		{name: "bad token", adminToken: testAdminToken, token: "bad", expected: http.StatusForbidden},
+		{name: "disabled", adminToken: "", token: "", expected: http.StatusForbidden},
 	}
-	type expected struct {
-		handler http.Handler
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.adminToken = tt.adminToken
+
+			req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+
+			rr := httptest.NewRecorder()
+			srv.adminOnly(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
 	}
+}
+
+func TestServer_authenticated(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actual, ok := userIDFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, userID, actual)
+		w.WriteHeader(http.StatusTeapot)
+	})
+
 	tests := []struct {
-		name     string
-		args     args
-		expected expected
+		name       string
+		header     string
+		repoCalled bool
+		repoErr    error
+		expected   int
 	}{
-		{
-			name: "get messages",
-			args: args{
-				method: http.MethodGet,
-				url:    fmt.Sprintf("/api/rooms/%s/messages", roomID),
-			},
-			expected: expected{
-				handler: srv.getMessages(),
-			},
-		},
-		{
-			name: "get messages with last id",
-			args: args{
-				method: http.MethodGet,
-				url:    fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, LastMessageIDParameter, uuid.New()),
-			},
-			expected: expected{
-				handler: srv.getMessages(),
-			},
-		},
-		{
-			name: "send messages",
-			args: args{
-				method: http.MethodPost,
-				url:    fmt.Sprintf("/api/rooms/%s/messages", roomID),
-			},
-			expected: expected{
-				handler: srv.sendMassage(),
-			},
-		},
+		{name: "ok", header: "Bearer token", repoCalled: true, expected: http.StatusTeapot},
+		{name: "no header", header: "", expected: http.StatusUnauthorized},
+		{name: "not bearer", header: "Basic token", expected: http.StatusUnauthorized},
+		{name: "unknown token", header: "Bearer token", repoCalled: true, repoErr: repository.ErrorNotFound,
+			expected: http.StatusUnauthorized},
+		{name: "err", header: "Bearer token", repoCalled: true, repoErr: errors.New("error"),
+			expected: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.repoCalled {
+				mocks.MockGetUserIDByToken(m, gomock.Any(), userID, tt.repoErr)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/rooms/%s/messages", roomID), nil)
+			if tt.header != "" {
+				req.Header.Set(AuthorizationHeader, tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			srv.authenticated(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
 	}
+}
+
+func TestServer_maybeAuthenticated(t *testing.T) {
+	setup(t)
 
+	userID := uuid.New()
+	tests := []struct {
+		name       string
+		header     string
+		repoCalled bool
+		repoErr    error
+		expected   int
+		readerID   *uuid.UUID
+	}{
+		{name: "user", header: "Bearer token", repoCalled: true, expected: http.StatusTeapot, readerID: &userID},
+		{name: "anonymous", header: "", expected: http.StatusTeapot},
+		{name: "not bearer", header: "Basic token", expected: http.StatusUnauthorized},
+		{name: "unknown token", header: "Bearer token", repoCalled: true, repoErr: repository.ErrorNotFound,
+			expected: http.StatusUnauthorized},
+	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			request := httptest.NewRequest(tt.args.method, tt.args.url, nil)
+			if tt.repoCalled {
+				mocks.MockGetUserIDByToken(m, gomock.Any(), userID, tt.repoErr)
+			}
 
-			rm := &mux.RouteMatch{}
-			srv.router.Match(request, rm)
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/rooms/%s/messages", roomID), nil)
+			if tt.header != "" {
+				req.Header.Set(AuthorizationHeader, tt.header)
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.readerID, readerIDFromContext(r.Context()))
+				w.WriteHeader(http.StatusTeapot)
+			})
 
-			v1 := reflect.ValueOf(rm.Handler)
-			v2 := reflect.ValueOf(tt.expected.handler)
-			assert.Equal(t, v2.Pointer(), v1.Pointer(), "unexpected router")
+			rr := httptest.NewRecorder()
+			srv.maybeAuthenticated(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
 		})
 	}
 }
 
-func TestNewServer(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	m := mocks.NewMockRepository(ctrl)
-	log, _ := test.NewNullLogger()
-	service := server.NewService(m, log)
+func TestServer_userOrAdmin(t *testing.T) {
+	setup(t)
 
-	srv := NewServer(service, log)
+	userID := uuid.New()
+	tests := []struct {
+		name       string
+		header     string
+		adminToken string
+		repoCalled bool
+		expected   int
+		editor     server.Editor
+	}{
+		{name: "user", header: "Bearer token", repoCalled: true, expected: http.StatusTeapot,
+			editor: server.Editor{UserID: userID}},
+		{name: "admin", adminToken: testAdminToken, expected: http.StatusTeapot, editor: server.Editor{Admin: true}},
+		{name: "bad admin token", adminToken: "bad", expected: http.StatusForbidden},
+		{name: "none", expected: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.repoCalled {
+				mocks.MockGetUserIDByToken(m, gomock.Any(), userID, nil)
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actual, ok := editorFromContext(r.Context())
+				assert.True(t, ok)
+				assert.Equal(t, tt.editor, actual)
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			req := httptest.NewRequest(http.MethodDelete,
+				fmt.Sprintf("/api/rooms/%s/messages/%s", roomID, uuid.New()), nil)
+			if tt.header != "" {
+				req.Header.Set(AuthorizationHeader, tt.header)
+			}
+			if tt.adminToken != "" {
+				req.Header.Set(AdminTokenHeader, tt.adminToken)
+			}
+
+			rr := httptest.NewRecorder()
+			srv.userOrAdmin(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
 
-	assert.Equal(t, log, srv.log)
-	assert.Equal(t, service, srv.service)
+func TestServer_editMessage(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: userID, RoomID: roomID, Text: "old",
+		Time: time.Unix(1621521072, 0).UTC()}
+	messageVars := map[string]string{
+		roomIDParameter:    roomID.String(),
+		messageIDParameter: msg.ID.String(),
+	}
+
+	newRequest := func(body string, userID uuid.UUID) *http.Request {
+		req := httptest.NewRequest(http.MethodPut,
+			fmt.Sprintf("/api/rooms/%s/messages/%s", roomID, msg.ID), strings.NewReader(body))
+		req = mux.SetURLVars(req, messageVars)
+		return req.WithContext(withUserID(req.Context(), userID))
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockEditMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Eq("new"), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{userID}), nil, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, newRequest(`{"text":"new"}`, userID))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("bad message id", func(t *testing.T) {
+		req := mux.SetURLVars(newRequest(`{"text":"new"}`, userID),
+			map[string]string{roomIDParameter: roomID.String(), messageIDParameter: "test"})
+
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, newRequest("{", userID))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("not author", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Any())
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, newRequest(`{"text":"new"}`, uuid.New()))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, newRequest(`{"text":"new"}`, userID))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.editMessage()(rr, newRequest(`{"text":"new"}`, userID))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_deleteMessage(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: userID, RoomID: roomID, Text: "old",
+		Time: time.Unix(1621521072, 0).UTC()}
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/rooms/%s/messages/%s", roomID, msg.ID), nil)
+	req = mux.SetURLVars(req, map[string]string{
+		roomIDParameter:    roomID.String(),
+		messageIDParameter: msg.ID.String(),
+	})
+	reqAdmin := req.WithContext(withAdmin(req.Context()))
+
+	t.Run("admin", func(t *testing.T) {
+		found := msg
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockDeleteMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{userID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		rr := httptest.NewRecorder()
+		srv.deleteMessage()(rr, reqAdmin)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.deleteMessage()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.deleteMessage()(rr, reqAdmin)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestServer_getDirectRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	peer := user.User{ID: uuid.New(), Username: "peer"}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/direct/peer", nil)
+	req = mux.SetURLVars(req, map[string]string{usernameParameter: peer.Username})
+	reqUser := req.WithContext(withUserID(req.Context(), userID))
+
+	t.Run("ok", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		m.EXPECT().IsRoomExist(gomock.Any(), gomock.Any()).Return(true, nil).Times(1)
+
+		rr := httptest.NewRecorder()
+		srv.getDirectRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actual uuid.UUID
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+		assert.NotEqual(t, uuid.UUID{}, actual)
+	})
+
+	t.Run("no messages yet", func(t *testing.T) {
+		found := peer
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		m.EXPECT().IsRoomExist(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+
+		rr := httptest.NewRecorder()
+		srv.getDirectRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("self", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &user.User{ID: userID, Username: peer.Username}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getDirectRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.getDirectRoom()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.getDirectRoom()(rr, reqUser)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_sendDirectMessage(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	peer := user.User{ID: uuid.New(), Username: "peer"}
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/direct/peer/messages", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{usernameParameter: peer.Username})
+		return req.WithContext(withUserID(req.Context(), usr.ID))
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		found := peer
+		var directRoom *room.Room
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), &found, nil)
+		m.EXPECT().IsRoomExist(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+		mocks.MockAddRoomMembers(m, gomock.Any(), gomock.Eq([]uuid.UUID{usr.ID, peer.ID}), nil)
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				directRoom = r
+				return nil
+			}).
+			Times(1)
+		m.EXPECT().GetRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ uuid.UUID) (*room.Room, error) {
+				return directRoom, nil
+			}).
+			Times(1)
+		mockMember(gomock.Any(), gomock.Eq(usr.ID))
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+
+		rr := httptest.NewRecorder()
+		srv.sendDirectMessage()(rr, newRequest(`{"text": "Hello"}`))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var actual uuid.UUID
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+		require.NotNil(t, directRoom)
+		assert.True(t, directRoom.Direct)
+		assert.Equal(t, directRoom.ID, actual)
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.sendDirectMessage()(rr, newRequest("test"))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("empty message", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.sendDirectMessage()(rr, newRequest(`{"text": " "}`))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq(peer.Username), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.sendDirectMessage()(rr, newRequest(`{"text": "Hello"}`))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/direct/peer/messages", strings.NewReader(`{"text": "Hello"}`))
+
+		rr := httptest.NewRecorder()
+		srv.sendDirectMessage()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestServer_getThread(t *testing.T) {
+	setup(t)
+
+	msg := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "parent",
+		Time: time.Unix(1621521072, 0).UTC()}
+	reply := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "reply",
+		Time: time.Unix(1621521073, 0).UTC(), ReplyTo: &msg.ID}
+
+	newRequest := func(query string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet,
+			fmt.Sprintf("/api/rooms/%s/messages/%s/thread%s", roomID, msg.ID, query), nil)
+		return mux.SetURLVars(req, map[string]string{
+			roomIDParameter:    roomID.String(),
+			messageIDParameter: msg.ID.String(),
+		})
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Eq(repository.Cursor{}),
+			gomock.Eq(server.MessageLimit+1), []message.Message{reply}, nil)
+		// Ids of users are collected from map, so their order varies
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), []user.User{
+			{ID: reply.UserID, Username: "replier"},
+			{ID: msg.UserID, Username: "author"},
+		}, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{reply.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{reply.ID, msg.ID}),
+			map[uuid.UUID]int{msg.ID: 1}, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getThread()(rr, newRequest(""))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var cm chat.Messages
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&cm))
+		assert.Equal(t, []message.Message{reply}, cm.Messages)
+		assert.Equal(t, map[uuid.UUID]message.Message{msg.ID: msg}, cm.Parents)
+		assert.Equal(t, map[uuid.UUID]int{msg.ID: 1}, cm.ReplyCounts)
+		assert.False(t, cm.HasMore)
+	})
+
+	t.Run("bad last message id", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.getThread()(rr, newRequest(fmt.Sprintf("?%s=bad", LastMessageIDParameter)))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.getThread()(rr, newRequest(""))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), gomock.Any(), nil,
+			errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.getThread()(rr, newRequest(""))
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_addReaction(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "test",
+		Time: time.Unix(1621521072, 0).UTC()}
+	messageVars := map[string]string{
+		roomIDParameter:    roomID.String(),
+		messageIDParameter: msg.ID.String(),
+	}
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/messages/%s/reactions", roomID, msg.ID), strings.NewReader(body))
+		req = mux.SetURLVars(req, messageVars)
+		return req.WithContext(withUserID(req.Context(), userID))
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockAddReaction(m, gomock.Eq(&reaction.Reaction{
+			RoomID: roomID, MessageID: msg.ID, UserID: userID, Emoji: "👍",
+		}), nil)
+		mocks.MockUpdateMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{msg.UserID}), nil, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		rr := httptest.NewRecorder()
+		srv.addReaction()(rr, newRequest(`{"emoji":"👍"}`))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("bad json", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.addReaction()(rr, newRequest("{"))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid reaction", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.addReaction()(rr, newRequest(`{"emoji":"+1"}`))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.addReaction()(rr, newRequest(`{"emoji":"👍"}`))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost,
+			fmt.Sprintf("/api/rooms/%s/messages/%s/reactions", roomID, msg.ID), strings.NewReader(`{"emoji":"👍"}`))
+		req = mux.SetURLVars(req, messageVars)
+
+		rr := httptest.NewRecorder()
+		srv.addReaction()(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestServer_removeReaction(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "test",
+		Time: time.Unix(1621521072, 0).UTC()}
+
+	req := httptest.NewRequest(http.MethodDelete,
+		fmt.Sprintf("/api/rooms/%s/messages/%s/reactions/%s", roomID, msg.ID, url.PathEscape("👍")), nil)
+	req = mux.SetURLVars(req, map[string]string{
+		roomIDParameter:    roomID.String(),
+		messageIDParameter: msg.ID.String(),
+		emojiParameter:     "👍",
+	})
+	req = req.WithContext(withUserID(req.Context(), userID))
+	expectedReaction := &reaction.Reaction{RoomID: roomID, MessageID: msg.ID, UserID: userID, Emoji: "👍"}
+
+	t.Run("ok", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockRemoveReaction(m, gomock.Eq(expectedReaction), nil)
+		mocks.MockUpdateMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{msg.UserID}), nil, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		rr := httptest.NewRecorder()
+		srv.removeReaction()(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockRemoveReaction(m, gomock.Eq(expectedReaction), repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.removeReaction()(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(roomID), gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockRemoveReaction(m, gomock.Eq(expectedReaction), errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.removeReaction()(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_getRooms(t *testing.T) {
+	setup(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+
+	t.Run("ok", func(t *testing.T) {
+		rooms := []room.Room{{ID: uuid.New()}, {ID: uuid.New()}}
+		mocks.MockGetRooms(m, rooms, nil)
+
+		rr := httptest.NewRecorder()
+		srv.getRooms()(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var actual []uuid.UUID
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{rooms[0].ID, rooms[1].ID}, actual)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRooms(m, nil, errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.getRooms()(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_createRoom(t *testing.T) {
+	setup(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/rooms", nil)
+
+	t.Run("ok", func(t *testing.T) {
+		var savedRoom *room.Room
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				savedRoom = r
+				return nil
+			}).
+			Times(1)
+
+		rr := httptest.NewRecorder()
+		srv.createRoom()(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var actual uuid.UUID
+		err := json.NewDecoder(rr.Body).Decode(&actual)
+		assert.NoError(t, err)
+		require.NotNil(t, savedRoom)
+		assert.Equal(t, savedRoom.ID, actual)
+		assert.False(t, savedRoom.Private)
+	})
+
+	t.Run("private", func(t *testing.T) {
+		var savedRoom *room.Room
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				savedRoom = r
+				return nil
+			}).
+			Times(1)
+
+		rr := httptest.NewRecorder()
+		srv.createRoom()(rr, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(`{"private":true}`)))
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		require.NotNil(t, savedRoom)
+		assert.True(t, savedRoom.Private)
+	})
+
+	t.Run("owner not found", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq("owner"), nil, repository.ErrorNotFound)
+
+		rr := httptest.NewRecorder()
+		srv.createRoom()(rr, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(`{"owner":"owner"}`)))
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("bad body", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.createRoom()(rr, httptest.NewRequest(http.MethodPost, "/api/rooms", strings.NewReader(`{`)))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockCreateRoom(m, gomock.Any(), errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.createRoom()(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_deleteRoom(t *testing.T) {
+	setup(t)
+
+	req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/rooms/%s", roomID), nil)
+	req = mux.SetURLVars(req, vars)
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockDeleteRoom(m, gomock.Eq(roomID), nil)
+
+		rr := httptest.NewRecorder()
+		srv.deleteRoom()(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("bad room id", func(t *testing.T) {
+		reqBadRoomID := mux.SetURLVars(req, map[string]string{roomIDParameter: "test"})
+
+		rr := httptest.NewRecorder()
+		srv.deleteRoom()(rr, reqBadRoomID)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), false, nil)
+
+		rr := httptest.NewRecorder()
+		srv.deleteRoom()(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("delete err", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockDeleteRoom(m, gomock.Eq(roomID), errors.New("error"))
+
+		rr := httptest.NewRecorder()
+		srv.deleteRoom()(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServer_routes(t *testing.T) {
+	setup(t)
+
+	srv.routes()
+
+	type args struct {
+		method string
+		url    string
+	}
+	type expected struct {
+		handler http.Handler
+	}
+	tests := []struct {
+		name     string
+		args     args
+		expected expected
+	}{
+		{
+			name: "get messages",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/messages", roomID),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.getMessages()),
+			},
+		},
+		{
+			name: "get messages with last id",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, LastMessageIDParameter, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.getMessages()),
+			},
+		},
+		{
+			name: "get messages before id",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/messages?%s=%s", roomID, BeforeMessageIDParameter, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.getMessages()),
+			},
+		},
+		{
+			name: "send messages",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/messages", roomID),
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.sendMassage()),
+			},
+		},
+		{
+			name: "edit message",
+			args: args{
+				method: http.MethodPut,
+				url:    fmt.Sprintf("/api/rooms/%s/messages/%s", roomID, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.editMessage()),
+			},
+		},
+		{
+			name: "delete message",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s/messages/%s", roomID, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.deleteMessage()),
+			},
+		},
+		{
+			name: "get thread",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/messages/%s/thread", roomID, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.getThread()),
+			},
+		},
+		{
+			name: "add reaction",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/messages/%s/reactions", roomID, uuid.New()),
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.addReaction()),
+			},
+		},
+		{
+			name: "remove reaction",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s/messages/%s/reactions/%s", roomID, uuid.New(), url.PathEscape("👍")),
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.removeReaction()),
+			},
+		},
+		{
+			name: "stream messages",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/ws", roomID),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.streamMessages()),
+			},
+		},
+		{
+			name: "stream events",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/events", roomID),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.streamEvents()),
+			},
+		},
+		{
+			name: "join room",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/join", roomID),
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.joinRoom()),
+			},
+		},
+		{
+			name: "leave room",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/leave", roomID),
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.leaveRoom()),
+			},
+		},
+		{
+			name: "get room members",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/members", roomID),
+			},
+			expected: expected{
+				handler: srv.maybeAuthenticated(srv.getRoomMembers()),
+			},
+		},
+		{
+			name: "invite to room",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/members", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.inviteToRoom()),
+			},
+		},
+		{
+			name: "kick user",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s/members/test", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.moderateUser("kick user", service.KickUser)),
+			},
+		},
+		{
+			name: "set role",
+			args: args{
+				method: http.MethodPut,
+				url:    fmt.Sprintf("/api/rooms/%s/members/test/role", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.setRole()),
+			},
+		},
+		{
+			name: "mute user",
+			args: args{
+				method: http.MethodPost,
+				url:    fmt.Sprintf("/api/rooms/%s/members/test/mute", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.muteUser()),
+			},
+		},
+		{
+			name: "unmute user",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s/members/test/mute", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.moderateUser("unmute user", service.UnmuteUser)),
+			},
+		},
+		{
+			name: "ban user",
+			args: args{
+				method: http.MethodPut,
+				url:    fmt.Sprintf("/api/rooms/%s/bans/test", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.moderateUser("ban user", service.BanUser)),
+			},
+		},
+		{
+			name: "unban user",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s/bans/test", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.moderateUser("unban user", service.UnbanUser)),
+			},
+		},
+		{
+			name: "get moderation log",
+			args: args{
+				method: http.MethodGet,
+				url:    fmt.Sprintf("/api/rooms/%s/moderation", roomID),
+			},
+			expected: expected{
+				handler: srv.userOrAdmin(srv.getModerationLog()),
+			},
+		},
+		{
+			name: "get direct room",
+			args: args{
+				method: http.MethodGet,
+				url:    "/api/direct/test",
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.getDirectRoom()),
+			},
+		},
+		{
+			name: "send direct message",
+			args: args{
+				method: http.MethodPost,
+				url:    "/api/direct/test/messages",
+			},
+			expected: expected{
+				handler: srv.authenticated(srv.sendDirectMessage()),
+			},
+		},
+		{
+			name: "create user",
+			args: args{
+				method: http.MethodPost,
+				url:    "/api/users",
+			},
+			expected: expected{
+				handler: srv.createUser(),
+			},
+		},
+		{
+			name: "get rooms",
+			args: args{
+				method: http.MethodGet,
+				url:    "/api/rooms",
+			},
+			expected: expected{
+				handler: srv.adminOnly(srv.getRooms()),
+			},
+		},
+		{
+			name: "create room",
+			args: args{
+				method: http.MethodPost,
+				url:    "/api/rooms",
+			},
+			expected: expected{
+				handler: srv.adminOnly(srv.createRoom()),
+			},
+		},
+		{
+			name: "delete room",
+			args: args{
+				method: http.MethodDelete,
+				url:    fmt.Sprintf("/api/rooms/%s", roomID),
+			},
+			expected: expected{
+				handler: srv.adminOnly(srv.deleteRoom()),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.args.method, tt.args.url, nil)
+
+			rm := &mux.RouteMatch{}
+			srv.router.Match(request, rm)
+
+			// Compared by names since inlined handler constructors may produce different copies of the same closure
+			v1 := runtime.FuncForPC(reflect.ValueOf(rm.Handler).Pointer()).Name()
+			v2 := runtime.FuncForPC(reflect.ValueOf(tt.expected.handler).Pointer()).Name()
+			assert.Equal(t, v2, v1, "unexpected router")
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	m := mocks.NewMockRepository(ctrl)
+	log, _ := test.NewNullLogger()
+	service := server.NewService(m, server.DefaultMessageRules(), log)
+
+	srv := NewServer(service, testAdminToken, time.Second, log)
+
+	assert.Equal(t, log, srv.log)
+	assert.Equal(t, service, srv.service)
+	assert.Equal(t, testAdminToken, srv.adminToken)
+	assert.Equal(t, time.Second, srv.requestTimeout)
+}
+
+func TestServer_requestContext(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/api/rooms", nil)
+
+	t.Run("timeout", func(t *testing.T) {
+		s := Server{requestTimeout: time.Minute}
+		ctx, cancel := s.requestContext(request, time.Second)
+		defer cancel()
+
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute+time.Second), deadline, time.Second)
+	})
+
+	t.Run("no timeout", func(t *testing.T) {
+		s := Server{}
+		ctx, cancel := s.requestContext(request, time.Second)
+		defer cancel()
+
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+
+		cancel()
+		assert.Error(t, ctx.Err())
+	})
 }
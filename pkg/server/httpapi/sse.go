@@ -0,0 +1,211 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+const (
+	// LastEventIDHeader is a header that is sent by Server-Sent Events clients on reconnect
+	LastEventIDHeader = "Last-Event-ID"
+
+	sseEventMessage    = "message"
+	sseEventUpdate     = "update"
+	sseEventForbidden  = "forbidden"
+	sseKeepAlivePeriod = 30 * time.Second
+)
+
+func (s *Server) streamEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lastMessageID, err := lastEventIDFromRequest(r)
+		if err != nil {
+			if err = respondJSONError(w, err, http.StatusBadRequest); err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			s.log.Error("streaming is not supported")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Only subscription is limited by request timeout, stream itself lasts until request is done
+		ctx, cancel := s.requestContext(r, 0)
+		sub, messages, err := s.subscribe(ctx, roomID, readerIDFromContext(r.Context()), lastMessageID)
+		cancel()
+		if err != nil {
+			err := respondJSONError(w, err, errorStatus(err, http.StatusBadRequest))
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		if err = s.sseStream(w, flusher, r, sub, messages); err != nil {
+			s.log.Debug("event stream: ", err)
+		}
+	}
+}
+
+// sseStream writes already sent messages and then new messages as events until request is done
+func (s *Server) sseStream(w io.Writer, flusher http.Flusher, r *http.Request,
+	sub *server.Subscription, messages *chat.Messages) error {
+	if err := sseWriteMessages(w, messages); err != nil {
+		return err
+	}
+	flusher.Flush()
+	sent := newMessageFilter(messages)
+
+	ticker := time.NewTicker(sseKeepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case cm, ok := <-sub.Messages():
+			if !ok {
+				// Reader who lost access to room is told not to reconnect, while slow one may reconnect
+				if err := sub.Err(); err != nil && !errors.Is(err, server.ErrorTooSlow) {
+					return sseWriteForbidden(w, flusher, err)
+				}
+				return errors.New("subscription dropped")
+			}
+
+			if cm = sent.filter(cm); cm == nil {
+				continue
+			}
+			if err := sseWriteMessages(w, cm); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return fmt.Errorf("keep-alive: %w", err)
+			}
+		case <-r.Context().Done():
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+// sseWriteMessages writes each message as separate event with message id as event id, updates of sent messages
+// are written without event id, so they don't change position of reconnecting client
+func sseWriteMessages(w io.Writer, cm *chat.Messages) error {
+	for _, msg := range cm.Messages {
+		event := sseMessageDetails(cm, &msg)
+		event.Messages = []message.Message{msg}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("json encode: %w", err)
+		}
+
+		_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, sseEventMessage, data)
+		if err != nil {
+			return fmt.Errorf("write event: %w", err)
+		}
+	}
+
+	for _, msg := range cm.Updated {
+		event := sseMessageDetails(cm, &msg)
+		event.Messages = []message.Message{}
+		event.Updated = []message.Message{msg}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("json encode: %w", err)
+		}
+
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", sseEventUpdate, data)
+		if err != nil {
+			return fmt.Errorf("write event: %w", err)
+		}
+	}
+	return nil
+}
+
+// sseWriteForbidden writes error as the last event of stream with "forbidden" as event type
+func sseWriteForbidden(w io.Writer, flusher http.Flusher, reason error) error {
+	data, err := json.Marshal(struct {
+		Error string `json:"error"`
+	}{Error: reason.Error()})
+	if err != nil {
+		return fmt.Errorf("json encode: %w", err)
+	}
+
+	if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", sseEventForbidden, data); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	flusher.Flush()
+	return nil
+}
+
+// lastEventIDFromRequest returns last message id from Last-Event-ID header or from query if header is not set
+func lastEventIDFromRequest(r *http.Request) (*uuid.UUID, error) {
+	lastEventIDStr := r.Header.Get(LastEventIDHeader)
+	if lastEventIDStr == "" {
+		return lastMessageIDFromQuery(r)
+	}
+
+	lastEventID, err := uuid.Parse(lastEventIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", LastEventIDHeader, err)
+	}
+	return &lastEventID, nil
+}
+
+// sseMessageDetails returns details of one message from cm: username of author, reactions, replied message
+// and reply counts
+func sseMessageDetails(cm *chat.Messages, msg *message.Message) *chat.Messages {
+	details := &chat.Messages{
+		Usernames: map[uuid.UUID]string{msg.UserID: cm.Usernames[msg.UserID]},
+	}
+	if counts, ok := cm.Reactions[msg.ID]; ok {
+		details.Reactions = map[uuid.UUID]reaction.Counts{msg.ID: counts}
+	}
+
+	ids := []uuid.UUID{msg.ID}
+	if msg.ReplyTo != nil {
+		if parent, ok := cm.Parents[*msg.ReplyTo]; ok {
+			details.Parents = map[uuid.UUID]message.Message{parent.ID: parent}
+			details.Usernames[parent.UserID] = cm.Usernames[parent.UserID]
+			ids = append(ids, parent.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if count, ok := cm.ReplyCounts[id]; ok {
+			if details.ReplyCounts == nil {
+				details.ReplyCounts = make(map[uuid.UUID]int)
+			}
+			details.ReplyCounts[id] = count
+		}
+	}
+	return details
+}
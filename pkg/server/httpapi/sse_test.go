@@ -0,0 +1,297 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEEvent reads next event skipping comments
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if event != (sseEvent{}) {
+				return event
+			}
+		case strings.HasPrefix(line, ":"):
+		//	comment
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line: %q", line)
+		}
+	}
+}
+
+func TestServer_streamEvents(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	log, _ := test.NewNullLogger()
+	service := server.NewService(repo, server.DefaultMessageRules(), log)
+	srv := NewServer(service, testAdminToken, 0, log)
+
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	roomID := uuid.New()
+	require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: roomID}))
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	require.NoError(t, repo.CreateUser(context.Background(), &usr, uuid.New().String()))
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{usr.ID}))
+
+	messages := make([]message.Message, 2)
+	for i := range messages {
+		messages[i] = message.Message{
+			ID:     uuid.New(),
+			UserID: usr.ID,
+			RoomID: roomID,
+			Text:   fmt.Sprintf("sent before %d", i),
+			Time:   time.Unix(1621521072+int64(i), 0).UTC(),
+		}
+		require.NoError(t, repo.SaveMessage(context.Background(), &messages[i]))
+	}
+
+	eventsURL := httpServer.URL + fmt.Sprintf("/api/rooms/%s/events", roomID)
+
+	stream := func(t *testing.T, lastEventID string) (*bufio.Reader, func()) {
+		t.Helper()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, eventsURL, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set(LastEventIDHeader, lastEventID)
+		}
+
+		resp, err := httpServer.Client().Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		return bufio.NewReader(resp.Body), func() {
+			cancel()
+			_ = resp.Body.Close()
+		}
+	}
+
+	decode := func(t *testing.T, event sseEvent) chat.Messages {
+		t.Helper()
+
+		var cm chat.Messages
+		require.NoError(t, json.Unmarshal([]byte(event.data), &cm))
+		require.Len(t, cm.Messages, 1)
+		assert.Equal(t, cm.Messages[0].ID.String(), event.id)
+		assert.Equal(t, sseEventMessage, event.event)
+		return cm
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		r, stop := stream(t, "")
+		defer stop()
+
+		for _, msg := range messages {
+			cm := decode(t, readSSEEvent(t, r))
+			assert.Equal(t, msg.Text, cm.Messages[0].Text)
+			assert.Equal(t, map[uuid.UUID]string{usr.ID: usr.Username}, cm.Usernames)
+		}
+
+		require.NoError(t, service.SendMessage(context.Background(), roomID, usr.ID, chat.NewMessage{Text: "new"}))
+
+		cm := decode(t, readSSEEvent(t, r))
+		assert.Equal(t, "new", cm.Messages[0].Text)
+		assert.Equal(t, usr.Username, cm.Usernames[usr.ID])
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		r, stop := stream(t, messages[0].ID.String())
+		defer stop()
+
+		cm := decode(t, readSSEEvent(t, r))
+		assert.Equal(t, messages[1].Text, cm.Messages[0].Text)
+		cm = decode(t, readSSEEvent(t, r))
+		assert.Equal(t, "new", cm.Messages[0].Text)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		r, stop := stream(t, messages[1].ID.String())
+		defer stop()
+
+		cm := decode(t, readSSEEvent(t, r))
+		assert.Equal(t, "new", cm.Messages[0].Text)
+
+		err := service.DeleteMessage(context.Background(), roomID, messages[0].ID, server.Editor{UserID: usr.ID})
+		require.NoError(t, err)
+
+		event := readSSEEvent(t, r)
+		assert.Equal(t, sseEventUpdate, event.event)
+		assert.Empty(t, event.id)
+
+		var update chat.Messages
+		require.NoError(t, json.Unmarshal([]byte(event.data), &update))
+		assert.Empty(t, update.Messages)
+		require.Len(t, update.Updated, 1)
+		assert.Equal(t, messages[0].ID, update.Updated[0].ID)
+		assert.True(t, update.Updated[0].Deleted)
+		assert.Equal(t, usr.Username, update.Usernames[usr.ID])
+	})
+
+	t.Run("bad last event id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, eventsURL, nil)
+		req.Header.Set(LastEventIDHeader, "bad")
+
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/rooms/%s/events", uuid.New()), nil)
+
+		rr := httptest.NewRecorder()
+		srv.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestServer_streamEvents_accessLost(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	log, _ := test.NewNullLogger()
+	service := server.NewService(repo, server.DefaultMessageRules(), log)
+	srv := NewServer(service, testAdminToken, 0, log)
+
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	roomID := uuid.New()
+	require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: roomID, Private: true}))
+	credentials, err := service.CreateUser(context.Background(), chat.NewUser{Username: "test"})
+	require.NoError(t, err)
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{credentials.UserID}))
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+		httpServer.URL+fmt.Sprintf("/api/rooms/%s/events", roomID), nil)
+	require.NoError(t, err)
+	req.Header.Set(AuthorizationHeader, "Bearer "+credentials.Token)
+	resp, err := httpServer.Client().Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, service.LeaveRoom(context.Background(), roomID, credentials.UserID))
+
+	// Reader who left private room is told not to reconnect
+	event := readSSEEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, sseEventForbidden, event.event)
+	assert.Empty(t, event.id)
+	assert.JSONEq(t, fmt.Sprintf(`{"error":%q}`, server.ErrorNotRoomMember), event.data)
+}
+
+func Test_lastEventIDFromRequest(t *testing.T) {
+	headerID := uuid.New()
+	queryID := uuid.New()
+
+	tests := []struct {
+		name     string
+		header   string
+		query    string
+		expected *uuid.UUID
+		err      bool
+	}{
+		{name: "none", expected: nil},
+		{name: "header", header: headerID.String(), expected: &headerID},
+		{name: "query", query: queryID.String(), expected: &queryID},
+		{name: "header over query", header: headerID.String(), query: queryID.String(), expected: &headerID},
+		{name: "bad header", header: "bad", err: true},
+		{name: "bad query", query: "bad", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := "/"
+			if tt.query != "" {
+				url += fmt.Sprintf("?%s=%s", LastMessageIDParameter, tt.query)
+			}
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			if tt.header != "" {
+				req.Header.Set(LastEventIDHeader, tt.header)
+			}
+
+			actual, err := lastEventIDFromRequest(req)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_sseMessageDetails(t *testing.T) {
+	parent := message.Message{ID: uuid.New(), UserID: uuid.New(), Text: "parent"}
+	reply := message.Message{ID: uuid.New(), UserID: uuid.New(), Text: "reply", ReplyTo: &parent.ID}
+	other := message.Message{ID: uuid.New(), UserID: uuid.New(), Text: "other"}
+
+	cm := &chat.Messages{
+		Messages: []message.Message{reply, other},
+		Usernames: map[uuid.UUID]string{
+			parent.UserID: "parent",
+			reply.UserID:  "reply",
+			other.UserID:  "other",
+		},
+		Reactions: map[uuid.UUID]reaction.Counts{
+			reply.ID: {"👍": 1},
+			other.ID: {"🎉": 2},
+		},
+		Parents:     map[uuid.UUID]message.Message{parent.ID: parent},
+		ReplyCounts: map[uuid.UUID]int{parent.ID: 1},
+	}
+
+	assert.Equal(t, &chat.Messages{
+		Usernames:   map[uuid.UUID]string{parent.UserID: "parent", reply.UserID: "reply"},
+		Reactions:   map[uuid.UUID]reaction.Counts{reply.ID: {"👍": 1}},
+		Parents:     map[uuid.UUID]message.Message{parent.ID: parent},
+		ReplyCounts: map[uuid.UUID]int{parent.ID: 1},
+	}, sseMessageDetails(cm, &reply))
+
+	assert.Equal(t, &chat.Messages{
+		Usernames: map[uuid.UUID]string{other.UserID: "other"},
+		Reactions: map[uuid.UUID]reaction.Counts{other.ID: {"🎉": 2}},
+	}, sseMessageDetails(cm, &other))
+}
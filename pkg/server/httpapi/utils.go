@@ -1,10 +1,17 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
 )
 
 // respondJSON writes data as JSON
@@ -39,3 +46,222 @@ func respondJSONError(w http.ResponseWriter, err error, statusCode int) error {
 func decodeJSON(r *http.Request, v interface{}) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
+
+// roomIDFromVars returns room id from request path variables
+func roomIDFromVars(r *http.Request) (uuid.UUID, error) {
+	return uuidFromVars(r, roomIDParameter)
+}
+
+// messageIDsFromVars returns room id and message id from request path variables
+func messageIDsFromVars(r *http.Request) (roomID, messageID uuid.UUID, err error) {
+	roomID, err = uuidFromVars(r, roomIDParameter)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	}
+
+	messageID, err = uuidFromVars(r, messageIDParameter)
+	if err != nil {
+		return uuid.UUID{}, uuid.UUID{}, err
+	}
+	return roomID, messageID, nil
+}
+
+// uuidFromVars returns id from request path variable
+func uuidFromVars(r *http.Request, parameter string) (uuid.UUID, error) {
+	idStr, ok := mux.Vars(r)[parameter]
+	if !ok {
+		return uuid.UUID{}, fmt.Errorf("%s is required", parameter)
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("invalid %s: %w", parameter, err)
+	}
+	return id, nil
+}
+
+// messagesQuery represents query parameters of get messages request
+type messagesQuery struct {
+	lastMessageID   *uuid.UUID
+	beforeMessageID *uuid.UUID
+	wait            time.Duration
+	updatedAfter    *time.Time
+}
+
+// messagesQueryFromRequest returns validated query parameters of get messages request
+func messagesQueryFromRequest(r *http.Request) (*messagesQuery, error) {
+	lastMessageID, err := lastMessageIDFromQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	beforeMessageID, err := beforeMessageIDFromQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	wait, err := waitFromQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAfter, err := updatedAfterFromQuery(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if beforeMessageID != nil && (lastMessageID != nil || wait > 0 || updatedAfter != nil) {
+		return nil, fmt.Errorf("%s can't be used with %s, %s or %s",
+			BeforeMessageIDParameter, LastMessageIDParameter, WaitParameter, UpdatedAfterParameter)
+	}
+
+	return &messagesQuery{
+		lastMessageID:   lastMessageID,
+		beforeMessageID: beforeMessageID,
+		wait:            wait,
+		updatedAfter:    updatedAfter,
+	}, nil
+}
+
+// lastMessageIDFromQuery returns last message id from request query or nil if it's not specified
+func lastMessageIDFromQuery(r *http.Request) (*uuid.UUID, error) {
+	return messageIDFromQuery(r, LastMessageIDParameter)
+}
+
+// beforeMessageIDFromQuery returns id of message to get history before from request query or nil if it's not specified
+func beforeMessageIDFromQuery(r *http.Request) (*uuid.UUID, error) {
+	return messageIDFromQuery(r, BeforeMessageIDParameter)
+}
+
+// messageIDFromQuery returns message id from request query parameter or nil if it's not specified
+func messageIDFromQuery(r *http.Request, parameter string) (*uuid.UUID, error) {
+	messageIDStr := r.URL.Query().Get(parameter)
+	if messageIDStr == "" {
+		return nil, nil
+	}
+
+	messageID, err := uuid.Parse(messageIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", parameter, err)
+	}
+	return &messageID, nil
+}
+
+// waitFromQuery returns duration to wait for new messages from request query or zero if it's not specified
+func waitFromQuery(r *http.Request) (time.Duration, error) {
+	waitStr := r.URL.Query().Get(WaitParameter)
+	if waitStr == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wait: %w", err)
+	}
+	if wait < 0 {
+		return 0, errors.New("invalid wait: must not be negative")
+	}
+	return wait, nil
+}
+
+// updatedAfterFromQuery returns time to get updated messages after from request query or nil if it's not specified
+func updatedAfterFromQuery(r *http.Request) (*time.Time, error) {
+	updatedAfterStr := r.URL.Query().Get(UpdatedAfterParameter)
+	if updatedAfterStr == "" {
+		return nil, nil
+	}
+
+	updatedAfter, err := time.Parse(time.RFC3339Nano, updatedAfterStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", UpdatedAfterParameter, err)
+	}
+	return &updatedAfter, nil
+}
+
+// bearerToken returns token from Authorization header or empty string if it's not specified
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get(AuthorizationHeader)
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix))
+}
+
+type userIDKey struct{}
+
+// withUserID returns copy of context with id of authenticated user
+func withUserID(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// userIDFromContext returns id of authenticated user stored in context
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(uuid.UUID)
+	return userID, ok
+}
+
+// readerIDFromContext returns id of authenticated user stored in context or nil if request is anonymous
+func readerIDFromContext(ctx context.Context) *uuid.UUID {
+	userID, ok := userIDFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
+
+type adminKey struct{}
+
+// withAdmin returns copy of context marked as context of request made by admin
+func withAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminKey{}, true)
+}
+
+// editorFromContext returns admin or authenticated user stored in context
+func editorFromContext(ctx context.Context) (server.Editor, bool) {
+	if admin, _ := ctx.Value(adminKey{}).(bool); admin {
+		return server.Editor{Admin: true}, true
+	}
+
+	userID, ok := userIDFromContext(ctx)
+	return server.Editor{UserID: userID}, ok
+}
+
+// errorStatuses maps service errors to HTTP statuses
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{err: server.ErrorRoomNotFound, status: http.StatusNotFound},
+	{err: server.ErrorUserNotFound, status: http.StatusNotFound},
+	{err: server.ErrorMessageNotFound, status: http.StatusNotFound},
+	{err: server.ErrorReactionNotFound, status: http.StatusNotFound},
+	{err: server.ErrorUnauthorized, status: http.StatusUnauthorized},
+	{err: server.ErrorNotMessageAuthor, status: http.StatusForbidden},
+	{err: server.ErrorInvalidUsername, status: http.StatusBadRequest},
+	{err: server.ErrorUsernameTaken, status: http.StatusConflict},
+	{err: server.ErrorEmptyMessage, status: http.StatusBadRequest},
+	{err: server.ErrorInvalidMessage, status: http.StatusBadRequest},
+	{err: server.ErrorMessageTooLong, status: http.StatusRequestEntityTooLarge},
+	{err: server.ErrorInvalidReaction, status: http.StatusBadRequest},
+	{err: server.ErrorParentNotFound, status: http.StatusBadRequest},
+	{err: server.ErrorNotRoomMember, status: http.StatusForbidden},
+	{err: server.ErrorDirectToSelf, status: http.StatusBadRequest},
+	{err: server.ErrorPrivateRoom, status: http.StatusForbidden},
+	{err: server.ErrorDirectRoom, status: http.StatusBadRequest},
+	{err: server.ErrorNotModerator, status: http.StatusForbidden},
+	{err: server.ErrorInvalidRole, status: http.StatusBadRequest},
+	{err: server.ErrorInvalidDuration, status: http.StatusBadRequest},
+	{err: server.ErrorMuted, status: http.StatusForbidden},
+	{err: server.ErrorBanned, status: http.StatusForbidden},
+	{err: context.DeadlineExceeded, status: http.StatusGatewayTimeout},
+}
+
+// errorStatus returns HTTP status corresponding to service error or defaultStatus if error is not known
+func errorStatus(err error, defaultStatus int) int {
+	for _, es := range errorStatuses {
+		if errors.Is(err, es.err) {
+			return es.status
+		}
+	}
+	return defaultStatus
+}
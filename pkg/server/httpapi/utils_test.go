@@ -1,13 +1,20 @@
 package httpapi
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/mux"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_respondJSON(t *testing.T) {
@@ -185,3 +192,232 @@ func Test_decodeJSON(t *testing.T) {
 		})
 	}
 }
+
+func Test_roomIDFromVars(t *testing.T) {
+	roomID := uuid.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		expected uuid.UUID
+		err      bool
+	}{
+		{
+			name:     "ok",
+			vars:     map[string]string{roomIDParameter: roomID.String()},
+			expected: roomID,
+			err:      false,
+		},
+		{
+			name: "no room id",
+			vars: nil,
+			err:  true,
+		},
+		{
+			name: "bad room id",
+			vars: map[string]string{roomIDParameter: "test"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := roomIDFromVars(mux.SetURLVars(req, tt.vars))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_messageIDsFromVars(t *testing.T) {
+	roomID := uuid.New()
+	messageID := uuid.New()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tests := []struct {
+		name string
+		vars map[string]string
+		err  bool
+	}{
+		{
+			name: "ok",
+			vars: map[string]string{roomIDParameter: roomID.String(), messageIDParameter: messageID.String()},
+			err:  false,
+		},
+		{
+			name: "no message id",
+			vars: map[string]string{roomIDParameter: roomID.String()},
+			err:  true,
+		},
+		{
+			name: "bad message id",
+			vars: map[string]string{roomIDParameter: roomID.String(), messageIDParameter: "test"},
+			err:  true,
+		},
+		{
+			name: "bad room id",
+			vars: map[string]string{roomIDParameter: "test", messageIDParameter: messageID.String()},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actualRoomID, actualMessageID, err := messageIDsFromVars(mux.SetURLVars(req, tt.vars))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, roomID, actualRoomID)
+			assert.Equal(t, messageID, actualMessageID)
+		})
+	}
+}
+
+func Test_waitFromQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected time.Duration
+		err      bool
+	}{
+		{name: "none", query: "", expected: 0},
+		{name: "ok", query: "?wait=30s", expected: 30 * time.Second},
+		{name: "zero", query: "?wait=0s", expected: 0},
+		{name: "negative", query: "?wait=-1s", err: true},
+		{name: "bad", query: "?wait=bad", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := waitFromQuery(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func Test_updatedAfterFromQuery(t *testing.T) {
+	updatedAfter := time.Date(2021, 5, 20, 14, 31, 12, 123456789, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected *time.Time
+		err      bool
+	}{
+		{name: "none", query: "", expected: nil},
+		{name: "ok", query: "?updatedAfter=2021-05-20T14:31:12.123456789Z", expected: &updatedAfter},
+		{name: "escaped offset", query: "?updatedAfter=2021-05-20T17%3A31%3A12.123456789%2B03%3A00",
+			expected: &updatedAfter},
+		{name: "bad", query: "?updatedAfter=bad", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := updatedAfterFromQuery(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil))
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.expected == nil {
+				assert.Nil(t, actual)
+				return
+			}
+			require.NotNil(t, actual)
+			assert.True(t, tt.expected.Equal(*actual))
+		})
+	}
+}
+
+func Test_bearerToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "none", header: "", expected: ""},
+		{name: "ok", header: "Bearer token", expected: "token"},
+		{name: "spaces", header: "Bearer  token ", expected: "token"},
+		{name: "other scheme", header: "Basic token", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(AuthorizationHeader, tt.header)
+			}
+
+			assert.Equal(t, tt.expected, bearerToken(req))
+		})
+	}
+}
+
+func Test_userIDFromContext(t *testing.T) {
+	userID := uuid.New()
+
+	_, ok := userIDFromContext(context.Background())
+	assert.False(t, ok)
+
+	actual, ok := userIDFromContext(withUserID(context.Background(), userID))
+	assert.True(t, ok)
+	assert.Equal(t, userID, actual)
+}
+
+func Test_editorFromContext(t *testing.T) {
+	userID := uuid.New()
+
+	_, ok := editorFromContext(context.Background())
+	assert.False(t, ok)
+
+	actual, ok := editorFromContext(withUserID(context.Background(), userID))
+	assert.True(t, ok)
+	assert.Equal(t, server.Editor{UserID: userID}, actual)
+
+	actual, ok = editorFromContext(withAdmin(context.Background()))
+	assert.True(t, ok)
+	assert.Equal(t, server.Editor{Admin: true}, actual)
+}
+
+func Test_errorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "room not found", err: server.ErrorRoomNotFound, expected: http.StatusNotFound},
+		{name: "user not found", err: server.ErrorUserNotFound, expected: http.StatusNotFound},
+		{name: "message not found", err: server.ErrorMessageNotFound, expected: http.StatusNotFound},
+		{name: "wrapped", err: fmt.Errorf("send message: %w", server.ErrorMessageTooLong),
+			expected: http.StatusRequestEntityTooLarge},
+		{name: "invalid message", err: server.ErrorInvalidMessage, expected: http.StatusBadRequest},
+		{name: "not author", err: server.ErrorNotMessageAuthor, expected: http.StatusForbidden},
+		{name: "reaction not found", err: server.ErrorReactionNotFound, expected: http.StatusNotFound},
+		{name: "invalid reaction", err: server.ErrorInvalidReaction, expected: http.StatusBadRequest},
+		{name: "parent not found", err: server.ErrorParentNotFound, expected: http.StatusBadRequest},
+		{name: "not member", err: server.ErrorNotRoomMember, expected: http.StatusForbidden},
+		{name: "direct to self", err: server.ErrorDirectToSelf, expected: http.StatusBadRequest},
+		{name: "private room", err: server.ErrorPrivateRoom, expected: http.StatusForbidden},
+		{name: "direct room", err: server.ErrorDirectRoom, expected: http.StatusBadRequest},
+		{name: "not moderator", err: server.ErrorNotModerator, expected: http.StatusForbidden},
+		{name: "invalid role", err: server.ErrorInvalidRole, expected: http.StatusBadRequest},
+		{name: "invalid duration", err: server.ErrorInvalidDuration, expected: http.StatusBadRequest},
+		{name: "muted", err: server.ErrorMuted, expected: http.StatusForbidden},
+		{name: "banned", err: server.ErrorBanned, expected: http.StatusForbidden},
+		{name: "timeout", err: fmt.Errorf("get rooms: %w", context.DeadlineExceeded),
+			expected: http.StatusGatewayTimeout},
+		{name: "unknown", err: errors.New("error"), expected: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, errorStatus(tt.err, http.StatusTeapot))
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingPeriod   = wsPongTimeout * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	// Same as CORS, any origin is allowed
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// subscribe starts receiving new messages of room and returns all messages sent after lastMessageID
+// (or latest if lastMessageID is nil) which were sent before subscription, readerID is nil for anonymous reader
+func (s *Server) subscribe(ctx context.Context, roomID uuid.UUID, readerID, lastMessageID *uuid.UUID) (
+	*server.Subscription, *chat.Messages, error) {
+	sub, err := s.service.Subscribe(ctx, roomID, readerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var messages *chat.Messages
+	if lastMessageID == nil {
+		messages, err = s.service.GetMessagesLatest(ctx, roomID, readerID)
+	} else {
+		messages, err = s.drainMessages(ctx, roomID, readerID, *lastMessageID)
+	}
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+
+	return sub, messages, nil
+}
+
+// drainMessages returns all messages sent after lastMessageID with their details by requesting pages until there
+// are no more
+func (s *Server) drainMessages(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID,
+	lastMessageID uuid.UUID) (*chat.Messages, error) {
+	messages := &chat.Messages{
+		Usernames: make(map[uuid.UUID]string),
+	}
+
+	for {
+		page, err := s.service.GetMessagesAfterMessage(ctx, roomID, readerID, lastMessageID)
+		if err != nil {
+			return nil, err
+		}
+
+		messages.Messages = append(messages.Messages, page.Messages...)
+		for id, username := range page.Usernames {
+			messages.Usernames[id] = username
+		}
+		for id, counts := range page.Reactions {
+			if messages.Reactions == nil {
+				messages.Reactions = make(map[uuid.UUID]reaction.Counts)
+			}
+			messages.Reactions[id] = counts
+		}
+		for id, parent := range page.Parents {
+			if messages.Parents == nil {
+				messages.Parents = make(map[uuid.UUID]message.Message)
+			}
+			messages.Parents[id] = parent
+		}
+		for id, count := range page.ReplyCounts {
+			if messages.ReplyCounts == nil {
+				messages.ReplyCounts = make(map[uuid.UUID]int)
+			}
+			messages.ReplyCounts[id] = count
+		}
+
+		if !page.HasMore || len(page.Messages) == 0 {
+			return messages, nil
+		}
+		lastMessageID = page.Messages[len(page.Messages)-1].ID
+	}
+}
+
+// messageFilter skips messages that were already sent
+type messageFilter map[uuid.UUID]struct{}
+
+func newMessageFilter(sent *chat.Messages) messageFilter {
+	f := make(messageFilter, len(sent.Messages))
+	for _, msg := range sent.Messages {
+		f[msg.ID] = struct{}{}
+	}
+	return f
+}
+
+// filter returns only messages that were not sent or nil if all messages were sent, updates of sent messages
+// are always kept
+func (f messageFilter) filter(cm *chat.Messages) *chat.Messages {
+	messages := make([]message.Message, 0, len(cm.Messages))
+	for _, msg := range cm.Messages {
+		if _, ok := f[msg.ID]; !ok {
+			messages = append(messages, msg)
+		}
+	}
+
+	if len(messages) == 0 && len(cm.Updated) == 0 {
+		return nil
+	}
+	return &chat.Messages{
+		Messages:    messages,
+		Usernames:   cm.Usernames,
+		Updated:     cm.Updated,
+		Reactions:   cm.Reactions,
+		Parents:     cm.Parents,
+		ReplyCounts: cm.ReplyCounts,
+	}
+}
+
+func (s *Server) streamMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := roomIDFromVars(r)
+		if err != nil {
+			s.log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lastMessageID, err := lastMessageIDFromQuery(r)
+		if err != nil {
+			if err = respondJSONError(w, err, http.StatusBadRequest); err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Only subscription is limited by request timeout, stream itself lasts until connection is closed
+		ctx, cancel := s.requestContext(r, 0)
+		sub, messages, err := s.subscribe(ctx, roomID, readerIDFromContext(r.Context()), lastMessageID)
+		cancel()
+		if err != nil {
+			err := respondJSONError(w, err, errorStatus(err, http.StatusBadRequest))
+			if err != nil {
+				s.log.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		defer sub.Close()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrader already responded with error
+			s.log.Error("websocket upgrade: ", err)
+			return
+		}
+		defer func() {
+			if err := conn.Close(); err != nil {
+				s.log.Error("websocket close: ", err)
+			}
+		}()
+
+		if err = s.wsStream(conn, sub, messages); err != nil {
+			s.log.Debug("websocket stream: ", err)
+		}
+	}
+}
+
+// wsStream writes already sent messages and then new messages until connection is closed
+func (s *Server) wsStream(conn *websocket.Conn, sub *server.Subscription, messages *chat.Messages) error {
+	closed := make(chan struct{})
+	go wsReadUntilClosed(conn, closed)
+
+	if len(messages.Messages) > 0 {
+		if err := wsWriteJSON(conn, messages); err != nil {
+			return err
+		}
+	}
+	sent := newMessageFilter(messages)
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case cm, ok := <-sub.Messages():
+			if !ok {
+				// Reader who lost access to room must not reconnect, while slow one may try again
+				if err := sub.Err(); err != nil && !errors.Is(err, server.ErrorTooSlow) {
+					return wsWriteClose(conn, websocket.ClosePolicyViolation, err.Error())
+				}
+				return wsWriteClose(conn, websocket.CloseTryAgainLater, "too slow")
+			}
+
+			if cm = sent.filter(cm); cm == nil {
+				continue
+			}
+			if err := wsWriteJSON(conn, cm); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			if err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+		case <-closed:
+			return nil
+		}
+	}
+}
+
+// wsReadUntilClosed discards all incoming messages and handles pongs, closes channel when connection is closed
+func wsReadUntilClosed(conn *websocket.Conn, closed chan<- struct{}) {
+	defer close(closed)
+
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+func wsWriteJSON(conn *websocket.Conn, v interface{}) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return fmt.Errorf("write deadline: %w", err)
+	}
+	if err := conn.WriteJSON(v); err != nil {
+		return fmt.Errorf("write json: %w", err)
+	}
+	return nil
+}
+
+func wsWriteClose(conn *websocket.Conn, code int, text string) error {
+	err := conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteTimeout))
+	if err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
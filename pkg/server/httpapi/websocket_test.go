@@ -0,0 +1,233 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/server"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_streamMessages(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	log, _ := test.NewNullLogger()
+	service := server.NewService(repo, server.DefaultMessageRules(), log)
+	srv := NewServer(service, testAdminToken, 0, log)
+
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	roomID := uuid.New()
+	require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: roomID}))
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	require.NoError(t, repo.CreateUser(context.Background(), &usr, uuid.New().String()))
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{usr.ID}))
+
+	sent := &message.Message{
+		ID:     uuid.New(),
+		UserID: usr.ID,
+		RoomID: roomID,
+		Text:   "sent before",
+		Time:   time.Unix(1621521072, 0).UTC(),
+	}
+	require.NoError(t, repo.SaveMessage(context.Background(), sent))
+
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + fmt.Sprintf("/api/rooms/%s/ws", roomID)
+
+	t.Run("ok", func(t *testing.T) {
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		defer func() { _ = conn.Close() }()
+
+		var actual chat.Messages
+		require.NoError(t, conn.ReadJSON(&actual))
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, sent.ID, actual.Messages[0].ID)
+		assert.Equal(t, usr.Username, actual.Usernames[usr.ID])
+
+		require.NoError(t, service.SendMessage(context.Background(), roomID, usr.ID, chat.NewMessage{Text: "new"}))
+
+		require.NoError(t, conn.ReadJSON(&actual))
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, "new", actual.Messages[0].Text)
+		assert.Equal(t, usr.Username, actual.Usernames[usr.ID])
+	})
+
+	t.Run("after last message", func(t *testing.T) {
+		conn, resp, err := websocket.DefaultDialer.Dial(
+			fmt.Sprintf("%s?%s=%s", wsURL, LastMessageIDParameter, sent.ID), nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		defer func() { _ = conn.Close() }()
+
+		var actual chat.Messages
+		require.NoError(t, conn.ReadJSON(&actual))
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, "new", actual.Messages[0].Text)
+	})
+
+	t.Run("drains backlog", func(t *testing.T) {
+		backlogRoomID := uuid.New()
+		require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: backlogRoomID}))
+
+		backlog := make([]message.Message, 2*server.MessageLimit+3)
+		for i := range backlog {
+			backlog[i] = message.Message{
+				ID:     uuid.New(),
+				UserID: usr.ID,
+				RoomID: backlogRoomID,
+				Text:   fmt.Sprintf("backlog %d", i),
+				Time:   time.Unix(1621521072+int64(i), 0).UTC(),
+			}
+			require.NoError(t, repo.SaveMessage(context.Background(), &backlog[i]))
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(httpServer.URL, "http")+
+				fmt.Sprintf("/api/rooms/%s/ws?%s=%s", backlogRoomID, LastMessageIDParameter, backlog[0].ID), nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		defer func() { _ = conn.Close() }()
+
+		var actual chat.Messages
+		require.NoError(t, conn.ReadJSON(&actual))
+		require.Len(t, actual.Messages, len(backlog)-1)
+		for i, msg := range actual.Messages {
+			assert.Equal(t, backlog[i+1].ID, msg.ID)
+		}
+	})
+
+	t.Run("drains details", func(t *testing.T) {
+		detailsRoomID := uuid.New()
+		require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: detailsRoomID}))
+
+		// Parent is received before reconnect, the reply and reactions are on different pages
+		missed := make([]message.Message, server.MessageLimit+2)
+		for i := range missed {
+			missed[i] = message.Message{
+				ID:     uuid.New(),
+				UserID: usr.ID,
+				RoomID: detailsRoomID,
+				Text:   fmt.Sprintf("missed %d", i),
+				Time:   time.Unix(1621521072+int64(i), 0).UTC(),
+			}
+		}
+		parent, reply, last := missed[0], missed[1], missed[len(missed)-1]
+		missed[1].ReplyTo = &parent.ID
+		for i := range missed {
+			require.NoError(t, repo.SaveMessage(context.Background(), &missed[i]))
+		}
+		for _, msg := range []message.Message{reply, last} {
+			require.NoError(t, repo.AddReaction(context.Background(), &reaction.Reaction{
+				RoomID: detailsRoomID, MessageID: msg.ID, UserID: usr.ID, Emoji: "👍",
+			}))
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(httpServer.URL, "http")+
+				fmt.Sprintf("/api/rooms/%s/ws?%s=%s", detailsRoomID, LastMessageIDParameter, parent.ID), nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		defer func() { _ = conn.Close() }()
+
+		var actual chat.Messages
+		require.NoError(t, conn.ReadJSON(&actual))
+		require.Len(t, actual.Messages, len(missed)-1)
+		assert.Equal(t, map[uuid.UUID]reaction.Counts{reply.ID: {"👍": 1}, last.ID: {"👍": 1}}, actual.Reactions)
+		require.Contains(t, actual.Parents, parent.ID)
+		assert.Equal(t, parent.Text, actual.Parents[parent.ID].Text)
+		assert.Equal(t, map[uuid.UUID]int{parent.ID: 1}, actual.ReplyCounts)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(
+			"ws"+strings.TrimPrefix(httpServer.URL, "http")+fmt.Sprintf("/api/rooms/%s/ws", uuid.New()), nil)
+		require.Error(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("bad last message id", func(t *testing.T) {
+		_, resp, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s?%s=%s", wsURL, LastMessageIDParameter, "bad"), nil)
+		require.Error(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestServer_streamMessages_accessLost(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	log, _ := test.NewNullLogger()
+	service := server.NewService(repo, server.DefaultMessageRules(), log)
+	srv := NewServer(service, testAdminToken, 0, log)
+
+	httpServer := httptest.NewServer(srv)
+	defer httpServer.Close()
+
+	roomID := uuid.New()
+	require.NoError(t, repo.CreateRoom(context.Background(), &room.Room{ID: roomID, Private: true}))
+	credentials, err := service.CreateUser(context.Background(), chat.NewUser{Username: "test"})
+	require.NoError(t, err)
+	require.NoError(t, repo.AddRoomMembers(context.Background(), roomID, []uuid.UUID{credentials.UserID}))
+
+	header := http.Header{AuthorizationHeader: []string{"Bearer " + credentials.Token}}
+	conn, resp, err := websocket.DefaultDialer.Dial(
+		"ws"+strings.TrimPrefix(httpServer.URL, "http")+fmt.Sprintf("/api/rooms/%s/ws", roomID), header)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	defer func() { _ = conn.Close() }()
+
+	require.NoError(t, service.BanUser(context.Background(), roomID, server.Editor{Admin: true}, "test"))
+
+	// Banned reader is told not to reconnect instead of being treated as slow
+	var actual chat.Messages
+	err = conn.ReadJSON(&actual)
+	require.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+	assert.Contains(t, err.Error(), server.ErrorBanned.Error())
+}
+
+func Test_messageFilter(t *testing.T) {
+	sent := &chat.Messages{
+		Messages: []message.Message{{ID: uuid.New()}, {ID: uuid.New()}},
+	}
+	f := newMessageFilter(sent)
+
+	assert.Nil(t, f.filter(&chat.Messages{Messages: sent.Messages[1:]}))
+
+	newMessage := message.Message{ID: uuid.New(), ReplyTo: &sent.Messages[0].ID}
+	usernames := map[uuid.UUID]string{uuid.New(): "test"}
+	parents := map[uuid.UUID]message.Message{sent.Messages[0].ID: sent.Messages[0]}
+	replyCounts := map[uuid.UUID]int{sent.Messages[0].ID: 1}
+	actual := f.filter(&chat.Messages{
+		Messages:    []message.Message{sent.Messages[0], newMessage},
+		Usernames:   usernames,
+		Parents:     parents,
+		ReplyCounts: replyCounts,
+	})
+	assert.Equal(t, &chat.Messages{
+		Messages:    []message.Message{newMessage},
+		Usernames:   usernames,
+		Parents:     parents,
+		ReplyCounts: replyCounts,
+	}, actual)
+
+	updated := []message.Message{{ID: sent.Messages[0].ID, Deleted: true}}
+	actual = f.filter(&chat.Messages{Messages: []message.Message{}, Updated: updated})
+	assert.Equal(t, &chat.Messages{Messages: []message.Message{}, Updated: updated}, actual)
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// subscriptionBuffer limits amount of not yet received messages, slower subscribers are dropped
+const subscriptionBuffer = 64
+
+// ErrorTooSlow is a reason of dropping subscriber which doesn't receive messages as fast as they are published
+var ErrorTooSlow = errors.New("too slow to receive messages")
+
+// Hub delivers new messages to subscribers of rooms
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[*Subscription]struct{}
+}
+
+// NewHub creates new Hub without subscribers
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[uuid.UUID]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives new messages of one room until closed
+type Subscription struct {
+	hub      *Hub
+	roomID   uuid.UUID
+	userID   *uuid.UUID
+	messages chan *chat.Messages
+	err      error
+}
+
+// Messages returns channel of new messages, channel is closed when subscription is closed or dropped
+func (s *Subscription) Messages() <-chan *chat.Messages {
+	return s.messages
+}
+
+// Err returns reason why subscription was dropped, nil if it was closed by subscriber,
+// must be called only after channel of messages is closed
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+// Close stops receiving new messages
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// Subscribe starts receiving new messages from specified room by user, userID is nil for anonymous subscriber
+func (h *Hub) Subscribe(roomID uuid.UUID, userID *uuid.UUID) *Subscription {
+	sub := &Subscription{
+		hub:      h,
+		roomID:   roomID,
+		userID:   userID,
+		messages: make(chan *chat.Messages, subscriptionBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	roomSubscribers, ok := h.subscribers[roomID]
+	if !ok {
+		roomSubscribers = make(map[*Subscription]struct{})
+		h.subscribers[roomID] = roomSubscribers
+	}
+	roomSubscribers[sub] = struct{}{}
+
+	return sub
+}
+
+// Publish sends messages to all subscribers of room, subscribers that can't keep up are dropped
+func (h *Hub) Publish(roomID uuid.UUID, messages *chat.Messages) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[roomID] {
+		select {
+		case sub.messages <- messages:
+		default:
+			h.remove(sub, ErrorTooSlow)
+		}
+	}
+}
+
+// DropUser drops all subscriptions of user to room with reason why user is no longer allowed to read room
+func (h *Hub) DropUser(roomID, userID uuid.UUID, reason error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers[roomID] {
+		if sub.userID != nil && *sub.userID == userID {
+			h.remove(sub, reason)
+		}
+	}
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(sub, nil)
+}
+
+// remove deletes subscriber and closes its channel after setting reason of removal, must be called with locked mutex
+func (h *Hub) remove(sub *Subscription, reason error) {
+	roomSubscribers := h.subscribers[sub.roomID]
+	if _, ok := roomSubscribers[sub]; !ok {
+		return
+	}
+
+	delete(roomSubscribers, sub)
+	if len(roomSubscribers) == 0 {
+		delete(h.subscribers, sub.roomID)
+	}
+	sub.err = reason
+	close(sub.messages)
+}
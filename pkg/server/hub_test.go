@@ -0,0 +1,117 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// hasSubscribers checks if room has any subscribers
+func hasSubscribers(h *Hub, roomID uuid.UUID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers[roomID]) > 0
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub()
+	roomID := uuid.New()
+	otherRoomID := uuid.New()
+
+	sub := hub.Subscribe(roomID, nil)
+	otherSub := hub.Subscribe(otherRoomID, nil)
+	assert.True(t, hasSubscribers(hub, roomID))
+	assert.False(t, hasSubscribers(hub, uuid.New()))
+
+	cm := &chat.Messages{Messages: []message.Message{{ID: uuid.New(), RoomID: roomID}}}
+	hub.Publish(roomID, cm)
+
+	select {
+	case actual := <-sub.Messages():
+		assert.Equal(t, cm, actual)
+	default:
+		t.Fatal("message not received")
+	}
+
+	select {
+	case <-otherSub.Messages():
+		t.Fatal("message received by other room")
+	default:
+	}
+}
+
+func TestSubscription_Close(t *testing.T) {
+	hub := NewHub()
+	roomID := uuid.New()
+
+	sub := hub.Subscribe(roomID, nil)
+	sub.Close()
+	sub.Close()
+
+	_, ok := <-sub.Messages()
+	assert.False(t, ok)
+	assert.NoError(t, sub.Err())
+	assert.False(t, hasSubscribers(hub, roomID))
+
+	hub.Publish(roomID, &chat.Messages{})
+}
+
+func TestHub_DropUser(t *testing.T) {
+	hub := NewHub()
+	roomID := uuid.New()
+	userID := uuid.New()
+	otherUserID := uuid.New()
+
+	first := hub.Subscribe(roomID, &userID)
+	second := hub.Subscribe(roomID, &userID)
+	other := hub.Subscribe(roomID, &otherUserID)
+	anonymous := hub.Subscribe(roomID, nil)
+	otherRoom := hub.Subscribe(uuid.New(), &userID)
+
+	hub.DropUser(roomID, userID, ErrorBanned)
+
+	for _, sub := range []*Subscription{first, second} {
+		_, ok := <-sub.Messages()
+		assert.False(t, ok)
+		assert.ErrorIs(t, sub.Err(), ErrorBanned)
+	}
+
+	hub.Publish(roomID, &chat.Messages{})
+	for _, sub := range []*Subscription{other, anonymous} {
+		_, ok := <-sub.Messages()
+		assert.True(t, ok)
+	}
+
+	otherRoom.Close()
+	other.Close()
+	anonymous.Close()
+	assert.False(t, hasSubscribers(hub, roomID))
+}
+
+func TestHub_Publish_slowSubscriber(t *testing.T) {
+	hub := NewHub()
+	roomID := uuid.New()
+
+	slow := hub.Subscribe(roomID, nil)
+	fast := hub.Subscribe(roomID, nil)
+
+	for i := 0; i < subscriptionBuffer+1; i++ {
+		hub.Publish(roomID, &chat.Messages{})
+		<-fast.Messages()
+	}
+
+	received := 0
+	for range slow.Messages() {
+		received++
+	}
+	assert.Equal(t, subscriptionBuffer, received)
+	assert.ErrorIs(t, slow.Err(), ErrorTooSlow)
+	assert.True(t, hasSubscribers(hub, roomID))
+
+	fast.Close()
+	assert.False(t, hasSubscribers(hub, roomID))
+}
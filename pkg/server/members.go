@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// getRoom returns room by its id or ErrorRoomNotFound
+func (s *Service) getRoom(ctx context.Context, roomID uuid.UUID) (*room.Room, error) {
+	r, err := s.roomRepo.GetRoom(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return nil, fmt.Errorf("get room: %w", ErrorRoomNotFound)
+		}
+		return nil, fmt.Errorf("get room: %w", err)
+	}
+	return r, nil
+}
+
+// checkMember returns ErrorNotRoomMember if user is not a member of room
+func (s *Service) checkMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	member, err := s.roomRepo.IsRoomMember(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("check member: %w", err)
+	}
+	if !member {
+		return fmt.Errorf("check member: %w", ErrorNotRoomMember)
+	}
+	return nil
+}
+
+// getMember returns member of room or ErrorNotRoomMember
+func (s *Service) getMember(ctx context.Context, roomID, userID uuid.UUID) (*room.Member, error) {
+	member, err := s.moderationRepo.GetRoomMember(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return nil, fmt.Errorf("get member: %w", ErrorNotRoomMember)
+		}
+		return nil, fmt.Errorf("get member: %w", err)
+	}
+	return member, nil
+}
+
+// checkBan returns ErrorBanned if user is banned in room
+func (s *Service) checkBan(ctx context.Context, roomID, userID uuid.UUID) error {
+	banned, err := s.moderationRepo.IsBanned(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("check ban: %w", err)
+	}
+	if banned {
+		return fmt.Errorf("check ban: %w", ErrorBanned)
+	}
+	return nil
+}
+
+// checkRead returns error if room not exist or user can't read it, public rooms can be read by anyone
+// including anonymous user (nil userID) except banned users, private and direct rooms only by their members
+func (s *Service) checkRead(ctx context.Context, roomID uuid.UUID, userID *uuid.UUID) error {
+	r, err := s.getRoom(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("check read: %w", err)
+	}
+	if !r.Private && !r.Direct {
+		if userID == nil {
+			return nil
+		}
+		if err = s.checkBan(ctx, roomID, *userID); err != nil {
+			return fmt.Errorf("check read: %w", err)
+		}
+		return nil
+	}
+
+	if userID == nil {
+		return fmt.Errorf("check read: %w", ErrorUnauthorized)
+	}
+	if err = s.checkMember(ctx, roomID, *userID); err != nil {
+		return fmt.Errorf("check read: %w", err)
+	}
+	return nil
+}
+
+// checkWrite returns error if room not exist, user is not its member or is muted, only members can write
+// to any room
+func (s *Service) checkWrite(ctx context.Context, roomID, userID uuid.UUID) error {
+	if _, err := s.getRoom(ctx, roomID); err != nil {
+		return fmt.Errorf("check write: %w", err)
+	}
+
+	member, err := s.getMember(ctx, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("check write: %w", err)
+	}
+	if member.Muted(time.Now()) {
+		return fmt.Errorf("check write: %w", ErrorMuted)
+	}
+	return nil
+}
+
+// JoinRoom adds user to members of public room, users join private and direct rooms only by invite,
+// so joining them succeeds only for their members, banned users can't join
+func (s *Service) JoinRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	r, err := s.getRoom(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("join room: %w", err)
+	}
+
+	if r.Private || r.Direct {
+		member, err := s.roomRepo.IsRoomMember(ctx, roomID, userID)
+		if err != nil {
+			return fmt.Errorf("join room: %w", err)
+		}
+		if !member {
+			return fmt.Errorf("join room: %w", ErrorPrivateRoom)
+		}
+		return nil
+	}
+
+	if err = s.checkBan(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("join room: %w", err)
+	}
+	if err = s.roomRepo.AddRoomMembers(ctx, roomID, []uuid.UUID{userID}); err != nil {
+		return fmt.Errorf("join room: %w", err)
+	}
+	return nil
+}
+
+// LeaveRoom removes user from members of room, leaving room user is not a member of has no effect,
+// users can't leave direct rooms, subscriptions of user to private room are dropped
+func (s *Service) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	r, err := s.getRoom(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("leave room: %w", err)
+	}
+	if r.Direct {
+		return fmt.Errorf("leave room: %w", ErrorDirectRoom)
+	}
+
+	if err = s.roomRepo.RemoveRoomMember(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("leave room: %w", err)
+	}
+
+	s.dropIfPrivate(r, userID)
+	return nil
+}
+
+// dropIfPrivate drops subscriptions of user who is no longer a member of private room,
+// public rooms can be read without membership, so subscriptions to them are kept
+func (s *Service) dropIfPrivate(r *room.Room, userID uuid.UUID) {
+	if r.Private {
+		s.hub.DropUser(r.ID, userID, ErrorNotRoomMember)
+	}
+}
+
+// InviteToRoom adds invited user to members of room, users can be invited by members of room or by admin,
+// no one can be invited to direct rooms and banned users can't be invited
+func (s *Service) InviteToRoom(ctx context.Context, roomID uuid.UUID, inviter Editor, invite chat.Invite) error {
+	r, err := s.getRoom(ctx, roomID)
+	if err != nil {
+		return fmt.Errorf("invite to room: %w", err)
+	}
+	if r.Direct {
+		return fmt.Errorf("invite to room: %w", ErrorDirectRoom)
+	}
+
+	if !inviter.Admin {
+		if err = s.checkMember(ctx, roomID, inviter.UserID); err != nil {
+			return fmt.Errorf("invite to room: %w", err)
+		}
+	}
+
+	invited, err := s.userRepo.GetUserByUsername(ctx, invite.Username)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return fmt.Errorf("invite to room: %w", ErrorUserNotFound)
+		}
+		return fmt.Errorf("invite to room: %w", err)
+	}
+
+	if err = s.checkBan(ctx, roomID, invited.ID); err != nil {
+		return fmt.Errorf("invite to room: %w", err)
+	}
+	if err = s.roomRepo.AddRoomMembers(ctx, roomID, []uuid.UUID{invited.ID}); err != nil {
+		return fmt.Errorf("invite to room: %w", err)
+	}
+	return nil
+}
+
+// GetRoomMembers returns members of room with their roles ordered by username, readerID is nil for anonymous
+// reader, members are visible to everyone who can read room
+func (s *Service) GetRoomMembers(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID) ([]chat.Member, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		return nil, fmt.Errorf("get room members: %w", err)
+	}
+
+	roomMembers, err := s.roomRepo.GetRoomMembers(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("get room members: %w", err)
+	}
+	if len(roomMembers) == 0 {
+		return []chat.Member{}, nil
+	}
+
+	memberIDs := make([]uuid.UUID, 0, len(roomMembers))
+	for _, member := range roomMembers {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	usernames, err := s.getUsernamesFromUserIDs(ctx, memberIDs)
+	if err != nil {
+		return nil, fmt.Errorf("get room members: %w", err)
+	}
+
+	now := time.Now()
+	members := make([]chat.Member, 0, len(roomMembers))
+	for _, member := range roomMembers {
+		username, ok := usernames[member.UserID]
+		if !ok {
+			continue
+		}
+
+		cm := chat.Member{ID: member.UserID, Username: username, Role: member.Role}
+		// Mutes that already ended are not shown
+		if member.Muted(now) {
+			cm.MutedUntil = member.MutedUntil
+		}
+		members = append(members, cm)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Username < members[j].Username
+	})
+	return members, nil
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_checkRead(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	t.Run("public anonymous", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+
+		assert.NoError(t, service.checkRead(context.Background(), roomID, nil))
+	})
+
+	t.Run("public user", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		assert.NoError(t, service.checkRead(context.Background(), roomID, &userID))
+	})
+
+	t.Run("public banned", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+
+		assert.ErrorIs(t, service.checkRead(context.Background(), roomID, &userID), ErrorBanned)
+	})
+
+	t.Run("private member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+
+		assert.NoError(t, service.checkRead(context.Background(), roomID, &userID))
+	})
+
+	t.Run("private anonymous", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+
+		assert.ErrorIs(t, service.checkRead(context.Background(), roomID, nil), ErrorUnauthorized)
+	})
+
+	t.Run("direct not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		assert.ErrorIs(t, service.checkRead(context.Background(), roomID, &userID), ErrorNotRoomMember)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		assert.ErrorIs(t, service.checkRead(context.Background(), roomID, &userID), ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, errAny)
+
+		assert.ErrorIs(t, service.checkRead(context.Background(), roomID, &userID), errAny)
+	})
+}
+
+func TestService_checkWrite(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	t.Run("member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+
+		assert.NoError(t, service.checkWrite(context.Background(), roomID, userID))
+	})
+
+	t.Run("public not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), nil, repository.ErrorNotFound)
+
+		assert.ErrorIs(t, service.checkWrite(context.Background(), roomID, userID), ErrorNotRoomMember)
+	})
+
+	t.Run("muted", func(t *testing.T) {
+		mutedUntil := time.Now().Add(time.Hour)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID),
+			&room.Member{UserID: userID, Role: room.RoleModerator, MutedUntil: &mutedUntil}, nil)
+
+		assert.ErrorIs(t, service.checkWrite(context.Background(), roomID, userID), ErrorMuted)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), nil, errAny)
+
+		assert.ErrorIs(t, service.checkWrite(context.Background(), roomID, userID), errAny)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		assert.ErrorIs(t, service.checkWrite(context.Background(), roomID, userID), ErrorRoomNotFound)
+	})
+}
+
+func TestService_JoinRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	t.Run("public", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{userID}), nil)
+
+		assert.NoError(t, service.JoinRoom(context.Background(), roomID, userID))
+	})
+
+	t.Run("banned", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+
+		assert.ErrorIs(t, service.JoinRoom(context.Background(), roomID, userID), ErrorBanned)
+	})
+
+	t.Run("private member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+
+		assert.NoError(t, service.JoinRoom(context.Background(), roomID, userID))
+	})
+
+	t.Run("private not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+
+		assert.ErrorIs(t, service.JoinRoom(context.Background(), roomID, userID), ErrorPrivateRoom)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		assert.ErrorIs(t, service.JoinRoom(context.Background(), roomID, userID), ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(userID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Any(), errAny)
+
+		assert.ErrorIs(t, service.JoinRoom(context.Background(), roomID, userID), errAny)
+	})
+}
+
+func TestService_LeaveRoom(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+		sub, err := service.Subscribe(context.Background(), roomID, &userID)
+		require.NoError(t, err)
+		defer sub.Close()
+
+		otherUserID := uuid.New()
+		otherSub := service.hub.Subscribe(roomID, &otherUserID)
+		defer otherSub.Close()
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), nil)
+
+		assert.NoError(t, service.LeaveRoom(context.Background(), roomID, userID))
+
+		// Stream of private room stops after leaving it
+		_, ok := <-sub.Messages()
+		assert.False(t, ok)
+
+		service.hub.Publish(roomID, &chat.Messages{})
+		_, ok = <-otherSub.Messages()
+		assert.True(t, ok)
+	})
+
+	t.Run("public room", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, &userID)
+		defer sub.Close()
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), nil)
+
+		assert.NoError(t, service.LeaveRoom(context.Background(), roomID, userID))
+
+		// Public room can be read without membership
+		service.hub.Publish(roomID, &chat.Messages{})
+		_, ok := <-sub.Messages()
+		assert.True(t, ok)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+
+		assert.ErrorIs(t, service.LeaveRoom(context.Background(), roomID, userID), ErrorDirectRoom)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		assert.ErrorIs(t, service.LeaveRoom(context.Background(), roomID, userID), ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), errAny)
+
+		assert.ErrorIs(t, service.LeaveRoom(context.Background(), roomID, userID), errAny)
+	})
+}
+
+func TestService_InviteToRoom(t *testing.T) {
+	setup(t)
+
+	inviter := Editor{UserID: uuid.New()}
+	invited := user.User{ID: uuid.New(), Username: "invited"}
+	invite := chat.Invite{Username: invited.Username}
+
+	t.Run("member", func(t *testing.T) {
+		found := invited
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(inviter.UserID), true, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), &found, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(invited.ID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{invited.ID}), nil)
+
+		assert.NoError(t, service.InviteToRoom(context.Background(), roomID, inviter, invite))
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		found := invited
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), &found, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(invited.ID), false, nil)
+		mocks.MockAddRoomMembers(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{invited.ID}), nil)
+
+		assert.NoError(t, service.InviteToRoom(context.Background(), roomID, Editor{Admin: true}, invite))
+	})
+
+	t.Run("banned", func(t *testing.T) {
+		found := invited
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), &found, nil)
+		mocks.MockIsBanned(m, gomock.Eq(roomID), gomock.Eq(invited.ID), true, nil)
+
+		err := service.InviteToRoom(context.Background(), roomID, Editor{Admin: true}, invite)
+		assert.ErrorIs(t, err, ErrorBanned)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(inviter.UserID), false, nil)
+
+		err := service.InviteToRoom(context.Background(), roomID, inviter, invite)
+		assert.ErrorIs(t, err, ErrorNotRoomMember)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(inviter.UserID), true, nil)
+		mocks.MockGetUserByUsername(m, gomock.Eq(invited.Username), nil, repository.ErrorNotFound)
+
+		err := service.InviteToRoom(context.Background(), roomID, inviter, invite)
+		assert.ErrorIs(t, err, ErrorUserNotFound)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+
+		err := service.InviteToRoom(context.Background(), roomID, Editor{Admin: true}, invite)
+		assert.ErrorIs(t, err, ErrorDirectRoom)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		err := service.InviteToRoom(context.Background(), roomID, inviter, invite)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+}
+
+func TestService_GetRoomMembers(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	users := []user.User{
+		{ID: uuid.New(), Username: "c"},
+		{ID: uuid.New(), Username: "a"},
+		{ID: uuid.New(), Username: "b"},
+	}
+	ids := []uuid.UUID{users[0].ID, users[1].ID, users[2].ID}
+	muteEnded := time.Now().Add(-time.Minute)
+	mutedUntil := time.Now().Add(time.Hour)
+	members := []room.Member{
+		{UserID: users[0].ID, Role: room.RoleOwner},
+		{UserID: users[1].ID, Role: room.RoleMember, MutedUntil: &muteEnded},
+		{UserID: users[2].ID, Role: room.RoleMember, MutedUntil: &mutedUntil},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMembers(m, gomock.Eq(roomID), members, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq(ids), users, nil)
+
+		actual, err := service.GetRoomMembers(context.Background(), roomID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []chat.Member{
+			{ID: users[1].ID, Username: "a", Role: room.RoleMember},
+			{ID: users[2].ID, Username: "b", Role: room.RoleMember, MutedUntil: &mutedUntil},
+			{ID: users[0].ID, Username: "c", Role: room.RoleOwner},
+		}, actual)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+		mocks.MockIsRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), true, nil)
+		mocks.MockGetRoomMembers(m, gomock.Eq(roomID), nil, nil)
+
+		actual, err := service.GetRoomMembers(context.Background(), roomID, &userID)
+		require.NoError(t, err)
+		assert.Equal(t, []chat.Member{}, actual)
+	})
+
+	t.Run("private anonymous", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Private: true}, nil)
+
+		_, err := service.GetRoomMembers(context.Background(), roomID, nil)
+		assert.ErrorIs(t, err, ErrorUnauthorized)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMembers(m, gomock.Eq(roomID), nil, errAny)
+
+		_, err := service.GetRoomMembers(context.Background(), roomID, nil)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+)
+
+// ModerationLogLimit limits amount of moderation actions to be received
+const ModerationLogLimit uint = 50
+
+// roleRanks orders roles of members, users can moderate only members with lower rank than their own
+var roleRanks = map[room.Role]int{
+	room.RoleMember:    1,
+	room.RoleModerator: 2,
+	room.RoleOwner:     3,
+}
+
+// adminRank is higher than rank of any role, so admin can moderate anyone in any room
+const adminRank = 4
+
+// moderatorRank returns rank of moderator in room or ErrorNotModerator if moderator is not allowed
+// to moderate room at all
+func (s *Service) moderatorRank(ctx context.Context, roomID uuid.UUID, moderator Editor) (int, error) {
+	if moderator.Admin {
+		return adminRank, nil
+	}
+
+	member, err := s.moderationRepo.GetRoomMember(ctx, roomID, moderator.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return 0, fmt.Errorf("moderator rank: %w", ErrorNotModerator)
+		}
+		return 0, fmt.Errorf("moderator rank: %w", err)
+	}
+
+	rank := roleRanks[member.Role]
+	if rank < roleRanks[room.RoleModerator] {
+		return 0, fmt.Errorf("moderator rank: %w", ErrorNotModerator)
+	}
+	return rank, nil
+}
+
+// moderationTarget is a user moderated in room
+type moderationTarget struct {
+	room   *room.Room
+	user   *user.User
+	member *room.Member // Member is nil if user is not a member of room
+	rank   int          // Rank of moderator
+}
+
+// getTarget returns user with specified username which moderator is allowed to moderate in room,
+// members can be moderated only by moderators with higher rank, direct rooms can't be moderated
+func (s *Service) getTarget(ctx context.Context, roomID uuid.UUID, moderator Editor,
+	username string) (*moderationTarget, error) {
+	r, err := s.getRoom(ctx, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("get target: %w", err)
+	}
+	if r.Direct {
+		return nil, fmt.Errorf("get target: %w", ErrorDirectRoom)
+	}
+
+	rank, err := s.moderatorRank(ctx, roomID, moderator)
+	if err != nil {
+		return nil, fmt.Errorf("get target: %w", err)
+	}
+
+	usr, err := s.userRepo.GetUserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return nil, fmt.Errorf("get target: %w", ErrorUserNotFound)
+		}
+		return nil, fmt.Errorf("get target: %w", err)
+	}
+
+	target := &moderationTarget{room: r, user: usr, rank: rank}
+	target.member, err = s.moderationRepo.GetRoomMember(ctx, roomID, usr.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return target, nil
+		}
+		return nil, fmt.Errorf("get target: %w", err)
+	}
+
+	if roleRanks[target.member.Role] >= rank {
+		return nil, fmt.Errorf("get target: %w", ErrorNotModerator)
+	}
+	return target, nil
+}
+
+// getTargetMember returns member of room with specified username which moderator is allowed to moderate
+func (s *Service) getTargetMember(ctx context.Context, roomID uuid.UUID, moderator Editor,
+	username string) (*moderationTarget, error) {
+	target, err := s.getTarget(ctx, roomID, moderator, username)
+	if err != nil {
+		return nil, err
+	}
+	if target.member == nil {
+		return nil, fmt.Errorf("get target: %w", ErrorNotRoomMember)
+	}
+	return target, nil
+}
+
+// updateMember saves changed member of room, ErrorNotRoomMember is returned if user left room meanwhile
+func (s *Service) updateMember(ctx context.Context, roomID uuid.UUID, member *room.Member) error {
+	if err := s.moderationRepo.UpdateRoomMember(ctx, roomID, member); err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return fmt.Errorf("update member: %w", ErrorNotRoomMember)
+		}
+		return fmt.Errorf("update member: %w", err)
+	}
+	return nil
+}
+
+// saveAction completes action done by moderator and saves it to moderation log of room
+func (s *Service) saveAction(ctx context.Context, moderator Editor, action *moderation.Action) error {
+	action.ID = uuid.New()
+	if !moderator.Admin {
+		moderatorID := moderator.UserID
+		action.ModeratorID = &moderatorID
+	}
+	action.Time = now()
+
+	if err := s.moderationRepo.SaveModerationAction(ctx, action); err != nil {
+		return fmt.Errorf("save action: %w", err)
+	}
+	return nil
+}
+
+// addOwner adds user to members of new room with room.RoleOwner, it's logged as done by admin
+func (s *Service) addOwner(ctx context.Context, roomID, userID uuid.UUID) error {
+	if err := s.roomRepo.AddRoomMembers(ctx, roomID, []uuid.UUID{userID}); err != nil {
+		return fmt.Errorf("add owner: %w", err)
+	}
+	if err := s.updateMember(ctx, roomID, &room.Member{UserID: userID, Role: room.RoleOwner}); err != nil {
+		return fmt.Errorf("add owner: %w", err)
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: userID, Kind: moderation.KindRole, Role: room.RoleOwner}
+	if err := s.saveAction(ctx, Editor{Admin: true}, action); err != nil {
+		return fmt.Errorf("add owner: %w", err)
+	}
+	return nil
+}
+
+// SetRole changes role of member with specified username, only owners of room and admin can change roles,
+// owners can't change roles of other owners
+func (s *Service) SetRole(ctx context.Context, roomID uuid.UUID, moderator Editor, username string,
+	change chat.RoleChange) error {
+	rank, ok := roleRanks[change.Role]
+	if !ok {
+		return fmt.Errorf("set role: %w", ErrorInvalidRole)
+	}
+
+	target, err := s.getTargetMember(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	if target.rank < roleRanks[room.RoleOwner] || rank > target.rank {
+		return fmt.Errorf("set role: %w", ErrorNotModerator)
+	}
+
+	target.member.Role = change.Role
+	if err = s.updateMember(ctx, roomID, target.member); err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindRole, Role: change.Role}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("set role: %w", err)
+	}
+	return nil
+}
+
+// MuteUser forbids member with specified username to write to room for duration of mute,
+// muting already muted member replaces previous mute, mute is kept if user leaves & joins room again
+func (s *Service) MuteUser(ctx context.Context, roomID uuid.UUID, moderator Editor, username string,
+	mute chat.Mute) error {
+	duration, err := time.ParseDuration(mute.Duration)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("mute user: %w", ErrorInvalidDuration)
+	}
+
+	target, err := s.getTargetMember(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("mute user: %w", err)
+	}
+
+	until := now().Add(duration).Truncate(time.Millisecond)
+	if err = s.moderationRepo.MuteUser(ctx, roomID, target.user.ID, until); err != nil {
+		return fmt.Errorf("mute user: %w", err)
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindMute, Until: &until}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("mute user: %w", err)
+	}
+	return nil
+}
+
+// UnmuteUser allows muted member with specified username to write to room again
+func (s *Service) UnmuteUser(ctx context.Context, roomID uuid.UUID, moderator Editor, username string) error {
+	target, err := s.getTargetMember(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+
+	if err = s.moderationRepo.UnmuteUser(ctx, roomID, target.user.ID); err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindUnmute}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("unmute user: %w", err)
+	}
+	return nil
+}
+
+// KickUser removes member with specified username from members of room, kicked user can join public room again,
+// subscriptions of kicked user to private room are dropped
+func (s *Service) KickUser(ctx context.Context, roomID uuid.UUID, moderator Editor, username string) error {
+	target, err := s.getTargetMember(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("kick user: %w", err)
+	}
+
+	if err = s.roomRepo.RemoveRoomMember(ctx, roomID, target.user.ID); err != nil {
+		return fmt.Errorf("kick user: %w", err)
+	}
+	s.dropIfPrivate(target.room, target.user.ID)
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindKick}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("kick user: %w", err)
+	}
+	return nil
+}
+
+// BanUser removes user with specified username from members of room and forbids to read, join
+// or be invited to it, users can be banned even if they are not members, subscriptions of banned user are dropped
+func (s *Service) BanUser(ctx context.Context, roomID uuid.UUID, moderator Editor, username string) error {
+	target, err := s.getTarget(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+
+	if err = s.moderationRepo.BanUser(ctx, roomID, target.user.ID); err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+	s.hub.DropUser(roomID, target.user.ID, ErrorBanned)
+	if target.member != nil {
+		if err = s.roomRepo.RemoveRoomMember(ctx, roomID, target.user.ID); err != nil {
+			return fmt.Errorf("ban user: %w", err)
+		}
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindBan}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("ban user: %w", err)
+	}
+	return nil
+}
+
+// UnbanUser allows banned user with specified username to read and join room again
+func (s *Service) UnbanUser(ctx context.Context, roomID uuid.UUID, moderator Editor, username string) error {
+	target, err := s.getTarget(ctx, roomID, moderator, username)
+	if err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+
+	if err = s.moderationRepo.UnbanUser(ctx, roomID, target.user.ID); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+
+	action := &moderation.Action{RoomID: roomID, TargetID: target.user.ID, Kind: moderation.KindUnban}
+	if err = s.saveAction(ctx, moderator, action); err != nil {
+		return fmt.Errorf("unban user: %w", err)
+	}
+	return nil
+}
+
+// GetModerationLog returns the newest moderation actions in room, log is visible only to moderators
+// of room and admin
+func (s *Service) GetModerationLog(ctx context.Context, roomID uuid.UUID,
+	moderator Editor) (*chat.ModerationLog, error) {
+	if _, err := s.getRoom(ctx, roomID); err != nil {
+		return nil, fmt.Errorf("moderation log: %w", err)
+	}
+	if _, err := s.moderatorRank(ctx, roomID, moderator); err != nil {
+		return nil, fmt.Errorf("moderation log: %w", err)
+	}
+
+	actions, err := s.moderationRepo.GetModerationActions(ctx, roomID, ModerationLogLimit)
+	if err != nil {
+		return nil, fmt.Errorf("moderation log: %w", err)
+	}
+
+	if len(actions) == 0 {
+		return &chat.ModerationLog{Actions: []moderation.Action{}, Usernames: map[uuid.UUID]string{}}, nil
+	}
+
+	usernames, err := s.getUsernamesFromUserIDs(ctx, actionUserIDs(actions))
+	if err != nil {
+		return nil, fmt.Errorf("moderation log: %w", err)
+	}
+	return &chat.ModerationLog{Actions: actions, Usernames: usernames}, nil
+}
+
+// actionUserIDs returns ids of moderators and moderated users of actions without duplicates
+func actionUserIDs(actions []moderation.Action) []uuid.UUID {
+	idsMap := make(map[uuid.UUID]struct{})
+	for _, action := range actions {
+		idsMap[action.TargetID] = struct{}{}
+		if action.ModeratorID != nil {
+			idsMap[*action.ModeratorID] = struct{}{}
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(idsMap))
+	for id := range idsMap {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,441 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/mymmrac/project-glynn/internal/mocks"
+	"github.com/mymmrac/project-glynn/pkg/data/chat"
+	"github.com/mymmrac/project-glynn/pkg/data/moderation"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
+	"github.com/mymmrac/project-glynn/pkg/uuid"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRole expects member of room with specified role to be requested
+func mockRole(userID uuid.UUID, role room.Role) {
+	mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(userID), &room.Member{UserID: userID, Role: role}, nil)
+}
+
+// mockTarget expects moderator with specified role to moderate target with specified role in public room,
+// target is not a member of room if its role is empty
+func mockTarget(moderator Editor, moderatorRole room.Role, target *user.User, targetRole room.Role) {
+	mockRoomTarget(&room.Room{ID: roomID}, moderator, moderatorRole, target, targetRole)
+}
+
+func mockRoomTarget(r *room.Room, moderator Editor, moderatorRole room.Role, target *user.User,
+	targetRole room.Role) {
+	mocks.MockGetRoom(m, gomock.Eq(roomID), r, nil)
+	if !moderator.Admin {
+		mockRole(moderator.UserID, moderatorRole)
+	}
+	found := *target
+	mocks.MockGetUserByUsername(m, gomock.Eq(target.Username), &found, nil)
+	if targetRole == "" {
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil, repository.ErrorNotFound)
+	} else {
+		mockRole(target.ID, targetRole)
+	}
+}
+
+// expectAction expects moderation action to be saved, returns saved action after it's saved
+func expectAction() *moderation.Action {
+	saved := &moderation.Action{}
+	m.EXPECT().
+		SaveModerationAction(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, action *moderation.Action) error {
+			*saved = *action
+			return nil
+		}).
+		Times(1)
+	return saved
+}
+
+// assertAction checks that saved action matches expected one, ignoring id and time which must be set
+func assertAction(t *testing.T, expected, actual *moderation.Action) {
+	t.Helper()
+
+	assert.NotEqual(t, uuid.UUID{}, actual.ID)
+	assert.WithinDuration(t, time.Now(), actual.Time, time.Minute)
+	exp, act := *expected, *actual
+	exp.ID, act.ID = uuid.UUID{}, uuid.UUID{}
+	exp.Time, act.Time = time.Time{}, time.Time{}
+	if exp.Until != nil && act.Until != nil {
+		assert.WithinDuration(t, *exp.Until, *act.Until, time.Minute)
+		exp.Until, act.Until = nil, nil
+	}
+	assert.Equal(t, exp, act)
+}
+
+func TestService_SetRole(t *testing.T) {
+	setup(t)
+
+	owner := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+	promote := chat.RoleChange{Role: room.RoleModerator}
+
+	t.Run("owner", func(t *testing.T) {
+		mockTarget(owner, room.RoleOwner, target, room.RoleMember)
+		mocks.MockUpdateRoomMember(m, gomock.Eq(roomID),
+			gomock.Eq(&room.Member{UserID: target.ID, Role: room.RoleModerator}), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.SetRole(context.Background(), roomID, owner, target.Username, promote))
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &owner.UserID, TargetID: target.ID,
+			Kind: moderation.KindRole, Role: room.RoleModerator}, saved)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		mockTarget(Editor{Admin: true}, "", target, room.RoleOwner)
+		mocks.MockUpdateRoomMember(m, gomock.Eq(roomID),
+			gomock.Eq(&room.Member{UserID: target.ID, Role: room.RoleMember}), nil)
+		saved := expectAction()
+
+		err := service.SetRole(context.Background(), roomID, Editor{Admin: true}, target.Username,
+			chat.RoleChange{Role: room.RoleMember})
+		require.NoError(t, err)
+		assertAction(t, &moderation.Action{RoomID: roomID, TargetID: target.ID, Kind: moderation.KindRole,
+			Role: room.RoleMember}, saved)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		err := service.SetRole(context.Background(), roomID, owner, target.Username, chat.RoleChange{Role: "admin"})
+		assert.ErrorIs(t, err, ErrorInvalidRole)
+	})
+
+	t.Run("moderator", func(t *testing.T) {
+		mockTarget(owner, room.RoleModerator, target, room.RoleMember)
+
+		err := service.SetRole(context.Background(), roomID, owner, target.Username, promote)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("other owner", func(t *testing.T) {
+		mockTarget(owner, room.RoleOwner, target, room.RoleOwner)
+
+		err := service.SetRole(context.Background(), roomID, owner, target.Username, promote)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mockTarget(owner, room.RoleOwner, target, "")
+
+		err := service.SetRole(context.Background(), roomID, owner, target.Username, promote)
+		assert.ErrorIs(t, err, ErrorNotRoomMember)
+	})
+
+	t.Run("left meanwhile", func(t *testing.T) {
+		mockTarget(owner, room.RoleOwner, target, room.RoleMember)
+		mocks.MockUpdateRoomMember(m, gomock.Eq(roomID), gomock.Any(), repository.ErrorNotFound)
+
+		err := service.SetRole(context.Background(), roomID, owner, target.Username, promote)
+		assert.ErrorIs(t, err, ErrorNotRoomMember)
+	})
+}
+
+func TestService_MuteUser(t *testing.T) {
+	setup(t)
+
+	moderator := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+	mute := chat.Mute{Duration: "10m"}
+
+	t.Run("ok", func(t *testing.T) {
+		var muted time.Time
+		mockTarget(moderator, room.RoleModerator, target, room.RoleMember)
+		m.EXPECT().
+			MuteUser(gomock.Any(), gomock.Eq(roomID), gomock.Eq(target.ID), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _, _ uuid.UUID, until time.Time) error {
+				muted = until
+				return nil
+			}).
+			Times(1)
+		saved := expectAction()
+
+		require.NoError(t, service.MuteUser(context.Background(), roomID, moderator, target.Username, mute))
+		until := time.Now().Add(10 * time.Minute)
+		assert.WithinDuration(t, until, muted, time.Minute)
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &moderator.UserID, TargetID: target.ID,
+			Kind: moderation.KindMute, Until: &until}, saved)
+	})
+
+	t.Run("invalid duration", func(t *testing.T) {
+		for _, duration := range []string{"", "10", "-1m", "0s"} {
+			err := service.MuteUser(context.Background(), roomID, moderator, target.Username,
+				chat.Mute{Duration: duration})
+			assert.ErrorIs(t, err, ErrorInvalidDuration, duration)
+		}
+	})
+
+	t.Run("same rank", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, room.RoleModerator)
+
+		err := service.MuteUser(context.Background(), roomID, moderator, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockRole(moderator.UserID, room.RoleMember)
+
+		err := service.MuteUser(context.Background(), roomID, moderator, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(moderator.UserID), nil, repository.ErrorNotFound)
+
+		err := service.MuteUser(context.Background(), roomID, moderator, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockRole(moderator.UserID, room.RoleModerator)
+		mocks.MockGetUserByUsername(m, gomock.Eq(target.Username), nil, repository.ErrorNotFound)
+
+		err := service.MuteUser(context.Background(), roomID, moderator, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorUserNotFound)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID, Direct: true}, nil)
+
+		err := service.MuteUser(context.Background(), roomID, Editor{Admin: true}, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorDirectRoom)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		err := service.MuteUser(context.Background(), roomID, moderator, target.Username, mute)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("rejoin", func(t *testing.T) {
+		ctx := context.Background()
+		repo := repository.NewMemoryRepository()
+		log, _ := test.NewNullLogger()
+		service := NewService(repo, DefaultMessageRules(), log)
+		require.NoError(t, repo.CreateUser(ctx, target, "hash"))
+		require.NoError(t, repo.CreateRoom(ctx, &room.Room{ID: roomID}))
+		require.NoError(t, service.JoinRoom(ctx, roomID, target.ID))
+
+		require.NoError(t, service.MuteUser(ctx, roomID, Editor{Admin: true}, target.Username, mute))
+		require.NoError(t, service.LeaveRoom(ctx, roomID, target.ID))
+		require.NoError(t, service.JoinRoom(ctx, roomID, target.ID))
+
+		err := service.SendMessage(ctx, roomID, target.ID, chat.NewMessage{Text: "text"})
+		assert.ErrorIs(t, err, ErrorMuted)
+	})
+}
+
+func TestService_UnmuteUser(t *testing.T) {
+	setup(t)
+
+	moderator := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("ok", func(t *testing.T) {
+		mockTarget(moderator, room.RoleOwner, target, room.RoleModerator)
+		mocks.MockUnmuteUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.UnmuteUser(context.Background(), roomID, moderator, target.Username))
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &moderator.UserID, TargetID: target.ID,
+			Kind: moderation.KindUnmute}, saved)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mockTarget(moderator, room.RoleOwner, target, "")
+
+		err := service.UnmuteUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, ErrorNotRoomMember)
+	})
+}
+
+func TestService_KickUser(t *testing.T) {
+	setup(t)
+
+	moderator := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("ok", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, room.RoleMember)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.KickUser(context.Background(), roomID, moderator, target.Username))
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &moderator.UserID, TargetID: target.ID,
+			Kind: moderation.KindKick}, saved)
+	})
+
+	t.Run("private room", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, &target.ID)
+		defer sub.Close()
+
+		mockRoomTarget(&room.Room{ID: roomID, Private: true}, moderator, room.RoleModerator, target, room.RoleMember)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		expectAction()
+
+		require.NoError(t, service.KickUser(context.Background(), roomID, moderator, target.Username))
+
+		// Kicked user can't read private room anymore
+		_, ok := <-sub.Messages()
+		assert.False(t, ok)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, "")
+
+		err := service.KickUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, ErrorNotRoomMember)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, room.RoleOwner)
+
+		err := service.KickUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, room.RoleMember)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), errAny)
+
+		err := service.KickUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
+
+func TestService_BanUser(t *testing.T) {
+	setup(t)
+
+	moderator := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("member", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, &target.ID)
+		defer sub.Close()
+
+		mockTarget(moderator, room.RoleModerator, target, room.RoleMember)
+		mocks.MockBanUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		mocks.MockRemoveRoomMember(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.BanUser(context.Background(), roomID, moderator, target.Username))
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &moderator.UserID, TargetID: target.ID,
+			Kind: moderation.KindBan}, saved)
+
+		// Banned user can't read even public room
+		_, ok := <-sub.Messages()
+		assert.False(t, ok)
+	})
+
+	t.Run("not member", func(t *testing.T) {
+		mockTarget(Editor{Admin: true}, "", target, "")
+		mocks.MockBanUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.BanUser(context.Background(), roomID, Editor{Admin: true}, target.Username))
+		assertAction(t, &moderation.Action{RoomID: roomID, TargetID: target.ID, Kind: moderation.KindBan}, saved)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, room.RoleMember)
+		mocks.MockBanUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), errAny)
+
+		err := service.BanUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
+
+func TestService_UnbanUser(t *testing.T) {
+	setup(t)
+
+	moderator := Editor{UserID: uuid.New()}
+	target := &user.User{ID: uuid.New(), Username: "target"}
+
+	t.Run("ok", func(t *testing.T) {
+		mockTarget(moderator, room.RoleModerator, target, "")
+		mocks.MockUnbanUser(m, gomock.Eq(roomID), gomock.Eq(target.ID), nil)
+		saved := expectAction()
+
+		require.NoError(t, service.UnbanUser(context.Background(), roomID, moderator, target.Username))
+		assertAction(t, &moderation.Action{RoomID: roomID, ModeratorID: &moderator.UserID, TargetID: target.ID,
+			Kind: moderation.KindUnban}, saved)
+	})
+
+	t.Run("not moderator", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockRole(moderator.UserID, room.RoleMember)
+
+		err := service.UnbanUser(context.Background(), roomID, moderator, target.Username)
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+}
+
+func TestService_GetModerationLog(t *testing.T) {
+	setup(t)
+
+	moderator := user.User{ID: uuid.New(), Username: "moderator"}
+	target := user.User{ID: uuid.New(), Username: "target"}
+	actions := []moderation.Action{
+		{ID: uuid.New(), RoomID: roomID, ModeratorID: &moderator.ID, TargetID: target.ID, Kind: moderation.KindKick},
+		{ID: uuid.New(), RoomID: roomID, TargetID: moderator.ID, Kind: moderation.KindRole, Role: room.RoleModerator},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockRole(moderator.ID, room.RoleModerator)
+		mocks.MockGetModerationActions(m, gomock.Eq(roomID), actions, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), []user.User{moderator, target}, nil)
+
+		actual, err := service.GetModerationLog(context.Background(), roomID, Editor{UserID: moderator.ID})
+		require.NoError(t, err)
+		assert.Equal(t, &chat.ModerationLog{
+			Actions:   actions,
+			Usernames: map[uuid.UUID]string{moderator.ID: moderator.Username, target.ID: target.Username},
+		}, actual)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetModerationActions(m, gomock.Eq(roomID), nil, nil)
+
+		actual, err := service.GetModerationLog(context.Background(), roomID, Editor{Admin: true})
+		require.NoError(t, err)
+		assert.Equal(t, &chat.ModerationLog{Actions: []moderation.Action{}, Usernames: map[uuid.UUID]string{}},
+			actual)
+	})
+
+	t.Run("not moderator", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockRole(target.ID, room.RoleMember)
+
+		_, err := service.GetModerationLog(context.Background(), roomID, Editor{UserID: target.ID})
+		assert.ErrorIs(t, err, ErrorNotModerator)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		_, err := service.GetModerationLog(context.Background(), roomID, Editor{Admin: true})
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetModerationActions(m, gomock.Eq(roomID), nil, errAny)
+
+		_, err := service.GetModerationLog(context.Background(), roomID, Editor{Admin: true})
+		assert.ErrorIs(t, err, errAny)
+	})
+}
@@ -1,12 +1,17 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/mymmrac/project-glynn/pkg/data/chat"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
+	"github.com/mymmrac/project-glynn/pkg/data/user"
 	"github.com/mymmrac/project-glynn/pkg/repository"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/sirupsen/logrus"
@@ -15,58 +20,236 @@ import (
 // MessageLimit limits amount of messages to be received
 const MessageLimit uint = 20
 
-var ErrorRoomNotFound = errors.New("no such room")
+// MaxWait limits how long request can wait for new messages
+const MaxWait = time.Minute
+
+// editsDelay is how long updates cursor stays behind time of request, time of update is taken before update is
+// saved, so updates saved during request may be older than request
+const editsDelay = 5 * time.Second
+
+var (
+	ErrorRoomNotFound    = errors.New("no such room")
+	ErrorUserNotFound    = errors.New("no such user")
+	ErrorMessageNotFound = errors.New("no such message in room")
+	ErrorInvalidUsername = errors.New("invalid username, must contain only [a-Z], [0-9] or '_', " +
+		"starting from letter and at least 3 chars long")
+	ErrorUsernameTaken    = errors.New("username already taken")
+	ErrorUnauthorized     = errors.New("invalid authentication token")
+	ErrorNotMessageAuthor = errors.New("only author can change message")
+	ErrorReactionNotFound = errors.New("no such reaction on message")
+	ErrorParentNotFound   = errors.New("replied message not found in room")
+	ErrorNotRoomMember    = errors.New("not a member of room")
+	ErrorDirectToSelf     = errors.New("direct messages to yourself are not allowed")
+	ErrorPrivateRoom      = errors.New("room is private, only invited users can join")
+	ErrorDirectRoom       = errors.New("members of direct room can't be changed")
+	ErrorNotModerator     = errors.New("not allowed to moderate user in room")
+	ErrorInvalidRole      = errors.New("invalid role, must be one of: member, moderator or owner")
+	ErrorInvalidDuration  = errors.New("invalid duration, must be positive like 90s, 10m or 1h30m")
+	ErrorMuted            = errors.New("muted in room")
+	ErrorBanned           = errors.New("banned in room")
+)
+
+var usernameRegex = regexp.MustCompile(user.UsernameRegex)
 
 // Service manages all logic for api
 type Service struct {
-	messageRepo repository.MessageRepository
-	userRepo    repository.UserRepository
-	roomRepo    repository.RoomRepository
-	log         *logrus.Logger
+	messageRepo    repository.MessageRepository
+	reactionRepo   repository.ReactionRepository
+	userRepo       repository.UserRepository
+	roomRepo       repository.RoomRepository
+	moderationRepo repository.ModerationRepository
+	rules          MessageRules
+	hub            *Hub
+	log            *logrus.Logger
 }
 
-// NewService creates new Service with repository.Repository
-func NewService(repo repository.Repository, log *logrus.Logger) *Service {
+// NewService creates new Service with repository.Repository, sent messages are validated using rules
+func NewService(repo repository.Repository, rules MessageRules, log *logrus.Logger) *Service {
 	return &Service{
-		messageRepo: repo,
-		userRepo:    repo,
-		roomRepo:    repo,
-		log:         log,
+		messageRepo:    repo,
+		reactionRepo:   repo,
+		userRepo:       repo,
+		roomRepo:       repo,
+		moderationRepo: repo,
+		rules:          rules,
+		hub:            NewHub(),
+		log:            log,
 	}
 }
 
-// GetMessagesAfterTime returns chat.Messages after specified time
-func (s *Service) GetMessagesAfterTime(roomID uuid.UUID, afterTime time.Time) (*chat.Messages, error) {
-	if err := s.CheckRoom(roomID); err != nil {
+// GetMessagesAfterTime returns page of earliest chat.Messages after specified time,
+// HasMore reports if there are more messages after returned ones, readerID is nil for anonymous reader
+func (s *Service) GetMessagesAfterTime(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID,
+	afterTime time.Time) (*chat.Messages, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
 		return nil, fmt.Errorf("messages after time: %w", err)
 	}
 
-	messages, err := s.messageRepo.GetMessages(roomID, afterTime, MessageLimit)
+	cm, err := s.getMessagesAfter(ctx, roomID, repository.TimeCursor(afterTime))
 	if err != nil {
 		return nil, fmt.Errorf("messages after time: %w", err)
 	}
+	return cm, nil
+}
 
-	ids := s.getUserIDsFromMessages(messages)
-	usernames, err := s.getUsernamesFromUserIDs(ids)
+// getMessagesAfter returns page of earliest chat.Messages after specified cursor
+func (s *Service) getMessagesAfter(ctx context.Context, roomID uuid.UUID,
+	after repository.Cursor) (*chat.Messages, error) {
+	// Requesting one extra message to know if there are more messages
+	messages, err := s.messageRepo.GetOldestMessages(ctx, roomID, after, MessageLimit+1)
 	if err != nil {
-		return nil, fmt.Errorf("messages after time: %w", err)
+		return nil, err
 	}
 
-	return &chat.Messages{
-		Messages:  messages,
-		Usernames: usernames,
-	}, nil
+	hasMore := uint(len(messages)) > MessageLimit
+	if hasMore {
+		messages = messages[:MessageLimit]
+	}
+
+	cm, err := s.newChatMessages(ctx, roomID, messages)
+	if err != nil {
+		return nil, err
+	}
+	cm.HasMore = hasMore
+	return cm, nil
+}
+
+// newChatMessages returns chat.Messages with given messages and messages replied by them
+func (s *Service) newChatMessages(ctx context.Context, roomID uuid.UUID,
+	messages []message.Message) (*chat.Messages, error) {
+	parents, err := s.getParents(ctx, roomID, messages)
+	if err != nil {
+		return nil, err
+	}
+	return s.newChatMessagesWithParents(ctx, roomID, messages, parents)
+}
+
+// newChatMessagesWithParents returns chat.Messages with given messages and parents, usernames of their authors,
+// reactions on messages and reply counts on both messages and parents
+func (s *Service) newChatMessagesWithParents(ctx context.Context, roomID uuid.UUID,
+	messages, parents []message.Message) (*chat.Messages, error) {
+	all := make([]message.Message, 0, len(messages)+len(parents))
+	all = append(append(all, messages...), parents...)
+
+	usernames, err := s.getUsernamesFromUserIDs(ctx, s.getUserIDsFromMessages(all))
+	if err != nil {
+		return nil, err
+	}
+
+	reactions, err := s.getReactionCounts(ctx, roomID, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	replyCounts, err := s.getReplyCounts(ctx, roomID, all)
+	if err != nil {
+		return nil, err
+	}
+
+	cm := &chat.Messages{
+		Messages:    messages,
+		Usernames:   usernames,
+		Reactions:   reactions,
+		ReplyCounts: replyCounts,
+	}
+	if len(parents) > 0 {
+		cm.Parents = make(map[uuid.UUID]message.Message, len(parents))
+		for _, parent := range parents {
+			cm.Parents[parent.ID] = parent
+		}
+	}
+	return cm, nil
+}
+
+// getParents returns messages replied by given messages, deleted replies are skipped as they have no text to quote
+func (s *Service) getParents(ctx context.Context, roomID uuid.UUID,
+	messages []message.Message) ([]message.Message, error) {
+	idsMap := make(map[uuid.UUID]struct{})
+	var ids []uuid.UUID
+	for _, msg := range messages {
+		if msg.ReplyTo == nil || msg.Deleted {
+			continue
+		}
+		if _, ok := idsMap[*msg.ReplyTo]; !ok {
+			idsMap[*msg.ReplyTo] = struct{}{}
+			ids = append(ids, *msg.ReplyTo)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	parents, err := s.messageRepo.GetMessagesFromIDs(ctx, roomID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get parents: %w", err)
+	}
+	return parents, nil
+}
+
+// getReplyCounts returns counts of replies on messages by message id
+func (s *Service) getReplyCounts(ctx context.Context, roomID uuid.UUID,
+	messages []message.Message) (map[uuid.UUID]int, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	counts, err := s.messageRepo.GetReplyCounts(ctx, roomID, messageIDs(messages))
+	if err != nil {
+		return nil, fmt.Errorf("get reply counts: %w", err)
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	return counts, nil
+}
+
+// now returns current time in UTC, storages keep only milliseconds, so it's truncated to keep saved times
+// and cursors built from them the same in any storage
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// messageIDs returns ids of messages keeping their order
+func messageIDs(messages []message.Message) []uuid.UUID {
+	ids := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
 }
 
-func (s Service) getUsernamesFromUserIDs(ids []uuid.UUID) (map[uuid.UUID]string, error) {
-	users, err := s.userRepo.GetUsersFromIDs(ids)
+// getReactionCounts returns counts of reactions on messages by message id, reactions on deleted messages are omitted
+func (s *Service) getReactionCounts(ctx context.Context, roomID uuid.UUID,
+	messages []message.Message) (map[uuid.UUID]reaction.Counts, error) {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, msg := range messages {
+		if !msg.Deleted {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	counts, err := s.reactionRepo.GetReactionCounts(ctx, roomID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get reactions: %w", err)
+	}
+	if len(counts) == 0 {
+		return nil, nil
+	}
+	return counts, nil
+}
+
+func (s Service) getUsernamesFromUserIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]string, error) {
+	users, err := s.userRepo.GetUsersFromIDs(ctx, ids)
 	if err != nil {
 		return nil, fmt.Errorf("get usernames: %w", err)
 	}
 
 	usernames := make(map[uuid.UUID]string)
-	for _, user := range users {
-		usernames[user.ID] = user.Username
+	for _, usr := range users {
+		usernames[usr.ID] = usr.Username
 	}
 
 	return usernames, nil
@@ -88,54 +271,646 @@ func (s *Service) getUserIDsFromMessages(messages []message.Message) []uuid.UUID
 	return ids
 }
 
+// getMessageCursor returns cursor pointing at message from room or ErrorMessageNotFound
+func (s *Service) getMessageCursor(ctx context.Context, roomID, messageID uuid.UUID) (repository.Cursor, error) {
+	msgTime, err := s.messageRepo.GetMessageTime(ctx, roomID, messageID)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return repository.Cursor{}, fmt.Errorf("message time: %w", ErrorMessageNotFound)
+		}
+		return repository.Cursor{}, fmt.Errorf("message time: %w", err)
+	}
+	return repository.MessageCursor(msgTime, messageID), nil
+}
+
 // GetMessagesAfterMessage returns chat.Messages after specified message
-func (s *Service) GetMessagesAfterMessage(roomID, lastMessageID uuid.UUID) (*chat.Messages, error) {
-	msgTime, err := s.messageRepo.GetMessageTime(lastMessageID)
+func (s *Service) GetMessagesAfterMessage(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID,
+	lastMessageID uuid.UUID) (*chat.Messages, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		return nil, fmt.Errorf("messages after message: %w", err)
+	}
+
+	cursor, err := s.getMessageCursor(ctx, roomID, lastMessageID)
 	if err != nil {
 		return nil, fmt.Errorf("messages after message: %w", err)
 	}
 
-	cm, err := s.GetMessagesAfterTime(roomID, msgTime)
+	cm, err := s.getMessagesAfter(ctx, roomID, cursor)
 	if err != nil {
 		return nil, fmt.Errorf("messages after message: %w", err)
 	}
 	return cm, nil
 }
 
+// GetMessagesBeforeMessage returns page of chat.Messages sent right before specified message,
+// HasMore reports if there are even older messages
+func (s *Service) GetMessagesBeforeMessage(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID,
+	beforeMessageID uuid.UUID) (*chat.Messages, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		return nil, fmt.Errorf("messages before message: %w", err)
+	}
+
+	cursor, err := s.getMessageCursor(ctx, roomID, beforeMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("messages before message: %w", err)
+	}
+
+	// Requesting one extra message to know if there are more messages
+	messages, err := s.messageRepo.GetMessagesBefore(ctx, roomID, cursor, MessageLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("messages before message: %w", err)
+	}
+
+	hasMore := uint(len(messages)) > MessageLimit
+	if hasMore {
+		messages = messages[1:]
+	}
+
+	cm, err := s.newChatMessages(ctx, roomID, messages)
+	if err != nil {
+		return nil, fmt.Errorf("messages before message: %w", err)
+	}
+	cm.HasMore = hasMore
+	return cm, nil
+}
+
 // GetMessagesLatest returns latest chat.Messages
-func (s *Service) GetMessagesLatest(roomID uuid.UUID) (*chat.Messages, error) {
-	cm, err := s.GetMessagesAfterTime(roomID, time.Time{})
+func (s *Service) GetMessagesLatest(ctx context.Context, roomID uuid.UUID,
+	readerID *uuid.UUID) (*chat.Messages, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		return nil, fmt.Errorf("latest messages: %w", err)
+	}
+
+	messages, err := s.messageRepo.GetMessages(ctx, roomID, repository.Cursor{}, MessageLimit)
+	if err != nil {
+		return nil, fmt.Errorf("latest messages: %w", err)
+	}
+
+	cm, err := s.newChatMessages(ctx, roomID, messages)
 	if err != nil {
 		return nil, fmt.Errorf("latest messages: %w", err)
 	}
 	return cm, nil
 }
 
-// SendMessage saves message
-func (s *Service) SendMessage(roomID uuid.UUID, newMessage chat.NewMessage) error {
-	if err := s.CheckRoom(roomID); err != nil {
+// getMessages returns chat.Messages after specified message or latest if lastMessageID is nil
+func (s *Service) getMessages(ctx context.Context, roomID uuid.UUID,
+	readerID, lastMessageID *uuid.UUID) (*chat.Messages, error) {
+	if lastMessageID == nil {
+		return s.GetMessagesLatest(ctx, roomID, readerID)
+	}
+	return s.GetMessagesAfterMessage(ctx, roomID, readerID, *lastMessageID)
+}
+
+// WaitMessages returns chat.Messages after specified message (or latest if lastMessageID is nil) with messages
+// edited or deleted after updatedAfter (if not nil), if there are no such messages waits for new message or change
+// of sent message up to specified duration (limited by MaxWait), UpdatedUntil of result is used as updatedAfter
+// of next request
+func (s *Service) WaitMessages(ctx context.Context, roomID uuid.UUID, readerID, lastMessageID *uuid.UUID,
+	updatedAfter *time.Time, wait time.Duration) (*chat.Messages, error) {
+	// Subscribing before getting messages, so messages sent in between won't be missed
+	sub := s.hub.Subscribe(roomID, readerID)
+	defer sub.Close()
+
+	cm, err := s.pollMessages(ctx, roomID, readerID, lastMessageID, updatedAfter)
+	if err != nil {
+		return nil, fmt.Errorf("wait messages: %w", err)
+	}
+
+	if len(cm.Messages) > 0 || len(cm.Updated) > 0 || wait <= 0 {
+		return cm, nil
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case newMessages, ok := <-sub.Messages():
+		if ok {
+			// Published messages are shared between subscribers, so they are copied before change,
+			// cursor isn't moved, so updates published meanwhile are returned by next request
+			published := *newMessages
+			published.UpdatedUntil = cm.UpdatedUntil
+			return &published, nil
+		}
+
+		// Subscription was dropped, so new messages must be requested again
+		cm, err = s.pollMessages(ctx, roomID, readerID, lastMessageID, updatedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("wait messages: %w", err)
+		}
+		return cm, nil
+	case <-timer.C:
+		return cm, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("wait messages: %w", ctx.Err())
+	}
+}
+
+// pollMessages returns chat.Messages after specified message (or latest if lastMessageID is nil) with messages
+// updated after updatedAfter (if not nil) and sets UpdatedUntil to time next updates must be requested after
+func (s *Service) pollMessages(ctx context.Context, roomID uuid.UUID, readerID, lastMessageID *uuid.UUID,
+	updatedAfter *time.Time) (*chat.Messages, error) {
+	updatedUntil := now().Add(-editsDelay)
+
+	cm, err := s.getMessages(ctx, roomID, readerID, lastMessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if updatedAfter != nil {
+		if updatedAfter.After(updatedUntil) {
+			updatedUntil = *updatedAfter
+		}
+
+		// Updates made after updatedUntil may still be saved with earlier time, so they are left for next request
+		updated, err := s.messageRepo.GetUpdatedMessages(ctx, roomID, *updatedAfter, updatedUntil, MessageLimit)
+		if err != nil {
+			return nil, fmt.Errorf("get updated messages: %w", err)
+		}
+
+		// If limit is reached, there may be more updates after the last one
+		if n := len(updated); uint(n) == MessageLimit {
+			updatedUntil = *updated[n-1].UpdatedAt
+		}
+
+		if err = s.addUpdated(ctx, roomID, cm, updated); err != nil {
+			return nil, err
+		}
+	}
+
+	cm.UpdatedUntil = &updatedUntil
+	return cm, nil
+}
+
+// addUpdated adds updated messages with their details to chat.Messages
+func (s *Service) addUpdated(ctx context.Context, roomID uuid.UUID, cm *chat.Messages,
+	updated []message.Message) error {
+	if len(updated) == 0 {
+		return nil
+	}
+
+	details, err := s.newChatMessages(ctx, roomID, updated)
+	if err != nil {
+		return fmt.Errorf("details of updated messages: %w", err)
+	}
+
+	cm.Updated = updated
+	if cm.Usernames == nil {
+		cm.Usernames = make(map[uuid.UUID]string, len(details.Usernames))
+	}
+	for id, username := range details.Usernames {
+		cm.Usernames[id] = username
+	}
+	for id, counts := range details.Reactions {
+		if cm.Reactions == nil {
+			cm.Reactions = make(map[uuid.UUID]reaction.Counts)
+		}
+		cm.Reactions[id] = counts
+	}
+	for id, parent := range details.Parents {
+		if cm.Parents == nil {
+			cm.Parents = make(map[uuid.UUID]message.Message)
+		}
+		cm.Parents[id] = parent
+	}
+	for id, count := range details.ReplyCounts {
+		if cm.ReplyCounts == nil {
+			cm.ReplyCounts = make(map[uuid.UUID]int)
+		}
+		cm.ReplyCounts[id] = count
+	}
+	return nil
+}
+
+// SendMessage validates and saves message sent by authenticated user
+func (s *Service) SendMessage(ctx context.Context, roomID, userID uuid.UUID, newMessage chat.NewMessage) error {
+	if err := s.rules.Validate(newMessage.Text); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	if err := s.checkWrite(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	parent, err := s.getParent(ctx, roomID, newMessage.ReplyTo)
+	if err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	usr, err := s.getUser(ctx, userID)
+	if err != nil {
 		return fmt.Errorf("send message: %w", err)
 	}
-	// TODO user check
-	// TODO text check
 
 	msg := &message.Message{
-		ID:     uuid.New(),
-		UserID: newMessage.UserID,
-		RoomID: roomID,
-		Text:   newMessage.Text,
-		Time:   time.Now(),
+		ID:      uuid.New(),
+		UserID:  userID,
+		RoomID:  roomID,
+		Text:    newMessage.Text,
+		Time:    now(),
+		ReplyTo: newMessage.ReplyTo,
 	}
 
-	if err := s.messageRepo.SaveMessage(msg); err != nil {
+	if err = s.messageRepo.SaveMessage(ctx, msg); err != nil {
 		return fmt.Errorf("send message: %w", err)
 	}
+
+	s.publish(ctx, msg, usr.Username, parent)
+	return nil
+}
+
+// getParent returns message from room replied by new message or ErrorParentNotFound,
+// nil is returned if new message is not a reply, deleted messages can't be replied
+func (s *Service) getParent(ctx context.Context, roomID uuid.UUID, replyTo *uuid.UUID) (*message.Message, error) {
+	if replyTo == nil {
+		return nil, nil
+	}
+
+	parent, err := s.messageRepo.GetMessage(ctx, roomID, *replyTo)
+	if err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return nil, fmt.Errorf("get parent: %w", ErrorParentNotFound)
+		}
+		return nil, fmt.Errorf("get parent: %w", err)
+	}
+	if parent.Deleted {
+		return nil, fmt.Errorf("get parent: %w", ErrorParentNotFound)
+	}
+	return parent, nil
+}
+
+// GetThread returns page of earliest replies on message after specified reply (or first replies if lastMessageID
+// is nil) with replied message in Parents, HasMore reports if there are more replies after returned ones
+func (s *Service) GetThread(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID, messageID uuid.UUID,
+	lastMessageID *uuid.UUID) (*chat.Messages, error) {
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		return nil, fmt.Errorf("thread: %w", err)
+	}
+
+	// Thread of deleted message is still available, only its text is erased
+	parent, err := s.messageRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("thread: %w", s.messageError(err))
+	}
+
+	var after repository.Cursor
+	if lastMessageID != nil {
+		after, err = s.getMessageCursor(ctx, roomID, *lastMessageID)
+		if err != nil {
+			return nil, fmt.Errorf("thread: %w", err)
+		}
+	}
+
+	// Requesting one extra reply to know if there are more replies
+	replies, err := s.messageRepo.GetReplies(ctx, roomID, messageID, after, MessageLimit+1)
+	if err != nil {
+		return nil, fmt.Errorf("thread: %w", err)
+	}
+
+	hasMore := uint(len(replies)) > MessageLimit
+	if hasMore {
+		replies = replies[:MessageLimit]
+	}
+
+	cm, err := s.newChatMessagesWithParents(ctx, roomID, replies, []message.Message{*parent})
+	if err != nil {
+		return nil, fmt.Errorf("thread: %w", err)
+	}
+	cm.HasMore = hasMore
+	return cm, nil
+}
+
+// Editor is a user who changes message or members of room, admin can change messages and rooms of any user
+type Editor struct {
+	UserID uuid.UUID // UserID of authenticated user, not used by admin
+	Admin  bool      // Admin reports if message is changed using admin API
+}
+
+// EditMessage validates and replaces text of message, only author or admin can edit message
+func (s *Service) EditMessage(ctx context.Context, roomID, messageID uuid.UUID, editor Editor,
+	edit chat.MessageEdit) error {
+	if err := s.rules.Validate(edit.Text); err != nil {
+		return fmt.Errorf("edit message: %w", err)
+	}
+
+	msg, err := s.getEditableMessage(ctx, roomID, messageID, editor)
+	if err != nil {
+		return fmt.Errorf("edit message: %w", err)
+	}
+
+	editedAt := now()
+	if err = s.messageRepo.EditMessage(ctx, roomID, messageID, edit.Text, editedAt); err != nil {
+		return fmt.Errorf("edit message: %w", s.messageError(err))
+	}
+
+	msg.Text = edit.Text
+	msg.EditedAt = &editedAt
+	s.publishUpdate(ctx, msg)
+	return nil
+}
+
+// DeleteMessage marks message as deleted and erases its text, only author or admin can delete message
+func (s *Service) DeleteMessage(ctx context.Context, roomID, messageID uuid.UUID, editor Editor) error {
+	msg, err := s.getEditableMessage(ctx, roomID, messageID, editor)
+	if err != nil {
+		return fmt.Errorf("delete message: %w", err)
+	}
+
+	// Deletion is saved as the latest edit, so clients requesting updates receive it
+	deletedAt := now()
+	if err = s.messageRepo.DeleteMessage(ctx, roomID, messageID, deletedAt); err != nil {
+		return fmt.Errorf("delete message: %w", s.messageError(err))
+	}
+
+	msg.Text = ""
+	msg.Deleted = true
+	msg.EditedAt = &deletedAt
+	s.publishUpdate(ctx, msg)
+	return nil
+}
+
+// getEditableMessage returns message which editor is allowed to change, deleted messages can't be changed
+func (s *Service) getEditableMessage(ctx context.Context, roomID, messageID uuid.UUID,
+	editor Editor) (*message.Message, error) {
+	// Admin can moderate any room, while author must still have access to room
+	var err error
+	if editor.Admin {
+		err = s.CheckRoom(ctx, roomID)
+	} else {
+		err = s.checkWrite(ctx, roomID, editor.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := s.getMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !editor.Admin && msg.UserID != editor.UserID {
+		return nil, ErrorNotMessageAuthor
+	}
+	return msg, nil
+}
+
+// getMessage returns message from room which is not deleted or ErrorMessageNotFound
+func (s *Service) getMessage(ctx context.Context, roomID, messageID uuid.UUID) (*message.Message, error) {
+	msg, err := s.messageRepo.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("get message: %w", s.messageError(err))
+	}
+	if msg.Deleted {
+		return nil, fmt.Errorf("get message: %w", ErrorMessageNotFound)
+	}
+	return msg, nil
+}
+
+// AddReaction saves reaction of authenticated user on message, deleted messages can't be reacted on
+func (s *Service) AddReaction(ctx context.Context, roomID, messageID, userID uuid.UUID,
+	newReaction chat.NewReaction) error {
+	if err := ValidateReaction(newReaction.Emoji); err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+
+	if err := s.checkWrite(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+
+	msg, err := s.getMessage(ctx, roomID, messageID)
+	if err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+
+	r := &reaction.Reaction{
+		RoomID:    roomID,
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     newReaction.Emoji,
+	}
+	if err = s.reactionRepo.AddReaction(ctx, r); err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+	if err = s.updateReactions(ctx, msg); err != nil {
+		return fmt.Errorf("add reaction: %w", err)
+	}
+
+	s.publishUpdate(ctx, msg)
+	return nil
+}
+
+// RemoveReaction deletes reaction of authenticated user on message or returns ErrorReactionNotFound
+func (s *Service) RemoveReaction(ctx context.Context, roomID, messageID, userID uuid.UUID, emoji string) error {
+	if err := s.checkWrite(ctx, roomID, userID); err != nil {
+		return fmt.Errorf("remove reaction: %w", err)
+	}
+
+	msg, err := s.getMessage(ctx, roomID, messageID)
+	if err != nil {
+		return fmt.Errorf("remove reaction: %w", err)
+	}
+
+	r := &reaction.Reaction{
+		RoomID:    roomID,
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}
+	if err = s.reactionRepo.RemoveReaction(ctx, r); err != nil {
+		if errors.Is(err, repository.ErrorNotFound) {
+			return fmt.Errorf("remove reaction: %w", ErrorReactionNotFound)
+		}
+		return fmt.Errorf("remove reaction: %w", err)
+	}
+	if err = s.updateReactions(ctx, msg); err != nil {
+		return fmt.Errorf("remove reaction: %w", err)
+	}
+
+	s.publishUpdate(ctx, msg)
+	return nil
+}
+
+// updateReactions saves change of reactions as update of message, so clients requesting updates receive new counts
+func (s *Service) updateReactions(ctx context.Context, msg *message.Message) error {
+	updatedAt := now()
+	if err := s.messageRepo.UpdateMessage(ctx, msg.RoomID, msg.ID, updatedAt); err != nil {
+		return fmt.Errorf("update message: %w", s.messageError(err))
+	}
+	return nil
+}
+
+// messageError replaces repository.ErrorNotFound with ErrorMessageNotFound
+func (s *Service) messageError(err error) error {
+	if errors.Is(err, repository.ErrorNotFound) {
+		return ErrorMessageNotFound
+	}
+	return err
+}
+
+// getUser returns user by id or ErrorUserNotFound
+func (s *Service) getUser(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	users, err := s.userRepo.GetUsersFromIDs(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("get user: %w", ErrorUserNotFound)
+	}
+	return &users[0], nil
+}
+
+// publish notifies subscribers of room about new message, parent is message replied by it or nil
+func (s *Service) publish(ctx context.Context, msg *message.Message, username string, parent *message.Message) {
+	cm := &chat.Messages{
+		Messages:  []message.Message{*msg},
+		Usernames: map[uuid.UUID]string{msg.UserID: username},
+	}
+
+	if parent != nil {
+		// Message is already sent, so it is published even if details of replied message can't be received
+		parentMessages, err := s.newChatMessagesWithParents(ctx, msg.RoomID, nil, []message.Message{*parent})
+		if err != nil {
+			s.log.Warn("Failed to get details of replied message: ", err)
+			parentMessages = &chat.Messages{
+				Usernames: map[uuid.UUID]string{},
+				Parents:   map[uuid.UUID]message.Message{parent.ID: *parent},
+			}
+		}
+		for id, parentUsername := range parentMessages.Usernames {
+			cm.Usernames[id] = parentUsername
+		}
+		cm.Parents = parentMessages.Parents
+		cm.ReplyCounts = parentMessages.ReplyCounts
+	}
+
+	s.hub.Publish(msg.RoomID, cm)
+}
+
+// publishUpdate notifies subscribers of room about edited or deleted message or changed reactions on message
+func (s *Service) publishUpdate(ctx context.Context, msg *message.Message) {
+	updated := []message.Message{*msg}
+	cm, err := s.newChatMessages(ctx, msg.RoomID, updated)
+	if err != nil {
+		// Message is already changed, so update is sent even without details like username of author
+		s.log.Warn("Failed to get details of updated message: ", err)
+		cm = &chat.Messages{
+			Usernames: make(map[uuid.UUID]string),
+		}
+	}
+
+	cm.Messages = []message.Message{}
+	cm.Updated = updated
+	s.hub.Publish(msg.RoomID, cm)
+}
+
+// Subscribe starts receiving new messages from room, subscription must be closed after use,
+// readerID is nil for anonymous reader
+func (s *Service) Subscribe(ctx context.Context, roomID uuid.UUID, readerID *uuid.UUID) (*Subscription, error) {
+	// Subscribing before check, so subscription is dropped even if reader loses access during check
+	sub := s.hub.Subscribe(roomID, readerID)
+	if err := s.checkRead(ctx, roomID, readerID); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+	return sub, nil
+}
+
+// CreateUser validates and saves new user, returns credentials of created user
+func (s *Service) CreateUser(ctx context.Context, newUser chat.NewUser) (*chat.Credentials, error) {
+	if !usernameRegex.MatchString(newUser.Username) {
+		return nil, fmt.Errorf("create user: %w", ErrorInvalidUsername)
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+
+	usr := &user.User{
+		ID:       uuid.New(),
+		Username: newUser.Username,
+	}
+
+	if err = s.userRepo.CreateUser(ctx, usr, hashToken(token)); err != nil {
+		if errors.Is(err, repository.ErrorUsernameTaken) {
+			return nil, fmt.Errorf("create user: %w", ErrorUsernameTaken)
+		}
+		return nil, fmt.Errorf("create user: %w", err)
+	}
+
+	return &chat.Credentials{
+		UserID: usr.ID,
+		Token:  token,
+	}, nil
+}
+
+// GetRooms returns all rooms except direct ones, which are private conversations managed only by their members
+func (s *Service) GetRooms(ctx context.Context) ([]room.Room, error) {
+	rooms, err := s.roomRepo.GetRooms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get rooms: %w", err)
+	}
+
+	listed := rooms[:0]
+	for _, rm := range rooms {
+		if !rm.Direct {
+			listed = append(listed, rm)
+		}
+	}
+	return listed, nil
+}
+
+// CreateRoom saves new room, returns id of created room, user with username of owner becomes its first member
+// with room.RoleOwner
+func (s *Service) CreateRoom(ctx context.Context, newRoom chat.NewRoom) (uuid.UUID, error) {
+	var owner *user.User
+	if newRoom.Owner != "" {
+		var err error
+		owner, err = s.userRepo.GetUserByUsername(ctx, newRoom.Owner)
+		if err != nil {
+			if errors.Is(err, repository.ErrorNotFound) {
+				return uuid.UUID{}, fmt.Errorf("create room: %w", ErrorUserNotFound)
+			}
+			return uuid.UUID{}, fmt.Errorf("create room: %w", err)
+		}
+	}
+
+	r := &room.Room{
+		ID:      uuid.New(),
+		Private: newRoom.Private,
+	}
+
+	if err := s.roomRepo.CreateRoom(ctx, r); err != nil {
+		return uuid.UUID{}, fmt.Errorf("create room: %w", err)
+	}
+
+	if owner != nil {
+		if err := s.addOwner(ctx, r.ID, owner.ID); err != nil {
+			return uuid.UUID{}, fmt.Errorf("create room: %w", err)
+		}
+	}
+	return r.ID, nil
+}
+
+// DeleteRoom deletes room and all its messages
+func (s *Service) DeleteRoom(ctx context.Context, roomID uuid.UUID) error {
+	if err := s.CheckRoom(ctx, roomID); err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+
+	if err := s.roomRepo.DeleteRoom(ctx, roomID); err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
 	return nil
 }
 
 // CheckRoom returns error if room not exist
-func (s *Service) CheckRoom(roomID uuid.UUID) error {
-	ok, err := s.roomRepo.IsRoomExist(roomID)
+func (s *Service) CheckRoom(ctx context.Context, roomID uuid.UUID) error {
+	ok, err := s.roomRepo.IsRoomExist(ctx, roomID)
 	if err != nil {
 		return fmt.Errorf("check room: %w", err)
 	}
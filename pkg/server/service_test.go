@@ -1,19 +1,25 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"github.com/mymmrac/project-glynn/pkg/data/chat"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/mymmrac/project-glynn/internal/mocks"
 	"github.com/mymmrac/project-glynn/pkg/data/message"
+	"github.com/mymmrac/project-glynn/pkg/data/reaction"
+	"github.com/mymmrac/project-glynn/pkg/data/room"
 	"github.com/mymmrac/project-glynn/pkg/data/user"
+	"github.com/mymmrac/project-glynn/pkg/repository"
 	"github.com/mymmrac/project-glynn/pkg/uuid"
 	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var errAny = errors.New("any error")
@@ -28,10 +34,32 @@ func setup(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	m = mocks.NewMockRepository(ctrl)
 	log, _ := test.NewNullLogger()
-	service = NewService(m, log)
+	service = NewService(m, DefaultMessageRules(), log)
 	roomID = uuid.New()
 }
 
+// mockRoom expects public room to be requested, if room not exist it is reported as not found
+func mockRoom(exist bool, err error) {
+	switch {
+	case err != nil:
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, err)
+	case exist:
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+	default:
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+	}
+}
+
+// mockMember expects member of room without moderation role to be requested
+func mockMember(userID gomock.Matcher) {
+	m.EXPECT().
+		GetRoomMember(gomock.Any(), gomock.Eq(roomID), userID).
+		DoAndReturn(func(_ context.Context, _, userID uuid.UUID) (*room.Member, error) {
+			return &room.Member{UserID: userID, Role: room.RoleMember}, nil
+		}).
+		Times(1)
+}
+
 func getMessagesData(afterTime time.Time) (users []user.User, ids []uuid.UUID,
 	usernames map[uuid.UUID]string, messages []message.Message) {
 	users = make([]user.User, 3)
@@ -64,14 +92,17 @@ func TestService_GetMessagesAfterTime(t *testing.T) {
 	setup(t)
 
 	afterTime := time.Unix(1621521072, 0).UTC()
+	afterCursor := repository.TimeCursor(afterTime)
 	users, _, usernames, messages := getMessagesData(afterTime)
 
 	t.Run("ok", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Eq(afterTime), gomock.Eq(MessageLimit), messages, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), messages, nil)
 		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
 
-		actual, err := service.GetMessagesAfterTime(roomID, afterTime)
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
 		assert.NoError(t, err)
 		assert.Equal(t,
 			&chat.Messages{
@@ -81,32 +112,185 @@ func TestService_GetMessagesAfterTime(t *testing.T) {
 			actual)
 	})
 
+	t.Run("has more", func(t *testing.T) {
+		fullPage := make([]message.Message, MessageLimit+1)
+		for i := range fullPage {
+			fullPage[i] = messages[i%len(messages)]
+		}
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), fullPage, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			&chat.Messages{
+				Messages:  fullPage[:MessageLimit],
+				Usernames: usernames,
+				HasMore:   true,
+			},
+			actual)
+	})
+
 	t.Run("check room err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), false, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
 
-		actual, err := service.GetMessagesAfterTime(roomID, afterTime)
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
 		assert.Error(t, err)
 		assert.Nil(t, actual)
 	})
 
 	t.Run("get messages err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Eq(afterTime), gomock.Eq(MessageLimit), nil, errAny)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), nil, errAny)
 
-		actual, err := service.GetMessagesAfterTime(roomID, afterTime)
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
 		assert.Error(t, err)
 		assert.Nil(t, actual)
 	})
 
 	t.Run("get usernames err", func(t *testing.T) {
-		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Eq(afterTime), gomock.Eq(MessageLimit), messages, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), messages, nil)
 		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, errAny)
 
-		actual, err := service.GetMessagesAfterTime(roomID, afterTime)
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
 		assert.Error(t, err)
 		assert.Nil(t, actual)
 	})
+
+	t.Run("reactions", func(t *testing.T) {
+		reactions := map[uuid.UUID]reaction.Counts{messages[0].ID: {"👍": 2}}
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), messages, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq(messageIDs(messages)), reactions, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq(messageIDs(messages)), nil, nil)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			&chat.Messages{
+				Messages:  messages,
+				Usernames: usernames,
+				Reactions: reactions,
+			},
+			actual)
+	})
+
+	t.Run("get reactions err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), messages, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, errAny)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.ErrorIs(t, err, errAny)
+		assert.Nil(t, actual)
+	})
+
+	parent := message.Message{ID: uuid.New(), UserID: users[0].ID, RoomID: roomID, Text: "parent",
+		Time: afterTime.Add(-time.Hour)}
+	replies := append([]message.Message(nil), messages...)
+	replies[1].ReplyTo = &parent.ID
+	replies[3].ReplyTo = &parent.ID
+
+	t.Run("replies", func(t *testing.T) {
+		replyCounts := map[uuid.UUID]int{parent.ID: 2}
+		allIDs := append(messageIDs(replies), parent.ID)
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), replies, nil)
+		mocks.MockGetMessagesFromIDs(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{parent.ID}),
+			[]message.Message{parent}, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq(messageIDs(replies)), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq(allIDs), replyCounts, nil)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.NoError(t, err)
+		assert.Equal(t,
+			&chat.Messages{
+				Messages:    replies,
+				Usernames:   usernames,
+				Parents:     map[uuid.UUID]message.Message{parent.ID: parent},
+				ReplyCounts: replyCounts,
+			},
+			actual)
+	})
+
+	t.Run("get parents err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), replies, nil)
+		mocks.MockGetMessagesFromIDs(m, gomock.Eq(roomID), gomock.Any(), nil, errAny)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.ErrorIs(t, err, errAny)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("get reply counts err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(afterCursor), gomock.Eq(MessageLimit+1), messages, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, errAny)
+
+		actual, err := service.GetMessagesAfterTime(context.Background(), roomID, nil, afterTime)
+		assert.ErrorIs(t, err, errAny)
+		assert.Nil(t, actual)
+	})
+}
+
+func TestService_getParents(t *testing.T) {
+	setup(t)
+
+	_, _, _, messages := getMessagesData(time.Unix(1621521072, 0).UTC())
+	parentID := uuid.New()
+	messages[0].ReplyTo = &parentID
+	messages[2].ReplyTo = &parentID
+	messages[3].ReplyTo = &messages[0].ID
+	messages[3].Deleted = true
+
+	t.Run("unique not deleted", func(t *testing.T) {
+		mocks.MockGetMessagesFromIDs(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{parentID}), nil, nil)
+
+		actual, err := service.getParents(context.Background(), roomID, messages)
+		assert.NoError(t, err)
+		assert.Empty(t, actual)
+	})
+
+	t.Run("no replies", func(t *testing.T) {
+		actual, err := service.getParents(context.Background(), roomID, messages[4:])
+		assert.NoError(t, err)
+		assert.Nil(t, actual)
+	})
+}
+
+func TestService_getReactionCounts(t *testing.T) {
+	setup(t)
+
+	_, _, _, messages := getMessagesData(time.Unix(1621521072, 0).UTC())
+	messages[1].Deleted = true
+
+	t.Run("deleted omitted", func(t *testing.T) {
+		expectedIDs := []uuid.UUID{messages[0].ID, messages[2].ID, messages[3].ID, messages[4].ID}
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq(expectedIDs), nil, nil)
+
+		actual, err := service.getReactionCounts(context.Background(), roomID, messages)
+		assert.NoError(t, err)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("only deleted", func(t *testing.T) {
+		actual, err := service.getReactionCounts(context.Background(), roomID, messages[1:2])
+		assert.NoError(t, err)
+		assert.Nil(t, actual)
+	})
 }
 
 func TestService_getUserIDsFromMessages(t *testing.T) {
@@ -232,7 +416,7 @@ func TestService_getUsernamesFromUserIDs(t *testing.T) {
 			}
 			mocks.MockGetUsersFromIDs(m, gomock.Eq(tt.args.ids), tt.users, err)
 
-			actual, err := service.getUsernamesFromUserIDs(tt.args.ids)
+			actual, err := service.getUsernamesFromUserIDs(context.Background(), tt.args.ids)
 			if tt.expectedErr {
 				assert.Error(t, err)
 				return
@@ -284,7 +468,7 @@ func TestService_CheckRoom(t *testing.T) {
 			}
 			mocks.MockIsRoomExist(m, gomock.Eq(roomID), tt.expected.ok, err)
 
-			err = service.CheckRoom(roomID)
+			err = service.CheckRoom(context.Background(), roomID)
 			if tt.expected.ok {
 				assert.NoError(t, err)
 				return
@@ -297,81 +481,159 @@ func TestService_CheckRoom(t *testing.T) {
 func TestService_SendMessage(t *testing.T) {
 	setup(t)
 
-	type args struct {
-		roomID     uuid.UUID
-		newMessage chat.NewMessage
-	}
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	muteEnded := time.Now().Add(-time.Minute)
+	mutedUntil := time.Now().Add(time.Hour)
+
 	type expected struct {
-		roomExistErr bool
-		err          bool
+		roomChecked bool
+		roomExist   bool
+		roomErr     error
+		notMember   bool
+		mutedUntil  *time.Time
+		muted       bool
+		users       []user.User
+		usersErr    error
+		saveCalled  bool
+		saveErr     error
+		err         error
 	}
 
 	tests := []struct {
 		name     string
-		args     args
+		text     string
 		expected expected
 	}{
 		{
 			name: "ok",
-			args: args{
-				roomID: roomID,
-				newMessage: chat.NewMessage{
-					UserID: uuid.New(),
-					Text:   "Test",
-				},
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomExist:   true,
+				users:       []user.User{usr},
+				saveCalled:  true,
 			},
+		},
+		{
+			name:     "empty text",
+			text:     " ",
+			expected: expected{err: ErrorEmptyMessage},
+		},
+		{
+			name:     "invalid text",
+			text:     "Test\x00",
+			expected: expected{err: ErrorInvalidMessage},
+		},
+		{
+			name:     "too long text",
+			text:     strings.Repeat("a", DefaultMessageMaxLength+1),
+			expected: expected{err: ErrorMessageTooLong},
+		},
+		{
+			name: "room not found",
+			text: "Test",
 			expected: expected{
-				roomExistErr: false,
-				err:          false,
+				roomChecked: true,
+				roomExist:   false,
+				err:         ErrorRoomNotFound,
 			},
 		},
 		{
 			name: "err room",
-			args: args{
-				roomID: roomID,
-				newMessage: chat.NewMessage{
-					UserID: uuid.New(),
-					Text:   "Test",
-				},
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomErr:     errAny,
+				err:         errAny,
 			},
+		},
+		{
+			name: "not member",
+			text: "Test",
 			expected: expected{
-				roomExistErr: true,
-				err:          true,
+				roomChecked: true,
+				roomExist:   true,
+				notMember:   true,
+				err:         ErrorNotRoomMember,
 			},
 		},
 		{
-			name: "err",
-			args: args{
-				roomID: roomID,
-				newMessage: chat.NewMessage{
-					UserID: uuid.New(),
-					Text:   "Test",
-				},
+			name: "muted",
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomExist:   true,
+				mutedUntil:  &mutedUntil,
+				muted:       true,
+				err:         ErrorMuted,
 			},
+		},
+		{
+			name: "mute ended",
+			text: "Test",
 			expected: expected{
-				roomExistErr: false,
-				err:          true,
+				roomChecked: true,
+				roomExist:   true,
+				mutedUntil:  &muteEnded,
+				users:       []user.User{usr},
+				saveCalled:  true,
+			},
+		},
+		{
+			name: "user not found",
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomExist:   true,
+				err:         ErrorUserNotFound,
+			},
+		},
+		{
+			name: "err user",
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomExist:   true,
+				usersErr:    errAny,
+				err:         errAny,
+			},
+		},
+		{
+			name: "err",
+			text: "Test",
+			expected: expected{
+				roomChecked: true,
+				roomExist:   true,
+				users:       []user.User{usr},
+				saveCalled:  true,
+				saveErr:     errAny,
+				err:         errAny,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var err error
-			times := 1
-			if tt.expected.roomExistErr {
-				err = errAny
-				times = 0
+			if tt.expected.roomChecked {
+				mockRoom(tt.expected.roomExist, tt.expected.roomErr)
 			}
-			mocks.MockIsRoomExist(m, gomock.Eq(roomID), !tt.expected.roomExistErr, err)
-
-			if tt.expected.err {
-				err = errAny
+			switch {
+			case !tt.expected.roomExist:
+			case tt.expected.notMember:
+				mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(usr.ID), nil, repository.ErrorNotFound)
+			default:
+				mocks.MockGetRoomMember(m, gomock.Eq(roomID), gomock.Eq(usr.ID),
+					&room.Member{UserID: usr.ID, Role: room.RoleMember, MutedUntil: tt.expected.mutedUntil}, nil)
+			}
+			if tt.expected.roomExist && !tt.expected.notMember && !tt.expected.muted {
+				mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), tt.expected.users, tt.expected.usersErr)
+			}
+			if tt.expected.saveCalled {
+				mocks.MockSaveMessage(m, gomock.Any(), tt.expected.saveErr, 1)
 			}
-			mocks.MockSaveMessage(m, gomock.Any(), err, times)
 
-			err = service.SendMessage(tt.args.roomID, tt.args.newMessage)
-			if tt.expected.err {
-				assert.Error(t, err)
+			err := service.SendMessage(context.Background(), roomID, usr.ID, chat.NewMessage{Text: tt.text})
+			if tt.expected.err != nil {
+				assert.ErrorIs(t, err, tt.expected.err)
 				return
 			}
 			assert.NoError(t, err)
@@ -379,6 +641,207 @@ func TestService_SendMessage(t *testing.T) {
 	}
 }
 
+func TestService_SendMessage_reply(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	parentAuthor := user.User{ID: uuid.New(), Username: "parent"}
+	parent := message.Message{ID: uuid.New(), UserID: parentAuthor.ID, RoomID: roomID, Text: "parent",
+		Time: time.Unix(1621521072, 0).UTC()}
+	newMessage := chat.NewMessage{Text: "reply", ReplyTo: &parent.ID}
+
+	t.Run("ok", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, nil)
+		defer sub.Close()
+
+		found := parent
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{parentAuthor.ID}), []user.User{parentAuthor}, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{parent.ID}),
+			map[uuid.UUID]int{parent.ID: 1}, nil)
+
+		err := service.SendMessage(context.Background(), roomID, usr.ID, newMessage)
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, &parent.ID, actual.Messages[0].ReplyTo)
+		assert.Equal(t, map[uuid.UUID]message.Message{parent.ID: parent}, actual.Parents)
+		assert.Equal(t, map[uuid.UUID]int{parent.ID: 1}, actual.ReplyCounts)
+		assert.Equal(t, map[uuid.UUID]string{usr.ID: usr.Username, parentAuthor.ID: parentAuthor.Username},
+			actual.Usernames)
+	})
+
+	t.Run("parent details err", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, nil)
+		defer sub.Close()
+
+		found := parent
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{parentAuthor.ID}), nil, errAny)
+
+		err := service.SendMessage(context.Background(), roomID, usr.ID, newMessage)
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, map[uuid.UUID]message.Message{parent.ID: parent}, actual.Parents)
+		assert.Equal(t, map[uuid.UUID]string{usr.ID: usr.Username}, actual.Usernames)
+	})
+
+	t.Run("parent not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), nil, repository.ErrorNotFound)
+
+		err := service.SendMessage(context.Background(), roomID, usr.ID, newMessage)
+		assert.ErrorIs(t, err, ErrorParentNotFound)
+	})
+
+	t.Run("parent deleted", func(t *testing.T) {
+		found := parent
+		found.Text = ""
+		found.Deleted = true
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+
+		err := service.SendMessage(context.Background(), roomID, usr.ID, newMessage)
+		assert.ErrorIs(t, err, ErrorParentNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), nil, errAny)
+
+		err := service.SendMessage(context.Background(), roomID, usr.ID, newMessage)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
+
+func TestService_GetThread(t *testing.T) {
+	setup(t)
+
+	afterTime := time.Unix(1621521072, 0).UTC()
+	users, _, usernames, replies := getMessagesData(afterTime)
+	parent := message.Message{ID: uuid.New(), UserID: users[0].ID, RoomID: roomID, Text: "parent", Time: afterTime}
+	for i := range replies {
+		replies[i].ReplyTo = &parent.ID
+	}
+	parents := map[uuid.UUID]message.Message{parent.ID: parent}
+	replyCounts := map[uuid.UUID]int{parent.ID: len(replies)}
+
+	t.Run("ok", func(t *testing.T) {
+		found := parent
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(parent.ID), gomock.Eq(repository.Cursor{}),
+			gomock.Eq(MessageLimit+1), replies, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq(messageIDs(replies)), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq(append(messageIDs(replies), parent.ID)),
+			replyCounts, nil)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, &chat.Messages{
+			Messages:    replies,
+			Usernames:   usernames,
+			Parents:     parents,
+			ReplyCounts: replyCounts,
+		}, actual)
+	})
+
+	t.Run("after reply has more", func(t *testing.T) {
+		found := parent
+		lastMessageID := uuid.New()
+		moreReplies := make([]message.Message, MessageLimit+1)
+		for i := range moreReplies {
+			moreReplies[i] = replies[i%len(replies)]
+		}
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(lastMessageID), afterTime, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(parent.ID),
+			gomock.Eq(repository.MessageCursor(afterTime, lastMessageID)), gomock.Eq(MessageLimit+1), moreReplies, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), replyCounts, nil)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, &lastMessageID)
+		require.NoError(t, err)
+		assert.True(t, actual.HasMore)
+		assert.Len(t, actual.Messages, int(MessageLimit))
+	})
+
+	t.Run("deleted parent", func(t *testing.T) {
+		found := parent
+		found.Text = ""
+		found.Deleted = true
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(parent.ID), gomock.Any(), gomock.Any(), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users[:1], nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{parent.ID}), nil, nil)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, nil)
+		require.NoError(t, err)
+		assert.Empty(t, actual.Messages)
+		assert.Equal(t, map[uuid.UUID]message.Message{parent.ID: found}, actual.Parents)
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), nil, repository.ErrorNotFound)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, nil)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("last message not found", func(t *testing.T) {
+		found := parent
+		lastMessageID := uuid.New()
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(lastMessageID), time.Time{},
+			repository.ErrorNotFound)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, &lastMessageID)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, nil)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		found := parent
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(parent.ID), &found, nil)
+		mocks.MockGetReplies(m, gomock.Eq(roomID), gomock.Eq(parent.ID), gomock.Any(), gomock.Any(), nil, errAny)
+
+		actual, err := service.GetThread(context.Background(), roomID, nil, parent.ID, nil)
+		assert.ErrorIs(t, err, errAny)
+		assert.Nil(t, actual)
+	})
+}
+
 func TestService_GetMessagesLatest(t *testing.T) {
 	setup(t)
 
@@ -413,7 +876,7 @@ func TestService_GetMessagesLatest(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+			mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
 			var err error
 			if tt.expected.err {
 				err = errAny
@@ -421,9 +884,11 @@ func TestService_GetMessagesLatest(t *testing.T) {
 			mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), messages, err)
 			if !tt.expected.err {
 				mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+				mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+				mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
 			}
 
-			actual, err := service.GetMessagesLatest(roomID)
+			actual, err := service.GetMessagesLatest(context.Background(), roomID, nil)
 			if tt.expected.err {
 				assert.Error(t, err)
 				return
@@ -484,21 +949,22 @@ func TestService_GetMessagesAfterMessage(t *testing.T) {
 			if tt.expected.messageTimeErr {
 				err = errAny
 			}
-			mocks.MockGetMessageTime(m, gomock.Eq(afterMessageID), afterTime, err)
+			mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+			mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(afterMessageID), afterTime, err)
 			if !tt.expected.messageTimeErr {
-				mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
-
 				err = nil
 				if tt.expected.err {
 					err = errAny
 				}
-				mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), messages, err)
+				mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit+1), messages, err)
 				if !tt.expected.err {
 					mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+					mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+					mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
 				}
 			}
 
-			actual, err := service.GetMessagesAfterMessage(roomID, afterMessageID)
+			actual, err := service.GetMessagesAfterMessage(context.Background(), roomID, nil, afterMessageID)
 			if tt.expected.err || tt.expected.messageTimeErr {
 				assert.Error(t, err)
 				return
@@ -507,4 +973,818 @@ func TestService_GetMessagesAfterMessage(t *testing.T) {
 			assert.Equal(t, tt.expected.chatMessages, actual)
 		})
 	}
+
+	t.Run("message not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(afterMessageID), time.Time{}, repository.ErrorNotFound)
+
+		actual, err := service.GetMessagesAfterMessage(context.Background(), roomID, nil, afterMessageID)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+		assert.Nil(t, actual)
+	})
+}
+
+func TestService_GetMessagesBeforeMessage(t *testing.T) {
+	setup(t)
+
+	beforeTime := time.Unix(1621521072, 0).UTC()
+	beforeMessageID := uuid.New()
+	users, _, usernames, messages := getMessagesData(beforeTime.Add(-time.Hour))
+
+	fullPage := make([]message.Message, MessageLimit+1)
+	for i := range fullPage {
+		fullPage[i] = messages[i%len(messages)]
+	}
+
+	type expected struct {
+		roomExist      bool
+		messageTimeErr error
+		messages       []message.Message
+		messagesErr    error
+		chatMessages   *chat.Messages
+		err            error
+	}
+	tests := []struct {
+		name     string
+		expected expected
+	}{
+		{
+			name: "ok",
+			expected: expected{
+				roomExist: true,
+				messages:  messages,
+				chatMessages: &chat.Messages{
+					Messages:  messages,
+					Usernames: usernames,
+					HasMore:   false,
+				},
+			},
+		},
+		{
+			name: "has more",
+			expected: expected{
+				roomExist: true,
+				messages:  fullPage,
+				chatMessages: &chat.Messages{
+					Messages:  fullPage[1:],
+					Usernames: usernames,
+					HasMore:   true,
+				},
+			},
+		},
+		{
+			name: "room not found",
+			expected: expected{
+				roomExist: false,
+				err:       ErrorRoomNotFound,
+			},
+		},
+		{
+			name: "err message time",
+			expected: expected{
+				roomExist:      true,
+				messageTimeErr: errAny,
+				err:            errAny,
+			},
+		},
+		{
+			name: "err",
+			expected: expected{
+				roomExist:   true,
+				messagesErr: errAny,
+				err:         errAny,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRoom(tt.expected.roomExist, nil)
+			if tt.expected.roomExist {
+				mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(beforeMessageID), beforeTime, tt.expected.messageTimeErr)
+			}
+			if tt.expected.roomExist && tt.expected.messageTimeErr == nil {
+				mocks.MockGetMessagesBefore(m, gomock.Eq(roomID),
+					gomock.Eq(repository.MessageCursor(beforeTime, beforeMessageID)), gomock.Eq(MessageLimit+1),
+					tt.expected.messages, tt.expected.messagesErr)
+			}
+			if tt.expected.err == nil {
+				mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+				mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+				mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+			}
+
+			actual, err := service.GetMessagesBeforeMessage(context.Background(), roomID, nil, beforeMessageID)
+			if tt.expected.err != nil {
+				assert.ErrorIs(t, err, tt.expected.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected.chatMessages, actual)
+		})
+	}
+}
+
+func TestService_CreateUser(t *testing.T) {
+	setup(t)
+
+	tests := []struct {
+		name        string
+		username    string
+		repoCalled  bool
+		repoErr     error
+		expectedErr error
+	}{
+		{
+			name:       "ok",
+			username:   "test_user1",
+			repoCalled: true,
+		},
+		{
+			name:        "short",
+			username:    "ab",
+			expectedErr: ErrorInvalidUsername,
+		},
+		{
+			name:        "starts with digit",
+			username:    "1abc",
+			expectedErr: ErrorInvalidUsername,
+		},
+		{
+			name:        "bad chars",
+			username:    "test user",
+			expectedErr: ErrorInvalidUsername,
+		},
+		{
+			name:        "taken",
+			username:    "test",
+			repoCalled:  true,
+			repoErr:     repository.ErrorUsernameTaken,
+			expectedErr: ErrorUsernameTaken,
+		},
+		{
+			name:        "err",
+			username:    "test",
+			repoCalled:  true,
+			repoErr:     errAny,
+			expectedErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var savedUser *user.User
+			var savedTokenHash string
+			if tt.repoCalled {
+				m.EXPECT().
+					CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, usr *user.User, tokenHash string) error {
+						savedUser = usr
+						savedTokenHash = tokenHash
+						return tt.repoErr
+					}).
+					Times(1)
+			}
+
+			actual, err := service.CreateUser(context.Background(), chat.NewUser{Username: tt.username})
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			require.NotNil(t, savedUser)
+			assert.Equal(t, savedUser.ID, actual.UserID)
+			assert.Equal(t, tt.username, savedUser.Username)
+			assert.NotEmpty(t, actual.Token)
+			assert.Equal(t, hashToken(actual.Token), savedTokenHash)
+		})
+	}
+}
+
+func TestService_GetRooms(t *testing.T) {
+	setup(t)
+
+	rooms := []room.Room{{ID: uuid.New()}, {ID: uuid.New()}}
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRooms(m, rooms, nil)
+
+		actual, err := service.GetRooms(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, rooms, actual)
+	})
+
+	t.Run("direct", func(t *testing.T) {
+		private := room.Room{ID: uuid.New(), Private: true}
+		mocks.MockGetRooms(m, []room.Room{{ID: uuid.New(), Direct: true, Private: true}, private}, nil)
+
+		actual, err := service.GetRooms(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []room.Room{private}, actual)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockGetRooms(m, nil, errAny)
+
+		actual, err := service.GetRooms(context.Background())
+		assert.Error(t, err)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("passes context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		m.EXPECT().
+			GetRooms(gomock.Eq(ctx)).
+			Return(rooms, nil).
+			Times(1)
+
+		actual, err := service.GetRooms(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, rooms, actual)
+	})
+}
+
+func TestService_CreateRoom(t *testing.T) {
+	setup(t)
+
+	t.Run("ok", func(t *testing.T) {
+		var savedRoom *room.Room
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				savedRoom = r
+				return nil
+			}).
+			Times(1)
+
+		actual, err := service.CreateRoom(context.Background(), chat.NewRoom{})
+		assert.NoError(t, err)
+		require.NotNil(t, savedRoom)
+		assert.Equal(t, savedRoom.ID, actual)
+		assert.False(t, savedRoom.Private)
+	})
+
+	t.Run("private", func(t *testing.T) {
+		var savedRoom *room.Room
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				savedRoom = r
+				return nil
+			}).
+			Times(1)
+
+		_, err := service.CreateRoom(context.Background(), chat.NewRoom{Private: true})
+		assert.NoError(t, err)
+		require.NotNil(t, savedRoom)
+		assert.True(t, savedRoom.Private)
+	})
+
+	t.Run("owner", func(t *testing.T) {
+		owner := user.User{ID: uuid.New(), Username: "owner"}
+		var savedRoom *room.Room
+		mocks.MockGetUserByUsername(m, gomock.Eq(owner.Username), &owner, nil)
+		m.EXPECT().
+			CreateRoom(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, r *room.Room) error {
+				savedRoom = r
+				return nil
+			}).
+			Times(1)
+		mocks.MockAddRoomMembers(m, gomock.Any(), gomock.Eq([]uuid.UUID{owner.ID}), nil)
+		mocks.MockUpdateRoomMember(m, gomock.Any(), gomock.Eq(&room.Member{UserID: owner.ID, Role: room.RoleOwner}), nil)
+		mocks.MockSaveModerationAction(m, gomock.Any(), nil)
+
+		actual, err := service.CreateRoom(context.Background(), chat.NewRoom{Owner: owner.Username})
+		assert.NoError(t, err)
+		require.NotNil(t, savedRoom)
+		assert.Equal(t, savedRoom.ID, actual)
+	})
+
+	t.Run("owner not found", func(t *testing.T) {
+		mocks.MockGetUserByUsername(m, gomock.Eq("unknown"), nil, repository.ErrorNotFound)
+
+		_, err := service.CreateRoom(context.Background(), chat.NewRoom{Owner: "unknown"})
+		assert.ErrorIs(t, err, ErrorUserNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockCreateRoom(m, gomock.Any(), errAny)
+
+		_, err := service.CreateRoom(context.Background(), chat.NewRoom{})
+		assert.Error(t, err)
+	})
+}
+
+func TestService_DeleteRoom(t *testing.T) {
+	setup(t)
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockDeleteRoom(m, gomock.Eq(roomID), nil)
+
+		err := service.DeleteRoom(context.Background(), roomID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), false, nil)
+
+		err := service.DeleteRoom(context.Background(), roomID)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockDeleteRoom(m, gomock.Eq(roomID), errAny)
+
+		err := service.DeleteRoom(context.Background(), roomID)
+		assert.Error(t, err)
+	})
+}
+
+func TestService_Subscribe(t *testing.T) {
+	setup(t)
+
+	t.Run("ok", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+
+		sub, err := service.Subscribe(context.Background(), roomID, nil)
+		require.NoError(t, err)
+		defer sub.Close()
+
+		usr := user.User{ID: uuid.New(), Username: "test"}
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+
+		err = service.SendMessage(context.Background(), roomID, usr.ID, chat.NewMessage{Text: "test"})
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, "test", actual.Messages[0].Text)
+		assert.Equal(t, usr.ID, actual.Messages[0].UserID)
+		assert.Equal(t, actual.Messages[0].Time.Truncate(time.Millisecond), actual.Messages[0].Time)
+		assert.Equal(t, map[uuid.UUID]string{usr.ID: usr.Username}, actual.Usernames)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		sub, err := service.Subscribe(context.Background(), roomID, nil)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+		assert.Nil(t, sub)
+	})
+}
+
+func TestService_WaitMessages(t *testing.T) {
+	setup(t)
+
+	afterTime := time.Unix(1621521072, 0).UTC()
+	users, _, usernames, messages := getMessagesData(afterTime)
+
+	t.Run("has messages", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), messages, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, nil, nil, time.Hour)
+		assert.NoError(t, err)
+		require.NotNil(t, actual.UpdatedUntil)
+		actual.UpdatedUntil = nil
+		assert.Equal(t, &chat.Messages{Messages: messages, Usernames: usernames}, actual)
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		updatedAfter := afterTime.Add(time.Minute)
+		editedAt := updatedAfter.Add(time.Minute)
+		edited := messages[1]
+		edited.Text, edited.EditedAt = "edited", &editedAt
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+		mocks.MockGetUpdatedMessages(m, gomock.Eq(roomID), gomock.Eq(updatedAfter), gomock.Any(),
+			gomock.Eq(MessageLimit), []message.Message{edited}, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{edited.UserID}), users[1:2], nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, nil, &updatedAfter, time.Hour)
+		assert.NoError(t, err)
+		assert.Empty(t, actual.Messages)
+		assert.Equal(t, []message.Message{edited}, actual.Updated)
+		assert.Equal(t, map[uuid.UUID]string{users[1].ID: users[1].Username}, actual.Usernames)
+		require.NotNil(t, actual.UpdatedUntil)
+		assert.True(t, actual.UpdatedUntil.After(editedAt))
+		assert.True(t, actual.UpdatedUntil.Before(time.Now().Add(-editsDelay+time.Second)))
+	})
+
+	t.Run("updated over limit", func(t *testing.T) {
+		updatedAfter := time.Now().UTC().Add(-time.Hour)
+		// Messages with changed reactions are updated without edit
+		updated := make([]message.Message, MessageLimit)
+		for i := range updated {
+			updatedAt := updatedAfter.Add(time.Duration(i+1) * time.Millisecond)
+			updated[i] = messages[0]
+			updated[i].ID, updated[i].UpdatedAt = uuid.New(), &updatedAt
+		}
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+		mocks.MockGetUpdatedMessages(m, gomock.Eq(roomID), gomock.Eq(updatedAfter), gomock.Any(),
+			gomock.Eq(MessageLimit), updated, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), users[:1], nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Any(), nil, nil)
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, nil, &updatedAfter, time.Hour)
+		assert.NoError(t, err)
+		assert.Len(t, actual.Updated, int(MessageLimit))
+		// There may be more updates, so next request continues after the last returned one
+		assert.Equal(t, updated[MessageLimit-1].UpdatedAt, actual.UpdatedUntil)
+	})
+
+	t.Run("edit saved late", func(t *testing.T) {
+		ctx := context.Background()
+		repo := repository.NewMemoryRepository()
+		log, _ := test.NewNullLogger()
+		service := NewService(repo, DefaultMessageRules(), log)
+		require.NoError(t, repo.CreateRoom(ctx, &room.Room{ID: roomID}))
+		saved := append([]message.Message(nil), messages[:2]...)
+		for i := range saved {
+			require.NoError(t, repo.SaveMessage(ctx, &saved[i]))
+		}
+
+		now := time.Now().UTC()
+		updatedAfter := now.Add(-time.Minute)
+		require.NoError(t, repo.EditMessage(ctx, roomID, saved[1].ID, "later", now.Add(-time.Second)))
+
+		first, err := service.WaitMessages(ctx, roomID, nil, nil, &updatedAfter, 0)
+		require.NoError(t, err)
+		// Edit stamped earlier is saved after the later one was already requested
+		earlier := now.Add(-2 * time.Second)
+		require.NoError(t, repo.EditMessage(ctx, roomID, saved[0].ID, "earlier", earlier))
+
+		second, err := service.WaitMessages(ctx, roomID, nil, nil, first.UpdatedUntil, 0)
+		require.NoError(t, err)
+		assert.Empty(t, append(first.Updated, second.Updated...), "recent edits must wait for delay")
+		require.NotNil(t, second.UpdatedUntil)
+		assert.True(t, second.UpdatedUntil.Before(earlier), "cursor must not pass edit which may be saved late")
+		pending, err := repo.GetUpdatedMessages(ctx, roomID, *second.UpdatedUntil, now, MessageLimit)
+		require.NoError(t, err)
+		assert.Len(t, pending, 2, "both edits must be returned once delay passes")
+	})
+
+	t.Run("new message", func(t *testing.T) {
+		lastMessageID := uuid.New()
+		mocks.MockGetMessageTime(m, gomock.Eq(roomID), gomock.Eq(lastMessageID), afterTime, nil)
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(users[0].ID))
+		mocks.MockGetOldestMessages(m, gomock.Eq(roomID), gomock.Eq(repository.MessageCursor(afterTime, lastMessageID)),
+			gomock.Eq(MessageLimit+1), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockSaveMessage(m, gomock.Any(), nil, 1)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{users[0].ID}), users[:1], nil)
+
+		go func() {
+			for !hasSubscribers(service.hub, roomID) {
+				time.Sleep(time.Millisecond)
+			}
+			assert.NoError(t, service.SendMessage(context.Background(), roomID, users[0].ID, chat.NewMessage{Text: "new"}))
+		}()
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, &lastMessageID, nil, time.Hour)
+		assert.NoError(t, err)
+		require.Len(t, actual.Messages, 1)
+		assert.Equal(t, "new", actual.Messages[0].Text)
+		assert.Equal(t, map[uuid.UUID]string{users[0].ID: users[0].Username}, actual.Usernames)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, nil, nil, time.Millisecond)
+		assert.NoError(t, err)
+		assert.Empty(t, actual.Messages)
+		assert.False(t, hasSubscribers(service.hub, roomID))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mocks.MockGetMessages(m, gomock.Eq(roomID), gomock.Any(), gomock.Eq(MessageLimit), nil, nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Any(), nil, nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		actual, err := service.WaitMessages(ctx, roomID, nil, nil, nil, time.Hour)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, actual)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		actual, err := service.WaitMessages(context.Background(), roomID, nil, nil, nil, time.Hour)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+		assert.Nil(t, actual)
+		assert.False(t, hasSubscribers(service.hub, roomID))
+	})
+}
+
+func TestService_EditMessage(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	msg := message.Message{ID: uuid.New(), UserID: usr.ID, RoomID: roomID, Text: "old",
+		Time: time.Unix(1621521072, 0).UTC()}
+	edit := chat.MessageEdit{Text: "new"}
+
+	t.Run("ok", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, nil)
+		defer sub.Close()
+
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockEditMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Eq(edit.Text), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID}, edit)
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		assert.Empty(t, actual.Messages)
+		require.Len(t, actual.Updated, 1)
+		assert.Equal(t, edit.Text, actual.Updated[0].Text)
+		require.NotNil(t, actual.Updated[0].EditedAt)
+		assert.Equal(t, map[uuid.UUID]string{usr.ID: usr.Username}, actual.Usernames)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		found := msg
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockEditMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Eq(edit.Text), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{Admin: true}, edit)
+		assert.NoError(t, err)
+	})
+
+	t.Run("empty text", func(t *testing.T) {
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID},
+			chat.MessageEdit{Text: " "})
+		assert.ErrorIs(t, err, ErrorEmptyMessage)
+	})
+
+	t.Run("not author", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Any())
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: uuid.New()}, edit)
+		assert.ErrorIs(t, err, ErrorNotMessageAuthor)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		found := msg
+		found.Text = ""
+		found.Deleted = true
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID}, edit)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID}, edit)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID}, edit)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockEditMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Eq(edit.Text), gomock.Any(), errAny)
+
+		err := service.EditMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID}, edit)
+		assert.ErrorIs(t, err, errAny)
+	})
+}
+
+func TestService_DeleteMessage(t *testing.T) {
+	setup(t)
+
+	usr := user.User{ID: uuid.New(), Username: "test"}
+	msg := message.Message{ID: uuid.New(), UserID: usr.ID, RoomID: roomID, Text: "old",
+		Time: time.Unix(1621521072, 0).UTC()}
+
+	t.Run("ok", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, nil)
+		defer sub.Close()
+
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockDeleteMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), nil, errAny)
+
+		err := service.DeleteMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID})
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		require.Len(t, actual.Updated, 1)
+		assert.True(t, actual.Updated[0].Deleted)
+		assert.Empty(t, actual.Updated[0].Text)
+		assert.NotNil(t, actual.Updated[0].EditedAt)
+		assert.Empty(t, actual.Usernames)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		found := msg
+		mocks.MockIsRoomExist(m, gomock.Eq(roomID), true, nil)
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockDeleteMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{usr.ID}), []user.User{usr}, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		err := service.DeleteMessage(context.Background(), roomID, msg.ID, Editor{Admin: true})
+		assert.NoError(t, err)
+	})
+
+	t.Run("not author", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Any())
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+
+		err := service.DeleteMessage(context.Background(), roomID, msg.ID, Editor{UserID: uuid.New()})
+		assert.ErrorIs(t, err, ErrorNotMessageAuthor)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(usr.ID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockDeleteMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), repository.ErrorNotFound)
+
+		err := service.DeleteMessage(context.Background(), roomID, msg.ID, Editor{UserID: usr.ID})
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
+}
+
+func TestService_AddReaction(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "test",
+		Time: time.Unix(1621521072, 0).UTC()}
+	newReaction := chat.NewReaction{Emoji: "👍"}
+	expectedReaction := &reaction.Reaction{RoomID: roomID, MessageID: msg.ID, UserID: userID, Emoji: "👍"}
+
+	t.Run("ok", func(t *testing.T) {
+		sub := service.hub.Subscribe(roomID, nil)
+		defer sub.Close()
+
+		found := msg
+		reactions := map[uuid.UUID]reaction.Counts{msg.ID: {"👍": 1}}
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockAddReaction(m, gomock.Eq(expectedReaction), nil)
+		mocks.MockUpdateMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{msg.UserID}), nil, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), reactions, nil)
+		mocks.MockGetReplyCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, nil)
+
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, newReaction)
+		require.NoError(t, err)
+
+		actual := <-sub.Messages()
+		assert.Equal(t, []message.Message{msg}, actual.Updated)
+		assert.Equal(t, reactions, actual.Reactions)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, chat.NewReaction{Emoji: "+1"})
+		assert.ErrorIs(t, err, ErrorInvalidReaction)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		found := msg
+		found.Text = ""
+		found.Deleted = true
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, newReaction)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), nil, repository.ErrorNotFound)
+
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, newReaction)
+		assert.ErrorIs(t, err, ErrorRoomNotFound)
+	})
+
+	t.Run("err", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockAddReaction(m, gomock.Eq(expectedReaction), errAny)
+
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, newReaction)
+		assert.ErrorIs(t, err, errAny)
+	})
+
+	t.Run("deleted meanwhile", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockAddReaction(m, gomock.Eq(expectedReaction), nil)
+		mocks.MockUpdateMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), repository.ErrorNotFound)
+
+		err := service.AddReaction(context.Background(), roomID, msg.ID, userID, newReaction)
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
+}
+
+func TestService_RemoveReaction(t *testing.T) {
+	setup(t)
+
+	userID := uuid.New()
+	msg := message.Message{ID: uuid.New(), UserID: uuid.New(), RoomID: roomID, Text: "test",
+		Time: time.Unix(1621521072, 0).UTC()}
+	expectedReaction := &reaction.Reaction{RoomID: roomID, MessageID: msg.ID, UserID: userID, Emoji: "👍"}
+
+	t.Run("ok", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockRemoveReaction(m, gomock.Eq(expectedReaction), nil)
+		mocks.MockUpdateMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), gomock.Any(), nil)
+		mocks.MockGetUsersFromIDs(m, gomock.Eq([]uuid.UUID{msg.UserID}), nil, nil)
+		mocks.MockGetReactionCounts(m, gomock.Eq(roomID), gomock.Eq([]uuid.UUID{msg.ID}), nil, errAny)
+
+		err := service.RemoveReaction(context.Background(), roomID, msg.ID, userID, "👍")
+		assert.NoError(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		found := msg
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), &found, nil)
+		mocks.MockRemoveReaction(m, gomock.Eq(expectedReaction), repository.ErrorNotFound)
+
+		err := service.RemoveReaction(context.Background(), roomID, msg.ID, userID, "👍")
+		assert.ErrorIs(t, err, ErrorReactionNotFound)
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		mocks.MockGetRoom(m, gomock.Eq(roomID), &room.Room{ID: roomID}, nil)
+		mockMember(gomock.Eq(userID))
+		mocks.MockGetMessage(m, gomock.Eq(roomID), gomock.Eq(msg.ID), nil, repository.ErrorNotFound)
+
+		err := service.RemoveReaction(context.Background(), roomID, msg.ID, userID, "👍")
+		assert.ErrorIs(t, err, ErrorMessageNotFound)
+	})
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMessageMaxLength is a default limit of message text length in characters
+const DefaultMessageMaxLength = 2000
+
+// ReactionMaxLength limits length of reaction in bytes, it fits the longest emoji sequences
+const ReactionMaxLength = 32
+
+var (
+	ErrorEmptyMessage   = errors.New("message text is empty")
+	ErrorInvalidMessage = errors.New("message text must be valid UTF-8 without control characters")
+	ErrorMessageTooLong = errors.New("message text is too long")
+
+	ErrorInvalidReaction = errors.New("reaction must be an emoji")
+)
+
+// MessageRules configures validation of message text
+type MessageRules struct {
+	MaxLength     int  // Maximal length of text in characters, zero means no limit
+	AllowNewLines bool // Allows line breaks in text
+}
+
+// DefaultMessageRules returns rules used if nothing else is configured
+func DefaultMessageRules() MessageRules {
+	return MessageRules{
+		MaxLength:     DefaultMessageMaxLength,
+		AllowNewLines: true,
+	}
+}
+
+// Validate checks that text is non-empty valid UTF-8 without control characters and fits length limit
+func (r MessageRules) Validate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return ErrorEmptyMessage
+	}
+
+	if !utf8.ValidString(text) {
+		return ErrorInvalidMessage
+	}
+
+	length := 0
+	for _, c := range text {
+		length++
+
+		if c == '\t' || (c == '\n' && r.AllowNewLines) {
+			continue
+		}
+		if unicode.IsControl(c) {
+			return fmt.Errorf("%w: unexpected character %q", ErrorInvalidMessage, c)
+		}
+	}
+
+	if r.MaxLength > 0 && length > r.MaxLength {
+		return fmt.Errorf("%w: %d characters, limit is %d", ErrorMessageTooLong, length, r.MaxLength)
+	}
+	return nil
+}
+
+// zeroWidthJoiner joins several emoji into one
+const zeroWidthJoiner = '\u200D'
+
+// ValidateReaction checks that reaction is a short valid UTF-8 string of emoji, emoji modifiers and joiners
+func ValidateReaction(emoji string) error {
+	if emoji == "" || len(emoji) > ReactionMaxLength || !utf8.ValidString(emoji) {
+		return ErrorInvalidReaction
+	}
+
+	hasSymbol := false
+	for _, c := range emoji {
+		switch {
+		case unicode.Is(unicode.So, c):
+			hasSymbol = true
+		case unicode.In(c, unicode.Sk, unicode.Mn, unicode.Me), c == zeroWidthJoiner:
+			// Skin tones, variation selectors & keycaps
+		case c >= '\U000E0020' && c <= '\U000E007F':
+			// Tags of subdivision flags
+		default:
+			return fmt.Errorf("%w: unexpected character %q", ErrorInvalidReaction, c)
+		}
+	}
+
+	if !hasSymbol {
+		return ErrorInvalidReaction
+	}
+	return nil
+}
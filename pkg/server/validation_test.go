@@ -0,0 +1,71 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageRules_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    MessageRules
+		text     string
+		expected error
+	}{
+		{name: "ok", rules: DefaultMessageRules(), text: "Test message"},
+		{name: "unicode", rules: DefaultMessageRules(), text: "Привіт 👋"},
+		{name: "tab", rules: DefaultMessageRules(), text: "a\tb"},
+		{name: "new line", rules: DefaultMessageRules(), text: "a\nb"},
+		{name: "new line not allowed", rules: MessageRules{}, text: "a\nb", expected: ErrorInvalidMessage},
+		{name: "empty", rules: DefaultMessageRules(), text: "", expected: ErrorEmptyMessage},
+		{name: "spaces", rules: DefaultMessageRules(), text: " \n\t", expected: ErrorEmptyMessage},
+		{name: "invalid utf8", rules: DefaultMessageRules(), text: "a\xffb", expected: ErrorInvalidMessage},
+		{name: "control char", rules: DefaultMessageRules(), text: "a\u001Bb", expected: ErrorInvalidMessage},
+		{name: "max length", rules: MessageRules{MaxLength: 3}, text: "абв"},
+		{name: "too long", rules: MessageRules{MaxLength: 3}, text: "абвг", expected: ErrorMessageTooLong},
+		{name: "no limit", rules: MessageRules{}, text: strings.Repeat("a", DefaultMessageMaxLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.Validate(tt.text)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateReaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		emoji    string
+		expected error
+	}{
+		{name: "ok", emoji: "👍"},
+		{name: "variation selector", emoji: "❤️"},
+		{name: "skin tone", emoji: "👍🏽"},
+		{name: "joined", emoji: "👩‍💻"},
+		{name: "flag", emoji: "🇺🇦"},
+		{name: "subdivision flag", emoji: "🏴󠁧󠁢󠁳󠁣󠁴󠁿"},
+		{name: "empty", emoji: "", expected: ErrorInvalidReaction},
+		{name: "text", emoji: "+1", expected: ErrorInvalidReaction},
+		{name: "emoji with text", emoji: "👍 ok", expected: ErrorInvalidReaction},
+		{name: "only modifier", emoji: "\uFE0F", expected: ErrorInvalidReaction},
+		{name: "invalid utf8", emoji: "👍\xff", expected: ErrorInvalidReaction},
+		{name: "too long", emoji: strings.Repeat("👍", ReactionMaxLength), expected: ErrorInvalidReaction},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReaction(tt.emoji)
+			if tt.expected != nil {
+				assert.ErrorIs(t, err, tt.expected)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}